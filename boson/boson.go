@@ -0,0 +1,211 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package boson talks to FLIR Boson cameras over their serial
+// command interface.
+package boson
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	Brand = "flir"
+	Model = "boson"
+)
+
+// Function codes from the Boson SDK.
+const (
+	getCameraSN    uint32 = 0x00050002
+	runFFC         uint32 = 0x00050007
+	setFFCMode     uint32 = 0x00050012
+	getSoftwareRev uint32 = 0x00050022
+	getFPATemp     uint32 = 0x00050030
+	getFFCRunning  uint32 = 0x0005005E
+)
+
+// FFCMode controls when the camera performs a flat field correction.
+type FFCMode uint32
+
+const (
+	FFCModeManual   FFCMode = 0
+	FFCModeAuto     FFCMode = 1
+	FFCModeExternal FFCMode = 2
+)
+
+const statusPending uint32 = 0xFFFFFFFF
+
+// commandTimeout is how long to wait for the camera to respond to a
+// command before giving up on it.
+const commandTimeout = 2 * time.Second
+
+// deadliner is implemented by ports which support timeouts, such as
+// the serial ports returned by Open.
+type deadliner interface {
+	SetDeadline(t time.Time) error
+}
+
+// Client sends commands to a Boson camera. It is goroutine safe.
+type Client struct {
+	mu      sync.Mutex
+	port    io.ReadWriteCloser
+	r       *bufio.Reader
+	seq     uint32
+	timeout time.Duration
+}
+
+// NewClient returns a Client which communicates over the port given.
+// If the port has a SetDeadline method commands fail when the camera
+// doesn't respond within a couple of seconds, otherwise they wait
+// until the port is closed.
+func NewClient(port io.ReadWriteCloser) *Client {
+	return &Client{
+		port:    port,
+		r:       bufio.NewReader(port),
+		timeout: commandTimeout,
+	}
+}
+
+// Close closes the port used by the client.
+func (c *Client) Close() error {
+	return c.port.Close()
+}
+
+// SerialNumber returns the camera's serial number.
+func (c *Client) SerialNumber() (uint32, error) {
+	data, err := c.command(getCameraSN, nil, 4)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(data), nil
+}
+
+// SoftwareRevision returns the camera's software version as
+// "major.minor.patch".
+func (c *Client) SoftwareRevision() (string, error) {
+	data, err := c.command(getSoftwareRev, nil, 12)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%d.%d",
+		binary.BigEndian.Uint32(data[0:4]),
+		binary.BigEndian.Uint32(data[4:8]),
+		binary.BigEndian.Uint32(data[8:12])), nil
+}
+
+// RunFFC triggers a flat field correction.
+func (c *Client) RunFFC() error {
+	_, err := c.command(runFFC, nil, 0)
+	return err
+}
+
+// FFCInProgress reports whether a flat field correction is running.
+func (c *Client) FFCInProgress() (bool, error) {
+	data, err := c.command(getFFCRunning, nil, 2)
+	if err != nil {
+		return false, err
+	}
+	return binary.BigEndian.Uint16(data) != 0, nil
+}
+
+// FPATemp returns the temperature of the camera's focal plane array in
+// degrees C.
+func (c *Client) FPATemp() (float64, error) {
+	data, err := c.command(getFPATemp, nil, 2)
+	if err != nil {
+		return 0, err
+	}
+	// Reported in tenths of a degree.
+	return float64(int16(binary.BigEndian.Uint16(data))) / 10, nil
+}
+
+// SetFFCMode sets when flat field corrections will be performed.
+func (c *Client) SetFFCMode(mode FFCMode) error {
+	_, err := c.command(setFFCMode, uint32Bytes(uint32(mode)), 0)
+	return err
+}
+
+// command sends a command to the camera and waits for its response,
+// returning the response data. The response must contain at least
+// minLen bytes of data.
+func (c *Client) command(function uint32, data []byte, minLen int) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if d, ok := c.port.(deadliner); ok {
+		if err := d.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+			return nil, err
+		}
+		defer d.SetDeadline(time.Time{})
+	}
+
+	c.seq++
+	payload := make([]byte, 12, 12+len(data))
+	binary.BigEndian.PutUint32(payload[0:4], c.seq)
+	binary.BigEndian.PutUint32(payload[4:8], function)
+	binary.BigEndian.PutUint32(payload[8:12], statusPending)
+	payload = append(payload, data...)
+	if _, err := c.port.Write(encodePacket(payload)); err != nil {
+		return nil, c.commandErr(function, err)
+	}
+
+	for {
+		resp, err := readPacket(c.r)
+		if err != nil {
+			return nil, c.commandErr(function, err)
+		}
+		if len(resp) < 12 {
+			return nil, fmt.Errorf("short response to command 0x%08x", function)
+		}
+		if binary.BigEndian.Uint32(resp[0:4]) != c.seq {
+			// Response to an earlier command which timed out.
+			continue
+		}
+		if fn := binary.BigEndian.Uint32(resp[4:8]); fn != function {
+			return nil, fmt.Errorf("response for command 0x%08x, expected 0x%08x", fn, function)
+		}
+		if status := binary.BigEndian.Uint32(resp[8:12]); status != 0 {
+			return nil, fmt.Errorf("command 0x%08x failed with status 0x%x", function, status)
+		}
+		resp = resp[12:]
+		if len(resp) < minLen {
+			return nil, fmt.Errorf("response to command 0x%08x has %d bytes, expected %d", function, len(resp), minLen)
+		}
+		return resp, nil
+	}
+}
+
+// commandErr describes a timeout talking to the camera more helpfully
+// than the port does.
+func (c *Client) commandErr(function uint32, err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("no response to command 0x%08x after %v", function, c.timeout)
+	}
+	return err
+}
+
+func uint32Bytes(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
@@ -0,0 +1,196 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package boson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	// Include all the bytes which need escaping.
+	payload := []byte{1, startByte, 2, endByte, 3, escapeByte, 4}
+	packet := encodePacket(payload)
+
+	assert.Equal(t, byte(startByte), packet[0])
+	assert.Equal(t, byte(endByte), packet[len(packet)-1])
+	for _, b := range packet[1 : len(packet)-1] {
+		assert.NotEqual(t, byte(startByte), b)
+		assert.NotEqual(t, byte(endByte), b)
+	}
+
+	// Leading noise should be skipped.
+	r := bufio.NewReader(bytes.NewReader(append([]byte{0x01, 0x02}, packet...)))
+	got, err := readPacket(r)
+	require.NoError(t, err)
+	assert.Equal(t, payload, got)
+}
+
+func TestCorruptPacket(t *testing.T) {
+	packet := encodePacket([]byte{1, 2, 3, 4})
+	packet[3] ^= 0xFF
+	_, err := readPacket(bufio.NewReader(bytes.NewReader(packet)))
+	assert.EqualError(t, err, "packet CRC mismatch")
+}
+
+func TestCommands(t *testing.T) {
+	camera := newFakeCamera(t)
+	defer camera.close()
+	client := NewClient(camera.clientConn)
+
+	serial, err := client.SerialNumber()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(12345), serial)
+
+	version, err := client.SoftwareRevision()
+	require.NoError(t, err)
+	assert.Equal(t, "3.0.1", version)
+
+	require.NoError(t, client.SetFFCMode(FFCModeManual))
+	assert.Equal(t, uint32(FFCModeManual), camera.ffcMode)
+
+	running, err := client.FFCInProgress()
+	require.NoError(t, err)
+	assert.False(t, running)
+	require.NoError(t, client.RunFFC())
+	assert.Equal(t, 1, camera.ffcs)
+	running, err = client.FFCInProgress()
+	require.NoError(t, err)
+	assert.True(t, running)
+
+	temp, err := client.FPATemp()
+	require.NoError(t, err)
+	assert.Equal(t, -2.5, temp)
+}
+
+func TestTelemetryRoundTrip(t *testing.T) {
+	in := cptvframe.Telemetry{
+		FrameCount:   123456,
+		TimeOn:       95 * time.Minute,
+		LastFFCTime:  90*time.Minute + 1500*time.Millisecond,
+		TempC:        -3.25,
+		LastFFCTempC: 31.5,
+		FFCState:     FFCComplete,
+	}
+	b := make([]byte, TelemetrySize)
+	PutTelemetry(b, &in)
+
+	var out cptvframe.Telemetry
+	require.NoError(t, ParseTelemetry(b, &out))
+	assert.Equal(t, in, out)
+
+	b[16] = 9
+	assert.EqualError(t, ParseTelemetry(b, &out), "invalid FFC state in telemetry")
+	assert.EqualError(t, ParseTelemetry(b[:10], &out), "short telemetry block")
+}
+
+func TestCommandError(t *testing.T) {
+	camera := newFakeCamera(t)
+	defer camera.close()
+	client := NewClient(camera.clientConn)
+
+	_, err := client.command(0x00123456, nil, 0)
+	assert.EqualError(t, err, "command 0x00123456 failed with status 0x1")
+}
+
+func TestCommandTimeout(t *testing.T) {
+	clientConn, conn := net.Pipe()
+	defer conn.Close()
+	go io.Copy(ioutil.Discard, conn) // Never replies.
+	client := NewClient(clientConn)
+	defer client.Close()
+	client.timeout = 10 * time.Millisecond
+
+	_, err := client.SerialNumber()
+	assert.EqualError(t, err, "no response to command 0x00050002 after 10ms")
+	_, err = client.FPATemp()
+	assert.EqualError(t, err, "no response to command 0x00050030 after 10ms")
+}
+
+// fakeCamera responds to commands like a Boson would.
+type fakeCamera struct {
+	t          *testing.T
+	clientConn net.Conn
+	conn       net.Conn
+	ffcMode    uint32
+	ffcs       int
+}
+
+func newFakeCamera(t *testing.T) *fakeCamera {
+	clientConn, conn := net.Pipe()
+	c := &fakeCamera{
+		t:          t,
+		clientConn: clientConn,
+		conn:       conn,
+		ffcMode:    uint32(FFCModeAuto),
+	}
+	go c.run()
+	return c
+}
+
+func (c *fakeCamera) close() {
+	c.clientConn.Close()
+	c.conn.Close()
+}
+
+func (c *fakeCamera) run() {
+	r := bufio.NewReader(c.conn)
+	for {
+		req, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		function := binary.BigEndian.Uint32(req[4:8])
+		status := uint32(0)
+		var data []byte
+		switch function {
+		case getCameraSN:
+			data = uint32Bytes(12345)
+		case getSoftwareRev:
+			data = append(append(uint32Bytes(3), uint32Bytes(0)...), uint32Bytes(1)...)
+		case setFFCMode:
+			c.ffcMode = binary.BigEndian.Uint32(req[12:16])
+		case runFFC:
+			c.ffcs++
+		case getFFCRunning:
+			data = []byte{0, 0}
+			if c.ffcs > 0 {
+				data[1] = 1
+			}
+		case getFPATemp:
+			data = []byte{0xFF, 0xE7} // -25
+		default:
+			status = 1
+		}
+		resp := append([]byte{}, req[:8]...)
+		resp = append(resp, uint32Bytes(status)...)
+		resp = append(resp, data...)
+		if _, err := c.conn.Write(encodePacket(resp)); err != nil {
+			return
+		}
+	}
+}
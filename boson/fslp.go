@@ -0,0 +1,124 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package boson
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The Boson is controlled using FLIR's serial lite protocol (FSLP).
+// Each packet is framed by start and end bytes, with any occurrence
+// of the special bytes in between being escaped.
+const (
+	startByte   = 0x8E
+	endByte     = 0xAE
+	escapeByte  = 0x9E
+	escapedDiff = 0x0D // escaped byte = special byte - escapedDiff
+
+	commandChannel = 0x00
+
+	crcInit = 0x1D0F
+)
+
+// encodePacket builds an escaped and framed FSLP packet for the
+// payload given.
+func encodePacket(payload []byte) []byte {
+	body := append([]byte{commandChannel}, payload...)
+	crc := make([]byte, 2)
+	binary.BigEndian.PutUint16(crc, crc16(body))
+	body = append(body, crc...)
+
+	out := make([]byte, 0, len(body)+8)
+	out = append(out, startByte)
+	for _, b := range body {
+		if b == startByte || b == endByte || b == escapeByte {
+			out = append(out, escapeByte, b-escapedDiff)
+		} else {
+			out = append(out, b)
+		}
+	}
+	return append(out, endByte)
+}
+
+// readPacket reads the next FSLP packet, returning its payload once
+// the CRC has been checked.
+func readPacket(r *bufio.Reader) ([]byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == startByte {
+			break
+		}
+	}
+
+	var body []byte
+	escaped := false
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case escaped:
+			body = append(body, b+escapedDiff)
+			escaped = false
+		case b == escapeByte:
+			escaped = true
+		case b == startByte:
+			return nil, errors.New("unexpected start of packet")
+		case b == endByte:
+			return checkPacket(body)
+		default:
+			body = append(body, b)
+		}
+	}
+}
+
+func checkPacket(body []byte) ([]byte, error) {
+	if len(body) < 3 {
+		return nil, errors.New("packet too short")
+	}
+	data, crc := body[:len(body)-2], binary.BigEndian.Uint16(body[len(body)-2:])
+	if crc16(data) != crc {
+		return nil, errors.New("packet CRC mismatch")
+	}
+	if data[0] != commandChannel {
+		return nil, fmt.Errorf("unexpected channel %d", data[0])
+	}
+	return data[1:], nil
+}
+
+// crc16 calculates the CRC-16/CCITT checksum used by FSLP.
+func crc16(data []byte) uint16 {
+	crc := uint16(crcInit)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,78 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package boson
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Open opens the camera's serial port (e.g. /dev/ttyACM0) and returns
+// a Client for it.
+func Open(portName string) (*Client, error) {
+	f, err := os.OpenFile(portName, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := makeRaw(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	// Commands rely on deadlines to time out.
+	if err := f.SetDeadline(time.Time{}); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s doesn't support timeouts: %v", portName, err)
+	}
+	return NewClient(f), nil
+}
+
+// makeRaw puts the serial port into raw mode so that the binary
+// protocol isn't mangled by the terminal line discipline.
+func makeRaw(f *os.File) error {
+	// f.Fd would put the port into blocking mode, which stops
+	// deadlines from working.
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var ioctlErr error
+	err = conn.Control(func(fd uintptr) {
+		ioctlErr = setRaw(int(fd))
+	})
+	if err != nil {
+		return err
+	}
+	return ioctlErr
+}
+
+func setRaw(fd int) error {
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CSIZE | unix.PARENB
+	t.Cflag |= unix.CS8
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+	return unix.IoctlSetTermios(fd, unix.TCSETS, t)
+}
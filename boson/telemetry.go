@@ -0,0 +1,88 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package boson
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+)
+
+// TelemetrySize is the number of bytes of telemetry leptond sends after
+// the pixels of each Boson frame.
+//
+// The telemetry block is little endian (like the pixels). leptond
+// fills it in from the serial port and its own counts, as the frames
+// read from the video device don't carry the camera's telemetry:
+//
+//	0  uint32 frames read since the camera was opened
+//	4  uint32 time on (ms)
+//	8  uint32 time on at the last FFC (ms)
+//	12 int16  FPA temperature (0.01°C)
+//	14 int16  FPA temperature at the last FFC (0.01°C)
+//	16 uint8  FFC state
+//	17 3 bytes padding
+const TelemetrySize = 20
+
+// FFC states, using the same values as the lepton3 package.
+const (
+	FFCNever    = "never"
+	FFCRunning  = "running"
+	FFCComplete = "complete"
+)
+
+var ffcStates = []string{FFCNever, FFCRunning, FFCComplete}
+
+// PutTelemetry encodes t into the first TelemetrySize bytes of b.
+func PutTelemetry(b []byte, t *cptvframe.Telemetry) {
+	binary.LittleEndian.PutUint32(b[0:4], uint32(t.FrameCount))
+	binary.LittleEndian.PutUint32(b[4:8], uint32(t.TimeOn/time.Millisecond))
+	binary.LittleEndian.PutUint32(b[8:12], uint32(t.LastFFCTime/time.Millisecond))
+	binary.LittleEndian.PutUint16(b[12:14], uint16(int16(math.Round(t.TempC*100))))
+	binary.LittleEndian.PutUint16(b[14:16], uint16(int16(math.Round(t.LastFFCTempC*100))))
+	b[16] = 0
+	for i, state := range ffcStates {
+		if state == t.FFCState {
+			b[16] = byte(i)
+		}
+	}
+	b[17], b[18], b[19] = 0, 0, 0
+}
+
+// ParseTelemetry decodes a telemetry block written by PutTelemetry
+// into t.
+func ParseTelemetry(b []byte, t *cptvframe.Telemetry) error {
+	if len(b) < TelemetrySize {
+		return errors.New("short telemetry block")
+	}
+	state := int(b[16])
+	if state >= len(ffcStates) {
+		return errors.New("invalid FFC state in telemetry")
+	}
+	*t = cptvframe.Telemetry{
+		FrameCount:   int(binary.LittleEndian.Uint32(b[0:4])),
+		TimeOn:       time.Duration(binary.LittleEndian.Uint32(b[4:8])) * time.Millisecond,
+		LastFFCTime:  time.Duration(binary.LittleEndian.Uint32(b[8:12])) * time.Millisecond,
+		TempC:        float64(int16(binary.LittleEndian.Uint16(b[12:14]))) / 100,
+		LastFFCTempC: float64(int16(binary.LittleEndian.Uint16(b[14:16]))) / 100,
+		FFCState:     ffcStates[state],
+	}
+	return nil
+}
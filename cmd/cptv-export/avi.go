@@ -0,0 +1,250 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"time"
+)
+
+// AVI header values.
+const (
+	aviFlagHasIndex = 0x10
+	aviFlagKeyFrame = 0x10
+	avihSize        = 56
+	strhSize        = 56
+	strfSize        = 40
+)
+
+type aviIndexEntry struct {
+	ID     [4]byte
+	Flags  uint32
+	Offset uint32
+	Size   uint32
+}
+
+// aviWriter writes uncompressed 24 bit RGB frames to an AVI file. The
+// frame counts and chunk sizes in the headers are filled in on Close.
+type aviWriter struct {
+	f         *os.File
+	w         *bufio.Writer
+	width     int
+	height    int
+	rowBytes  int
+	frame     []byte
+	index     []aviIndexEntry
+	moviStart int64 // offset of the 'movi' list type
+	written   int64
+
+	// Offsets of the header fields which are filled in on Close.
+	riffSizeAt    int64
+	totalFramesAt int64
+	lengthAt      int64
+	moviSizeAt    int64
+}
+
+func newAVIWriter(filename string, width, height, fps int) (*aviWriter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	rowBytes := (width*3 + 3) &^ 3
+	w := &aviWriter{
+		f:        f,
+		w:        bufio.NewWriter(f),
+		width:    width,
+		height:   height,
+		rowBytes: rowBytes,
+		frame:    make([]byte, rowBytes*height),
+	}
+	if err := w.writeHeader(fps); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *aviWriter) writeHeader(fps int) error {
+	frameBytes := uint32(len(w.frame))
+	var b bytes.Buffer
+	put := func(v interface{}) {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	fourCC := func(s string) {
+		b.WriteString(s)
+	}
+
+	fourCC("RIFF")
+	w.riffSizeAt = int64(b.Len())
+	put(uint32(0))
+	fourCC("AVI ")
+
+	fourCC("LIST")
+	put(uint32(4 + 8 + avihSize + 12 + 8 + strhSize + 8 + strfSize))
+	fourCC("hdrl")
+
+	fourCC("avih")
+	put(uint32(avihSize))
+	put(uint32(time.Second / time.Microsecond / time.Duration(fps))) // microseconds per frame
+	put(frameBytes * uint32(fps))                                    // max bytes per second
+	put(uint32(0))                                                   // padding granularity
+	put(uint32(aviFlagHasIndex))
+	w.totalFramesAt = int64(b.Len())
+	put(uint32(0)) // total frames
+	put(uint32(0)) // initial frames
+	put(uint32(1)) // streams
+	put(frameBytes)
+	put(uint32(w.width))
+	put(uint32(w.height))
+	put([4]uint32{})
+
+	fourCC("LIST")
+	put(uint32(4 + 8 + strhSize + 8 + strfSize))
+	fourCC("strl")
+
+	fourCC("strh")
+	put(uint32(strhSize))
+	fourCC("vids")
+	fourCC("DIB ")
+	put(uint32(0))   // flags
+	put(uint16(0))   // priority
+	put(uint16(0))   // language
+	put(uint32(0))   // initial frames
+	put(uint32(1))   // scale
+	put(uint32(fps)) // rate
+	put(uint32(0))   // start
+	w.lengthAt = int64(b.Len())
+	put(uint32(0)) // length in frames
+	put(frameBytes)
+	put(^uint32(0)) // quality
+	put(uint32(0))  // sample size
+	put([4]int16{0, 0, int16(w.width), int16(w.height)})
+
+	fourCC("strf")
+	put(uint32(strfSize))
+	put(uint32(strfSize))
+	put(int32(w.width))
+	put(int32(w.height)) // positive for bottom up rows
+	put(uint16(1))       // planes
+	put(uint16(24))      // bits per pixel
+	put(uint32(0))       // BI_RGB
+	put(frameBytes)
+	put([4]uint32{})
+
+	fourCC("LIST")
+	w.moviSizeAt = int64(b.Len())
+	put(uint32(0))
+	w.moviStart = int64(b.Len())
+	fourCC("movi")
+
+	n, err := w.w.Write(b.Bytes())
+	w.written = int64(n)
+	return err
+}
+
+func (w *aviWriter) WriteFrame(img image.Image) error {
+	bounds := img.Bounds()
+	for y := 0; y < w.height; y++ {
+		// Rows are stored bottom up.
+		row := w.frame[(w.height-1-y)*w.rowBytes:]
+		for x := 0; x < w.width; x++ {
+			c := color.RGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.RGBA)
+			row[x*3], row[x*3+1], row[x*3+2] = c.B, c.G, c.R
+		}
+	}
+
+	entry := aviIndexEntry{
+		ID:     [4]byte{'0', '0', 'd', 'b'},
+		Flags:  aviFlagKeyFrame,
+		Offset: uint32(w.written - w.moviStart),
+		Size:   uint32(len(w.frame)),
+	}
+	if err := w.writeChunk(entry.ID, w.frame); err != nil {
+		return err
+	}
+	w.index = append(w.index, entry)
+	return nil
+}
+
+func (w *aviWriter) writeChunk(id [4]byte, data []byte) error {
+	if _, err := w.w.Write(id[:]); err != nil {
+		return err
+	}
+	if err := binary.Write(w.w, binary.LittleEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(data); err != nil {
+		return err
+	}
+	w.written += 8 + int64(len(data))
+	if len(data)%2 == 1 {
+		if err := w.w.WriteByte(0); err != nil {
+			return err
+		}
+		w.written++
+	}
+	return nil
+}
+
+func (w *aviWriter) Close() error {
+	err := w.finish()
+	if closeErr := w.f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (w *aviWriter) finish() error {
+	moviSize := w.written - w.moviStart
+
+	var index bytes.Buffer
+	for _, entry := range w.index {
+		binary.Write(&index, binary.LittleEndian, &entry)
+	}
+	if err := w.writeChunk([4]byte{'i', 'd', 'x', '1'}, index.Bytes()); err != nil {
+		return err
+	}
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+
+	frames := uint32(len(w.index))
+	fields := []struct {
+		at    int64
+		value uint32
+	}{
+		{w.riffSizeAt, uint32(w.written - 8)},
+		{w.totalFramesAt, frames},
+		{w.lengthAt, frames},
+		{w.moviSizeAt, uint32(moviSize)},
+	}
+	for _, field := range fields {
+		if _, err := w.f.Seek(field.at, io.SeekStart); err != nil {
+			return err
+		}
+		if err := binary.Write(w.f, binary.LittleEndian, field.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
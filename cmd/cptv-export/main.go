@@ -0,0 +1,275 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	arg "github.com/alexflint/go-arg"
+
+	"github.com/TheCacophonyProject/thermal-recorder/recorder"
+	"github.com/TheCacophonyProject/thermal-recorder/replay"
+	"github.com/TheCacophonyProject/thermal-recorder/thermalimage"
+)
+
+var version = "<not set>"
+
+// Output formats.
+const (
+	formatPNG = "png"
+	formatGIF = "gif"
+	formatY4M = "y4m"
+	formatAVI = "avi"
+)
+
+const motionMetadataExt = ".motion.json"
+
+// overlayColour is used to draw motion regions.
+var overlayColour = color.RGBA{0, 0xff, 0, 0xff}
+
+type Args struct {
+	Input     string   `arg:"positional,required" help:"CPTV or CPTR file to export"`
+	Output    string   `arg:"positional,required" help:"file to write, or directory for PNG frames"`
+	Format    string   `arg:"-f,--format" help:"output format: png, gif, y4m or avi (defaults to the output file's extension, or png)"`
+	ColourMap string   `arg:"-m,--colour-map" help:"colour map: greyscale or ironbow"`
+	Min       *float64 `arg:"--min" help:"pixel value shown as the coldest colour (defaults to the lowest in the file)"`
+	Max       *float64 `arg:"--max" help:"pixel value shown as the hottest colour (defaults to the highest in the file)"`
+	Celsius   bool     `arg:"--celsius" help:"--min and --max are in °C, for radiometric cameras"`
+	Regions   bool     `arg:"-r,--regions" help:"draw the motion regions saved with the recording"`
+}
+
+func (Args) Version() string {
+	return version
+}
+
+func procArgs() Args {
+	args := Args{ColourMap: "ironbow"}
+	arg.MustParse(&args)
+	return args
+}
+
+func main() {
+	log.SetFlags(0)
+	if err := runMain(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runMain() error {
+	args := procArgs()
+
+	format, err := outputFormat(args.Format, args.Output)
+	if err != nil {
+		return err
+	}
+	cm, ok := thermalimage.ColourMaps[args.ColourMap]
+	if !ok {
+		return fmt.Errorf("unknown colour map %q, use one of %s", args.ColourMap, strings.Join(thermalimage.ColourMapNames(), ", "))
+	}
+	r, err := pixelRange(args)
+	if err != nil {
+		return err
+	}
+	var regions map[int][]recorder.Region
+	if args.Regions {
+		if regions, err = readRegions(motionMetadataName(args.Input)); err != nil {
+			return err
+		}
+	}
+
+	src, err := replay.Open(args.Input)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	log.Printf("%s: %s %s %dx%d@%dfps", args.Input, src.Brand(), src.Model(), src.ResX(), src.ResY(), src.FPS())
+	log.Printf("pixel range %d to %d", r.Min, r.Max)
+
+	w, err := newFrameWriter(format, args.Output, src)
+	if err != nil {
+		return err
+	}
+	count, err := export(src, w, r, cm, format, regions)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("wrote %d frames to %s", count, args.Output)
+	return nil
+}
+
+// outputFormat returns the format given or the one that matches the
+// output file's extension.
+func outputFormat(format, output string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(output)), ".")
+		switch format {
+		case formatGIF, formatY4M, formatAVI:
+		default:
+			format = formatPNG
+		}
+	}
+	switch format {
+	case formatPNG, formatGIF, formatY4M, formatAVI:
+		return format, nil
+	}
+	return "", fmt.Errorf("unknown format %q", format)
+}
+
+func newFrameWriter(format, output string, camera cptvframe.CameraSpec) (frameWriter, error) {
+	switch format {
+	case formatGIF:
+		return newGIFWriter(output, camera.FPS()), nil
+	case formatY4M:
+		return newY4MWriter(output, camera.ResX(), camera.ResY(), camera.FPS())
+	case formatAVI:
+		return newAVIWriter(output, camera.ResX(), camera.ResY(), camera.FPS())
+	}
+	return newPNGWriter(output)
+}
+
+// pixelRange returns the range of pixel values to show. Limits which
+// aren't given are found by reading the whole file.
+func pixelRange(args Args) (thermalimage.Range, error) {
+	toPixel := func(v float64) float64 {
+		if args.Celsius {
+			// Radiometric cameras report centikelvin.
+			return (v + 273.15) * 100
+		}
+		return v
+	}
+	var r thermalimage.Range
+	if args.Min == nil || args.Max == nil {
+		var err error
+		if r, err = fileRange(args.Input); err != nil {
+			return r, err
+		}
+	}
+	if args.Min != nil {
+		r.Min = clampPixel(toPixel(*args.Min))
+	}
+	if args.Max != nil {
+		r.Max = clampPixel(toPixel(*args.Max))
+	}
+	return r, r.Validate()
+}
+
+func clampPixel(v float64) uint16 {
+	if v < 0 {
+		return 0
+	}
+	if v > 0xffff {
+		return 0xffff
+	}
+	return uint16(v + 0.5)
+}
+
+// fileRange returns the range of pixel values in a file.
+func fileRange(filename string) (thermalimage.Range, error) {
+	r := thermalimage.Range{Min: 0xffff}
+	src, err := replay.Open(filename)
+	if err != nil {
+		return r, err
+	}
+	defer src.Close()
+	raw := make([]byte, src.FrameSize())
+	frame := cptvframe.NewFrame(src)
+	for {
+		if err := src.NextFrame(raw); err == io.EOF {
+			return r, nil
+		} else if err != nil {
+			return r, err
+		}
+		if err := replay.DecodeFrame(src.Brand(), src.Model(), raw, frame); err != nil {
+			return r, err
+		}
+		r.Extend(frame)
+	}
+}
+
+// export renders each frame from src and passes it to w, returning the
+// number of frames written.
+func export(src replay.Source, w frameWriter, r thermalimage.Range, cm *thermalimage.ColourMap, format string, regions map[int][]recorder.Region) (int, error) {
+	raw := make([]byte, src.FrameSize())
+	frame := cptvframe.NewFrame(src)
+	for i := 0; ; i++ {
+		if err := src.NextFrame(raw); err == io.EOF {
+			return i, nil
+		} else if err != nil {
+			return i, err
+		}
+		if err := replay.DecodeFrame(src.Brand(), src.Model(), raw, frame); err != nil {
+			return i, err
+		}
+
+		var img draw.Image
+		if format == formatGIF {
+			img = thermalimage.Paletted(frame, r, cm, overlayColour)
+		} else {
+			img = thermalimage.RGBA(frame, r, cm)
+		}
+		for _, region := range regions[i] {
+			rect := image.Rect(region.X, region.Y, region.X+region.Width, region.Y+region.Height)
+			thermalimage.DrawRect(img, rect, overlayColour)
+		}
+		if err := w.WriteFrame(img); err != nil {
+			return i, err
+		}
+	}
+}
+
+// motionMetadataName returns the name of the motion metadata file
+// thermal-recorder writes next to a recording.
+func motionMetadataName(recordingName string) string {
+	return strings.TrimSuffix(recordingName, filepath.Ext(recordingName)) + motionMetadataExt
+}
+
+// readRegions reads the motion regions from a motion metadata file,
+// keyed by frame index.
+func readRegions(filename string) (map[int][]recorder.Region, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("reading motion regions: %v", err)
+	}
+	var meta struct {
+		Frames []recorder.FrameMetadata `json:"frames"`
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("reading motion regions from %s: %v", filename, err)
+	}
+	if len(meta.Frames) == 0 {
+		return nil, errors.New("no motion regions saved with the recording")
+	}
+	regions := make(map[int][]recorder.Region)
+	for _, frame := range meta.Frames {
+		regions[frame.Frame] = frame.Regions
+	}
+	return regions, nil
+}
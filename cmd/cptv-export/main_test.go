@@ -0,0 +1,181 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TheCacophonyProject/thermal-recorder/recorder"
+	"github.com/TheCacophonyProject/thermal-recorder/replay"
+	"github.com/TheCacophonyProject/thermal-recorder/thermalimage"
+)
+
+const testFile = "../thermal-recorder/motiontest/animals/rat.cptv"
+
+func TestOutputFormat(t *testing.T) {
+	for _, c := range []struct {
+		format, output, want string
+	}{
+		{"", "out.gif", formatGIF},
+		{"", "out.Y4M", formatY4M},
+		{"", "out.avi", formatAVI},
+		{"", "frames", formatPNG},
+		{"", "out.mp4", formatPNG},
+		{"avi", "out.gif", formatAVI},
+	} {
+		format, err := outputFormat(c.format, c.output)
+		require.NoError(t, err)
+		assert.Equal(t, c.want, format, c.output)
+	}
+	_, err := outputFormat("mp4", "out.mp4")
+	assert.Error(t, err)
+}
+
+func TestPixelRange(t *testing.T) {
+	low, high := 20.0, 40.0
+	r, err := pixelRange(Args{Min: &low, Max: &high, Celsius: true})
+	require.NoError(t, err)
+	assert.Equal(t, thermalimage.Range{Min: 29315, Max: 31315}, r)
+
+	_, err = pixelRange(Args{Input: testFile, Max: &high})
+	require.Error(t, err, "max below the file's min")
+
+	high = 10000
+	r, err = pixelRange(Args{Input: testFile, Max: &high})
+	require.NoError(t, err)
+	assert.Equal(t, uint16(10000), r.Max)
+	assert.True(t, r.Min > 0 && r.Min < 10000)
+}
+
+// exportTestFile exports the test file in format, returning the
+// number of frames written.
+func exportTestFile(t *testing.T, format, output string, regions map[int][]recorder.Region) int {
+	r, err := fileRange(testFile)
+	require.NoError(t, err)
+	src, err := replay.Open(testFile)
+	require.NoError(t, err)
+	defer src.Close()
+	w, err := newFrameWriter(format, output, src)
+	require.NoError(t, err)
+	count, err := export(src, w, r, thermalimage.Ironbow, format, regions)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	require.True(t, count > 0)
+	return count
+}
+
+func TestExportY4M(t *testing.T) {
+	output := filepath.Join(tempDir(t), "out.y4m")
+	count := exportTestFile(t, formatY4M, output, nil)
+
+	data, err := ioutil.ReadFile(output)
+	require.NoError(t, err)
+	header := "YUV4MPEG2 W160 H120 F9:1 Ip A1:1 C444\n"
+	assert.Equal(t, header, string(data[:len(header)]))
+	assert.Equal(t, len(header)+count*(len("FRAME\n")+3*160*120), len(data))
+}
+
+func TestExportAVI(t *testing.T) {
+	output := filepath.Join(tempDir(t), "out.avi")
+	count := exportTestFile(t, formatAVI, output, nil)
+
+	data, err := ioutil.ReadFile(output)
+	require.NoError(t, err)
+	u32 := func(at int) int { return int(binary.LittleEndian.Uint32(data[at:])) }
+	assert.Equal(t, "RIFF", string(data[0:4]))
+	assert.Equal(t, len(data)-8, u32(4))
+	assert.Equal(t, "AVI LIST", string(data[8:16]))
+	assert.Equal(t, "hdrlavih", string(data[20:28]))
+	assert.Equal(t, 1000000/9, u32(32))
+	assert.Equal(t, count, u32(48), "total frames")
+	assert.Equal(t, 160, u32(64))
+	assert.Equal(t, 120, u32(68))
+
+	frameBytes := 160 * 3 * 120
+	idx := len(data) - 8 - count*16
+	assert.Equal(t, "idx1", string(data[idx:idx+4]))
+	assert.Equal(t, count*16, u32(idx+4))
+	moviStart := idx - count*(8+frameBytes) - 4
+	assert.Equal(t, "movi", string(data[moviStart:moviStart+4]))
+	assert.Equal(t, "00db", string(data[moviStart+4:moviStart+8]))
+}
+
+func TestExportGIF(t *testing.T) {
+	output := filepath.Join(tempDir(t), "out.gif")
+	count := exportTestFile(t, formatGIF, output, nil)
+
+	f, err := os.Open(output)
+	require.NoError(t, err)
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	require.NoError(t, err)
+	assert.Len(t, g.Image, count)
+	assert.Equal(t, 11, g.Delay[0])
+}
+
+func TestExportPNGWithRegions(t *testing.T) {
+	dir := tempDir(t)
+	metaFile := filepath.Join(dir, "rat"+motionMetadataExt)
+	meta := `{"frames": [{"frame": 2, "regions": [{"x": 10, "y": 20, "width": 30, "height": 40}]}]}`
+	require.NoError(t, ioutil.WriteFile(metaFile, []byte(meta), 0644))
+	regions, err := readRegions(metaFile)
+	require.NoError(t, err)
+
+	output := filepath.Join(dir, "frames")
+	count := exportTestFile(t, formatPNG, output, regions)
+	files, err := filepath.Glob(filepath.Join(output, "*.png"))
+	require.NoError(t, err)
+	assert.Len(t, files, count)
+
+	overlayAt := func(frame, x, y int) bool {
+		f, err := os.Open(filepath.Join(output, fmt.Sprintf("frame-%05d.png", frame)))
+		require.NoError(t, err)
+		defer f.Close()
+		img, err := png.Decode(f)
+		require.NoError(t, err)
+		r, g, b, _ := img.At(x, y).RGBA()
+		return r == 0 && g == 0xffff && b == 0
+	}
+	// PNG files are numbered from 1.
+	assert.True(t, overlayAt(3, 10, 20))
+	assert.True(t, overlayAt(3, 39, 59))
+	assert.False(t, overlayAt(3, 20, 30))
+	assert.False(t, overlayAt(2, 10, 20))
+}
+
+func TestReadRegionsMissing(t *testing.T) {
+	_, err := readRegions(filepath.Join(tempDir(t), "missing"+motionMetadataExt))
+	assert.Error(t, err)
+	assert.Equal(t, "/a/b/20190101.motion.json", motionMetadataName("/a/b/20190101.cptv"))
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "cptv-export")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
@@ -0,0 +1,155 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// frameWriter writes rendered frames to an output format.
+type frameWriter interface {
+	WriteFrame(img image.Image) error
+	Close() error
+}
+
+// pngWriter writes each frame to a numbered PNG file in a directory.
+type pngWriter struct {
+	dir   string
+	count int
+}
+
+func newPNGWriter(dir string) (*pngWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &pngWriter{dir: dir}, nil
+}
+
+func (w *pngWriter) WriteFrame(img image.Image) error {
+	w.count++
+	f, err := os.Create(filepath.Join(w.dir, fmt.Sprintf("frame-%05d.png", w.count)))
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (w *pngWriter) Close() error {
+	return nil
+}
+
+// gifWriter collects paletted frames and writes them as an animated
+// GIF when closed.
+type gifWriter struct {
+	filename string
+	anim     gif.GIF
+	delay    int
+}
+
+func newGIFWriter(filename string, fps int) *gifWriter {
+	return &gifWriter{
+		filename: filename,
+		delay:    (100 + fps/2) / fps,
+	}
+}
+
+func (w *gifWriter) WriteFrame(img image.Image) error {
+	paletted, ok := img.(*image.Paletted)
+	if !ok {
+		return fmt.Errorf("GIF frames must be paletted, got %T", img)
+	}
+	w.anim.Image = append(w.anim.Image, paletted)
+	w.anim.Delay = append(w.anim.Delay, w.delay)
+	return nil
+}
+
+func (w *gifWriter) Close() error {
+	f, err := os.Create(w.filename)
+	if err != nil {
+		return err
+	}
+	if err := gif.EncodeAll(f, &w.anim); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// y4mWriter writes an uncompressed YUV4MPEG2 stream with 4:4:4
+// chroma, which ffmpeg and most video players can read.
+type y4mWriter struct {
+	f      *os.File
+	w      *bufio.Writer
+	width  int
+	height int
+	planes []byte
+}
+
+func newY4MWriter(filename string, width, height, fps int) (*y4mWriter, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	w := &y4mWriter{
+		f:      f,
+		w:      bufio.NewWriter(f),
+		width:  width,
+		height: height,
+		planes: make([]byte, 3*width*height),
+	}
+	if _, err := fmt.Fprintf(w.w, "YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 C444\n", width, height, fps); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *y4mWriter) WriteFrame(img image.Image) error {
+	n := w.width * w.height
+	bounds := img.Bounds()
+	for y := 0; y < w.height; y++ {
+		for x := 0; x < w.width; x++ {
+			c := color.RGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.RGBA)
+			i := y*w.width + x
+			w.planes[i], w.planes[n+i], w.planes[2*n+i] = color.RGBToYCbCr(c.R, c.G, c.B)
+		}
+	}
+	if _, err := w.w.WriteString("FRAME\n"); err != nil {
+		return err
+	}
+	_, err := w.w.Write(w.planes)
+	return err
+}
+
+func (w *y4mWriter) Close() error {
+	if err := w.w.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
@@ -0,0 +1,245 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	goconfig "github.com/TheCacophonyProject/go-config"
+	arg "github.com/alexflint/go-arg"
+	"gopkg.in/yaml.v1"
+
+	"github.com/TheCacophonyProject/thermal-recorder/framesocket"
+	"github.com/TheCacophonyProject/thermal-recorder/headers"
+	"github.com/TheCacophonyProject/thermal-recorder/replay"
+)
+
+var version = "<not set>"
+
+type Args struct {
+	Files         []string `arg:"positional,required" help:"CPTV or CPTR files to replay"`
+	ConfigDir     string   `arg:"-c,--config" help:"path to configuration directory"`
+	Socket        string   `arg:"-s,--socket" help:"frame socket to send to (defaults to the configured lepton frame output)"`
+	Loop          bool     `arg:"-l,--loop" help:"replay the files forever"`
+	FPS           int      `arg:"--fps" help:"send frames at this rate instead of the rate recorded in the file"`
+	ClearEvery    int      `arg:"--clear-every" help:"send the clear message every N frames"`
+	BadFrameEvery int      `arg:"--bad-frame-every" help:"replace every Nth frame with a bad frame"`
+	Protocol      int      `arg:"--protocol-version" help:"frame protocol version to send (0 for the legacy protocol)"`
+	Timestamps    bool     `arg:"-t,--timestamps" help:"include timestamps in log output"`
+}
+
+func (Args) Version() string {
+	return version
+}
+
+func procArgs() Args {
+	var args Args
+	args.ConfigDir = goconfig.DefaultConfigDir
+	args.Protocol = framesocket.Version
+	arg.MustParse(&args)
+	return args
+}
+
+func main() {
+	err := runMain()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runMain() error {
+	args := procArgs()
+	if !args.Timestamps {
+		log.SetFlags(0) // Removes default timestamp flag
+	}
+	log.Printf("version: %s", version)
+
+	if args.Socket == "" {
+		socket, err := configuredFrameOutput(args.ConfigDir)
+		if err != nil {
+			return err
+		}
+		args.Socket = socket
+	}
+	log.Printf("frame output: %s", args.Socket)
+
+	p := &player{args: args}
+	defer p.disconnect()
+	for {
+		for _, filename := range args.Files {
+			if err := p.play(filename); err != nil {
+				return err
+			}
+		}
+		if !args.Loop {
+			return nil
+		}
+	}
+}
+
+func configuredFrameOutput(configDir string) (string, error) {
+	configRW, err := goconfig.New(configDir)
+	if err != nil {
+		return "", err
+	}
+	lepton := goconfig.DefaultLepton()
+	if err := configRW.Unmarshal(goconfig.LeptonKey, &lepton); err != nil {
+		return "", err
+	}
+	return lepton.FrameOutput, nil
+}
+
+// player streams frames from files to the frame socket. The
+// connection is kept open between files unless the camera described
+// by the next file is different.
+type player struct {
+	args        Args
+	conn        *net.UnixConn
+	frames      *framesocket.Writer
+	header      []byte
+	totalFrames int
+}
+
+func (p *player) play(filename string) error {
+	src, err := replay.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	header, err := cameraSpecs(src, p.args.Protocol)
+	if err != nil {
+		return err
+	}
+	if p.conn != nil && string(header) != string(p.header) {
+		log.Print("camera changed, reconnecting")
+		p.disconnect()
+	}
+	if p.conn == nil {
+		if err := p.connect(header); err != nil {
+			return err
+		}
+	} else if err := p.frames.WriteCommand(framesocket.Clear); err != nil {
+		return err
+	}
+
+	fps := src.FPS()
+	if p.args.FPS > 0 {
+		fps = p.args.FPS
+	}
+	log.Printf("replaying %s (%s %s %dx%d@%dfps)", filename, src.Brand(), src.Model(), src.ResX(), src.ResY(), fps)
+
+	frame := make([]byte, src.FrameSize())
+	ticker := time.NewTicker(time.Second / time.Duration(fps))
+	defer ticker.Stop()
+	for {
+		err := src.NextFrame(frame)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		captured := <-ticker.C
+
+		p.totalFrames++
+		if p.args.ClearEvery > 0 && p.totalFrames%p.args.ClearEvery == 0 {
+			log.Print("sending clear message")
+			if err := p.frames.WriteCommand(framesocket.Clear); err != nil {
+				return err
+			}
+		}
+		if p.args.BadFrameEvery > 0 && p.totalFrames%p.args.BadFrameEvery == 0 {
+			log.Print("sending bad frame")
+			if err := p.frames.WriteFrame(badFrame(len(frame)), captured); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := p.frames.WriteFrame(frame, captured); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *player) connect(header []byte) error {
+	log.Print("waiting for socket to be available")
+	for {
+		if _, err := os.Stat(p.args.Socket); !os.IsNotExist(err) {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+
+	log.Print("dialing frame output socket")
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{
+		Net:  "unix",
+		Name: p.args.Socket,
+	})
+	if err != nil {
+		return errors.New("error: connecting to frame output socket failed")
+	}
+	if _, err := conn.Write(header); err != nil {
+		conn.Close()
+		return err
+	}
+	p.conn = conn
+	p.frames = framesocket.NewWriter(conn, p.args.Protocol)
+	p.header = header
+	return nil
+}
+
+func (p *player) disconnect() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+		p.frames = nil
+	}
+}
+
+// cameraSpecs returns the header which leptond would send for the
+// camera that made the recording.
+func cameraSpecs(src replay.Source, protocolVersion int) ([]byte, error) {
+	cameraSpecs := map[string]interface{}{
+		headers.XResolution: src.ResX(),
+		headers.YResolution: src.ResY(),
+		headers.FrameSize:   src.FrameSize(),
+		headers.Model:       src.Model(),
+		headers.Brand:       src.Brand(),
+		headers.FPS:         src.FPS(),
+		headers.Serial:      src.Serial(),
+		headers.Firmware:    src.Firmware(),
+	}
+	if protocolVersion != framesocket.LegacyVersion {
+		cameraSpecs[headers.ProtocolVersion] = protocolVersion
+	}
+	cameraYAML, err := yaml.Marshal(cameraSpecs)
+	if err != nil {
+		return nil, err
+	}
+	return append(cameraYAML, '\n'), nil
+}
+
+// badFrame returns a frame with every pixel set to zero which the
+// frame parsers reject.
+func badFrame(size int) []byte {
+	return make([]byte, size)
+}
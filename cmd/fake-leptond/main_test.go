@@ -0,0 +1,50 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/TheCacophonyProject/lepton3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TheCacophonyProject/thermal-recorder/framesocket"
+	"github.com/TheCacophonyProject/thermal-recorder/headers"
+	"github.com/TheCacophonyProject/thermal-recorder/replay"
+)
+
+func TestCameraSpecsReadByRecorder(t *testing.T) {
+	src, err := replay.Open("../thermal-recorder/motiontest/animals/cat.cptv")
+	require.NoError(t, err)
+	defer src.Close()
+
+	header, err := cameraSpecs(src, framesocket.Version)
+	require.NoError(t, err)
+
+	info, err := headers.ReadHeaderInfo(bufio.NewReader(bytes.NewReader(header)))
+	require.NoError(t, err)
+	assert.Equal(t, 160, info.ResX())
+	assert.Equal(t, 120, info.ResY())
+	assert.Equal(t, 9, info.FPS())
+	assert.Equal(t, lepton3.BytesPerFrame, info.FrameSize())
+	assert.Equal(t, lepton3.Brand, info.Brand())
+	assert.Equal(t, lepton3.Model, info.Model())
+	assert.Equal(t, framesocket.Version, info.ProtocolVersion())
+}
@@ -0,0 +1,266 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+
+	"github.com/TheCacophonyProject/thermal-recorder/boson"
+	"github.com/TheCacophonyProject/thermal-recorder/loglimiter"
+)
+
+func newBosonCamera(conf *Config) *bosonCamera {
+	return &bosonCamera{
+		conf:     conf.Boson,
+		powerPin: conf.PowerPin,
+		log:      loglimiter.New(time.Minute),
+	}
+}
+
+// bosonCamera reads Y16 frames from a FLIR Boson. The camera is
+// controlled over its serial port while the frames are read from a
+// video device which supplies raw frames.
+//
+// Each frame is followed by a telemetry block (see boson.PutTelemetry).
+// The video device only supplies the pixels, so the camera's own frame
+// counter isn't available; the frame count sent is the number of
+// frames read since the camera was opened instead. The FFC state and FPA temperature are polled over the serial port
+// every TelemetryInterval on their own goroutine so that the round
+// trips don't hold up reading frames; times are measured from when the
+// camera was opened.
+type bosonCamera struct {
+	conf     BosonConfig
+	powerPin string
+	client   *boson.Client
+	video    *os.File
+	log      *loglimiter.LogLimiter
+
+	opened   time.Time
+	stopPoll chan struct{}
+	pollDone chan struct{}
+
+	mu         sync.Mutex
+	framesRead int
+	telemetry  cptvframe.Telemetry
+}
+
+// minTelemetryInterval stops the serial port being polled flat out if
+// TelemetryInterval isn't set.
+const minTelemetryInterval = 10 * time.Millisecond
+
+func (c *bosonCamera) Open() error {
+	log.Print("opening camera serial port")
+	client, err := boson.Open(c.conf.SerialPort)
+	if err != nil {
+		return err
+	}
+
+	log.Print("opening camera video")
+	video, err := os.Open(c.conf.VideoDevice)
+	if err != nil {
+		client.Close()
+		return err
+	}
+	c.start(client, video)
+	return nil
+}
+
+// start starts reading frames from video and polling telemetry using
+// client.
+func (c *bosonCamera) start(client *boson.Client, video *os.File) {
+	c.client = client
+	c.video = video
+	c.opened = time.Now()
+	c.mu.Lock()
+	c.framesRead = 0
+	c.telemetry = cptvframe.Telemetry{FFCState: boson.FFCNever}
+	c.mu.Unlock()
+	c.stopPoll = make(chan struct{})
+	c.pollDone = make(chan struct{})
+	go c.pollTelemetry(client, c.stopPoll, c.pollDone)
+}
+
+func (c *bosonCamera) Close() {
+	// The client is closed before waiting for polling to stop so that
+	// a command waiting on the serial port gives up.
+	if c.stopPoll != nil {
+		close(c.stopPoll)
+	}
+	if c.client != nil {
+		c.client.Close()
+		c.client = nil
+	}
+	if c.stopPoll != nil {
+		<-c.pollDone
+		c.stopPoll = nil
+	}
+	if c.video != nil {
+		c.video.Close()
+		c.video = nil
+	}
+}
+
+func (c *bosonCamera) NextFrame(raw []byte) error {
+	if c.video == nil {
+		return errors.New("camera not open")
+	}
+	pixelBytes := c.ResX() * c.ResY() * 2
+	if _, err := io.ReadFull(c.video, raw[:pixelBytes]); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.framesRead++
+	c.telemetry.FrameCount = c.framesRead
+	c.telemetry.TimeOn = time.Since(c.opened)
+	boson.PutTelemetry(raw[pixelBytes:], &c.telemetry)
+	return nil
+}
+
+// pollTelemetry reads the telemetry from client every
+// TelemetryInterval until stop is closed, then closes done.
+func (c *bosonCamera) pollTelemetry(client *boson.Client, stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	interval := c.conf.TelemetryInterval
+	if interval < minTelemetryInterval {
+		interval = minTelemetryInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.readTelemetry(client)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// readTelemetry reads the FPA temperature and FFC state from client.
+// The latest values are copied into each frame by NextFrame.
+func (c *bosonCamera) readTelemetry(client *boson.Client) {
+	temp, tempErr := client.FPATemp()
+	running, ffcErr := client.FFCInProgress()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &c.telemetry
+	t.TimeOn = time.Since(c.opened)
+	if tempErr != nil {
+		c.log.Printf("failed to read FPA temperature: %v", tempErr)
+	} else {
+		t.TempC = temp
+	}
+	if ffcErr != nil {
+		c.log.Printf("failed to read FFC state: %v", ffcErr)
+		return
+	}
+	if running {
+		c.ffcRunning()
+	} else if t.FFCState == boson.FFCRunning {
+		// Measure from the end of the FFC so the frames following
+		// it are treated as affected by it.
+		t.FFCState = boson.FFCComplete
+		t.LastFFCTime = t.TimeOn
+	}
+}
+
+// ffcRunning marks a FFC as in progress. c.mu must be held.
+func (c *bosonCamera) ffcRunning() {
+	t := &c.telemetry
+	t.FFCState = boson.FFCRunning
+	t.LastFFCTime = t.TimeOn
+	t.LastFFCTempC = t.TempC
+}
+
+func (c *bosonCamera) ResX() int {
+	return c.conf.ResX
+}
+
+func (c *bosonCamera) ResY() int {
+	return c.conf.ResY
+}
+
+func (c *bosonCamera) FPS() int {
+	return c.conf.FPS
+}
+
+func (c *bosonCamera) FrameSize() int {
+	return c.ResX()*c.ResY()*2 + boson.TelemetrySize
+}
+
+func (c *bosonCamera) Brand() string {
+	return boson.Brand
+}
+
+func (c *bosonCamera) Model() (string, error) {
+	return boson.Model, nil
+}
+
+func (c *bosonCamera) Serial() (int, error) {
+	if c.client == nil {
+		return 0, errors.New("camera not open")
+	}
+	serial, err := c.client.SerialNumber()
+	return int(serial), err
+}
+
+func (c *bosonCamera) Firmware() (string, error) {
+	if c.client == nil {
+		return "", errors.New("camera not open")
+	}
+	return c.client.SoftwareRevision()
+}
+
+func (c *bosonCamera) RunFFC() error {
+	if c.client == nil {
+		return errors.New("camera not open")
+	}
+	if err := c.client.RunFFC(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ffcRunning()
+	return nil
+}
+
+func (c *bosonCamera) SetAutoFFC(automatic bool) error {
+	if c.client == nil {
+		return errors.New("camera not open")
+	}
+	mode := boson.FFCModeManual
+	if automatic {
+		mode = boson.FFCModeAuto
+	}
+	return c.client.SetFFCMode(mode)
+}
+
+func (c *bosonCamera) PowerCycle() error {
+	if c.powerPin == "" {
+		return nil
+	}
+	return cyclePowerPin(c.powerPin, 10*time.Second)
+}
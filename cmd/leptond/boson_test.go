@@ -0,0 +1,76 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TheCacophonyProject/thermal-recorder/boson"
+	"github.com/TheCacophonyProject/thermal-recorder/loglimiter"
+)
+
+func TestBosonFramesNotHeldUpByTelemetry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boson")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := &bosonCamera{
+		conf: BosonConfig{ResX: 4, ResY: 3, FPS: 9, TelemetryInterval: time.Millisecond},
+		log:  loglimiter.New(time.Minute),
+	}
+	pixelBytes := c.ResX() * c.ResY() * 2
+	videoPath := filepath.Join(dir, "video")
+	require.NoError(t, ioutil.WriteFile(videoPath, make([]byte, 3*pixelBytes), 0644))
+	video, err := os.Open(videoPath)
+	require.NoError(t, err)
+
+	// The camera's serial port never replies.
+	clientConn, cameraConn := net.Pipe()
+	defer cameraConn.Close()
+	go io.Copy(ioutil.Discard, cameraConn)
+	c.start(boson.NewClient(clientConn), video)
+
+	done := make(chan struct{})
+	raw := make([]byte, c.FrameSize())
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, c.NextFrame(raw))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading frames waited for telemetry")
+	}
+
+	var telemetry cptvframe.Telemetry
+	require.NoError(t, boson.ParseTelemetry(raw[pixelBytes:], &telemetry))
+	assert.Equal(t, 3, telemetry.FrameCount)
+	assert.Equal(t, boson.FFCNever, telemetry.FFCState)
+	c.Close()
+}
@@ -0,0 +1,127 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"periph.io/x/periph/conn/gpio"
+	"periph.io/x/periph/conn/gpio/gpioreg"
+
+	"github.com/TheCacophonyProject/thermal-recorder/leptoncci"
+)
+
+const (
+	cameraLepton = "lepton3"
+	cameraBoson  = "boson"
+	cameraFile   = "file"
+)
+
+// Camera is a source of raw thermal frames that leptond can stream to
+// the frame socket.
+type Camera interface {
+	cptvframe.CameraSpec
+
+	// Open prepares the camera for reading frames.
+	Open() error
+
+	// Close stops reading frames and releases the camera.
+	Close()
+
+	// NextFrame reads the next raw frame into raw, which will be
+	// FrameSize() bytes long.
+	NextFrame(raw []byte) error
+
+	// FrameSize returns the number of bytes in each raw frame.
+	FrameSize() int
+
+	Brand() string
+	Model() (string, error)
+	Serial() (int, error)
+	Firmware() (string, error)
+
+	// RunFFC triggers a flat field correction.
+	RunFFC() error
+
+	// SetAutoFFC controls whether the camera runs flat field
+	// corrections by itself.
+	SetAutoFFC(automatic bool) error
+
+	// PowerCycle turns the camera off and on again. The camera
+	// must be closed.
+	PowerCycle() error
+}
+
+// ControllableCamera is a camera with controls beyond those every
+// Camera has, which are made available through the D-Bus service. Only
+// Lepton cameras have them. Changes last until the camera is restarted.
+type ControllableCamera interface {
+	Camera
+
+	SetGainMode(mode leptoncci.GainMode) error
+	SetRadiometry(enable bool) error
+	SetTLinear(enable bool) error
+	// SetFFCInterval sets how often the camera runs flat field
+	// corrections when it's running them by itself.
+	SetFFCInterval(interval time.Duration) error
+	SetSpotMeterROI(roi leptoncci.ROI) error
+	SetAGC(enable bool) error
+
+	// ControlStatus returns the camera's status and the state of its
+	// controls. Controls the camera doesn't support are left out.
+	ControlStatus() (map[string]interface{}, error)
+}
+
+func newCamera(conf *Config) (Camera, error) {
+	switch conf.Camera {
+	case cameraLepton:
+		return newLeptonCamera(conf), nil
+	case cameraBoson:
+		return newBosonCamera(conf), nil
+	case cameraFile:
+		return newFileCamera(conf), nil
+	}
+	return nil, fmt.Errorf("unknown camera type %q", conf.Camera)
+}
+
+// cyclePowerPin turns the camera off and on using the GPIO pin given,
+// waiting for the camera to start up afterwards.
+func cyclePowerPin(pinName string, startupTime time.Duration) error {
+	pin := gpioreg.ByName(pinName)
+	if pin == nil {
+		return fmt.Errorf("unknown camera power pin %s", pinName)
+	}
+
+	log.Print("turning camera power off")
+	if err := pin.Out(gpio.Low); err != nil {
+		return fmt.Errorf("failed to set camera power pin low: %v", err)
+	}
+	time.Sleep(3 * time.Second)
+
+	log.Print("turning camera power on")
+	if err := pin.Out(gpio.High); err != nil {
+		return fmt.Errorf("failed to set camera power pin high: %v", err)
+	}
+
+	log.Print("waiting for camera startup")
+	time.Sleep(startupTime)
+	log.Print("camera should be ready")
+	return nil
+}
@@ -17,13 +17,86 @@
 package main
 
 import (
+	"time"
+
 	goconfig "github.com/TheCacophonyProject/go-config"
+
+	"github.com/TheCacophonyProject/thermal-recorder/framesocket"
+	"github.com/TheCacophonyProject/thermal-recorder/metrics"
 )
 
+const leptondKey = "leptond"
+
 type Config struct {
-	SPISpeed    int64
-	PowerPin    string
-	FrameOutput string
+	SPISpeed        int64
+	PowerPin        string
+	FrameOutput     string
+	Camera          string
+	Boson           BosonConfig
+	ReplayFiles     []string
+	ProtocolVersion int
+	ExtraOutputs    []string
+	SubscribeSocket string
+	QueueLength     int
+	Metrics         metrics.Config
+}
+
+// outputs returns the sockets which frames are sent to.
+func (c *Config) outputs() []string {
+	return append([]string{c.FrameOutput}, c.ExtraOutputs...)
+}
+
+// BosonConfig holds the settings used when leptond is reading from a
+// FLIR Boson.
+type BosonConfig struct {
+	SerialPort  string `mapstructure:"serial-port"`
+	VideoDevice string `mapstructure:"video-device"`
+	ResX        int    `mapstructure:"res-x"`
+	ResY        int    `mapstructure:"res-y"`
+	FPS         int    `mapstructure:"fps"`
+
+	// TelemetryInterval is how often the FFC state and FPA
+	// temperature are read from the camera.
+	TelemetryInterval time.Duration `mapstructure:"telemetry-interval"`
+}
+
+// leptondConfig is the "leptond" config section. It selects which
+// camera backend is used. Frames are sent using the legacy protocol
+// unless ProtocolVersion is set, as consumers which predate the framed
+// protocol can't read it and nothing in the header tells leptond which
+// protocol a consumer understands.
+//
+// Frames are sent to the lepton frame output and any extra outputs,
+// and to clients connecting to the subscribe socket if it is set.
+// Each consumer can fall QueueLength frames behind before frames are
+// dropped for it. Metrics sets up how leptond's metrics are exported.
+type leptondConfig struct {
+	Camera          string         `mapstructure:"camera"`
+	Boson           BosonConfig    `mapstructure:"boson"`
+	ReplayFiles     []string       `mapstructure:"replay-files"`
+	ProtocolVersion int            `mapstructure:"protocol-version"`
+	ExtraOutputs    []string       `mapstructure:"extra-outputs"`
+	SubscribeSocket string         `mapstructure:"subscribe-socket"`
+	QueueLength     int            `mapstructure:"queue-length"`
+	Metrics         metrics.Config `mapstructure:"metrics"`
+}
+
+func defaultLeptondConfig() leptondConfig {
+	return leptondConfig{
+		Camera: cameraLepton,
+		Boson: BosonConfig{
+			SerialPort:  "/dev/ttyACM0",
+			VideoDevice: "/dev/video0",
+			ResX:        640,
+			ResY:        512,
+			FPS:         60,
+
+			TelemetryInterval: 250 * time.Millisecond,
+		},
+		ProtocolVersion: framesocket.LegacyVersion,
+		QueueLength:     20,
+		Metrics:         metrics.DefaultConfig(),
+	}
 }
 
 func ParseConfig(configFolder string) (*Config, error) {
@@ -42,9 +115,22 @@ func ParseConfig(configFolder string) (*Config, error) {
 		return nil, err
 	}
 
+	leptond := defaultLeptondConfig()
+	if err := configRW.Unmarshal(leptondKey, &leptond); err != nil {
+		return nil, err
+	}
+
 	return &Config{
-		SPISpeed:    lepton.SPISpeed,
-		PowerPin:    gpio.ThermalCameraPower,
-		FrameOutput: lepton.FrameOutput,
+		SPISpeed:        lepton.SPISpeed,
+		PowerPin:        gpio.ThermalCameraPower,
+		FrameOutput:     lepton.FrameOutput,
+		Camera:          leptond.Camera,
+		Boson:           leptond.Boson,
+		ReplayFiles:     leptond.ReplayFiles,
+		ProtocolVersion: leptond.ProtocolVersion,
+		ExtraOutputs:    leptond.ExtraOutputs,
+		SubscribeSocket: leptond.SubscribeSocket,
+		QueueLength:     leptond.QueueLength,
+		Metrics:         leptond.Metrics,
 	}, nil
 }
@@ -0,0 +1,130 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/TheCacophonyProject/thermal-recorder/replay"
+)
+
+func newFileCamera(conf *Config) *fileCamera {
+	return &fileCamera{
+		files: conf.ReplayFiles,
+	}
+}
+
+// fileCamera replays CPTV or CPTR files as if they came from a
+// camera. The files are played in order, in a loop, and must all have
+// been made by the same type of camera.
+type fileCamera struct {
+	files     []string
+	fileIndex int
+	src       replay.Source
+	nextFrame time.Time
+}
+
+func (c *fileCamera) Open() error {
+	if len(c.files) == 0 {
+		return errors.New("no files configured to replay")
+	}
+	c.fileIndex = 0
+	return c.openFile()
+}
+
+func (c *fileCamera) openFile() error {
+	filename := c.files[c.fileIndex]
+	src, err := replay.Open(filename)
+	if err != nil {
+		return err
+	}
+	if c.src != nil {
+		if src.ResX() != c.ResX() || src.ResY() != c.ResY() || src.FrameSize() != c.FrameSize() {
+			src.Close()
+			return fmt.Errorf("%s was made by a different camera", filename)
+		}
+		c.src.Close()
+	}
+	log.Printf("replaying %s", filename)
+	c.src = src
+	return nil
+}
+
+func (c *fileCamera) Close() {
+	if c.src != nil {
+		c.src.Close()
+		c.src = nil
+	}
+}
+
+func (c *fileCamera) NextFrame(raw []byte) error {
+	if c.src == nil {
+		return errors.New("camera not open")
+	}
+	err := c.src.NextFrame(raw)
+	if err == io.EOF {
+		c.fileIndex = (c.fileIndex + 1) % len(c.files)
+		if err := c.openFile(); err != nil {
+			return err
+		}
+		err = c.src.NextFrame(raw)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Release frames at the rate the camera would have.
+	now := time.Now()
+	if c.nextFrame.Before(now) {
+		c.nextFrame = now
+	}
+	time.Sleep(c.nextFrame.Sub(now))
+	c.nextFrame = c.nextFrame.Add(time.Second / time.Duration(c.FPS()))
+	return nil
+}
+
+func (c *fileCamera) ResX() int         { return c.src.ResX() }
+func (c *fileCamera) ResY() int         { return c.src.ResY() }
+func (c *fileCamera) FPS() int          { return c.src.FPS() }
+func (c *fileCamera) FrameSize() int    { return c.src.FrameSize() }
+func (c *fileCamera) Brand() string     { return c.src.Brand() }
+func (c *fileCamera) PowerCycle() error { return nil }
+
+func (c *fileCamera) Model() (string, error) {
+	return c.src.Model(), nil
+}
+
+func (c *fileCamera) Serial() (int, error) {
+	return c.src.Serial(), nil
+}
+
+func (c *fileCamera) Firmware() (string, error) {
+	return c.src.Firmware(), nil
+}
+
+func (c *fileCamera) RunFFC() error {
+	log.Print("ignoring FFC request for file camera")
+	return nil
+}
+
+func (c *fileCamera) SetAutoFFC(automatic bool) error {
+	return nil
+}
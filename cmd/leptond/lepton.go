@@ -0,0 +1,237 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2018, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"time"
+
+	"github.com/TheCacophonyProject/lepton3"
+	"periph.io/x/periph/host"
+
+	"github.com/TheCacophonyProject/thermal-recorder/leptoncci"
+)
+
+func newLeptonCamera(conf *Config) *leptonCamera {
+	return &leptonCamera{
+		spiSpeed: conf.SPISpeed,
+		powerPin: conf.PowerPin,
+	}
+}
+
+// leptonCamera reads frames from a FLIR Lepton 3 or 3.5 over SPI.
+// The controls which the lepton3 package doesn't provide are used
+// through a separate CCI client.
+type leptonCamera struct {
+	spiSpeed int64
+	powerPin string
+	*lepton3.Lepton3
+	cci *leptoncci.Client
+}
+
+func (c *leptonCamera) Open() error {
+	camera, err := lepton3.New(c.spiSpeed)
+	if err != nil {
+		return err
+	}
+	camera.SetLogFunc(func(t string) { log.Printf(t) })
+
+	log.Print("enabling radiometry")
+	if err := camera.SetRadiometry(true); err != nil {
+		camera.Close()
+		return err
+	}
+
+	log.Print("opening camera")
+	if err := camera.Open(); err != nil {
+		camera.Close()
+		return err
+	}
+
+	cci, err := leptoncci.Open()
+	if err != nil {
+		camera.Close()
+		return err
+	}
+	c.Lepton3 = camera
+	c.cci = cci
+	return nil
+}
+
+func (c *leptonCamera) Close() {
+	if c.cci != nil {
+		c.cci.Close()
+		c.cci = nil
+	}
+	if c.Lepton3 != nil {
+		c.Lepton3.Close()
+		c.Lepton3 = nil
+	}
+}
+
+func (c *leptonCamera) ResX() int {
+	return lepton3.FrameCols
+}
+
+func (c *leptonCamera) ResY() int {
+	return lepton3.FrameRows
+}
+
+func (c *leptonCamera) FPS() int {
+	return lepton3.FramesHz
+}
+
+func (c *leptonCamera) FrameSize() int {
+	return lepton3.BytesPerFrame
+}
+
+func (c *leptonCamera) Brand() string {
+	return lepton3.Brand
+}
+
+func (c *leptonCamera) Serial() (int, error) {
+	serial, err := c.GetSerial()
+	return int(serial), err
+}
+
+func (c *leptonCamera) Firmware() (string, error) {
+	firmware, err := c.GetSoftwareVersion()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d.%d.%d", firmware.Gpp_major, firmware.Gpp_minor, firmware.Gpp_build), nil
+}
+
+func (c *leptonCamera) Model() (string, error) {
+	return c.GetModel()
+}
+
+func (c *leptonCamera) SetGainMode(mode leptoncci.GainMode) error {
+	return c.cci.SetGainMode(mode)
+}
+
+func (c *leptonCamera) SetTLinear(enable bool) error {
+	return c.cci.SetTLinear(enable)
+}
+
+func (c *leptonCamera) SetFFCInterval(interval time.Duration) error {
+	mode, err := c.GetFFCModeControl()
+	if err != nil {
+		return err
+	}
+	mode.DesiredFFCPeriod = interval
+	return c.SetFFCModeControl(mode)
+}
+
+func (c *leptonCamera) SetSpotMeterROI(roi leptoncci.ROI) error {
+	return c.cci.SetSpotMeterROI(roi)
+}
+
+func (c *leptonCamera) SetAGC(enable bool) error {
+	return c.cci.SetAGC(enable)
+}
+
+func (c *leptonCamera) ControlStatus() (map[string]interface{}, error) {
+	status, err := c.cci.Status()
+	if err != nil {
+		return nil, err
+	}
+	s := map[string]interface{}{"status": status.String()}
+	if uptime, err := c.cci.Uptime(); err == nil {
+		s["uptimeSecs"] = uptime.Seconds()
+	}
+	if temp, err := c.cci.FPATemp(); err == nil {
+		s["fpaTempC"] = temp
+	}
+	if temp, err := c.cci.HousingTemp(); err == nil {
+		s["housingTempC"] = temp
+	}
+	if mode, err := c.cci.GainMode(); err == nil {
+		s["gainMode"] = mode.String()
+	}
+	if agc, err := c.cci.AGC(); err == nil {
+		s["agc"] = agc
+	}
+	if ffc, err := c.GetFFCModeControl(); err == nil {
+		s["autoFFC"] = ffc.FFCShutterMode == lepton3.FFCShutterModeAuto
+		s["ffcIntervalSecs"] = int(ffc.DesiredFFCPeriod / time.Second)
+		s["secsSinceFFC"] = int(ffc.ElapsedTimeSinceLastFFC / time.Second)
+	}
+	// Lepton 3 cameras don't support radiometry.
+	if radiometry, err := c.cci.Radiometry(); err == nil {
+		s["radiometry"] = radiometry
+	}
+	tlinear, err := c.cci.TLinear()
+	if err != nil {
+		return s, nil
+	}
+	s["tlinear"] = tlinear
+	if roi, err := c.cci.SpotMeterROI(); err == nil {
+		s["spotMeterROI"] = []int{roi.StartRow, roi.StartCol, roi.EndRow, roi.EndCol}
+	}
+	if spot, err := c.cci.SpotMeter(); err == nil && tlinear {
+		s["spotMeterC"] = spot.Mean
+	}
+	return s, nil
+}
+
+func (c *leptonCamera) PowerCycle() error {
+	if c.powerPin == "" {
+		return nil
+	}
+
+	// It turns out when GPIO23 is low the camera's Vin->GND voltage
+	// was only dropping to 2.5V instead of 0V. It seems the camera is
+	// still getting some kind of power via other pins. This seems to
+	// sometimes make the camera fail to reset properly (more likely
+	// in some devices than others).
+	//
+	// Uninstalling the SPI driver disables more of the camera's pins
+	// and allows the voltage to drop to 1.2V, allowing the camera to
+	// reset reliably.
+	//
+	// Side note: uninstalling the I2C driver as well allows Vin to go
+	// to 0V but we can't practically uninstall it without breaking
+	// the RTC and ATtiny.
+	uninstallSPIDriver()
+
+	if err := cyclePowerPin(c.powerPin, 8*time.Second); err != nil {
+		return err
+	}
+
+	installSPIDriver()
+
+	log.Print("host reinitialisation")
+	if _, err := host.Init(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func uninstallSPIDriver() {
+	log.Print("uninstalling spi driver")
+	exec.Command("modprobe", "-r", "spi_bcm2835").Run()
+	time.Sleep(2 * time.Second)
+}
+
+func installSPIDriver() {
+	log.Print("installing spi driver")
+	exec.Command("modprobe", "spi_bcm2835").Run()
+	time.Sleep(8 * time.Second)
+}
@@ -17,24 +17,19 @@
 package main
 
 import (
-	"errors"
-	"fmt"
 	"log"
-	"net"
-	"os"
-	"os/exec"
 	"time"
 
 	arg "github.com/alexflint/go-arg"
 	"github.com/coreos/go-systemd/daemon"
 	"gopkg.in/yaml.v1"
-	"periph.io/x/periph/conn/gpio"
-	"periph.io/x/periph/conn/gpio/gpioreg"
 	"periph.io/x/periph/host"
 
 	"github.com/TheCacophonyProject/go-config"
-	"github.com/TheCacophonyProject/lepton3"
+	"github.com/TheCacophonyProject/thermal-recorder/fanout"
+	"github.com/TheCacophonyProject/thermal-recorder/framesocket"
 	"github.com/TheCacophonyProject/thermal-recorder/headers"
+	"github.com/TheCacophonyProject/thermal-recorder/metrics"
 )
 
 const (
@@ -44,9 +39,6 @@ const (
 	frameLogInterval         = 60 * 5 * framesHz
 
 	framesPerSdNotify = 5 * framesHz
-
-	telemetryBytes = 160 * 4 //this should be made public in lepton3
-	clearBuffer    = "clear"
 )
 
 var version = "<not set>"
@@ -101,147 +93,137 @@ func runMain() error {
 		return err
 	}
 
-	// Wait for socket to be available.
-	log.Print("waiting for socket to be available")
-	for {
-		if _, err := os.Stat(conf.FrameOutput); !os.IsNotExist(err) {
-			break
+	if conf.Camera != cameraFile {
+		log.Print("host initialisation")
+		if _, err := host.Init(); err != nil {
+			return err
 		}
-		time.Sleep(time.Second)
-		resetWatchdog()
 	}
 
-	log.Print("dialing frame output socket")
-	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{
-		Net:  "unix",
-		Name: conf.FrameOutput,
-	})
+	camera, err := newCamera(conf)
 	if err != nil {
-		return errors.New("error: connecting to frame output socket failed")
-	}
-
-	var camera *lepton3.Lepton3
-	defer func() {
-		if camera != nil {
-			camera.Close()
-		}
-		conn.Close()
-	}()
-
-	log.Print("host initialisation")
-	if _, err := host.Init(); err != nil {
 		return err
 	}
+	defer camera.Close()
 
 	if !args.Quick {
-		if err := cycleCameraPower(conf.PowerPin); err != nil {
+		if err := camera.PowerCycle(); err != nil {
 			return err
 		}
 	}
 
-	camera, err = startCamera(conf)
-	if err != nil {
+	if err := camera.Open(); err != nil {
 		return err
 	}
 	service.setCamera(camera)
 
-	err = sendCameraSpecs(conf, camera, conn)
+	header, err := cameraSpecs(camera, conf.ProtocolVersion)
 	if err != nil {
 		return err
 	}
 
+	isCommand := func(msg []byte) bool {
+		return framesocket.IsCommand(msg, conf.ProtocolVersion)
+	}
+	broker := fanout.New(header, conf.QueueLength, isCommand)
+	defer broker.Close()
+	addBrokerMetrics(broker)
+	if err := metrics.Start(&conf.Metrics); err != nil {
+		return err
+	}
+	for _, output := range conf.outputs() {
+		go broker.Dial(output)
+	}
+	if conf.SubscribeSocket != "" {
+		log.Printf("accepting subscribers on %s", conf.SubscribeSocket)
+		if err := broker.Listen(conf.SubscribeSocket); err != nil {
+			return err
+		}
+	}
+
+	frames := framesocket.NewWriter(broker, conf.ProtocolVersion)
+	return runCameraLoop(camera, frames, service)
+}
+
+// runCameraLoop streams frames from the camera, restarting the camera
+// whenever reading a frame fails or a restart is requested.
+func runCameraLoop(camera Camera, frames *framesocket.Writer, service *leptondService) error {
 	for {
-		err = runCamera(conf, camera, conn, service)
+		err := runCamera(camera, frames, service)
 		if err != nil {
 			if _, isNextFrameErr := err.(*nextFrameErr); !isNextFrameErr {
 				return err
 			}
 			log.Printf("recording error: %v", err)
+			frameErrors.Inc()
 		}
+		cameraRestarts.Inc()
 
 		log.Print("closing camera")
 		service.removeCamera()
 		camera.Close()
 
-		err = cycleCameraPower(conf.PowerPin)
-		if err != nil {
+		if err := camera.PowerCycle(); err != nil {
+			return err
+		}
+		if err := camera.Open(); err != nil {
 			return err
 		}
-		camera, err = startCamera(conf)
 		service.setCamera(camera)
-		if err != nil {
+		log.Print("sending camera restarted")
+		if err := frames.WriteCommand(framesocket.CameraRestarted); err != nil {
 			return err
 		}
-		log.Print("Clearing Buffer")
-		conn.Write([]byte(clearBuffer))
-	}
-}
-
-func startCamera(conf *Config) (*lepton3.Lepton3, error) {
-	camera, err := lepton3.New(conf.SPISpeed)
-	if err != nil {
-		return nil, err
-	}
-	camera.SetLogFunc(func(t string) { log.Printf(t) })
-
-	log.Print("enabling radiometry")
-	if err := camera.SetRadiometry(true); err != nil {
-		return nil, err
-	}
-
-	log.Print("opening camera")
-	if err := camera.Open(); err != nil {
-		return nil, err
 	}
-	return camera, err
 }
 
-func sendCameraSpecs(conf *Config, camera *lepton3.Lepton3, conn *net.UnixConn) error {
-	serial, err := camera.GetSerial()
+// cameraSpecs returns the header describing the camera which is sent
+// to each frame consumer when it connects.
+func cameraSpecs(camera Camera, protocolVersion int) ([]byte, error) {
+	serial, err := camera.Serial()
 	if err != nil {
 		serial = 0
 	}
-	firmwareDsp, err := camera.GetSoftwareVersion()
+	firmware, err := camera.Firmware()
 	if err != nil {
-		firmwareDsp = lepton3.LeptonSoftwareRevision{}
+		firmware = ""
 	}
-	firmware := fmt.Sprintf("%d.%d.%d", firmwareDsp.Gpp_major, firmwareDsp.Gpp_minor, firmwareDsp.Gpp_build)
 
-	model, err := camera.GetModel()
+	model, err := camera.Model()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	camera_specs := map[string]interface{}{
 		headers.XResolution: camera.ResX(),
 		headers.YResolution: camera.ResY(),
-		headers.FrameSize:   lepton3.BytesPerFrame,
+		headers.FrameSize:   camera.FrameSize(),
 		headers.Model:       model,
-		headers.Brand:       lepton3.Brand,
+		headers.Brand:       camera.Brand(),
 		headers.FPS:         camera.FPS(),
 		headers.Serial:      serial,
 		headers.Firmware:    firmware,
 	}
+	if protocolVersion != framesocket.LegacyVersion {
+		camera_specs[headers.ProtocolVersion] = protocolVersion
+	}
 
 	cameraYAML, err := yaml.Marshal(camera_specs)
 	if err != nil {
-		return err
-	}
-	if _, err := conn.Write(cameraYAML); err != nil {
-		return err
+		return nil, err
 	}
-	conn.Write([]byte("\n"))
-	return nil
+	return append(cameraYAML, '\n'), nil
 }
 
-func runCamera(conf *Config, camera *lepton3.Lepton3, conn *net.UnixConn, service *leptondService) error {
-	conn.SetWriteBuffer(camera.ResX() * camera.ResY() * 2 * 20)
+func runCamera(camera Camera, frames *framesocket.Writer, service *leptondService) error {
 	log.Print("reading frames")
-	frame := lepton3.NewRawFrame()
+	frame := make([]byte, camera.FrameSize())
 	notifyCount := 0
 	for {
 		if err := camera.NextFrame(frame); err != nil {
 			return &nextFrameErr{err}
 		}
+		captured := time.Now()
+		framesRead.Inc()
 
 		if notifyCount++; notifyCount >= framesPerSdNotify {
 			resetWatchdog()
@@ -254,7 +236,14 @@ func runCamera(conf *Config, camera *lepton3.Lepton3, conn *net.UnixConn, servic
 			return nil
 		}
 
-		if _, err := conn.Write(frame[:]); err != nil {
+		if service.takeFFCStarted() {
+			ffcsRequested.Inc()
+			if err := frames.WriteCommand(framesocket.FFCStarted); err != nil {
+				return err
+			}
+		}
+
+		if err := frames.WriteFrame(frame, captured); err != nil {
 			return err
 		}
 	}
@@ -268,62 +257,14 @@ func logConfig(conf *Config) {
 	log.Printf("SPI speed: %d", conf.SPISpeed)
 	log.Printf("power pin: %s", conf.PowerPin)
 	log.Printf("frame output: %s", conf.FrameOutput)
-}
-
-func cycleCameraPower(pinName string) error {
-	if pinName == "" {
-		return nil
-	}
-
-	// It turns out when GPIO23 is low the camera's Vin->GND voltage
-	// was only dropping to 2.5V instead of 0V. It seems the camera is
-	// still getting some kind of power via other pins. This seems to
-	// sometimes make the camera fail to reset properly (more likely
-	// in some devices than others).
-	//
-	// Uninstalling the SPI driver disables more of the camera's pins
-	// and allows the voltage to drop to 1.2V, allowing the camera to
-	// reset reliably.
-	//
-	// Side note: uninstalling the I2C driver as well allows Vin to go
-	// to 0V but we can't practically uninstall it without breaking
-	// the RTC and ATtiny.
-	uninstallSPIDriver()
-
-	pin := gpioreg.ByName(pinName)
-
-	log.Print("turning camera power off")
-	if err := pin.Out(gpio.Low); err != nil {
-		return fmt.Errorf("failed to set camera power pin low: %v", err)
+	log.Printf("camera: %s", conf.Camera)
+	log.Printf("frame protocol version: %d", conf.ProtocolVersion)
+	log.Printf("frame outputs: %v", conf.outputs())
+	if conf.SubscribeSocket != "" {
+		log.Printf("subscribe socket: %s", conf.SubscribeSocket)
 	}
-	time.Sleep(3 * time.Second)
-
-	log.Print("turning camera power on")
-	if err := pin.Out(gpio.High); err != nil {
-		return fmt.Errorf("failed to set camera power pin high: %v", err)
+	log.Printf("subscriber queue length: %d", conf.QueueLength)
+	if conf.Metrics.Address != "" || conf.Metrics.File != "" {
+		log.Printf("metrics: %+v", conf.Metrics)
 	}
-
-	log.Print("waiting for camera startup")
-	time.Sleep(8 * time.Second)
-	log.Print("camera should be ready")
-
-	installSPIDriver()
-
-	log.Print("host reinitialisation")
-	if _, err := host.Init(); err != nil {
-		return err
-	}
-	return nil
-}
-
-func uninstallSPIDriver() {
-	log.Print("uninstalling spi driver")
-	exec.Command("modprobe", "-r", "spi_bcm2835").Run()
-	time.Sleep(2 * time.Second)
-}
-
-func installSPIDriver() {
-	log.Print("installing spi driver")
-	exec.Command("modprobe", "spi_bcm2835").Run()
-	time.Sleep(8 * time.Second)
 }
@@ -0,0 +1,234 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TheCacophonyProject/thermal-recorder/fanout"
+	"github.com/TheCacophonyProject/thermal-recorder/framesocket"
+	"github.com/TheCacophonyProject/thermal-recorder/headers"
+)
+
+const testFrameSize = 8
+
+// testCamera produces a fixed number of frames each time it is opened
+// before failing.
+type testCamera struct {
+	framesPerOpen int
+	maxOpens      int
+	opens         int
+	powerCycles   int
+	frames        int
+	isOpen        bool
+}
+
+func (c *testCamera) ResX() int                       { return 2 }
+func (c *testCamera) ResY() int                       { return 2 }
+func (c *testCamera) FPS() int                        { return 9 }
+func (c *testCamera) FrameSize() int                  { return testFrameSize }
+func (c *testCamera) Brand() string                   { return "test" }
+func (c *testCamera) Model() (string, error)          { return "testcam", nil }
+func (c *testCamera) Serial() (int, error)            { return 42, nil }
+func (c *testCamera) Firmware() (string, error)       { return "1.2.3", nil }
+func (c *testCamera) RunFFC() error                   { return nil }
+func (c *testCamera) SetAutoFFC(automatic bool) error { return nil }
+func (c *testCamera) Close()                          { c.isOpen = false }
+
+func (c *testCamera) Open() error {
+	if c.opens >= c.maxOpens {
+		return errors.New("camera broken")
+	}
+	c.opens++
+	c.frames = 0
+	c.isOpen = true
+	return nil
+}
+
+func (c *testCamera) PowerCycle() error {
+	if c.isOpen {
+		return errors.New("power cycled while open")
+	}
+	c.powerCycles++
+	return nil
+}
+
+func (c *testCamera) NextFrame(raw []byte) error {
+	if c.frames >= c.framesPerOpen {
+		return errors.New("frame read failed")
+	}
+	c.frames++
+	for i := range raw {
+		raw[i] = byte(c.opens)
+	}
+	return nil
+}
+
+// startConsumer starts a broker for camera with a single consumer
+// listening on a socket, as thermal-recorder does. Summaries of the
+// messages received are sent on the returned channel once the broker
+// is closed.
+func startConsumer(t *testing.T, camera Camera) (*fanout.Broker, <-chan []string, func()) {
+	dir, err := ioutil.TempDir("", "leptond")
+	require.NoError(t, err)
+	sockPath := filepath.Join(dir, "frames")
+	listener, err := net.Listen("unix", sockPath)
+	require.NoError(t, err)
+
+	header, err := cameraSpecs(camera, framesocket.Version)
+	require.NoError(t, err)
+	broker := fanout.New(header, 100, nil)
+	go broker.Dial(sockPath)
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	listener.Close()
+	for broker.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	received := make(chan []string, 1)
+	go func() {
+		received <- readMessages(t, conn)
+	}()
+
+	return broker, received, func() {
+		broker.Close()
+		conn.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// readMessages reads the header and then summarises each message
+// sent until the connection is closed.
+func readMessages(t *testing.T, conn net.Conn) []string {
+	reader := bufio.NewReader(conn)
+	header, err := headers.ReadHeaderInfo(reader)
+	require.NoError(t, err)
+	frames, err := framesocket.NewReader(reader, header)
+	require.NoError(t, err)
+
+	var out []string
+	frame := make([]byte, header.FrameSize())
+	for {
+		msg, err := frames.ReadMessage(frame)
+		if err != nil {
+			return out
+		}
+		if msg.Type == framesocket.Frame {
+			out = append(out, fmt.Sprintf("frame %d: %d", msg.Seq, msg.Frame[0]))
+		} else {
+			out = append(out, msg.Type.String())
+		}
+	}
+}
+
+func TestCameraRestartLoop(t *testing.T) {
+	camera := &testCamera{framesPerOpen: 2, maxOpens: 3}
+	service := &leptondService{actions: new(actions)}
+	require.NoError(t, camera.Open())
+
+	broker, received, cleanup := startConsumer(t, camera)
+	defer cleanup()
+
+	frames := framesocket.NewWriter(broker, framesocket.Version)
+	err := runCameraLoop(camera, frames, service)
+	assert.EqualError(t, err, "camera broken")
+	time.Sleep(50 * time.Millisecond) // Let the broker send the queued messages.
+	broker.Close()
+
+	assert.Equal(t, 3, camera.opens)
+	assert.Equal(t, 3, camera.powerCycles)
+	assert.Nil(t, service.camera)
+
+	assert.Equal(t, []string{
+		"frame 1: 1", "frame 2: 1", "camera-restarted",
+		"frame 3: 2", "frame 4: 2", "camera-restarted",
+		"frame 5: 3", "frame 6: 3",
+	}, <-received)
+}
+
+func TestRestartRequestedThroughService(t *testing.T) {
+	camera := &testCamera{framesPerOpen: 100, maxOpens: 1}
+	service := &leptondService{actions: new(actions)}
+	require.NoError(t, camera.Open())
+	service.setCamera(camera)
+	require.Nil(t, service.RestartCamera())
+
+	frames := framesocket.NewWriter(ioutil.Discard, framesocket.Version)
+	err := runCameraLoop(camera, frames, service)
+	assert.EqualError(t, err, "camera broken")
+	assert.Equal(t, 1, camera.frames)
+	assert.Equal(t, 1, camera.powerCycles)
+}
+
+func TestFFCStartedSent(t *testing.T) {
+	camera := &testCamera{framesPerOpen: 2, maxOpens: 1}
+	service := &leptondService{actions: new(actions)}
+	require.NoError(t, camera.Open())
+	service.setCamera(camera)
+	require.Nil(t, service.RunFFC())
+
+	broker, received, cleanup := startConsumer(t, camera)
+	defer cleanup()
+
+	frames := framesocket.NewWriter(broker, framesocket.Version)
+	runCameraLoop(camera, frames, service)
+	time.Sleep(50 * time.Millisecond) // Let the broker send the queued messages.
+	broker.Close()
+
+	assert.Equal(t, []string{"ffc-started", "frame 1: 1", "frame 2: 1"}, <-received)
+}
+
+func TestLegacyProtocolByDefault(t *testing.T) {
+	conf := defaultLeptondConfig()
+	assert.Equal(t, framesocket.LegacyVersion, conf.ProtocolVersion)
+
+	header, err := cameraSpecs(new(testCamera), conf.ProtocolVersion)
+	require.NoError(t, err)
+	info, err := headers.ReadHeaderInfo(bufio.NewReader(bytes.NewReader(header)))
+	require.NoError(t, err)
+	assert.Equal(t, framesocket.LegacyVersion, info.ProtocolVersion())
+}
+
+func TestCameraSpecs(t *testing.T) {
+	header, err := cameraSpecs(new(testCamera), framesocket.Version)
+	require.NoError(t, err)
+
+	info, err := headers.ReadHeaderInfo(bufio.NewReader(bytes.NewReader(header)))
+	require.NoError(t, err)
+	assert.Equal(t, 2, info.ResX())
+	assert.Equal(t, 2, info.ResY())
+	assert.Equal(t, testFrameSize, info.FrameSize())
+	assert.Equal(t, "test", info.Brand())
+	assert.Equal(t, "testcam", info.Model())
+	assert.Equal(t, 42, info.CameraSerial())
+	assert.Equal(t, "1.2.3", info.Firmware())
+	assert.Equal(t, framesocket.Version, info.ProtocolVersion())
+}
@@ -0,0 +1,40 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"github.com/TheCacophonyProject/thermal-recorder/fanout"
+	"github.com/TheCacophonyProject/thermal-recorder/metrics"
+)
+
+var (
+	framesRead     = metrics.NewCounter("leptond_frames_total", "Frames read from the camera.")
+	frameErrors    = metrics.NewCounter("leptond_frame_errors_total", "Failures reading a frame from the camera.")
+	cameraRestarts = metrics.NewCounter("leptond_camera_restarts_total", "Times the camera was restarted after a failure or a request.")
+	ffcsRequested  = metrics.NewCounter("leptond_ffc_total", "Flat field corrections run through the D-Bus service.")
+)
+
+// addBrokerMetrics adds metrics describing the frame consumers.
+func addBrokerMetrics(broker *fanout.Broker) {
+	metrics.NewGaugeFunc("leptond_subscribers", "Frame consumers connected.", func() float64 {
+		return float64(broker.Subscribers())
+	})
+	metrics.NewGaugeFunc("leptond_socket_backlog_messages", "Most messages waiting to be sent to a frame consumer.", func() float64 {
+		return float64(broker.Backlog())
+	})
+	metrics.NewCounterFunc("leptond_messages_dropped_total", "Frames dropped because a frame consumer was too slow.", broker.Dropped)
+}
@@ -19,11 +19,14 @@ package main
 import (
 	"errors"
 	"fmt"
+	"log"
 	"sync"
+	"time"
 
-	"github.com/TheCacophonyProject/lepton3"
 	"github.com/godbus/dbus"
 	"github.com/godbus/dbus/introspect"
+
+	"github.com/TheCacophonyProject/thermal-recorder/leptoncci"
 )
 
 const (
@@ -34,11 +37,12 @@ const (
 var mu sync.Mutex
 
 type actions struct {
-	reset bool
+	reset      bool
+	ffcStarted bool
 }
 
 type leptondService struct {
-	camera  *lepton3.Lepton3
+	camera  Camera
 	actions *actions
 }
 
@@ -70,7 +74,7 @@ func genIntrospectable(v interface{}) introspect.Introspectable {
 	return introspect.NewIntrospectable(node)
 }
 
-func (s *leptondService) setCamera(camera *lepton3.Lepton3) {
+func (s *leptondService) setCamera(camera Camera) {
 	mu.Lock()
 	defer mu.Unlock()
 	s.camera = camera
@@ -91,6 +95,7 @@ func (s leptondService) RunFFC() *dbus.Error {
 	if err := s.camera.RunFFC(); err != nil {
 		return makeDbusError("RunFFC", err)
 	}
+	s.actions.ffcStarted = true
 	return nil
 }
 
@@ -113,6 +118,148 @@ func (s leptondService) RestartCamera() *dbus.Error {
 	return nil
 }
 
+// controls returns the camera if it has the extra controls. mu must
+// be held.
+func (s *leptondService) controls(method string) (ControllableCamera, *dbus.Error) {
+	if s.camera == nil {
+		return nil, makeDbusError(method, fmt.Errorf("no camera available"))
+	}
+	camera, ok := s.camera.(ControllableCamera)
+	if !ok {
+		return nil, makeDbusError(method, fmt.Errorf("camera doesn't support %s", method))
+	}
+	return camera, nil
+}
+
+// SetGainMode sets the camera's gain mode to "high", "low" or "auto".
+func (s leptondService) SetGainMode(mode string) *dbus.Error {
+	mu.Lock()
+	defer mu.Unlock()
+	camera, dbusErr := s.controls("SetGainMode")
+	if dbusErr != nil {
+		return dbusErr
+	}
+	gainMode, err := leptoncci.ParseGainMode(mode)
+	if err != nil {
+		return makeDbusError("SetGainMode", err)
+	}
+	if err := camera.SetGainMode(gainMode); err != nil {
+		return makeDbusError("SetGainMode", err)
+	}
+	log.Printf("camera gain mode set to %s", gainMode)
+	return nil
+}
+
+func (s leptondService) SetRadiometry(enable bool) *dbus.Error {
+	mu.Lock()
+	defer mu.Unlock()
+	camera, dbusErr := s.controls("SetRadiometry")
+	if dbusErr != nil {
+		return dbusErr
+	}
+	if err := camera.SetRadiometry(enable); err != nil {
+		return makeDbusError("SetRadiometry", err)
+	}
+	log.Printf("camera radiometry set to %t", enable)
+	return nil
+}
+
+func (s leptondService) SetTLinear(enable bool) *dbus.Error {
+	mu.Lock()
+	defer mu.Unlock()
+	camera, dbusErr := s.controls("SetTLinear")
+	if dbusErr != nil {
+		return dbusErr
+	}
+	if err := camera.SetTLinear(enable); err != nil {
+		return makeDbusError("SetTLinear", err)
+	}
+	log.Printf("camera TLinear set to %t", enable)
+	return nil
+}
+
+// SetFFCInterval sets how often, in seconds, the camera runs flat field
+// corrections by itself.
+func (s leptondService) SetFFCInterval(secs int) *dbus.Error {
+	mu.Lock()
+	defer mu.Unlock()
+	camera, dbusErr := s.controls("SetFFCInterval")
+	if dbusErr != nil {
+		return dbusErr
+	}
+	if secs < 1 {
+		return makeDbusError("SetFFCInterval", fmt.Errorf("FFC interval must be at least 1 second"))
+	}
+	if err := camera.SetFFCInterval(time.Duration(secs) * time.Second); err != nil {
+		return makeDbusError("SetFFCInterval", err)
+	}
+	log.Printf("camera FFC interval set to %ds", secs)
+	return nil
+}
+
+// SetSpotMeterROI sets the region measured by the spot meter. The end
+// row and column are included.
+func (s leptondService) SetSpotMeterROI(startRow, startCol, endRow, endCol int) *dbus.Error {
+	mu.Lock()
+	defer mu.Unlock()
+	camera, dbusErr := s.controls("SetSpotMeterROI")
+	if dbusErr != nil {
+		return dbusErr
+	}
+	roi := leptoncci.ROI{StartRow: startRow, StartCol: startCol, EndRow: endRow, EndCol: endCol}
+	if err := camera.SetSpotMeterROI(roi); err != nil {
+		return makeDbusError("SetSpotMeterROI", err)
+	}
+	log.Printf("camera spot meter region set to %+v", roi)
+	return nil
+}
+
+// SetAGC enables or disables automatic gain control. Recordings need
+// raw values so it should only be enabled for testing.
+func (s leptondService) SetAGC(enable bool) *dbus.Error {
+	mu.Lock()
+	defer mu.Unlock()
+	camera, dbusErr := s.controls("SetAGC")
+	if dbusErr != nil {
+		return dbusErr
+	}
+	if err := camera.SetAGC(enable); err != nil {
+		return makeDbusError("SetAGC", err)
+	}
+	if enable {
+		log.Print("camera AGC enabled, frames will no longer have raw values")
+	} else {
+		log.Print("camera AGC disabled")
+	}
+	return nil
+}
+
+// CameraStatus returns the camera's status and the state of its
+// controls.
+func (s leptondService) CameraStatus() (map[string]interface{}, *dbus.Error) {
+	mu.Lock()
+	defer mu.Unlock()
+	camera, dbusErr := s.controls("CameraStatus")
+	if dbusErr != nil {
+		return nil, dbusErr
+	}
+	status, err := camera.ControlStatus()
+	if err != nil {
+		return nil, makeDbusError("CameraStatus", err)
+	}
+	return status, nil
+}
+
+// takeFFCStarted reports whether an FFC has been run through the
+// service since it was last called.
+func (s *leptondService) takeFFCStarted() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	started := s.actions.ffcStarted
+	s.actions.ffcStarted = false
+	return started
+}
+
 func makeDbusError(name string, err error) *dbus.Error {
 	return &dbus.Error{
 		Name: dbusName + "." + name,
@@ -0,0 +1,109 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TheCacophonyProject/thermal-recorder/leptoncci"
+)
+
+// controllableTestCamera records the controls set on it.
+type controllableTestCamera struct {
+	testCamera
+	gainMode    leptoncci.GainMode
+	radiometry  bool
+	ffcInterval time.Duration
+	roi         leptoncci.ROI
+}
+
+func (c *controllableTestCamera) SetGainMode(mode leptoncci.GainMode) error {
+	c.gainMode = mode
+	return nil
+}
+
+func (c *controllableTestCamera) SetRadiometry(enable bool) error {
+	c.radiometry = enable
+	return nil
+}
+
+func (c *controllableTestCamera) SetTLinear(enable bool) error {
+	return errors.New("TLinear not supported")
+}
+
+func (c *controllableTestCamera) SetFFCInterval(interval time.Duration) error {
+	c.ffcInterval = interval
+	return nil
+}
+
+func (c *controllableTestCamera) SetSpotMeterROI(roi leptoncci.ROI) error {
+	c.roi = roi
+	return roi.Validate()
+}
+
+func (c *controllableTestCamera) SetAGC(enable bool) error { return nil }
+
+func (c *controllableTestCamera) ControlStatus() (map[string]interface{}, error) {
+	return map[string]interface{}{"gainMode": c.gainMode.String()}, nil
+}
+
+func newTestService(camera Camera) *leptondService {
+	s := &leptondService{actions: new(actions)}
+	s.setCamera(camera)
+	return s
+}
+
+func TestServiceControls(t *testing.T) {
+	camera := new(controllableTestCamera)
+	s := newTestService(camera)
+
+	require.Nil(t, s.SetGainMode("low"))
+	assert.Equal(t, leptoncci.GainLow, camera.gainMode)
+	require.Nil(t, s.SetRadiometry(true))
+	assert.True(t, camera.radiometry)
+	require.Nil(t, s.SetFFCInterval(300))
+	assert.Equal(t, 5*time.Minute, camera.ffcInterval)
+	require.Nil(t, s.SetSpotMeterROI(1, 2, 3, 4))
+	assert.Equal(t, leptoncci.ROI{StartRow: 1, StartCol: 2, EndRow: 3, EndCol: 4}, camera.roi)
+
+	status, dbusErr := s.CameraStatus()
+	require.Nil(t, dbusErr)
+	assert.Equal(t, "low", status["gainMode"])
+}
+
+func TestServiceControlErrors(t *testing.T) {
+	s := newTestService(new(controllableTestCamera))
+	assert.NotNil(t, s.SetGainMode("medium"))
+	assert.NotNil(t, s.SetTLinear(true))
+	assert.NotNil(t, s.SetFFCInterval(0))
+	assert.NotNil(t, s.SetSpotMeterROI(0, 0, 200, 10))
+
+	s = newTestService(new(testCamera))
+	dbusErr := s.SetGainMode("high")
+	require.NotNil(t, dbusErr)
+	assert.Equal(t, []interface{}{"camera doesn't support SetGainMode"}, dbusErr.Body)
+
+	s.removeCamera()
+	_, dbusErr = s.CameraStatus()
+	require.NotNil(t, dbusErr)
+	assert.Equal(t, []interface{}{"no camera available"}, dbusErr.Body)
+}
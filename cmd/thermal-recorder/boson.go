@@ -7,15 +7,24 @@ import (
 
 	"github.com/TheCacophonyProject/go-cptv/cptvframe"
 	"github.com/TheCacophonyProject/lepton3"
+
+	"github.com/TheCacophonyProject/thermal-recorder/boson"
 )
 
 func convertRawBosonFrame(raw []byte, out *cptvframe.Frame, edgePixels int) error {
-	// TODO populate telemetry once bosond is sending it
-	out.Status = cptvframe.Telemetry{
-		// Make it appear like there hasn't been a FFC recently. Without
-		// this the motion detector will never trigger.
-		LastFFCTime: time.Second,
-		TimeOn:      time.Minute,
+	pixelBytes := len(out.Pix) * len(out.Pix[0]) * 2
+	if len(raw) >= pixelBytes+boson.TelemetrySize {
+		if err := boson.ParseTelemetry(raw[pixelBytes:], &out.Status); err != nil {
+			return &lepton3.BadFrameErr{Cause: err}
+		}
+	} else {
+		// Older versions of leptond don't send telemetry. Make it
+		// appear like there hasn't been a FFC recently. Without this
+		// the motion detector will never trigger.
+		out.Status = cptvframe.Telemetry{
+			LastFFCTime: time.Second,
+			TimeOn:      time.Minute,
+		}
 	}
 
 	i := 0
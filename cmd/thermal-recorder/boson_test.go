@@ -0,0 +1,63 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TheCacophonyProject/thermal-recorder/boson"
+)
+
+func rawBosonFrame(camera cptvframe.CameraSpec, telemetry *cptvframe.Telemetry) []byte {
+	pixelBytes := camera.ResX() * camera.ResY() * 2
+	raw := make([]byte, pixelBytes)
+	for i := 0; i < pixelBytes; i += 2 {
+		raw[i] = 1
+	}
+	if telemetry != nil {
+		raw = append(raw, make([]byte, boson.TelemetrySize)...)
+		boson.PutTelemetry(raw[pixelBytes:], telemetry)
+	}
+	return raw
+}
+
+func TestBosonFrameTelemetry(t *testing.T) {
+	camera := new(TestCamera)
+	telemetry := cptvframe.Telemetry{
+		FrameCount:  10,
+		TimeOn:      time.Minute,
+		LastFFCTime: 55 * time.Second,
+		TempC:       20.5,
+		FFCState:    boson.FFCComplete,
+	}
+	frame := cptvframe.NewFrame(camera)
+	require.NoError(t, convertRawBosonFrame(rawBosonFrame(camera, &telemetry), frame, 0))
+	assert.Equal(t, telemetry, frame.Status)
+	assert.Equal(t, uint16(1), frame.Pix[0][0])
+}
+
+func TestBosonFrameWithoutTelemetry(t *testing.T) {
+	camera := new(TestCamera)
+	frame := cptvframe.NewFrame(camera)
+	require.NoError(t, convertRawBosonFrame(rawBosonFrame(camera, nil), frame, 0))
+	assert.Equal(t, time.Minute-time.Second, frame.Status.TimeOn-frame.Status.LastFFCTime)
+}
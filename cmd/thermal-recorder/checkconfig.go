@@ -0,0 +1,69 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/TheCacophonyProject/lepton3"
+
+	"github.com/TheCacophonyProject/thermal-recorder/motion"
+)
+
+// checkCamera describes a camera model that a config can be checked
+// against without one being connected.
+type checkCamera struct {
+	resX int
+	resY int
+	fps  int
+}
+
+func (c checkCamera) ResX() int { return c.resX }
+func (c checkCamera) ResY() int { return c.resY }
+func (c checkCamera) FPS() int  { return c.fps }
+
+var checkCameras = map[string]checkCamera{
+	lepton3.Model:   {160, 120, 9},
+	lepton3.Model35: {160, 120, 9},
+	"boson":         {640, 512, 60},
+}
+
+// checkConfig parses and validates the config in configDir as it would
+// be used with cameraModel, returning an error describing the first
+// problem found.
+func checkConfig(configDir, cameraModel string) error {
+	camera, ok := checkCameras[cameraModel]
+	if !ok {
+		return fmt.Errorf("unknown camera model %q", cameraModel)
+	}
+	conf, err := ParseConfig(configDir)
+	if err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+	if err := conf.LoadMotionConfig(cameraModel); err != nil {
+		return fmt.Errorf("motion config: %v", err)
+	}
+	if _, err := motion.NewMask(&conf.Mask, camera); err != nil {
+		return fmt.Errorf("motion mask: %v", err)
+	}
+	if err := conf.ValidateMotion(camera); err != nil {
+		return fmt.Errorf("motion config: %v", err)
+	}
+	log.Printf("config in %s is valid for a %s camera", configDir, cameraModel)
+	return nil
+}
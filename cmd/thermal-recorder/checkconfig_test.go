@@ -0,0 +1,61 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	goconfig "github.com/TheCacophonyProject/go-config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestConfig(t *testing.T, contents string) string {
+	dir, err := ioutil.TempDir("", "check-config")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, goconfig.ConfigFileName), []byte(contents), 0644))
+	return dir
+}
+
+func TestCheckConfig(t *testing.T) {
+	dir := writeTestConfig(t, "[thermal-motion]\nedge-pixels = 2\n")
+	assert.NoError(t, checkConfig(dir, "lepton3.5"))
+	assert.NoError(t, checkConfig(dir, "boson"))
+	assert.EqualError(t, checkConfig(dir, "unknown"), `unknown camera model "unknown"`)
+
+	dir = writeTestConfig(t, "[thermal-motion]\nedge-pixels = 70\n")
+	assert.EqualError(t, checkConfig(dir, "lepton3.5"),
+		"motion config: edge-pixels is 70, must be between 0 and 59 for a 160x120 camera")
+	assert.NoError(t, checkConfig(dir, "boson"))
+
+	// The default trigger frames are fine without a preview.
+	dir = writeTestConfig(t, "[thermal-recorder]\npreview-secs = 0\n")
+	assert.NoError(t, checkConfig(dir, "lepton3.5"))
+
+	dir = writeTestConfig(t, "[thermal-motion]\ntrigger-frames = 0\n")
+	assert.EqualError(t, checkConfig(dir, "lepton3.5"),
+		"motion config: trigger-frames is 0, must be at least 1")
+
+	dir = writeTestConfig(t, "[[thermal-recorder-profiles]]\nname = \"midnight\"\n"+
+		"start-recording = \"23:00\"\nstop-recording = \"01:00\"\ncount-thresh = 20000\n")
+	assert.EqualError(t, checkConfig(dir, "lepton3.5"),
+		"motion config: profile midnight: count-thresh is 20000, must be between 1 and 18644 (the pixels inside the edges and motion mask)")
+}
@@ -17,9 +17,16 @@
 package main
 
 import (
+	"fmt"
+	"time"
+
 	goconfig "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/thermal-recorder/metrics"
 	"github.com/TheCacophonyProject/thermal-recorder/motion"
 	"github.com/TheCacophonyProject/thermal-recorder/recorder"
+	"github.com/TheCacophonyProject/thermal-recorder/snapshot"
+	"github.com/TheCacophonyProject/thermal-recorder/storage"
 	"github.com/TheCacophonyProject/thermal-recorder/throttle"
 )
 
@@ -32,11 +39,52 @@ type Config struct {
 	MinDiskSpace uint64
 	Recorder     recorder.RecorderConfig
 	Motion       goconfig.ThermalMotion
+	Tracking     motion.TrackingConfig
+	Mask         motion.MaskConfig
 	Throttler    goconfig.ThermalThrottler
 	Location     goconfig.Location
+	HTTP         HTTPConfig
+	Metrics      metrics.Config
+	Storage      storage.Config
+	Sync         SyncConfig
+	Snapshots    snapshot.Config
 	Verbose      bool
 }
 
+// Config sections used only by thermal-recorder.
+const (
+	httpKey      = "thermal-recorder-http"      // live view HTTP server
+	metricsKey   = "thermal-recorder-metrics"   // exporting metrics
+	storageKey   = "thermal-recorder-storage"   // recording retention rules
+	syncKey      = "thermal-recorder-sync"      // syncing recordings while they're written
+	snapshotsKey = "thermal-recorder-snapshots" // snapshot schedule
+)
+
+// SyncConfig sets how often the frames written to a recording are
+// synced to storage, which bounds how much is lost if thermal-recorder
+// stops uncleanly. A recording is synced every Frames frames and at
+// least every Interval. Either can be 0 to turn it off.
+type SyncConfig struct {
+	Frames   int           `mapstructure:"frames"`
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// DefaultSyncConfig syncs recordings every 10 seconds.
+func DefaultSyncConfig() SyncConfig {
+	return SyncConfig{Interval: 10 * time.Second}
+}
+
+// enabled reports whether recordings are synced while they're written.
+func (c SyncConfig) enabled() bool {
+	return c.Frames > 0 || c.Interval > 0
+}
+
+// HTTPConfig sets up the live view HTTP server. The server isn't
+// started when Address is empty.
+type HTTPConfig struct {
+	Address string `mapstructure:"address"`
+}
+
 func (c *Config) LoadMotionConfig(cameraModel string) error {
 	configRW, err := goconfig.New(c.ConfigDir)
 	if err != nil {
@@ -50,6 +98,29 @@ func (c *Config) LoadMotionConfig(cameraModel string) error {
 	return nil
 }
 
+// ValidateMotion checks the motion config, with and without each
+// profile applied, against camera. The motion mask is taken into
+// account if it can be loaded.
+func (c *Config) ValidateMotion(camera cptvframe.CameraSpec) error {
+	mask, err := motion.NewMask(&c.Mask, camera)
+	if err != nil {
+		mask = nil
+	}
+	if err := motion.ValidateConfig(&c.Motion, camera, mask); err != nil {
+		return err
+	}
+	for i := range c.Recorder.Profiles {
+		profile := &c.Recorder.Profiles[i]
+		motionConf := c.Motion
+		recorderConf := c.Recorder
+		profile.Apply(&motionConf, &recorderConf)
+		if err := motion.ValidateConfig(&motionConf, camera, mask); err != nil {
+			return fmt.Errorf("profile %s: %v", profile.Name, err)
+		}
+	}
+	return nil
+}
+
 func ParseConfig(configFolder string) (*Config, error) {
 	configRW, err := goconfig.New(configFolder)
 	if err != nil {
@@ -66,6 +137,16 @@ func ParseConfig(configFolder string) (*Config, error) {
 		return nil, err
 	}
 
+	trackingConfig, err := motion.NewTrackingConfig(configRW)
+	if err != nil {
+		return nil, err
+	}
+
+	maskConfig, err := motion.NewMaskConfig(configRW, configFolder)
+	if err != nil {
+		return nil, err
+	}
+
 	var locationConfig goconfig.Location
 	if err := configRW.Unmarshal(goconfig.LocationKey, &locationConfig); err != nil {
 		return nil, err
@@ -81,6 +162,31 @@ func ParseConfig(configFolder string) (*Config, error) {
 		return nil, err
 	}
 
+	var httpConfig HTTPConfig
+	if err := configRW.Unmarshal(httpKey, &httpConfig); err != nil {
+		return nil, err
+	}
+
+	metricsConfig, err := metrics.NewConfig(configRW, metricsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	storageConfig, err := storage.NewConfig(configRW, storageKey)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotConfig, err := snapshot.NewConfig(configRW, snapshotsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	syncConfig := DefaultSyncConfig()
+	if err := configRW.Unmarshal(syncKey, &syncConfig); err != nil {
+		return nil, err
+	}
+
 	var deviceConfig goconfig.Device
 	if err := configRW.Unmarshal(goconfig.DeviceKey, &deviceConfig); err != nil {
 		return nil, err
@@ -95,7 +201,14 @@ func ParseConfig(configFolder string) (*Config, error) {
 		MinDiskSpace: thermalRecorderConfig.MinDiskSpaceMB,
 		Recorder:     *recorderConfig,
 		Throttler:    *throttlerConfig,
+		Tracking:     *trackingConfig,
+		Mask:         *maskConfig,
 		Location:     locationConfig,
+		HTTP:         httpConfig,
+		Metrics:      *metricsConfig,
+		Storage:      *storageConfig,
+		Sync:         syncConfig,
+		Snapshots:    *snapshotConfig,
 		Verbose:      false,
 	}, nil
 }
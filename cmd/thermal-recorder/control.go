@@ -0,0 +1,158 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/TheCacophonyProject/thermal-recorder/motion"
+)
+
+// controlTimeout is how long a control request waits for the camera
+// connection to run it.
+const controlTimeout = 5 * time.Second
+
+var errNotConnected = errors.New("reading from camera has not started yet")
+
+// controlRequest is run by handleConn between frames.
+type controlRequest struct {
+	fn     func(*connRecorders) error
+	result chan error
+}
+
+// connControl lets the D-Bus service control the camera connection.
+// Requests which change recording are run by handleConn between
+// frames so they don't race with frame processing. Pausing is kept
+// across camera connections.
+type connControl struct {
+	requests chan controlRequest
+
+	mu        sync.Mutex
+	paused    bool
+	processor *motion.MotionProcessor
+	cptv      *CPTVFileRecorder
+}
+
+var control = newConnControl()
+
+func newConnControl() *connControl {
+	return &connControl{requests: make(chan controlRequest)}
+}
+
+// connected is called when a camera connection has been set up.
+func (c *connControl) connected(processor *motion.MotionProcessor, cptv *CPTVFileRecorder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.processor = processor
+	c.cptv = cptv
+	processor.SetPaused(c.paused)
+}
+
+// disconnected is called when the camera connection ends.
+func (c *connControl) disconnected() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.processor = nil
+	c.cptv = nil
+}
+
+// run passes fn to the camera connection and waits for its result.
+func (c *connControl) run(fn func(*connRecorders) error) error {
+	c.mu.Lock()
+	connected := c.processor != nil
+	c.mu.Unlock()
+	if !connected {
+		return errNotConnected
+	}
+
+	req := controlRequest{fn: fn, result: make(chan error, 1)}
+	timeout := time.After(controlTimeout)
+	select {
+	case c.requests <- req:
+	case <-timeout:
+		return errors.New("camera connection isn't reading frames")
+	}
+	select {
+	case err := <-req.result:
+		return err
+	case <-timeout:
+		return errors.New("camera connection didn't respond")
+	}
+}
+
+// setPaused pauses or resumes recordings triggered by motion.
+func (c *connControl) setPaused(paused bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if paused == c.paused {
+		return
+	}
+	c.paused = paused
+	if c.processor != nil {
+		c.processor.SetPaused(paused)
+	}
+	if paused {
+		log.Println("motion recording paused")
+	} else {
+		log.Println("motion recording resumed")
+	}
+}
+
+func (c *connControl) isPaused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// currentRecording returns the name of the motion or manual recording
+// being written and its frames written so far, or "" if there isn't
+// one.
+func (c *connControl) currentRecording() (string, int) {
+	c.mu.Lock()
+	cptv := c.cptv
+	c.mu.Unlock()
+	if cptv == nil {
+		return "", 0
+	}
+	return cptv.Current()
+}
+
+// startManualRecording starts a recording of secs seconds, saved with
+// the manual trigger.
+func startManualRecording(secs int) error {
+	return control.run(func(r *connRecorders) error {
+		// The trigger is changed on the writing goroutine either side
+		// of the recording being started so that only it is affected.
+		r.async.Run(func() { r.cptv.SetTrigger(triggerManual) })
+		defer r.async.Run(func() { r.cptv.SetTrigger(triggerMotion) })
+		if err := processor.StartManualRecording(secs); err != nil {
+			return err
+		}
+		log.Printf("manual recording of %ds started", secs)
+		return nil
+	})
+}
+
+// stopManualRecording stops a manual recording in progress.
+func stopManualRecording() error {
+	return control.run(func(*connRecorders) error {
+		return processor.StopManualRecording()
+	})
+}
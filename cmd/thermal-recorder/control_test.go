@@ -0,0 +1,148 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/lepton3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TheCacophonyProject/thermal-recorder/motion"
+	"github.com/TheCacophonyProject/thermal-recorder/recorder"
+)
+
+// controlTest sets up the globals used by the control requests as
+// handleConn does, restoring them afterwards.
+type controlTest struct {
+	conf      *Config
+	dir       string
+	recorders *connRecorders
+	camera    *TestCamera
+}
+
+func newControlTest(t *testing.T) *controlTest {
+	cptvRecorder, dir, cleanup := newTestFileRecorder(t)
+	t.Cleanup(cleanup)
+	camera := new(TestCamera)
+	async := recorder.NewAsyncRecorder(cptvRecorder, camera, 100)
+	ct := &controlTest{
+		conf:      CurrentConfig(),
+		dir:       dir,
+		recorders: &connRecorders{cptv: cptvRecorder, async: async},
+		camera:    camera,
+	}
+
+	oldControl, oldProcessor, oldLive := control, processor, live
+	t.Cleanup(func() { control, processor, live = oldControl, oldProcessor, oldLive })
+	control = newConnControl()
+	live = newLiveView(ct.conf)
+	processor = motion.NewMotionProcessor(lepton3.ParseRawFrame, &ct.conf.Motion, &ct.conf.Tracking,
+		&ct.conf.Recorder, &ct.conf.Location, live, async, camera, nil, nil)
+	control.connected(processor, cptvRecorder)
+	return ct
+}
+
+// serveRequest runs the next control request as handleConn would.
+func (ct *controlTest) serveRequest() {
+	go func() {
+		req := <-control.requests
+		req.result <- req.fn(ct.recorders)
+	}()
+}
+
+func (ct *controlTest) processFrames(n int) {
+	for i := 0; i < n; i++ {
+		processor.ProcessFrame(cptvframe.NewFrame(ct.camera))
+	}
+}
+
+func TestControlNotConnected(t *testing.T) {
+	c := newConnControl()
+	assert.Equal(t, errNotConnected, c.run(func(*connRecorders) error { return nil }))
+}
+
+func TestManualRecording(t *testing.T) {
+	ct := newControlTest(t)
+	ct.processFrames(30)
+
+	ct.serveRequest()
+	require.NoError(t, startManualRecording(2))
+	ct.processFrames(10)
+	ct.recorders.async.Run(func() {
+		name, frames := ct.recorders.cptv.Current()
+		assert.NotEmpty(t, name)
+		assert.False(t, filepath.Ext(name) == ".temp")
+		// The preview frames are written along with the frames since.
+		previewFrames := ct.conf.Recorder.PreviewSecs*ct.camera.FPS() + ct.conf.Motion.TriggerFrames - 1
+		assert.Equal(t, previewFrames+10, frames)
+	})
+
+	ct.serveRequest()
+	require.NoError(t, stopManualRecording())
+	ct.serveRequest()
+	assert.Error(t, stopManualRecording())
+	ct.recorders.async.Close()
+
+	name, _ := ct.recorders.cptv.Current()
+	assert.Empty(t, name)
+	recordings, _ := filepath.Glob(filepath.Join(ct.dir, "*.cptv"))
+	require.Len(t, recordings, 1)
+	data, err := ioutil.ReadFile(recordingMetadataName(recordings[0]))
+	require.NoError(t, err)
+	var meta recordingMetadata
+	require.NoError(t, json.Unmarshal(data, &meta))
+	assert.Equal(t, triggerManual, meta.Trigger)
+
+	// Later recordings are triggered by motion again.
+	assert.Equal(t, triggerMotion, ct.recorders.cptv.getTrigger())
+}
+
+func TestManualRecordingTooLong(t *testing.T) {
+	ct := newControlTest(t)
+	defer ct.recorders.async.Close()
+	ct.processFrames(5)
+
+	ct.serveRequest()
+	assert.Error(t, startManualRecording(ct.conf.Recorder.MaxSecs+1))
+	assert.False(t, processor.ManualRecording())
+}
+
+func TestPauseRecording(t *testing.T) {
+	ct := newControlTest(t)
+	defer ct.recorders.async.Close()
+
+	control.setPaused(true)
+	assert.True(t, processor.Paused())
+	assert.True(t, recorderStatus()["paused"].(bool))
+
+	// Pausing is kept for the next camera connection.
+	control.disconnected()
+	control.setPaused(false)
+	control.setPaused(true)
+	control.connected(processor, ct.recorders.cptv)
+	assert.True(t, processor.Paused())
+
+	control.setPaused(false)
+	assert.False(t, processor.Paused())
+	assert.False(t, recorderStatus()["paused"].(bool))
+}
@@ -24,66 +24,180 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
-	"syscall"
+	"strings"
+	"sync"
 	"time"
 
+	goconfig "github.com/TheCacophonyProject/go-config"
 	cptv "github.com/TheCacophonyProject/go-cptv"
 	"github.com/TheCacophonyProject/go-cptv/cptvframe"
 	"github.com/TheCacophonyProject/thermal-recorder/leptondController"
+	"github.com/TheCacophonyProject/thermal-recorder/recorder"
+	"github.com/TheCacophonyProject/thermal-recorder/storage"
 	yaml "gopkg.in/yaml.v2"
 )
 
-func NewCPTVFileRecorder(config *Config, camera cptvframe.CameraSpec, brand, model string, serial int, firmware string) *CPTVFileRecorder {
+// NewCPTVFileRecorder returns a recorder saving recordings to the
+// output directory, which is looked after by store.
+func NewCPTVFileRecorder(config *Config, store *storage.Manager, camera cptvframe.CameraSpec, brand, model string, serial int, firmware string) *CPTVFileRecorder {
+	cfr := &CPTVFileRecorder{
+		store: store,
+		header: cptv.Header{
+			FPS:          camera.FPS(),
+			Brand:        brand,
+			Model:        model,
+			CameraSerial: serial,
+			Firmware:     firmware,
+		},
+		camera:  camera,
+		trigger: triggerMotion,
+		meta: recordingMetadata{
+			Brand:           brand,
+			Model:           model,
+			CameraSerial:    serial,
+			Firmware:        firmware,
+			RecorderVersion: version,
+		},
+	}
+	cfr.setConfig(config)
+	return cfr
+}
+
+// setConfig sets up the output directory and the details saved with
+// each recording from config.
+func (cfr *CPTVFileRecorder) setConfig(config *Config) {
 	motionYAML, err := yaml.Marshal(config.Motion)
 	if err != nil {
 		panic(fmt.Sprintf("failed to convert motion config to YAML: %v", err))
 	}
-	cptvHeader := cptv.Header{
-		DeviceName:   config.DeviceName,
-		PreviewSecs:  config.Recorder.PreviewSecs,
-		MotionConfig: string(motionYAML),
-		Latitude:     config.Location.Latitude,
-		Longitude:    config.Location.Longitude,
-		LocTimestamp: config.Location.Timestamp,
-		Altitude:     config.Location.Altitude,
-		Accuracy:     config.Location.Accuracy,
-		FPS:          camera.FPS(),
-		Brand:        brand,
-		Model:        model,
-		CameraSerial: serial,
-		Firmware:     firmware,
-	}
+	cfr.outputDir = config.OutputDir
+	cfr.constantFreePercent = config.Storage.ConstantMinFreePercent
+	cfr.sync = config.Sync
+	cfr.motionYAML = string(motionYAML)
+
+	cfr.header.DeviceName = config.DeviceName
+	cfr.header.PreviewSecs = config.Recorder.PreviewSecs
+	cfr.header.MotionConfig = string(motionYAML)
+	cfr.header.Latitude = config.Location.Latitude
+	cfr.header.Longitude = config.Location.Longitude
+	cfr.header.LocTimestamp = config.Location.Timestamp
+	cfr.header.Altitude = config.Location.Altitude
+	cfr.header.Accuracy = config.Location.Accuracy
+	cfr.header.DeviceID = 0
 	if config.DeviceID > 0 {
-		cptvHeader.DeviceID = config.DeviceID
+		cfr.header.DeviceID = config.DeviceID
 	}
-	return &CPTVFileRecorder{
-		outputDir:    config.OutputDir,
-		header:       cptvHeader,
-		minDiskSpace: config.MinDiskSpace,
-		camera:       camera,
-		motionYAML:   string(motionYAML),
+
+	cfr.meta.DeviceID = config.DeviceID
+	cfr.meta.DeviceName = config.DeviceName
+	cfr.meta.Location = nil
+	if config.Location != (goconfig.Location{}) {
+		cfr.meta.Location = &locationMetadata{
+			Latitude:  config.Location.Latitude,
+			Longitude: config.Location.Longitude,
+			Altitude:  config.Location.Altitude,
+			Accuracy:  config.Location.Accuracy,
+			Timestamp: config.Location.Timestamp,
+		}
 	}
 }
 
+// UpdateConfig applies a changed config to the following recordings.
+func (cfr *CPTVFileRecorder) UpdateConfig(config *Config) error {
+	cfr.setConfig(config)
+	if cfr.constantRecorder {
+		return cfr.SetAsConstantRecorder()
+	}
+	return nil
+}
+
 type CPTVFileRecorder struct {
-	outputDir        string
-	header           cptv.Header
-	minDiskSpace     uint64
-	camera           cptvframe.CameraSpec
-	writer           *cptv.FileWriter
-	motionYAML       string
-	constantRecorder bool
+	outputDir           string
+	store               *storage.Manager
+	header              cptv.Header
+	constantFreePercent int
+	camera              cptvframe.CameraSpec
+	writer              *cptv.FileWriter
+	sync                SyncConfig
+	syncer              *recordingSyncer
+	motionYAML          string
+	constantRecorder    bool
+	frameMeta           []recorder.FrameMetadata
+	meta                recordingMetadata
+	bucketLevel         func() int64
+	profile             func() (string, *goconfig.ThermalMotion)
+
+	triggerMu sync.Mutex
+	trigger   string
+
+	// currentMu guards the name and frame count of the recording being
+	// written, which are read by Current.
+	currentMu sync.Mutex
+	current   string
+	frames    int
+}
+
+// motionMetadata is written to a JSON file next to each recording
+// which has motion metadata.
+type motionMetadata struct {
+	Frames []recorder.FrameMetadata `json:"frames"`
 }
 
 func (cfr *CPTVFileRecorder) SetAsConstantRecorder() error {
-	folder := path.Join(cfr.outputDir, "/constant-recordings")
+	folder := path.Join(cfr.outputDir, storage.ConstantDir)
 	cfr.outputDir = folder
 	cfr.constantRecorder = true
-	return os.Mkdir(folder, 0755)
+	cfr.SetTrigger(triggerConstant)
+	if err := os.Mkdir(folder, 0755); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
+
+// SetTrigger sets the reason saved with the following recordings.
+func (cfr *CPTVFileRecorder) SetTrigger(trigger string) {
+	cfr.triggerMu.Lock()
+	defer cfr.triggerMu.Unlock()
+	cfr.trigger = trigger
+}
+
+func (cfr *CPTVFileRecorder) getTrigger() string {
+	cfr.triggerMu.Lock()
+	defer cfr.triggerMu.Unlock()
+	return cfr.trigger
+}
+
+// Current returns the final name of the recording being written and
+// the number of frames written to it, or "" if there isn't one. It may
+// be called from any goroutine.
+func (cfr *CPTVFileRecorder) Current() (string, int) {
+	cfr.currentMu.Lock()
+	defer cfr.currentMu.Unlock()
+	return cfr.current, cfr.frames
+}
+
+func (cfr *CPTVFileRecorder) setCurrent(name string) {
+	cfr.currentMu.Lock()
+	defer cfr.currentMu.Unlock()
+	cfr.current = name
+	cfr.frames = 0
+}
+
+// SetBucketLevelFunc sets the function used to find the throttler's
+// bucket level (in frames) when a recording finishes.
+func (cfr *CPTVFileRecorder) SetBucketLevelFunc(bucketLevel func() int64) {
+	cfr.bucketLevel = bucketLevel
+}
+
+// SetProfileFunc sets the function used to find the name of the active
+// recording profile, and the motion config with it applied, when a
+// recording starts.
+func (cfr *CPTVFileRecorder) SetProfileFunc(profile func() (string, *goconfig.ThermalMotion)) {
+	cfr.profile = profile
 }
 
 func (cfr *CPTVFileRecorder) CheckCanRecord() error {
-	enoughSpace, err := checkDiskSpace(cfr.minDiskSpace, cfr.outputDir)
+	enoughSpace, err := cfr.store.CheckSpace()
 	if err != nil {
 		return fmt.Errorf("problem with checking disk space: %v", err)
 	} else if !enoughSpace {
@@ -94,12 +208,26 @@ func (cfr *CPTVFileRecorder) CheckCanRecord() error {
 
 func (fw *CPTVFileRecorder) StartRecording(background *cptvframe.Frame, tempThreshold uint16) error {
 	if fw.constantRecorder {
-		if err := deleteExcessRecordings(fw.outputDir); err != nil {
+		if err := fw.store.MakeSpace(fw.constantFreePercent); err != nil {
 			return err
 		}
 	} else {
 		leptondController.SetAutoFFC(false)
 	}
+	var profile string
+	var profileMotion *goconfig.ThermalMotion
+	if fw.profile != nil {
+		profile, profileMotion = fw.profile()
+	}
+	motionYAML := fw.motionYAML
+	if profileMotion != nil {
+		// Record the settings actually in use.
+		data, err := yaml.Marshal(profileMotion)
+		if err != nil {
+			return fmt.Errorf("failed to convert motion config to YAML: %v", err)
+		}
+		motionYAML = string(data)
+	}
 	filename := filepath.Join(fw.outputDir, newRecordingTempName())
 	if fw.constantRecorder {
 		log.Printf("constant recording started: %s", filename)
@@ -111,8 +239,7 @@ func (fw *CPTVFileRecorder) StartRecording(background *cptvframe.Frame, tempThre
 	if err != nil {
 		return err
 	}
-	motionYAML := fmt.Sprintf("%striggeredthresh: %d\n", fw.motionYAML, tempThreshold)
-	fw.header.MotionConfig = motionYAML
+	fw.header.MotionConfig = fmt.Sprintf("%striggeredthresh: %d\n", motionYAML, tempThreshold)
 	fw.header.BackgroundFrame = background
 	if err = writer.WriteHeader(fw.header); err != nil {
 		writer.Close()
@@ -120,6 +247,23 @@ func (fw *CPTVFileRecorder) StartRecording(background *cptvframe.Frame, tempThre
 	}
 	fw.header.BackgroundFrame = nil
 	fw.writer = writer
+	fw.syncer, err = newRecordingSyncer(filename, fw.sync)
+	if err != nil {
+		log.Printf("recording won't be synced while it's written: %v", err)
+	}
+	fw.setCurrent(recordingFinalName(filename))
+	fw.frameMeta = nil
+	fw.meta.StartTime = time.Now()
+	fw.meta.PreviewFrames = 0
+	fw.meta.Trigger = fw.getTrigger()
+	fw.meta.Profile = profile
+	fw.meta.CameraState = nil
+	if state, err := leptondController.GetCameraStatus(); err == nil {
+		fw.meta.CameraState = state
+	}
+	if !fw.constantRecorder {
+		signals.recordingStarted(fw.meta.Trigger)
+	}
 	return nil
 }
 
@@ -128,31 +272,116 @@ func (fw *CPTVFileRecorder) StopRecording() error {
 		leptondController.SetAutoFFC(true)
 	}
 	if fw.writer != nil {
+		fw.syncer.close()
+		fw.syncer = nil
 		fw.writer.Close()
 
-		finalName, err := renameTempRecording(fw.writer.Name())
+		finalName, err := fw.finishRecording(fw.writer.Name())
+		if info, statErr := os.Stat(finalName); err == nil && statErr == nil {
+			bytesWritten.Add(uint64(info.Size()))
+		}
+		if err == nil && !fw.constantRecorder {
+			signals.recordingFinished(finalName)
+		}
+		fw.setCurrent("")
+		fw.frameMeta = nil
+		name := finalName
+		if name == "" {
+			// It couldn't be renamed, so is left to be recovered.
+			name = fw.writer.Name()
+		}
 		if fw.constantRecorder {
-			log.Printf("constant recording stopped: %s", finalName)
+			log.Printf("constant recording stopped: %s", name)
 		} else {
-			log.Printf("recording stopped: %s", finalName)
+			log.Printf("recording stopped: %s", name)
 		}
 		fw.writer = nil
+		fw.store.Tidy()
 
 		return err
 	}
 	return nil
 }
 
+// finishRecording writes the metadata files for a recording and then
+// gives it its final name, so the metadata is in place by the time
+// the recording appears. Failing to write the metadata is only
+// logged, as the recording is still worth keeping without it.
+func (fw *CPTVFileRecorder) finishRecording(tempName string) (string, error) {
+	finalName := recordingFinalName(tempName)
+	if len(fw.frameMeta) > 0 {
+		if err := writeJSONFile(motionMetadataName(finalName), &motionMetadata{Frames: fw.frameMeta}); err != nil {
+			log.Printf("failed to write motion metadata for %s: %v", finalName, err)
+		}
+	}
+
+	meta := fw.meta
+	meta.EndTime = time.Now()
+	meta.Frames = fw.frames
+	if fw.bucketLevel != nil {
+		level := fw.bucketLevel()
+		meta.ThrottleBucket = &level
+	}
+	if err := writeJSONFile(recordingMetadataName(finalName), &meta); err != nil {
+		log.Printf("failed to write recording metadata for %s: %v", finalName, err)
+	}
+
+	if fw.sync.enabled() {
+		if err := syncFile(tempName); err != nil {
+			log.Printf("failed to sync recording: %v", err)
+		}
+	}
+	finalName, err := renameTempRecording(tempName)
+	if err == nil && fw.sync.enabled() {
+		if err := syncFile(filepath.Dir(finalName)); err != nil {
+			log.Printf("failed to sync recording directory: %v", err)
+		}
+	}
+	return finalName, err
+}
+
 func (fw *CPTVFileRecorder) Stop() {
 	if fw.writer != nil {
+		fw.syncer.close()
+		fw.syncer = nil
 		fw.writer.Close()
 		os.Remove(fw.writer.Name())
 		fw.writer = nil
+		fw.setCurrent("")
+		fw.frameMeta = nil
 	}
 }
 
 func (fw *CPTVFileRecorder) WriteFrame(frame *cptvframe.Frame) error {
-	return fw.writer.WriteFrame(frame)
+	if err := fw.writer.WriteFrame(frame); err != nil {
+		return err
+	}
+	fw.currentMu.Lock()
+	fw.frames++
+	fw.currentMu.Unlock()
+	fw.syncer.frameWritten()
+	return nil
+}
+
+// WriteFrameWithMetadata writes the frame and keeps the metadata to be
+// saved when the recording stops.
+func (fw *CPTVFileRecorder) WriteFrameWithMetadata(frame *cptvframe.Frame, meta *recorder.FrameMetadata) error {
+	metaCopy := *meta
+	metaCopy.Frame = fw.frames
+	if err := fw.WriteFrame(frame); err != nil {
+		return err
+	}
+	fw.frameMeta = append(fw.frameMeta, metaCopy)
+	if meta.Preview {
+		fw.meta.PreviewFrames++
+	}
+	return nil
+}
+
+// motionMetadataName returns the name of the motion metadata file for
+// a recording.
+func motionMetadataName(recordingName string) string {
+	return strings.TrimSuffix(recordingName, ".cptv") + motionMetadataExt
 }
 
 func newRecordingTempName() string {
@@ -174,45 +403,16 @@ func recordingFinalName(filename string) string {
 	return reTempName.ReplaceAllString(filename, `$1`)
 }
 
+// deleteTempFiles deletes unfinished metadata files and recordings
+// which were part way through being recovered. Unfinished recordings
+// are left for recoverRecordings.
 func deleteTempFiles(directory string) error {
-	matches, _ := filepath.Glob(filepath.Join(directory, "*."+cptvTempExt))
-	for _, filename := range matches {
+	metaMatches, _ := filepath.Glob(filepath.Join(directory, "*.json.temp"))
+	recoveringMatches, _ := filepath.Glob(filepath.Join(directory, "*.cptv"+recoveringExt+"*"))
+	for _, filename := range append(metaMatches, recoveringMatches...) {
 		if err := os.Remove(filename); err != nil {
 			return err
 		}
 	}
 	return nil
 }
-
-func checkDiskSpace(mb uint64, dir string) (bool, error) {
-	var fs syscall.Statfs_t
-	if err := syscall.Statfs(dir, &fs); err != nil {
-		return false, err
-	}
-	return fs.Bavail*uint64(fs.Bsize)/1024/1024 >= mb, nil
-}
-
-func deleteExcessRecordings(dir string) error {
-	var fs syscall.Statfs_t
-	for {
-		if err := syscall.Statfs(dir, &fs); err != nil {
-			return err
-		}
-		percentageLeft := (fs.Bavail * 100) / fs.Blocks
-		if percentageLeft > 30 {
-			return nil
-		}
-		matches, err := filepath.Glob(path.Join(dir, "*.cptv*"))
-		if err != nil {
-			return err
-		}
-		if len(matches) == 0 {
-			return errors.New("no more recordings to delete and not enough space for new recordings")
-		}
-		err = os.Remove(matches[0]) // Because how the files are named with the date the first in the list should be the oldest
-		if err != nil {
-			return err
-		}
-		log.Println("deleted old recording: ", matches[0])
-	}
-}
@@ -0,0 +1,177 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	goconfig "github.com/TheCacophonyProject/go-config"
+	cptv "github.com/TheCacophonyProject/go-cptv"
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/lepton3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TheCacophonyProject/thermal-recorder/recorder"
+	"github.com/TheCacophonyProject/thermal-recorder/storage"
+)
+
+func newTestFileRecorder(t *testing.T) (*CPTVFileRecorder, string, func()) {
+	dir, err := ioutil.TempDir("", "thermal-recorder")
+	require.NoError(t, err)
+	conf := CurrentConfig()
+	conf.OutputDir = dir
+	camera := new(TestCamera)
+	store := storage.New(dir, 0, &conf.Storage, nil)
+	rec := NewCPTVFileRecorder(conf, store, camera, lepton3.Brand, lepton3.Model, 1, "1.2.3")
+	return rec, dir, func() { os.RemoveAll(dir) }
+}
+
+func TestMotionMetadataWritten(t *testing.T) {
+	rec, dir, cleanup := newTestFileRecorder(t)
+	defer cleanup()
+	camera := new(TestCamera)
+
+	require.NoError(t, rec.StartRecording(cptvframe.NewFrame(camera), 3000))
+	frame := cptvframe.NewFrame(camera)
+	require.NoError(t, rec.WriteFrameWithMetadata(frame, &recorder.FrameMetadata{
+		Preview:    true,
+		DeltaCount: 2,
+		TempThresh: 3000,
+	}))
+	require.NoError(t, rec.WriteFrameWithMetadata(frame, &recorder.FrameMetadata{
+		Frame:      99, // Ignored, set by the recorder.
+		Motion:     true,
+		Trigger:    true,
+		DeltaCount: 20,
+		TempThresh: 3000,
+		Regions:    []recorder.Region{{TrackID: 1, X: 10, Y: 20, Width: 3, Height: 4, Pixels: 9}},
+	}))
+	require.NoError(t, rec.StopRecording())
+
+	recordings, _ := filepath.Glob(filepath.Join(dir, "*.cptv"))
+	require.Len(t, recordings, 1)
+	data, err := ioutil.ReadFile(motionMetadataName(recordings[0]))
+	require.NoError(t, err)
+
+	var meta motionMetadata
+	require.NoError(t, json.Unmarshal(data, &meta))
+	assert.Equal(t, []recorder.FrameMetadata{
+		{Frame: 0, Preview: true, DeltaCount: 2, TempThresh: 3000},
+		{
+			Frame:      1,
+			Motion:     true,
+			Trigger:    true,
+			DeltaCount: 20,
+			TempThresh: 3000,
+			Regions:    []recorder.Region{{TrackID: 1, X: 10, Y: 20, Width: 3, Height: 4, Pixels: 9}},
+		},
+	}, meta.Frames)
+
+	temps, _ := filepath.Glob(filepath.Join(dir, "*.temp"))
+	assert.Empty(t, temps)
+}
+
+func TestNoMotionMetadataWithoutMetadataFrames(t *testing.T) {
+	rec, dir, cleanup := newTestFileRecorder(t)
+	defer cleanup()
+	camera := new(TestCamera)
+
+	require.NoError(t, rec.StartRecording(cptvframe.NewFrame(camera), 3000))
+	require.NoError(t, rec.WriteFrame(cptvframe.NewFrame(camera)))
+	require.NoError(t, rec.StopRecording())
+
+	recordings, _ := filepath.Glob(filepath.Join(dir, "*.cptv"))
+	assert.Len(t, recordings, 1)
+	metaFiles, _ := filepath.Glob(filepath.Join(dir, "*"+motionMetadataExt))
+	assert.Empty(t, metaFiles)
+}
+
+func TestRecordingKeptWhenMetadataFails(t *testing.T) {
+	rec, dir, cleanup := newTestFileRecorder(t)
+	defer cleanup()
+	camera := new(TestCamera)
+
+	require.NoError(t, rec.StartRecording(cptvframe.NewFrame(camera), 3000))
+	frame := cptvframe.NewFrame(camera)
+	require.NoError(t, rec.WriteFrameWithMetadata(frame, &recorder.FrameMetadata{Motion: true}))
+	// Directories in the way of the metadata files stop them being
+	// written.
+	finalName := recordingFinalName(rec.writer.Name())
+	require.NoError(t, os.Mkdir(motionMetadataName(finalName)+".temp", 0755))
+	require.NoError(t, os.Mkdir(recordingMetadataName(finalName)+".temp", 0755))
+	require.NoError(t, rec.StopRecording())
+
+	recordings, _ := filepath.Glob(filepath.Join(dir, "*.cptv"))
+	assert.Equal(t, []string{finalName}, recordings)
+	metaFiles, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.Empty(t, metaFiles)
+}
+
+func TestRecordingMetadataWritten(t *testing.T) {
+	rec, dir, cleanup := newTestFileRecorder(t)
+	defer cleanup()
+	camera := new(TestCamera)
+	rec.SetTrigger(triggerTest)
+	rec.SetBucketLevelFunc(func() int64 { return 42 })
+	profileMotion := CurrentConfig().Motion
+	profileMotion.CountThresh = 17
+	rec.SetProfileFunc(func() (string, *goconfig.ThermalMotion) { return "dusk", &profileMotion })
+
+	start := time.Now()
+	require.NoError(t, rec.StartRecording(cptvframe.NewFrame(camera), 3000))
+	frame := cptvframe.NewFrame(camera)
+	require.NoError(t, rec.WriteFrameWithMetadata(frame, &recorder.FrameMetadata{Preview: true}))
+	require.NoError(t, rec.WriteFrameWithMetadata(frame, &recorder.FrameMetadata{Motion: true}))
+	require.NoError(t, rec.WriteFrame(frame))
+	require.NoError(t, rec.StopRecording())
+
+	recordings, _ := filepath.Glob(filepath.Join(dir, "*.cptv"))
+	require.Len(t, recordings, 1)
+	data, err := ioutil.ReadFile(recordingMetadataName(recordings[0]))
+	require.NoError(t, err)
+
+	var meta recordingMetadata
+	require.NoError(t, json.Unmarshal(data, &meta))
+	assert.Equal(t, 3, meta.Frames)
+	assert.Equal(t, 1, meta.PreviewFrames)
+	assert.Equal(t, triggerTest, meta.Trigger)
+	assert.Equal(t, "dusk", meta.Profile)
+	require.NotNil(t, meta.ThrottleBucket)
+	assert.Equal(t, int64(42), *meta.ThrottleBucket)
+	assert.Equal(t, lepton3.Brand, meta.Brand)
+	assert.Equal(t, lepton3.Model, meta.Model)
+	assert.Equal(t, 1, meta.CameraSerial)
+	assert.Equal(t, "1.2.3", meta.Firmware)
+	assert.Equal(t, "test name", meta.DeviceName)
+	assert.Nil(t, meta.Location)
+	assert.Equal(t, version, meta.RecorderVersion)
+	assert.False(t, meta.StartTime.Before(start.Truncate(time.Second)))
+	assert.False(t, meta.EndTime.Before(meta.StartTime))
+
+	f, err := os.Open(recordings[0])
+	require.NoError(t, err)
+	defer f.Close()
+	reader, err := cptv.NewReader(f)
+	require.NoError(t, err)
+	assert.Contains(t, reader.MotionConfig(), "countthresh: 17\n")
+}
@@ -42,6 +42,16 @@ type EventLoggingRecordingListener struct {
 	recordedFrames       string
 	motionDetectedFrames string
 	framesHz             int
+	trackIDs             map[int]bool
+	detections           []detection
+}
+
+// detection is a period of motion found in a CPTV file, in frames. End
+// is exclusive. Trigger is the frame where the recording started.
+type detection struct {
+	Start   int
+	End     int
+	Trigger int
 }
 
 func (p *EventLoggingRecordingListener) MotionDetected() {
@@ -58,6 +68,11 @@ func (p *EventLoggingRecordingListener) RecordingStarted() {
 	}
 	p.recordedFrames += fmt.Sprintf("(%d:", p.frameCount)
 	p.motionDetectedFrames += fmt.Sprintf("(%d:", p.frameCount-p.config.Motion.TriggerFrames+1)
+	p.detections = append(p.detections, detection{
+		Start:   p.frameCount - p.config.Motion.TriggerFrames + 1,
+		End:     -1,
+		Trigger: p.frameCount,
+	})
 }
 
 func (p *EventLoggingRecordingListener) RecordingEnded() {
@@ -66,6 +81,21 @@ func (p *EventLoggingRecordingListener) RecordingEnded() {
 	}
 	p.recordedFrames += fmt.Sprintf("%d)", p.frameCount)
 	p.motionDetectedFrames += fmt.Sprintf("%d)", p.frameCount-p.config.Recorder.MinSecs*p.framesHz)
+	if n := len(p.detections); n > 0 {
+		p.detections[n-1].End = p.frameCount - p.config.Recorder.MinSecs*p.framesHz + 1
+	}
+}
+
+func (p *EventLoggingRecordingListener) TracksUpdated(tracks []motion.Track) {
+	if p.trackIDs == nil {
+		p.trackIDs = make(map[int]bool)
+	}
+	for _, track := range tracks {
+		if p.verbose && !p.trackIDs[track.ID] {
+			log.Printf("%d: Track %d started at %v", p.frameCount, track.ID, track.Region.Bounds)
+		}
+		p.trackIDs[track.ID] = true
+	}
 }
 
 func (p *EventLoggingRecordingListener) completed() {
@@ -77,6 +107,10 @@ func (p *EventLoggingRecordingListener) completed() {
 		p.recordedFrames += "end)"
 	}
 
+	if n := len(p.detections); n > 0 && p.detections[n-1].End < 0 {
+		p.detections[n-1].End = p.frameCount
+	}
+
 	if p.motionDetectedFrames == "" {
 		p.motionDetectedFrames = "None"
 	}
@@ -90,18 +124,27 @@ type CPTVPlaybackTester struct {
 	config   *Config
 	basePath string
 	results  map[string]*EventLoggingRecordingListener
+	// loadMotionConfig is set to load the motion config for the camera
+	// model of each file from the config directory.
+	loadMotionConfig bool
+	// quiet stops each file tested being logged, for the sweep command
+	// which tests the same files many times.
+	quiet bool
 }
 
 func NewCPTVPlaybackTester(conf *Config) *CPTVPlaybackTester {
 	return &CPTVPlaybackTester{
-		config:  conf,
-		results: make(map[string]*EventLoggingRecordingListener),
+		config:           conf,
+		results:          make(map[string]*EventLoggingRecordingListener),
+		loadMotionConfig: true,
 	}
 }
 
 func (cpt *CPTVPlaybackTester) processIfCPTVFile(path string, info os.FileInfo, err error) error {
 	if strings.HasSuffix(path, ".cptv") {
-		log.Printf("Testing  %s", path)
+		if !cpt.quiet {
+			log.Printf("Testing  %s", path)
+		}
 		newResult := cpt.Detect(path)
 		newResult.completed()
 		shortName := path[len(cpt.basePath)+1:]
@@ -112,7 +155,9 @@ func (cpt *CPTVPlaybackTester) processIfCPTVFile(path string, info os.FileInfo,
 
 func (cpt *CPTVPlaybackTester) TestAllCPTVFiles(dir string) map[string]*EventLoggingRecordingListener {
 	cpt.basePath = dir
-	log.Printf("Looking for CPTV files in %s", cpt.basePath)
+	if !cpt.quiet {
+		log.Printf("Looking for CPTV files in %s", cpt.basePath)
+	}
 	filepath.Walk(cpt.basePath, cpt.processIfCPTVFile)
 	return cpt.results
 }
@@ -146,22 +191,29 @@ func (cpt *CPTVPlaybackTester) Detect(filename string) *EventLoggingRecordingLis
 	recorder := new(recorder.NoWriteRecorder)
 
 	file, reader, err := motionTesterLoadFile(filename)
-	cpt.config.LoadMotionConfig(reader.ModelName())
+	if cpt.loadMotionConfig {
+		cpt.config.LoadMotionConfig(reader.ModelName())
+	}
 	cpt.config.Motion.Verbose = verbose
 	camera := new(TestCamera)
 	listener := new(EventLoggingRecordingListener)
 	listener.config = cpt.config
 	listener.verbose = verbose
 	listener.framesHz = camera.FPS()
-	processor := motion.NewMotionProcessor(lepton3.ParseRawFrame, &cpt.config.Motion, &cpt.config.Recorder, &cpt.config.Location, listener, recorder, camera, nil, nil)
+	processor := motion.NewMotionProcessor(lepton3.ParseRawFrame, &cpt.config.Motion, &cpt.config.Tracking, &cpt.config.Recorder, &cpt.config.Location, listener, recorder, camera, nil, nil)
+	if mask := loadMask(cpt.config, camera); mask != nil {
+		processor.SetMask(mask)
+	}
 
 	if err != nil {
 		log.Printf("Could not open file %v", err)
 	}
 	defer file.Close()
 
-	log.Printf("Device name: %v", reader.DeviceName())
-	log.Printf("Timestamp: %v", reader.Timestamp())
+	if !cpt.quiet {
+		log.Printf("Device name: %v", reader.DeviceName())
+		log.Printf("Timestamp: %v", reader.Timestamp())
+	}
 
 	fakeTime := time.Minute
 	frame := reader.EmptyFrame()
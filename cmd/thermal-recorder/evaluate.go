@@ -0,0 +1,315 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"path/filepath"
+	"sort"
+
+	goconfig "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/window"
+)
+
+// EvaluateCmd runs motion detection over a directory of labelled CPTV
+// files and scores the results.
+type EvaluateCmd struct {
+	Dir    string `arg:"positional,required" help:"directory of CPTV files"`
+	Labels string `arg:"-l,--labels,required" help:"JSON file of labels for the CPTV files"`
+	JSON   string `arg:"--json" help:"also write the report as JSON to this file"`
+}
+
+// fileLabels describes what is in a CPTV file. Animals are periods
+// with an animal in view as [start, end] seconds from the start of the
+// file. Noise marks a file with no animals in it.
+type fileLabels struct {
+	Noise   bool         `json:"noise"`
+	Animals [][2]float64 `json:"animals"`
+}
+
+// readLabels reads a labels file, which is a JSON object mapping CPTV
+// file names, relative to the directory being evaluated, to their
+// labels. For example:
+//
+//	{
+//	  "cat.cptv": {"animals": [[2.5, 4.5]]},
+//	  "skyline.cptv": {"noise": true}
+//	}
+func readLabels(path string) (map[string]fileLabels, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	labels := make(map[string]fileLabels)
+	if err := json.Unmarshal(data, &labels); err != nil {
+		return nil, fmt.Errorf("reading labels %s: %v", path, err)
+	}
+	for name, l := range labels {
+		if l.Noise == (len(l.Animals) > 0) {
+			return nil, fmt.Errorf("labels for %s need either noise or animals", name)
+		}
+		for _, animal := range l.Animals {
+			if animal[0] < 0 || animal[1] <= animal[0] {
+				return nil, fmt.Errorf("labels for %s have an invalid animal period %v", name, animal)
+			}
+		}
+	}
+	return labels, nil
+}
+
+// evaluationScore is the score for a CPTV file or for all files.
+// Precision and recall are per frame, and are nil when there were no
+// frames to divide by.
+type evaluationScore struct {
+	File                string   `json:"file,omitempty"`
+	Frames              int      `json:"frames"`
+	AnimalFrames        int      `json:"animalFrames"`
+	DetectedFrames      int      `json:"detectedFrames"`
+	TruePositiveFrames  int      `json:"truePositiveFrames"`
+	Precision           *float64 `json:"precision"`
+	Recall              *float64 `json:"recall"`
+	FalseTriggers       int      `json:"falseTriggers"`
+	FalseTriggerMinutes float64  `json:"falseTriggerMinutes"`
+	Animals             int      `json:"animals"`
+	AnimalsMissed       int      `json:"animalsMissed"`
+	MeanLatencySecs     *float64 `json:"meanTriggerLatencySecs"`
+
+	latencies []float64
+}
+
+// evaluationReport holds the scores from an evaluation.
+type evaluationReport struct {
+	Motion     goconfig.ThermalMotion `json:"motion"`
+	Files      []evaluationScore      `json:"files"`
+	Overall    evaluationScore        `json:"overall"`
+	Unlabelled []string               `json:"unlabelled,omitempty"`
+	Missing    []string               `json:"missing,omitempty"`
+}
+
+// evaluate runs every labelled CPTV file in dir through motion
+// detection using conf. The recording window is ignored.
+func evaluate(conf *Config, dir string, labels map[string]fileLabels) (*evaluationReport, error) {
+	conf.Recorder.Window = window.Window{NoWindow: true}
+	results := NewCPTVPlaybackTester(conf).TestAllCPTVFiles(filepath.Clean(dir))
+	return scoreResults(conf, results, labels)
+}
+
+// scoreResults scores the results of running CPTV files through
+// motion detection against labels. Files without labels are skipped
+// and listed in the report along with labelled files that weren't
+// found.
+func scoreResults(conf *Config, results map[string]*EventLoggingRecordingListener, labels map[string]fileLabels) (*evaluationReport, error) {
+	report := &evaluationReport{Motion: conf.Motion}
+	names := make([]string, 0, len(results))
+	for name := range results {
+		if _, ok := labels[name]; ok {
+			names = append(names, name)
+		} else {
+			report.Unlabelled = append(report.Unlabelled, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no labelled CPTV files found")
+	}
+	for name := range labels {
+		if _, ok := results[name]; !ok {
+			report.Missing = append(report.Missing, name)
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(report.Unlabelled)
+	sort.Strings(report.Missing)
+
+	for _, name := range names {
+		score := scoreDetections(results[name].detections, labels[name], results[name].frameCount, results[name].framesHz)
+		score.File = name
+		report.Files = append(report.Files, score)
+		report.Overall.add(&score)
+	}
+	report.Overall.finish()
+	return report, nil
+}
+
+// logUnmatched logs the files which couldn't be scored.
+func (r *evaluationReport) logUnmatched() {
+	for _, name := range r.Unlabelled {
+		log.Printf("no labels for %s, skipping", name)
+	}
+	for _, name := range r.Missing {
+		log.Printf("labelled file %s not found", name)
+	}
+}
+
+// scoreDetections compares detections with labels for a file of frames
+// frames at fps frames per second.
+func scoreDetections(detections []detection, labels fileLabels, frames, fps int) evaluationScore {
+	score := evaluationScore{Frames: frames}
+	animal := make([]bool, frames)
+	type period struct{ start, end int }
+	var animals []period
+	for _, a := range labels.Animals {
+		p := period{
+			start: clamp(int(math.Round(a[0]*float64(fps))), 0, frames),
+			end:   clamp(int(math.Round(a[1]*float64(fps))), 0, frames),
+		}
+		animals = append(animals, p)
+		for i := p.start; i < p.end; i++ {
+			animal[i] = true
+		}
+	}
+
+	detected := make([]bool, frames)
+	for _, d := range detections {
+		start, end := clamp(d.Start, 0, frames), clamp(d.End, 0, frames)
+		overlapsAnimal := false
+		for i := start; i < end; i++ {
+			detected[i] = true
+			overlapsAnimal = overlapsAnimal || animal[i]
+		}
+		if !overlapsAnimal {
+			score.FalseTriggers++
+			score.FalseTriggerMinutes += float64(end-start) / float64(fps) / 60
+		}
+	}
+
+	for i := range animal {
+		if animal[i] {
+			score.AnimalFrames++
+		}
+		if detected[i] {
+			score.DetectedFrames++
+		}
+		if animal[i] && detected[i] {
+			score.TruePositiveFrames++
+		}
+	}
+
+	// The latency for an animal is from when it appears until the first
+	// recording overlapping it was triggered.
+	for _, a := range animals {
+		score.Animals++
+		found := false
+		for _, d := range detections {
+			if d.Start < a.end && d.End > a.start {
+				latency := float64(d.Trigger-a.start) / float64(fps)
+				score.latencies = append(score.latencies, math.Max(latency, 0))
+				found = true
+				break
+			}
+		}
+		if !found {
+			score.AnimalsMissed++
+		}
+	}
+
+	score.finish()
+	return score
+}
+
+// add adds the counts from other to s.
+func (s *evaluationScore) add(other *evaluationScore) {
+	s.Frames += other.Frames
+	s.AnimalFrames += other.AnimalFrames
+	s.DetectedFrames += other.DetectedFrames
+	s.TruePositiveFrames += other.TruePositiveFrames
+	s.FalseTriggers += other.FalseTriggers
+	s.FalseTriggerMinutes += other.FalseTriggerMinutes
+	s.Animals += other.Animals
+	s.AnimalsMissed += other.AnimalsMissed
+	s.latencies = append(s.latencies, other.latencies...)
+}
+
+// finish works out the ratios from the counts.
+func (s *evaluationScore) finish() {
+	s.Precision = ratio(float64(s.TruePositiveFrames), float64(s.DetectedFrames))
+	s.Recall = ratio(float64(s.TruePositiveFrames), float64(s.AnimalFrames))
+	sum := 0.0
+	for _, latency := range s.latencies {
+		sum += latency
+	}
+	s.MeanLatencySecs = ratio(sum, float64(len(s.latencies)))
+}
+
+func ratio(a, b float64) *float64 {
+	if b == 0 {
+		return nil
+	}
+	r := a / b
+	return &r
+}
+
+func clamp(v, low, high int) int {
+	if v < low {
+		return low
+	}
+	if v > high {
+		return high
+	}
+	return v
+}
+
+// writeText writes the report as a table.
+func (r *evaluationReport) writeText(w io.Writer) {
+	fmt.Fprintf(w, "%-24s %9s %9s %9s %11s %8s %10s\n",
+		"file", "precision", "recall", "false", "false mins", "missed", "latency s")
+	for _, score := range append(r.Files, r.Overall) {
+		name := score.File
+		if name == "" {
+			name = "overall"
+		}
+		fmt.Fprintf(w, "%-24s %9s %9s %9d %11.2f %8s %10s\n",
+			name,
+			formatRatio(score.Precision),
+			formatRatio(score.Recall),
+			score.FalseTriggers,
+			score.FalseTriggerMinutes,
+			fmt.Sprintf("%d/%d", score.AnimalsMissed, score.Animals),
+			formatRatio(score.MeanLatencySecs))
+	}
+}
+
+func formatRatio(r *float64) string {
+	if r == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", *r)
+}
+
+// runEvaluate runs the evaluate command.
+func runEvaluate(conf *Config, cmd *EvaluateCmd, w io.Writer) error {
+	labels, err := readLabels(cmd.Labels)
+	if err != nil {
+		return err
+	}
+	report, err := evaluate(conf, cmd.Dir, labels)
+	if err != nil {
+		return err
+	}
+	report.logUnmatched()
+	logConfig(conf)
+	report.writeText(w)
+	if cmd.JSON != "" {
+		return writeJSONFile(cmd.JSON, report)
+	}
+	return nil
+}
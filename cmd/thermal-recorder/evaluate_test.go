@@ -0,0 +1,98 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoreDetections(t *testing.T) {
+	labels := fileLabels{Animals: [][2]float64{{1, 3}, {8, 9}}}
+	detections := []detection{
+		{Start: 18, End: 36, Trigger: 19}, // The first animal is frames 9 to 27.
+		{Start: 50, End: 59, Trigger: 51}, // Nothing there.
+	}
+
+	score := scoreDetections(detections, labels, 100, 9)
+	assert.Equal(t, 27, score.AnimalFrames)
+	assert.Equal(t, 27, score.DetectedFrames)
+	assert.Equal(t, 9, score.TruePositiveFrames)
+	assert.InDelta(t, 1.0/3, *score.Precision, 0.001)
+	assert.InDelta(t, 1.0/3, *score.Recall, 0.001)
+	assert.Equal(t, 1, score.FalseTriggers)
+	assert.InDelta(t, 1.0/60, score.FalseTriggerMinutes, 0.001)
+	assert.Equal(t, 2, score.Animals)
+	assert.Equal(t, 1, score.AnimalsMissed)
+	assert.InDelta(t, 10.0/9, *score.MeanLatencySecs, 0.001)
+}
+
+func TestScoreDetectionsNoise(t *testing.T) {
+	score := scoreDetections(nil, fileLabels{Noise: true}, 100, 9)
+	assert.Nil(t, score.Precision)
+	assert.Nil(t, score.Recall)
+	assert.Nil(t, score.MeanLatencySecs)
+	assert.Equal(t, 0, score.FalseTriggers)
+}
+
+func writeLabels(t *testing.T, contents string) string {
+	f, err := ioutil.TempFile("", "labels")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.Remove(f.Name()) })
+	_, err = f.WriteString(contents)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	return f.Name()
+}
+
+func TestReadLabels(t *testing.T) {
+	_, err := readLabels(writeLabels(t, `{"a.cptv": {}}`))
+	assert.EqualError(t, err, "labels for a.cptv need either noise or animals")
+
+	_, err = readLabels(writeLabels(t, `{"a.cptv": {"animals": [[3, 2]]}}`))
+	assert.EqualError(t, err, "labels for a.cptv have an invalid animal period [3 2]")
+
+	labels, err := readLabels(writeLabels(t, `{"a.cptv": {"animals": [[2, 3]]}, "b.cptv": {"noise": true}}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]fileLabels{
+		"a.cptv": {Animals: [][2]float64{{2, 3}}},
+		"b.cptv": {Noise: true},
+	}, labels)
+}
+
+func TestEvaluateNoiseRecordings(t *testing.T) {
+	labels := map[string]fileLabels{
+		"noise_01.cptv": {Noise: true},
+		"noise_02.cptv": {Noise: true},
+	}
+	report, err := evaluate(CurrentConfig(), filepath.Join(GetBaseDir(), "motiontest", "noise"), labels)
+	require.NoError(t, err)
+
+	require.Len(t, report.Files, 2)
+	assert.Equal(t, "noise_01.cptv", report.Files[0].File)
+	assert.Equal(t, 0, report.Files[0].FalseTriggers)
+	// noise_02.cptv is detected in frames 1 to 48.
+	assert.Equal(t, 1, report.Files[1].FalseTriggers)
+	assert.InDelta(t, 48.0/9/60, report.Files[1].FalseTriggerMinutes, 0.001)
+	assert.Equal(t, 1, report.Overall.FalseTriggers)
+	assert.Equal(t, 0.0, *report.Overall.Precision)
+}
@@ -0,0 +1,297 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+
+	"github.com/TheCacophonyProject/thermal-recorder/thermalimage"
+)
+
+const (
+	// maxStreamFPS limits the frame rate of the MJPEG stream, so that
+	// 60Hz cameras don't load the CPU with JPEG encoding.
+	maxStreamFPS = 10
+	// frameWait is how long to wait for a frame before giving up.
+	frameWait = 5 * time.Second
+	// eventKeepAlive is how often a comment is sent to event stream
+	// clients when there are no events.
+	eventKeepAlive = 30 * time.Second
+	mjpegBoundary  = "thermal-frame"
+	jpegQuality    = 85
+)
+
+var errNoFrames = errors.New("no frames from the camera")
+
+// startHTTPServer serves the live view on addr in the background.
+func startHTTPServer(addr string, l *liveView) {
+	log.Printf("starting live view HTTP server on %s", addr)
+	go func() {
+		err := http.ListenAndServe(addr, newLiveViewHandler(l))
+		log.Printf("live view HTTP server stopped: %v", err)
+	}()
+}
+
+func newLiveViewHandler(l *liveView) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", serveIndex)
+	mux.HandleFunc("/status", l.serveStatus)
+	mux.HandleFunc("/events", l.serveEvents)
+	mux.HandleFunc("/frame.png", l.serveFrame)
+	mux.HandleFunc("/background.png", l.serveBackground)
+	mux.HandleFunc("/stream.mjpeg", l.serveStream)
+	return mux
+}
+
+func serveIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, indexPage)
+}
+
+func (l *liveView) serveStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(l.status())
+}
+
+// serveEvents sends motion, recording and camera events as
+// server-sent events.
+func (l *liveView) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	events, unsubscribe := l.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("encoding live view event: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// serveFrame serves the next frame from the camera as a PNG.
+func (l *liveView) serveFrame(w http.ResponseWriter, r *http.Request) {
+	cm, ok := requestColourMap(w, r)
+	if !ok {
+		return
+	}
+	frame, err := l.waitFrame(r.Context(), frameWait)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	servePNG(w, renderFrame(frame, cm))
+}
+
+// serveBackground serves the motion detector's background frame as a
+// PNG.
+func (l *liveView) serveBackground(w http.ResponseWriter, r *http.Request) {
+	cm, ok := requestColourMap(w, r)
+	if !ok {
+		return
+	}
+	background := l.background()
+	if background == nil {
+		http.Error(w, "reading from camera has not started yet", http.StatusServiceUnavailable)
+		return
+	}
+	servePNG(w, renderFrame(background, cm))
+}
+
+// serveStream serves frames from the camera as an MJPEG stream.
+func (l *liveView) serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	cm, ok := requestColourMap(w, r)
+	if !ok {
+		return
+	}
+	unwatch := l.watch()
+	defer unwatch()
+
+	w.Header().Set("Content-Type", "multipart/x-mixed-replace; boundary="+mjpegBoundary)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var buf bytes.Buffer
+	var lastSent time.Time
+	_, next := l.latestFrame()
+	for {
+		select {
+		case <-next:
+		case <-r.Context().Done():
+			return
+		}
+		var frame *cptvframe.Frame
+		frame, next = l.latestFrame()
+		if frame == nil || time.Since(lastSent) < time.Second/maxStreamFPS {
+			continue
+		}
+		lastSent = time.Now()
+
+		buf.Reset()
+		if err := jpeg.Encode(&buf, renderFrame(frame, cm), &jpeg.Options{Quality: jpegQuality}); err != nil {
+			log.Printf("encoding live view frame: %v", err)
+			return
+		}
+		if _, err := fmt.Fprintf(w, "--%s\r\nContent-Type: image/jpeg\r\nContent-Length: %d\r\n\r\n", mjpegBoundary, buf.Len()); err != nil {
+			return
+		}
+		if _, err := w.Write(append(buf.Bytes(), '\r', '\n')); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// waitFrame returns the next frame from the camera.
+func (l *liveView) waitFrame(ctx context.Context, timeout time.Duration) (*cptvframe.Frame, error) {
+	unwatch := l.watch()
+	defer unwatch()
+	_, next := l.latestFrame()
+	select {
+	case <-next:
+	case <-time.After(timeout):
+		return nil, errNoFrames
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	frame, _ := l.latestFrame()
+	return frame, nil
+}
+
+// requestColourMap returns the colour map chosen with the "colours"
+// query parameter, ironbow by default. It replies with an error if the
+// colour map isn't known.
+func requestColourMap(w http.ResponseWriter, r *http.Request) (*thermalimage.ColourMap, bool) {
+	name := r.URL.Query().Get("colours")
+	if name == "" {
+		name = "ironbow"
+	}
+	cm, ok := thermalimage.ColourMaps[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown colour map %q", name), http.StatusBadRequest)
+	}
+	return cm, ok
+}
+
+// renderFrame renders frame using the full colour map for the range
+// of pixel values in it.
+func renderFrame(frame *cptvframe.Frame, cm *thermalimage.ColourMap) image.Image {
+	return thermalimage.RGBA(frame, thermalimage.FrameRange(frame), cm)
+}
+
+func servePNG(w http.ResponseWriter, img image.Image) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(buf.Bytes())
+}
+
+const indexPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>thermal-recorder</title>
+<style>
+body { font-family: sans-serif; margin: 1em; }
+img { width: 480px; max-width: 100%; image-rendering: pixelated; background: #222; }
+pre { background: #eee; padding: 0.5em; overflow: auto; }
+#events { height: 12em; }
+</style>
+</head>
+<body>
+<h1>thermal-recorder</h1>
+<img src="stream.mjpeg" alt="live view">
+<img id="background" src="background.png" alt="background">
+<h2>Status</h2>
+<pre id="status"></pre>
+<h2>Events</h2>
+<pre id="events"></pre>
+<script>
+function updateStatus() {
+  fetch("status").then(r => r.json()).then(s => {
+    document.getElementById("status").textContent = JSON.stringify(s, null, 2);
+  });
+  document.getElementById("background").src = "background.png?t=" + Date.now();
+}
+updateStatus();
+setInterval(updateStatus, 5000);
+
+const events = document.getElementById("events");
+const source = new EventSource("events");
+["camera-connected", "camera-disconnected", "motion-started", "motion-ended",
+ "recording-started", "recording-ended"].forEach(type => {
+  source.addEventListener(type, e => {
+    events.textContent = e.data + "\n" + events.textContent;
+  });
+});
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,228 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/lepton3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TheCacophonyProject/thermal-recorder/headers"
+	"github.com/TheCacophonyProject/thermal-recorder/motion"
+	"github.com/TheCacophonyProject/thermal-recorder/recorder"
+)
+
+// liveViewTest runs the frames from a CPTV file through a motion
+// processor reporting to a liveView served by a test HTTP server.
+type liveViewTest struct {
+	conf      *Config
+	live      *liveView
+	server    *httptest.Server
+	camera    *headers.HeaderInfo
+	processor *motion.MotionProcessor
+	frames    []*cptvframe.Frame
+}
+
+func newLiveViewTest(t *testing.T) *liveViewTest {
+	outputDir, err := ioutil.TempDir("", "liveview")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(outputDir) })
+
+	conf := CurrentConfig()
+	conf.OutputDir = outputDir
+	header := fmt.Sprintf("%s: 160\n%s: 120\n%s: 9\n%s: flir\n%s: %s\n\n",
+		headers.XResolution, headers.YResolution, headers.FPS, headers.Brand, headers.Model, lepton3.Model)
+	camera, err := headers.ReadHeaderInfo(bufio.NewReader(strings.NewReader(header)))
+	require.NoError(t, err)
+
+	lt := &liveViewTest{
+		conf:   conf,
+		live:   newLiveView(conf),
+		camera: camera,
+		frames: NewCPTVPlaybackTester(conf).LoadAllCptvFrames("motiontest/animals/cat.cptv"),
+	}
+	require.True(t, len(lt.frames) > 50)
+	// As in Detect, give the frames a TimeOn so they aren't taken as
+	// being just after an FFC.
+	for _, frame := range lt.frames {
+		frame.Status.TimeOn = time.Minute
+	}
+	lt.server = httptest.NewServer(newLiveViewHandler(lt.live))
+	t.Cleanup(lt.server.Close)
+	return lt
+}
+
+func (lt *liveViewTest) connect(bucketLevel func() int64) {
+	lt.processor = motion.NewMotionProcessor(lepton3.ParseRawFrame, &lt.conf.Motion, &lt.conf.Tracking,
+		&lt.conf.Recorder, &lt.conf.Location, lt.live, new(recorder.NoWriteRecorder), lt.camera, nil, nil)
+	lt.live.connected(lt.camera, lt.processor, bucketLevel)
+}
+
+func (lt *liveViewTest) processFrames() {
+	for _, frame := range lt.frames {
+		lt.processor.ProcessFrame(frame)
+		lt.live.frameProcessed()
+	}
+}
+
+// processFramesUntil keeps processing frames, as a camera would, until
+// done is closed.
+func (lt *liveViewTest) processFramesUntil(done <-chan struct{}) {
+	for i := 0; ; i++ {
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Millisecond):
+		}
+		lt.processor.ProcessFrame(lt.frames[i%len(lt.frames)])
+		lt.live.frameProcessed()
+	}
+}
+
+func (lt *liveViewTest) get(t *testing.T, path string) *http.Response {
+	resp, err := http.Get(lt.server.URL + path)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func (lt *liveViewTest) status(t *testing.T) *liveStatus {
+	resp := lt.get(t, "/status")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	status := new(liveStatus)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(status))
+	return status
+}
+
+func TestLiveViewStatus(t *testing.T) {
+	lt := newLiveViewTest(t)
+
+	status := lt.status(t)
+	assert.Nil(t, status.Camera)
+	assert.Nil(t, status.ThrottleBucketFrames)
+	assert.True(t, status.Window.Always)
+	assert.True(t, status.Window.Active)
+	assert.Empty(t, status.Disk.Error)
+	assert.True(t, status.Disk.TotalMB > 0)
+	assert.Equal(t, lt.conf.MinDiskSpace, status.Disk.MinFreeMB)
+
+	lt.connect(func() int64 { return 42 })
+	lt.processFrames()
+	status = lt.status(t)
+	require.NotNil(t, status.Camera)
+	assert.Equal(t, lepton3.Model, status.Camera.Model)
+	assert.Equal(t, 160, status.Camera.ResX)
+	assert.Equal(t, uint64(len(lt.frames)), status.FramesRead)
+	assert.NotZero(t, status.TempThresh)
+	assert.Equal(t, 1, status.Recordings)
+	require.NotNil(t, status.ThrottleBucketFrames)
+	assert.Equal(t, int64(42), *status.ThrottleBucketFrames)
+
+	lt.live.disconnected()
+	status = lt.status(t)
+	assert.Nil(t, status.Camera)
+	assert.False(t, status.Recording)
+}
+
+func TestLiveViewEvents(t *testing.T) {
+	lt := newLiveViewTest(t)
+	resp := lt.get(t, "/events")
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	lt.connect(nil)
+	lt.processFrames()
+	lt.live.disconnected()
+
+	var types []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data: ") {
+			var event liveEvent
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+			types = append(types, event.Type)
+			if event.Type == eventCameraDisconnected {
+				break
+			}
+		}
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, []string{
+		eventCameraConnected,
+		eventMotionStarted,
+		eventRecordingStarted,
+		eventMotionEnded,
+		eventRecordingEnded,
+		eventCameraDisconnected,
+	}, types)
+}
+
+func TestLiveViewImages(t *testing.T) {
+	lt := newLiveViewTest(t)
+
+	resp := lt.get(t, "/background.png")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	lt.connect(nil)
+	done := make(chan struct{})
+	defer close(done)
+	go lt.processFramesUntil(done)
+
+	for _, path := range []string{"/frame.png", "/background.png", "/frame.png?colours=greyscale"} {
+		resp := lt.get(t, path)
+		require.Equal(t, http.StatusOK, resp.StatusCode, path)
+		assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+		img, err := png.Decode(resp.Body)
+		require.NoError(t, err, path)
+		assert.Equal(t, 160, img.Bounds().Dx())
+		assert.Equal(t, 120, img.Bounds().Dy())
+	}
+
+	resp = lt.get(t, "/frame.png?colours=rainbow")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = lt.get(t, "/stream.mjpeg")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "multipart/x-mixed-replace; boundary="+mjpegBoundary, resp.Header.Get("Content-Type"))
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "--"+mjpegBoundary+"\r\n", line)
+	line, err = reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "Content-Type: image/jpeg\r\n", line)
+}
+
+func TestLiveViewIndex(t *testing.T) {
+	lt := newLiveViewTest(t)
+	resp := lt.get(t, "/")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, http.StatusNotFound, lt.get(t, "/nothing").StatusCode)
+}
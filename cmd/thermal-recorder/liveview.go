@@ -0,0 +1,392 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/window"
+
+	"github.com/TheCacophonyProject/thermal-recorder/headers"
+	"github.com/TheCacophonyProject/thermal-recorder/motion"
+)
+
+// Live view event types.
+const (
+	eventCameraConnected    = "camera-connected"
+	eventCameraDisconnected = "camera-disconnected"
+	eventMotionStarted      = "motion-started"
+	eventMotionEnded        = "motion-ended"
+	eventRecordingStarted   = "recording-started"
+	eventRecordingEnded     = "recording-ended"
+)
+
+// liveEventBuffer is how many events can wait to be sent to a client.
+// Later events are dropped for that client until it catches up.
+const liveEventBuffer = 32
+
+// liveEvent is sent to live view clients when something happens.
+type liveEvent struct {
+	Type    string                 `json:"type"`
+	Time    time.Time              `json:"time"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// liveView keeps the state shown by the live view HTTP server. It is
+// the motion processor's RecordingListener and is updated by
+// handleConn after each frame, both from the frame processing
+// goroutine. The HTTP handlers read it from their own goroutines.
+type liveView struct {
+	mu sync.Mutex
+
+	window       window.Window
+	outputDir    string
+	minDiskSpace uint64
+
+	camera      *headers.HeaderInfo
+	processor   *motion.MotionProcessor
+	bucketLevel func() int64
+
+	framesRead      uint64
+	tempThresh      uint16
+	deltaCount      int
+	tracks          int
+	motion          bool
+	motionThisFrame bool
+	recording       bool
+	manualRecording bool
+	recordingStart  time.Time
+	recordings      int
+
+	// frame is the most recent frame. It is only kept up to date while
+	// there are watchers. nextFrame is closed when it is replaced.
+	watchers  int
+	frame     *cptvframe.Frame
+	nextFrame chan struct{}
+
+	subscribers map[chan liveEvent]struct{}
+}
+
+// live is updated by the camera connection and read by the live view
+// HTTP server.
+var live *liveView
+
+func newLiveView(conf *Config) *liveView {
+	l := &liveView{
+		nextFrame:   make(chan struct{}),
+		subscribers: make(map[chan liveEvent]struct{}),
+	}
+	l.setConfig(conf)
+	return l
+}
+
+// setConfig keeps the parts of conf shown in the status.
+func (l *liveView) setConfig(conf *Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.window = conf.Recorder.Window
+	l.outputDir = conf.OutputDir
+	l.minDiskSpace = conf.MinDiskSpace
+}
+
+// connected is called when a camera connects. bucketLevel is nil when
+// throttling is off.
+func (l *liveView) connected(camera *headers.HeaderInfo, processor *motion.MotionProcessor, bucketLevel func() int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.camera = camera
+	l.processor = processor
+	l.bucketLevel = bucketLevel
+	l.framesRead = 0
+	l.tempThresh = 0
+	l.deltaCount = 0
+	l.tracks = 0
+	l.motion = false
+	l.motionThisFrame = false
+	l.recording = false
+	l.publish(eventCameraConnected, map[string]interface{}{
+		"brand": camera.Brand(),
+		"model": camera.Model(),
+	})
+}
+
+// disconnected is called when the camera connection ends.
+func (l *liveView) disconnected() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.camera == nil {
+		return
+	}
+	l.endRecording()
+	l.camera = nil
+	l.processor = nil
+	l.bucketLevel = nil
+	l.motion = false
+	l.publish(eventCameraDisconnected, nil)
+}
+
+func (l *liveView) MotionDetected() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.motionThisFrame = true
+}
+
+// RecordingStarted is called when the motion processor starts a
+// recording. The recording can still be throttled.
+func (l *liveView) RecordingStarted() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.recording = true
+	l.recordingStart = time.Now()
+	if l.processor != nil {
+		l.tempThresh = l.processor.TempThresh()
+	}
+	l.recordings++
+	l.publish(eventRecordingStarted, map[string]interface{}{"tempThresh": l.tempThresh})
+}
+
+func (l *liveView) RecordingEnded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.endRecording()
+}
+
+func (l *liveView) endRecording() {
+	if !l.recording {
+		return
+	}
+	l.recording = false
+	l.manualRecording = false
+	l.publish(eventRecordingEnded, map[string]interface{}{
+		"secs": time.Since(l.recordingStart).Seconds(),
+	})
+}
+
+func (l *liveView) TracksUpdated(tracks []motion.Track) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tracks = len(tracks)
+}
+
+// frameProcessed is called after the motion processor has processed a
+// frame.
+func (l *liveView) frameProcessed() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.processor == nil {
+		return
+	}
+	l.framesRead++
+	l.tempThresh = l.processor.TempThresh()
+	l.deltaCount = l.processor.DeltaCount()
+	l.manualRecording = l.processor.ManualRecording()
+	if l.motionThisFrame != l.motion {
+		l.motion = l.motionThisFrame
+		if l.motion {
+			l.publish(eventMotionStarted, map[string]interface{}{"tempThresh": l.tempThresh})
+		} else {
+			l.publish(eventMotionEnded, nil)
+		}
+	}
+	l.motionThisFrame = false
+
+	if l.watchers > 0 {
+		_, l.frame = l.processor.GetRecentFrame()
+		close(l.nextFrame)
+		l.nextFrame = make(chan struct{})
+	}
+}
+
+// publish sends an event to the subscribers. l.mu must be held.
+func (l *liveView) publish(eventType string, details map[string]interface{}) {
+	event := liveEvent{Type: eventType, Time: time.Now(), Details: details}
+	for events := range l.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// subscribe returns a channel of events and a function to call when
+// they are no longer wanted.
+func (l *liveView) subscribe() (<-chan liveEvent, func()) {
+	events := make(chan liveEvent, liveEventBuffer)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.subscribers[events] = struct{}{}
+	return events, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.subscribers, events)
+	}
+}
+
+// watch asks for the most recent frame to be kept, returning a
+// function to call when it is no longer wanted.
+func (l *liveView) watch() func() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.watchers++
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.watchers--
+		if l.watchers == 0 {
+			l.frame = nil
+		}
+	}
+}
+
+// latestFrame returns the most recent frame kept while watching, which
+// may be nil, and a channel which is closed when there is a newer one.
+// The frame must not be changed.
+func (l *liveView) latestFrame() (*cptvframe.Frame, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.frame, l.nextFrame
+}
+
+// background returns a copy of the motion detector's background frame,
+// or nil if there is no camera connected.
+func (l *liveView) background() *cptvframe.Frame {
+	l.mu.Lock()
+	processor := l.processor
+	l.mu.Unlock()
+	if processor == nil {
+		return nil
+	}
+	_, background := processor.MaskAndBackground()
+	return background
+}
+
+// liveStatus is the status document served by the live view.
+type liveStatus struct {
+	Version         string        `json:"version"`
+	Camera          *cameraStatus `json:"camera"`
+	FramesRead      uint64        `json:"framesRead"`
+	TempThresh      uint16        `json:"tempThresh"`
+	DeltaCount      int           `json:"deltaCount"`
+	Motion          bool          `json:"motion"`
+	Tracks          int           `json:"tracks"`
+	Recording       bool          `json:"recording"`
+	ManualRecording bool          `json:"manualRecording"`
+	RecordingSecs   float64       `json:"recordingSecs,omitempty"`
+	Recordings      int           `json:"recordings"`
+	Paused          bool          `json:"paused"`
+	// ThrottleBucketFrames is the number of frames that can be recorded
+	// before recordings are throttled, or nil if throttling is off.
+	ThrottleBucketFrames *int64       `json:"throttleBucketFrames"`
+	Window               windowStatus `json:"window"`
+	// Profile is the name of the active recording profile, or "" if
+	// none is.
+	Profile string     `json:"profile,omitempty"`
+	Disk    diskStatus `json:"disk"`
+}
+
+type cameraStatus struct {
+	Brand    string `json:"brand"`
+	Model    string `json:"model"`
+	ResX     int    `json:"resX"`
+	ResY     int    `json:"resY"`
+	FPS      int    `json:"fps"`
+	Serial   int    `json:"serial"`
+	Firmware string `json:"firmware"`
+}
+
+type windowStatus struct {
+	Always    bool       `json:"always"`
+	Active    bool       `json:"active"`
+	NextStart *time.Time `json:"nextStart,omitempty"`
+	NextEnd   *time.Time `json:"nextEnd,omitempty"`
+}
+
+type diskStatus struct {
+	FreeMB    uint64 `json:"freeMB"`
+	TotalMB   uint64 `json:"totalMB"`
+	MinFreeMB uint64 `json:"minFreeMB"`
+	Error     string `json:"error,omitempty"`
+}
+
+// status returns the current status.
+func (l *liveView) status() *liveStatus {
+	l.mu.Lock()
+	s := &liveStatus{
+		Version:         version,
+		FramesRead:      l.framesRead,
+		TempThresh:      l.tempThresh,
+		DeltaCount:      l.deltaCount,
+		Motion:          l.motion,
+		Tracks:          l.tracks,
+		Recording:       l.recording,
+		ManualRecording: l.manualRecording,
+		Recordings:      l.recordings,
+		Disk:            diskStatus{MinFreeMB: l.minDiskSpace},
+	}
+	if l.recording {
+		s.RecordingSecs = time.Since(l.recordingStart).Seconds()
+	}
+	if l.camera != nil {
+		s.Camera = &cameraStatus{
+			Brand:    l.camera.Brand(),
+			Model:    l.camera.Model(),
+			ResX:     l.camera.ResX(),
+			ResY:     l.camera.ResY(),
+			FPS:      l.camera.FPS(),
+			Serial:   l.camera.CameraSerial(),
+			Firmware: l.camera.Firmware(),
+		}
+	}
+	bucketLevel := l.bucketLevel
+	processor := l.processor
+	w := l.window
+	outputDir := l.outputDir
+	l.mu.Unlock()
+
+	if bucketLevel != nil {
+		level := bucketLevel()
+		s.ThrottleBucketFrames = &level
+	}
+	s.Paused = control.isPaused()
+	s.Window = newWindowStatus(&w)
+	if processor != nil {
+		s.Profile = processor.Profile()
+	}
+	s.Disk.FreeMB, s.Disk.TotalMB, s.Disk.Error = diskSpace(outputDir)
+	return s
+}
+
+func newWindowStatus(w *window.Window) windowStatus {
+	if w.NoWindow {
+		return windowStatus{Always: true, Active: true}
+	}
+	start, end := w.NextStart(), w.NextEnd()
+	return windowStatus{Active: w.Active(), NextStart: &start, NextEnd: &end}
+}
+
+// diskSpace returns the free and total space in MB for dir, or an
+// error message.
+func diskSpace(dir string) (free, total uint64, errMsg string) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		return 0, 0, err.Error()
+	}
+	return fs.Bavail * uint64(fs.Bsize) / 1024 / 1024, fs.Blocks * uint64(fs.Bsize) / 1024 / 1024, ""
+}
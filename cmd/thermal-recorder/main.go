@@ -18,52 +18,57 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/TheCacophonyProject/event-reporter/eventclient"
-	goconfig "github.com/TheCacophonyProject/go-config"
 	"github.com/TheCacophonyProject/go-cptv/cptvframe"
 	"github.com/TheCacophonyProject/lepton3"
-	"github.com/TheCacophonyProject/window"
 	arg "github.com/alexflint/go-arg"
-	"github.com/google/go-cmp/cmp"
-	"github.com/google/go-cmp/cmp/cmpopts"
-	"github.com/rjeczalik/notify"
 	"periph.io/x/periph/host"
 
 	config "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/thermal-recorder/framesocket"
 	"github.com/TheCacophonyProject/thermal-recorder/headers"
 	"github.com/TheCacophonyProject/thermal-recorder/leptondController"
+	"github.com/TheCacophonyProject/thermal-recorder/metrics"
 	"github.com/TheCacophonyProject/thermal-recorder/motion"
 	"github.com/TheCacophonyProject/thermal-recorder/recorder"
+	"github.com/TheCacophonyProject/thermal-recorder/storage"
 	"github.com/TheCacophonyProject/thermal-recorder/throttle"
 )
 
 const (
-	cptvTempExt = "cptv.temp"
-	clearBuffer = "clear"
+	cptvTempExt       = "cptv.temp"
+	motionMetadataExt = ".motion.json"
+
+	// writeQueueBytes is the memory set aside for frames waiting to be
+	// written to each recording. Frames arriving when it's full are
+	// dropped.
+	writeQueueBytes = 32 * 1024 * 1024
 )
 
 var (
-	version    = "<not set>"
-	processor  *motion.MotionProcessor
-	headerInfo *headers.HeaderInfo = nil
-
-	frameLogIntervalFirstMin = 15
-	frameLogInterval         = 60 * 5
+	version   = "<not set>"
+	processor *motion.MotionProcessor
+	// snapshotRecorder records the snapshots started by newSnapshotRecording.
+	snapshotRecorder *CPTVFileRecorder
+	headerInfo       *headers.HeaderInfo = nil
 )
 
 type Args struct {
-	ConfigDir    string `arg:"-c,--config" help:"path to configuration directory"`
-	Timestamps   bool   `arg:"-t,--timestamps" help:"include timestamps in log output"`
-	TestCptvFile string `arg:"-f, --testfile" help:"Run a CPTV file through to see what the results are"`
-	Verbose      bool   `arg:"-v, --verbose" help:"Make logging more verbose"`
+	ConfigDir    string       `arg:"-c,--config" help:"path to configuration directory"`
+	Timestamps   bool         `arg:"-t,--timestamps" help:"include timestamps in log output"`
+	TestCptvFile string       `arg:"-f, --testfile" help:"Run a CPTV file through to see what the results are"`
+	Verbose      bool         `arg:"-v, --verbose" help:"Make logging more verbose"`
+	CheckConfig  bool         `arg:"--check-config" help:"check the configuration for problems and exit"`
+	Camera       string       `arg:"--camera" help:"camera model to check the configuration against (lepton3, lepton3.5 or boson)"`
+	Evaluate     *EvaluateCmd `arg:"subcommand:evaluate" help:"score motion detection against labelled CPTV files"`
+	Sweep        *SweepCmd    `arg:"subcommand:sweep" help:"rank motion settings by their score against labelled CPTV files"`
 }
 
 func (Args) Version() string {
@@ -73,6 +78,7 @@ func (Args) Version() string {
 func procArgs() Args {
 	var args Args
 	args.ConfigDir = config.DefaultConfigDir
+	args.Camera = lepton3.Model35
 	arg.MustParse(&args)
 	return args
 }
@@ -84,57 +90,6 @@ func main() {
 	}
 }
 
-// checkConfigChanges will compare the config from when first loaded to a new config each time
-// the config file is modified.
-// If there is a difference then the program will exit and systemd will restart the service, causing
-// the new config to be loaded.
-func checkConfigChanges(conf *Config, configDir string) error {
-	configFilePath := filepath.Join(configDir, config.ConfigFileName)
-	fsEvents := make(chan notify.EventInfo, 1)
-	if err := notify.Watch(configFilePath, fsEvents, notify.InCloseWrite, notify.InMovedTo); err != nil {
-		return err
-	}
-	defer notify.Stop(fsEvents)
-
-	for {
-		<-fsEvents
-		newConfig, err := ParseConfig(configDir)
-		if err != nil {
-			log.Println("error reloading config:", err)
-			continue
-		}
-
-		// Need to set Window.Now in Recorder.Config to nil to compare them.
-		isRecorderConfigEqual := func(x, y recorder.RecorderConfig) bool {
-			x.Window.Now = nil
-			y.Window.Now = nil
-			return cmp.Equal(x, y, cmp.AllowUnexported(window.Window{}))
-		}
-
-		// Checking the diff of the current and new config.
-		diff := cmp.Diff(
-			conf,
-			newConfig,
-			cmp.AllowUnexported(
-				config.Location{},
-				recorder.RecorderConfig{},
-				goconfig.ThermalMotion{},
-				goconfig.ThermalThrottler{},
-				window.Window{},
-			),
-			cmpopts.IgnoreFields(Config{}, "Motion"), // Ignore the motion config as this is modified with config.LoadMotionConfig
-			cmp.Comparer(isRecorderConfigEqual))      // Custom compare function for recorder config ignoring Window.Now
-
-		if diff != "" {
-			log.Println("Config changed:", diff, "\nExiting to allow systemctl to restart service.")
-			os.Exit(0)
-		} else {
-			log.Println("No relevant changes detected in config file.")
-		}
-
-	}
-}
-
 func runMain() error {
 	args := procArgs()
 
@@ -142,27 +97,49 @@ func runMain() error {
 		log.SetFlags(0) // Removes default timestamp flag
 	}
 
+	if args.CheckConfig {
+		return checkConfig(args.ConfigDir, args.Camera)
+	}
+
 	log.Printf("running version: %s", version)
 	conf, err := ParseConfig(args.ConfigDir)
 	if err != nil {
 		return err
 	}
 
-	// Check for config changes.
-	go checkConfigChanges(conf, args.ConfigDir)
-
 	conf.Verbose = args.Verbose
 
+	if args.Evaluate != nil {
+		return runEvaluate(conf, args.Evaluate, os.Stdout)
+	}
+	if args.Sweep != nil {
+		return runSweep(conf, args.Sweep, os.Stdout)
+	}
+
+	// Check for config changes.
+	go checkConfigChanges(args.ConfigDir, args.Verbose)
+
 	if args.TestCptvFile != "" {
 		results := NewCPTVPlaybackTester(conf).Detect(args.TestCptvFile)
 		logConfig(conf)
 
 		log.Printf("Detected: %-16s Recorded: %-16s Motion frames: %d/%d", results.motionDetectedFrames, results.recordedFrames, results.motionDetectedCount, results.frameCount)
+		if conf.Tracking.Enabled {
+			log.Printf("Tracks: %d", len(results.trackIDs))
+		}
 		return nil
 	}
 
+	live = newLiveView(conf)
+	if conf.HTTP.Address != "" {
+		startHTTPServer(conf.HTTP.Address, live)
+	}
+	if err := metrics.Start(&conf.Metrics); err != nil {
+		return err
+	}
+
 	log.Println("starting d-bus service")
-	err = startService(conf.OutputDir)
+	err = startService(conf)
 	if err != nil {
 		return err
 	}
@@ -172,12 +149,18 @@ func runMain() error {
 		return err
 	}
 
-	log.Println("deleting temp files")
-	if err := deleteTempFiles(conf.OutputDir); err != nil {
+	log.Println("recovering unfinished recordings")
+	if err := recoverRecordings(conf.OutputDir); err != nil {
 		return err
 	}
 
-	go snapshotRecordingTriggers(conf.Recorder.Window)
+	storageManager = storage.New(conf.OutputDir, conf.MinDiskSpace, &conf.Storage, reportDeletion)
+	go storageManager.Run(storageCheckInterval)
+
+	if err := setSnapshotSchedule(conf); err != nil {
+		return err
+	}
+	go runSnapshotSchedule()
 
 	for {
 		// Set up listener for frames sent by leptond.
@@ -213,65 +196,140 @@ func handleConn(conn net.Conn, conf *Config) error {
 	}
 
 	log.Printf("connection from %s %s (%dx%d@%dfps)", headerInfo.Brand(), headerInfo.Model(), headerInfo.ResX(), headerInfo.ResY(), headerInfo.FPS())
-	conf.LoadMotionConfig(headerInfo.Model())
+	frames, err := framesocket.NewReader(reader, headerInfo)
+	if err != nil {
+		return err
+	}
+	log.Printf("frame protocol version: %d", frames.Version())
+	if err := loadMotionConfig(conf, headerInfo); err != nil {
+		return err
+	}
 	logConfig(conf)
+	live.setConfig(conf)
 
 	parseFrame := frameParser(headerInfo.Brand(), headerInfo.Model())
 	if parseFrame == nil {
 		return fmt.Errorf("unable to handle frames for %s %s", headerInfo.Brand(), headerInfo.Model())
 	}
 
-	cptvRecorder := NewCPTVFileRecorder(conf, headerInfo, headerInfo.Brand(), headerInfo.Model(), headerInfo.CameraSerial(), headerInfo.Firmware())
+	cptvRecorder := NewCPTVFileRecorder(conf, storageManager, headerInfo, headerInfo.Brand(), headerInfo.Model(), headerInfo.CameraSerial(), headerInfo.Firmware())
 	defer cptvRecorder.Stop()
-	var recorder recorder.Recorder = cptvRecorder
+	var motionRecorder recorder.Recorder = &meteredRecorder{recorder: cptvRecorder}
 
 	if conf.Throttler.Activate {
 		minRecordingLength := conf.Recorder.MinSecs + conf.Recorder.PreviewSecs
-		recorder = throttle.NewThrottledRecorder(cptvRecorder, &conf.Throttler, minRecordingLength, new(throttle.ThrottledEventRecorder), headerInfo)
+		listener := throttleListener{new(throttle.ThrottledEventRecorder)}
+		throttled := throttle.NewThrottledRecorder(motionRecorder, &conf.Throttler, minRecordingLength, listener, headerInfo)
+		cptvRecorder.SetBucketLevelFunc(throttled.BucketLevel)
+		motionRecorder = throttled
 	}
+	asyncRecorder := newAsyncRecorder(motionRecorder, headerInfo, writeQueueFrames(headerInfo))
+	defer asyncRecorder.Close()
 
 	// Constant Recorder
 	var constantRecorder *CPTVFileRecorder
+	var asyncConstantRecorder *recorder.AsyncRecorder
 	if conf.Recorder.ConstantRecorder {
-		constantRecorder = NewCPTVFileRecorder(conf, headerInfo, headerInfo.Brand(), headerInfo.Model(), headerInfo.CameraSerial(), headerInfo.Firmware())
+		constantRecorder = NewCPTVFileRecorder(conf, storageManager, headerInfo, headerInfo.Brand(), headerInfo.Model(), headerInfo.CameraSerial(), headerInfo.Firmware())
 		constantRecorder.SetAsConstantRecorder()
+		asyncConstantRecorder = newAsyncRecorder(constantRecorder, headerInfo, writeQueueFrames(headerInfo))
+		defer asyncConstantRecorder.Close()
 	}
 
+	mu.Lock()
+	snapshotRecorder = NewCPTVFileRecorder(conf, storageManager, headerInfo, headerInfo.Brand(), headerInfo.Model(), headerInfo.CameraSerial(), headerInfo.Firmware())
+	mu.Unlock()
+	asyncSnapshotRecorder := newAsyncRecorder(snapshotRecorder, headerInfo, snapshotQueueFrames(conf, headerInfo))
+	defer asyncSnapshotRecorder.Close()
+
+	recorders := &connRecorders{
+		camera:        headerInfo,
+		cptv:          cptvRecorder,
+		async:         asyncRecorder,
+		constant:      constantRecorder,
+		asyncConstant: asyncConstantRecorder,
+		snapshot:      snapshotRecorder,
+		asyncSnapshot: asyncSnapshotRecorder,
+	}
+	if throttled, ok := motionRecorder.(*throttle.ThrottledRecorder); ok {
+		recorders.throttled = throttled
+	}
+
+	listener := &motionListener{RecordingListener: live}
 	processor = motion.NewMotionProcessor(
 		parseFrame,
 		&conf.Motion,
+		&conf.Tracking,
 		&conf.Recorder,
 		&conf.Location,
-		nil,
-		recorder,
+		listener,
+		asyncRecorder,
 		headerInfo,
-		constantRecorder,
-		NewCPTVFileRecorder(conf, headerInfo, headerInfo.Brand(), headerInfo.Model(), headerInfo.CameraSerial(), headerInfo.Firmware()),
+		asyncConstantRecorder,
+		asyncSnapshotRecorder,
 	)
 
+	if mask := loadMask(conf, headerInfo); mask != nil {
+		processor.SetMask(mask)
+	}
+	cptvRecorder.SetProfileFunc(processor.ActiveProfile)
+	snapshotRecorder.SetProfileFunc(processor.ActiveProfile)
+	if constantRecorder != nil {
+		constantRecorder.SetProfileFunc(processor.ActiveProfile)
+	}
+
+	var bucketLevel func() int64
+	if recorders.throttled != nil {
+		bucketLevel = recorders.throttled.BucketLevel
+	}
+	live.connected(headerInfo, processor, bucketLevel)
+	defer live.disconnected()
+	control.connected(processor, cptvRecorder)
+	defer control.disconnected()
+
 	log.Print("reading frames")
 
-	frameLogIntervalFirstMin *= headerInfo.FPS()
-	frameLogInterval *= headerInfo.FPS()
+	frameLogIntervalFirstMin := 15 * headerInfo.FPS()
+	frameLogInterval := 60 * 5 * headerInfo.FPS()
 	rawFrame := make([]byte, headerInfo.FrameSize())
+	var lastSeq uint64
+	var framesDroppedCounted uint64
 	for {
-		_, err := io.ReadFull(reader, rawFrame[:5])
+		select {
+		case newConf := <-configUpdates:
+			if err := recorders.applyConfig(conf, newConf); err != nil {
+				return err
+			}
+		case req := <-control.requests:
+			req.result <- req.fn(recorders)
+		default:
+		}
+
+		msg, err := frames.ReadMessage(rawFrame)
 		if err != nil {
 			return err
 		}
-		message := string(rawFrame[:5])
-		if message == clearBuffer {
-			log.Print("clearing motion buffer")
+		switch msg.Type {
+		case framesocket.Clear, framesocket.CameraRestarted:
+			log.Printf("%s received, clearing motion buffer", msg.Type)
+			if msg.Type == framesocket.CameraRestarted {
+				cameraRestarts.Inc()
+			}
 			processor.Reset(headerInfo)
 			continue
+		case framesocket.FFCStarted:
+			log.Print("camera FFC started")
+			ffcs.Inc()
+			continue
 		}
 
-		_, err = io.ReadFull(reader, rawFrame[5:])
-		if err != nil {
-			return err
+		if lastSeq != 0 && msg.Seq > lastSeq+1 {
+			log.Printf("%d frames missed", msg.Seq-lastSeq-1)
+			framesMissed.Add(msg.Seq - lastSeq - 1)
 		}
-		message = string(rawFrame[:5])
+		lastSeq = msg.Seq
 		totalFrames++
+		framesReceived.Inc()
 
 		if totalFrames%frameLogIntervalFirstMin == 0 &&
 			totalFrames <= 60*headerInfo.FPS() || totalFrames%frameLogInterval == 0 {
@@ -279,7 +337,14 @@ func handleConn(conn net.Conn, conf *Config) error {
 		}
 
 		err = processor.Process(rawFrame)
+		if err == nil {
+			live.frameProcessed()
+			listener.frameProcessed()
+			tempThreshGauge.Set(float64(processor.TempThresh()))
+		}
+		updateWriteMetrics(asyncRecorder.Stats(), &framesDroppedCounted)
 		if _, isBadFrame := err.(*lepton3.BadFrameErr); isBadFrame {
+			badFrames.Inc()
 			event := eventclient.Event{
 				Timestamp: time.Now(),
 				Type:      "bad-thermal-frame",
@@ -292,6 +357,89 @@ func handleConn(conn net.Conn, conf *Config) error {
 	}
 }
 
+// loadMotionConfig loads the motion config for camera. If it can't be
+// used the camera's default motion config is tried instead, and an
+// error is returned if that can't be used either.
+func loadMotionConfig(conf *Config, camera *headers.HeaderInfo) error {
+	err := conf.LoadMotionConfig(camera.Model())
+	if err == nil {
+		err = conf.ValidateMotion(camera)
+	}
+	if err == nil {
+		return nil
+	}
+	log.Printf("invalid motion config, trying the defaults for %s: %v", camera.Model(), err)
+	conf.Motion = config.DefaultThermalMotion(camera.Model())
+	if err := conf.ValidateMotion(camera); err != nil {
+		return fmt.Errorf("default motion config can't be used either: %v", err)
+	}
+	log.Printf("using the default motion config for %s", camera.Model())
+	return nil
+}
+
+// loadMask returns the motion detection mask set up in the config, or
+// nil if there isn't one or it can't be used.
+func loadMask(conf *Config, camera cptvframe.CameraSpec) *motion.Mask {
+	mask, err := motion.NewMask(&conf.Mask, camera)
+	if err != nil {
+		log.Printf("not using motion mask: %v", err)
+		return nil
+	}
+	if count := mask.Count(); count < camera.ResX()*camera.ResY() {
+		log.Printf("motion mask includes %d of %d pixels", count, camera.ResX()*camera.ResY())
+		return mask
+	}
+	return nil
+}
+
+// setMotionMask saves b, a byte per pixel, as the bitmap motion mask
+// and passes the new mask to the motion processor.
+func setMotionMask(conf *Config, b []byte) error {
+	if processor == nil || headerInfo == nil {
+		return errors.New("reading from camera has not started yet")
+	}
+	if conf.Mask.Bitmap == "" {
+		return errors.New("no motion mask bitmap file is configured")
+	}
+	bitmap, err := motion.MaskFromBytes(b, headerInfo)
+	if err != nil {
+		return err
+	}
+	if err := bitmap.WriteBitmap(conf.Mask.Bitmap); err != nil {
+		return err
+	}
+	mask, err := motion.NewMask(&conf.Mask, headerInfo)
+	if err != nil {
+		return err
+	}
+	log.Printf("motion mask updated, includes %d of %d pixels", mask.Count(), headerInfo.ResX()*headerInfo.ResY())
+	processor.SetMask(mask)
+	return nil
+}
+
+// writeQueueFrames returns how many frames can wait to be written to
+// a recording, limited by writeQueueBytes.
+func writeQueueFrames(camera cptvframe.CameraSpec) int {
+	frameBytes := camera.ResX() * camera.ResY() * 2
+	return writeQueueBytes / frameBytes
+}
+
+// snapshotQueueFrames returns how many frames can wait to be written
+// to a snapshot recording. It is enough to queue a whole snapshot
+// unless that would use more than writeQueueBytes.
+func snapshotQueueFrames(conf *Config, camera cptvframe.CameraSpec) int {
+	frames := conf.Snapshots.Frames
+	if limit := writeQueueFrames(camera); frames > limit {
+		return limit
+	}
+	return frames
+}
+
+func newAsyncRecorder(r recorder.Recorder, camera cptvframe.CameraSpec, queueLen int) *recorder.AsyncRecorder {
+	log.Printf("recording write queue: %d frames", queueLen)
+	return recorder.NewAsyncRecorder(r, camera, queueLen)
+}
+
 func frameParser(brand, model string) func([]byte, *cptvframe.Frame, int) error {
 	if brand != "flir" {
 		return nil
@@ -312,9 +460,23 @@ func logConfig(conf *Config) {
 	log.Printf("recording limits: %ds to %ds", conf.Recorder.MinSecs, conf.Recorder.MaxSecs)
 	log.Printf("preview seconds: %d", conf.Recorder.PreviewSecs)
 	log.Printf("minimum disk space: %d", conf.MinDiskSpace)
+	log.Printf("storage: %+v", conf.Storage)
+	log.Printf("sync: %+v", conf.Sync)
+	log.Printf("snapshots: %+v", conf.Snapshots)
 	log.Printf("motion: %+v", conf.Motion)
+	log.Printf("tracking: %+v", conf.Tracking)
+	log.Printf("motion mask: %+v", conf.Mask)
 	log.Printf("throttler: %+v", conf.Throttler)
 	log.Printf("location latitude: %v", conf.Location.Latitude)
 	log.Printf("location longitude: %v", conf.Location.Longitude)
 	log.Printf("recording window: %s", conf.Recorder.Window)
+	for _, p := range conf.Recorder.Profiles {
+		log.Printf("profile %s: %s", p.Name, p.Window)
+	}
+	if conf.HTTP.Address != "" {
+		log.Printf("live view HTTP address: %s", conf.HTTP.Address)
+	}
+	if conf.Metrics.Address != "" || conf.Metrics.File != "" {
+		log.Printf("metrics: %+v", conf.Metrics)
+	}
 }
@@ -0,0 +1,135 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+
+	"github.com/TheCacophonyProject/thermal-recorder/metrics"
+	"github.com/TheCacophonyProject/thermal-recorder/motion"
+	"github.com/TheCacophonyProject/thermal-recorder/recorder"
+	"github.com/TheCacophonyProject/thermal-recorder/throttle"
+)
+
+var (
+	framesReceived      = metrics.NewCounter("thermal_recorder_frames_total", "Frames received from the camera.")
+	framesMissed        = metrics.NewCounter("thermal_recorder_frames_missed_total", "Frames missing from the sequence sent by the camera.")
+	badFrames           = metrics.NewCounter("thermal_recorder_bad_frames_total", "Bad frames, each causing the camera to be restarted.")
+	cameraRestarts      = metrics.NewCounter("thermal_recorder_camera_restarts_total", "Camera restarts reported by leptond.")
+	ffcs                = metrics.NewCounter("thermal_recorder_ffc_total", "Flat field corrections reported by leptond.")
+	motionFrames        = metrics.NewCounter("thermal_recorder_motion_frames_total", "Frames in which motion was detected.")
+	motionDetections    = metrics.NewCounter("thermal_recorder_motion_detections_total", "Periods of consecutive frames with motion.")
+	recordingsStarted   = metrics.NewCounter("thermal_recorder_recordings_started_total", "Motion recordings started.")
+	recordingsThrottled = metrics.NewCounter("thermal_recorder_recordings_throttled_total", "Motion recordings cut short by the throttler.")
+	recordingsFailed    = metrics.NewCounter("thermal_recorder_recordings_failed_total", "Motion recordings which failed to start or to be finished.")
+	bytesWritten        = metrics.NewCounter("thermal_recorder_bytes_written_total", "Bytes of CPTV recordings written.")
+	recordingsDeleted   = metrics.NewCounter("thermal_recorder_recordings_deleted_total", "Recordings deleted to keep within the storage limits.")
+	framesDropped       = metrics.NewCounter("thermal_recorder_frames_dropped_total", "Frames dropped from motion recordings because the write backlog was full.")
+	writeBacklog        = metrics.NewGauge("thermal_recorder_write_backlog_frames", "Frames waiting to be written to a motion recording.")
+	tempThreshGauge     = metrics.NewGauge("thermal_recorder_temp_thresh", "Temperature threshold used for motion detection in the latest frame.")
+	frameWriteTime      = metrics.NewHistogram("thermal_recorder_frame_write_seconds", "Time taken to write each frame to a motion recording.", metrics.LatencyBuckets)
+	syncTime            = metrics.NewHistogram("thermal_recorder_sync_seconds", "Time taken to sync recordings being written to storage.", metrics.LatencyBuckets)
+)
+
+// meteredRecorder passes recordings on to another recorder, counting
+// them and timing each frame written for the metrics.
+type meteredRecorder struct {
+	recorder recorder.Recorder
+}
+
+func (mr *meteredRecorder) CheckCanRecord() error {
+	return mr.recorder.CheckCanRecord()
+}
+
+func (mr *meteredRecorder) StartRecording(background *cptvframe.Frame, tempThresh uint16) error {
+	err := mr.recorder.StartRecording(background, tempThresh)
+	if err != nil {
+		recordingsFailed.Inc()
+	} else {
+		recordingsStarted.Inc()
+	}
+	return err
+}
+
+func (mr *meteredRecorder) StopRecording() error {
+	err := mr.recorder.StopRecording()
+	if err != nil {
+		recordingsFailed.Inc()
+	}
+	return err
+}
+
+func (mr *meteredRecorder) WriteFrame(frame *cptvframe.Frame) error {
+	defer frameWriteTime.ObserveSince(time.Now())
+	return mr.recorder.WriteFrame(frame)
+}
+
+func (mr *meteredRecorder) WriteFrameWithMetadata(frame *cptvframe.Frame, meta *recorder.FrameMetadata) error {
+	metaRecorder, ok := mr.recorder.(recorder.MetadataRecorder)
+	if !ok {
+		return mr.WriteFrame(frame)
+	}
+	defer frameWriteTime.ObserveSince(time.Now())
+	return metaRecorder.WriteFrameWithMetadata(frame, meta)
+}
+
+// throttleListener counts throttled recordings before passing the
+// event on.
+type throttleListener struct {
+	throttle.ThrottledEventListener
+}
+
+func (l throttleListener) WhenThrottled() {
+	recordingsThrottled.Inc()
+	l.ThrottledEventListener.WhenThrottled()
+}
+
+// motionListener counts frames with motion and periods of motion
+// before passing the events on. It is used from the frame processing
+// goroutine.
+type motionListener struct {
+	motion.RecordingListener
+	motion          bool
+	motionThisFrame bool
+}
+
+func (l *motionListener) MotionDetected() {
+	motionFrames.Inc()
+	l.motionThisFrame = true
+	l.RecordingListener.MotionDetected()
+}
+
+// frameProcessed is called after the motion processor has processed a
+// frame.
+func (l *motionListener) frameProcessed() {
+	if l.motionThisFrame && !l.motion {
+		motionDetections.Inc()
+	}
+	l.motion = l.motionThisFrame
+	l.motionThisFrame = false
+}
+
+// updateWriteMetrics updates the write backlog metrics from the stats
+// of the motion recording's AsyncRecorder. dropped is the number of
+// dropped frames already counted.
+func updateWriteMetrics(stats recorder.AsyncStats, dropped *uint64) {
+	writeBacklog.Set(float64(stats.Backlog))
+	framesDropped.Add(stats.Dropped - *dropped)
+	*dropped = stats.Dropped
+}
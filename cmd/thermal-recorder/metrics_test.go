@@ -0,0 +1,122 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TheCacophonyProject/thermal-recorder/metrics"
+	"github.com/TheCacophonyProject/thermal-recorder/motion"
+	"github.com/TheCacophonyProject/thermal-recorder/recorder"
+)
+
+// failingRecorder fails to start and stop recordings.
+type failingRecorder struct {
+	recorder.NoWriteRecorder
+}
+
+func (*failingRecorder) StartRecording(*cptvframe.Frame, uint16) error { return errors.New("no") }
+func (*failingRecorder) StopRecording() error                          { return errors.New("no") }
+
+type countingThrottleListener struct {
+	count int
+}
+
+func (l *countingThrottleListener) WhenThrottled() {
+	l.count++
+}
+
+type countingMotionListener struct {
+	count int
+}
+
+func (l *countingMotionListener) MotionDetected()            { l.count++ }
+func (*countingMotionListener) RecordingStarted()            {}
+func (*countingMotionListener) RecordingEnded()              {}
+func (*countingMotionListener) TracksUpdated([]motion.Track) {}
+
+func TestMeteredRecorder(t *testing.T) {
+	started, failed := recordingsStarted.Value(), recordingsFailed.Value()
+	frame := cptvframe.NewFrame(new(TestCamera))
+
+	mr := &meteredRecorder{recorder: new(recorder.NoWriteRecorder)}
+	require.NoError(t, mr.StartRecording(nil, 0))
+	require.NoError(t, mr.WriteFrame(frame))
+	require.NoError(t, mr.WriteFrameWithMetadata(frame, new(recorder.FrameMetadata)))
+	require.NoError(t, mr.StopRecording())
+	assert.Equal(t, started+1, recordingsStarted.Value())
+	assert.Equal(t, failed, recordingsFailed.Value())
+
+	mr = &meteredRecorder{recorder: new(failingRecorder)}
+	assert.Error(t, mr.StartRecording(nil, 0))
+	assert.Error(t, mr.StopRecording())
+	assert.Equal(t, started+1, recordingsStarted.Value())
+	assert.Equal(t, failed+2, recordingsFailed.Value())
+}
+
+func TestThrottleListener(t *testing.T) {
+	throttled := recordingsThrottled.Value()
+	counting := new(countingThrottleListener)
+	throttleListener{counting}.WhenThrottled()
+	assert.Equal(t, 1, counting.count)
+	assert.Equal(t, throttled+1, recordingsThrottled.Value())
+}
+
+func TestMotionListener(t *testing.T) {
+	frames, detections := motionFrames.Value(), motionDetections.Value()
+	counting := new(countingMotionListener)
+	l := &motionListener{RecordingListener: counting}
+	for _, motion := range []bool{true, true, false, true, false} {
+		if motion {
+			l.MotionDetected()
+		}
+		l.frameProcessed()
+	}
+	assert.Equal(t, 3, counting.count)
+	assert.Equal(t, frames+3, motionFrames.Value())
+	assert.Equal(t, detections+2, motionDetections.Value())
+}
+
+func TestUpdateWriteMetrics(t *testing.T) {
+	before := framesDropped.Value()
+	var counted uint64
+	updateWriteMetrics(recorder.AsyncStats{Backlog: 5, Dropped: 3}, &counted)
+	updateWriteMetrics(recorder.AsyncStats{Backlog: 2, Dropped: 4}, &counted)
+	assert.Equal(t, float64(2), writeBacklog.Value())
+	assert.Equal(t, before+4, framesDropped.Value())
+	assert.Equal(t, uint64(4), counted)
+}
+
+func TestMetricsExported(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, metrics.Default.WriteText(&buf))
+	for _, name := range []string{
+		"thermal_recorder_frames_total",
+		"thermal_recorder_bad_frames_total",
+		"thermal_recorder_recordings_throttled_total",
+		"thermal_recorder_temp_thresh",
+		"thermal_recorder_frame_write_seconds_bucket",
+	} {
+		assert.Contains(t, buf.String(), "\n"+name)
+	}
+}
@@ -0,0 +1,95 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// Reasons for a recording being made.
+const (
+	triggerMotion   = "motion"
+	triggerSnapshot = "snapshot"
+	triggerConstant = "constant"
+	triggerTest     = "test"
+	triggerManual   = "manual"
+)
+
+const recordingMetadataExt = ".json"
+
+// recordingMetadata is written to a JSON file next to every finished
+// recording so that recordings can be indexed without parsing the
+// CPTV file.
+type recordingMetadata struct {
+	StartTime       time.Time         `json:"startTime"`
+	EndTime         time.Time         `json:"endTime"`
+	Frames          int               `json:"frames"`
+	PreviewFrames   int               `json:"previewFrames"`
+	Trigger         string            `json:"trigger"`
+	Profile         string            `json:"profile,omitempty"`
+	ThrottleBucket  *int64            `json:"throttleBucketFrames,omitempty"`
+	Brand           string            `json:"brand"`
+	Model           string            `json:"model"`
+	CameraSerial    int               `json:"cameraSerial"`
+	Firmware        string            `json:"firmware"`
+	DeviceID        int               `json:"deviceId,omitempty"`
+	DeviceName      string            `json:"deviceName"`
+	Location        *locationMetadata `json:"location,omitempty"`
+	RecorderVersion string            `json:"recorderVersion"`
+	// CameraState is the camera's status and the state of its
+	// controls when the recording started, as given by leptond.
+	CameraState map[string]interface{} `json:"cameraState,omitempty"`
+	// Recovered is set for recordings recovered after thermal-recorder
+	// stopped while writing them. Metadata which hadn't been written
+	// yet is filled in from the CPTV file, leaving the trigger empty
+	// unless it was a constant recording.
+	Recovered bool `json:"recovered,omitempty"`
+}
+
+type locationMetadata struct {
+	Latitude  float32   `json:"latitude"`
+	Longitude float32   `json:"longitude"`
+	Altitude  float32   `json:"altitude"`
+	Accuracy  float32   `json:"accuracy"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// recordingMetadataName returns the name of the metadata file for a
+// recording.
+func recordingMetadataName(recordingName string) string {
+	return strings.TrimSuffix(recordingName, ".cptv") + recordingMetadataExt
+}
+
+// writeJSONFile writes v to name as JSON. The file is written under a
+// temporary name first so a complete file is only ever seen under the
+// final name.
+func writeJSONFile(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tempName := name + ".temp"
+	if err := ioutil.WriteFile(tempName, data, 0644); err != nil {
+		os.Remove(tempName)
+		return err
+	}
+	return os.Rename(tempName, name)
+}
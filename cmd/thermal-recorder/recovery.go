@@ -0,0 +1,323 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cptv "github.com/TheCacophonyProject/go-cptv"
+
+	"github.com/TheCacophonyProject/thermal-recorder/storage"
+)
+
+// The CPTV writer writes frames uncompressed to a file with this added
+// to the recording's name, and only compresses them into the
+// recording when it is closed.
+const rawTempExt = ".tmp"
+
+// recoveringExt is the extension of a recording while it's being
+// recovered.
+const recoveringExt = ".recovering"
+
+// errNoCompleteFrames is returned when a recording being recovered has
+// no complete frames.
+var errNoCompleteFrames = errors.New("no complete frames")
+
+// recoverRecordings finishes the recordings in dir and its constant
+// recordings directory which were being written when thermal-recorder
+// last stopped, for example because of a power cut. Recordings which
+// can't be read are deleted.
+func recoverRecordings(dir string) error {
+	for _, d := range []string{dir, filepath.Join(dir, storage.ConstantDir)} {
+		if err := deleteTempFiles(d); err != nil {
+			return err
+		}
+		tempNames, err := findTempRecordings(d)
+		if err != nil {
+			return err
+		}
+		trigger := ""
+		if d != dir {
+			trigger = triggerConstant
+		}
+		for _, tempName := range tempNames {
+			finalName, frames, err := recoverRecording(tempName, trigger)
+			switch {
+			case err == nil:
+				log.Printf("recovered recording %s with %d frames", finalName, frames)
+			case finalName != "":
+				log.Printf("failed to recover recording %s: %v", tempName, err)
+			default:
+				log.Printf("discarding unreadable recording %s: %v", tempName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// findTempRecordings returns the temporary names of the recordings in
+// dir which weren't finished.
+func findTempRecordings(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*."+cptvTempExt))
+	if err != nil {
+		return nil, err
+	}
+	rawMatches, err := filepath.Glob(filepath.Join(dir, "*."+cptvTempExt+rawTempExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, rawName := range rawMatches {
+		tempName := strings.TrimSuffix(rawName, rawTempExt)
+		if _, err := os.Stat(tempName); os.IsNotExist(err) {
+			matches = append(matches, tempName)
+		}
+	}
+	return matches, nil
+}
+
+// recoverRecording saves the header and complete frames of an
+// unfinished recording as a finished recording with metadata marking
+// it as recovered. The temporary files are then deleted. trigger is
+// used if there is no metadata for the recording.
+//
+// The final name is returned along with the number of frames
+// recovered. It is "" if the recording couldn't be read and has been
+// deleted.
+func recoverRecording(tempName, trigger string) (string, int, error) {
+	finalName := recordingFinalName(tempName)
+	rawName := tempName + rawTempExt
+	removeTemp := func() {
+		os.Remove(tempName)
+		os.Remove(rawName)
+	}
+	if _, err := os.Stat(finalName); err == nil {
+		// It was finished but the temporary files weren't removed.
+		removeTemp()
+		return finalName, 0, nil
+	}
+
+	frames, err := rewriteRecording(tempName, rawName, finalName+recoveringExt)
+	if err != nil {
+		os.Remove(finalName + recoveringExt)
+		os.Remove(finalName + recoveringExt + rawTempExt)
+		if _, ok := err.(*recoveryReadError); ok || err == errNoCompleteFrames {
+			removeTemp()
+			return "", 0, err
+		}
+		return finalName, 0, err
+	}
+
+	if err := writeRecoveredMetadata(finalName, trigger, frames); err != nil {
+		return finalName, 0, err
+	}
+	if err := os.Rename(finalName+recoveringExt, finalName); err != nil {
+		return finalName, 0, err
+	}
+	removeTemp()
+	return finalName, frames.count, nil
+}
+
+// recoveryReadError is returned when an unfinished recording can't be
+// read at all.
+type recoveryReadError struct {
+	err error
+}
+
+func (e *recoveryReadError) Error() string {
+	return e.err.Error()
+}
+
+// recoveredFrames describes the frames saved from an unfinished
+// recording.
+type recoveredFrames struct {
+	header cptv.Header
+	count  int
+	fps    int
+}
+
+// rewriteRecording copies the header and complete frames of an
+// unfinished recording to newName. The uncompressed frames in rawName
+// are used if they can be read, otherwise tempName is read as it was
+// compressed before thermal-recorder stopped.
+func rewriteRecording(tempName, rawName, newName string) (*recoveredFrames, error) {
+	reader, closeReader, err := openRaw(rawName)
+	if err != nil {
+		reader, closeReader, err = openCompressed(tempName)
+	}
+	if err != nil {
+		return nil, &recoveryReadError{err}
+	}
+	defer closeReader()
+
+	header := cptv.Header{
+		Timestamp:    reader.Timestamp(),
+		DeviceName:   reader.DeviceName(),
+		DeviceID:     reader.DeviceID(),
+		CameraSerial: reader.SerialNumber(),
+		Firmware:     reader.FirmwareVersion(),
+		PreviewSecs:  reader.PreviewSecs(),
+		MotionConfig: reader.MotionConfig(),
+		Latitude:     reader.Latitude(),
+		Longitude:    reader.Longitude(),
+		LocTimestamp: reader.LocTimestamp(),
+		Altitude:     reader.Altitude(),
+		Accuracy:     reader.Accuracy(),
+		FPS:          reader.FPS(),
+		Brand:        reader.BrandName(),
+		Model:        reader.ModelName(),
+	}
+	frame := reader.EmptyFrame()
+	err = reader.ReadFrame(frame)
+	if err == nil && frame.Status.BackgroundFrame {
+		header.BackgroundFrame = frame.CreateCopy()
+		err = reader.ReadFrame(frame)
+	}
+	if err != nil {
+		return nil, errNoCompleteFrames
+	}
+
+	writer, err := cptv.NewFileWriter(newName, reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := writer.WriteHeader(header); err != nil {
+		writer.Close()
+		return nil, err
+	}
+	frames := &recoveredFrames{header: header, fps: reader.FPS()}
+	for err == nil {
+		if err := writer.WriteFrame(frame); err != nil {
+			writer.Close()
+			return nil, err
+		}
+		frames.count++
+		err = reader.ReadFrame(frame)
+	}
+	if err != io.EOF {
+		log.Printf("recovering %s: stopped at incomplete frame %d: %v", tempName, frames.count+1, err)
+	}
+	// FileWriter.Close doesn't return the error from compressing the
+	// recording.
+	if err := writer.Writer.Close(); err != nil {
+		return nil, err
+	}
+	return frames, nil
+}
+
+// openCompressed opens a recording which was compressed.
+func openCompressed(name string) (*cptv.Reader, func(), error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader, err := cptv.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return reader, func() { f.Close() }, nil
+}
+
+// openRaw opens the uncompressed frames written by the CPTV writer.
+// The reader only reads compressed files, so they are compressed as
+// they're read.
+func openRaw(name string) (*cptv.Reader, func(), error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		gw := gzip.NewWriter(pw)
+		_, err := io.Copy(gw, f)
+		if err == nil {
+			err = gw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	closeAll := func() {
+		// Closing the pipe stops the compressing goroutine if the
+		// whole file wasn't read.
+		pr.Close()
+		f.Close()
+	}
+	reader, err := cptv.NewReader(pr)
+	if err != nil {
+		closeAll()
+		return nil, nil, err
+	}
+	return reader, closeAll, nil
+}
+
+// writeRecoveredMetadata marks the metadata for a recovered recording
+// as recovered, creating it from the CPTV header if it wasn't written
+// before thermal-recorder stopped.
+func writeRecoveredMetadata(finalName, trigger string, frames *recoveredFrames) error {
+	metaName := recordingMetadataName(finalName)
+	var meta recordingMetadata
+	data, err := ioutil.ReadFile(metaName)
+	if err == nil {
+		err = json.Unmarshal(data, &meta)
+	}
+	if err != nil {
+		meta = newRecoveredMetadata(trigger, frames)
+	}
+	meta.Frames = frames.count
+	meta.Recovered = true
+	return writeJSONFile(metaName, &meta)
+}
+
+func newRecoveredMetadata(trigger string, frames *recoveredFrames) recordingMetadata {
+	h := &frames.header
+	meta := recordingMetadata{
+		StartTime:       h.Timestamp,
+		Trigger:         trigger,
+		Brand:           h.Brand,
+		Model:           h.Model,
+		CameraSerial:    h.CameraSerial,
+		Firmware:        h.Firmware,
+		DeviceID:        h.DeviceID,
+		DeviceName:      h.DeviceName,
+		RecorderVersion: version,
+	}
+	if frames.fps > 0 {
+		meta.EndTime = h.Timestamp.Add(time.Duration(frames.count) * time.Second / time.Duration(frames.fps))
+		meta.PreviewFrames = h.PreviewSecs * frames.fps
+		if meta.PreviewFrames > frames.count {
+			meta.PreviewFrames = frames.count
+		}
+	}
+	if h.Latitude != 0 || h.Longitude != 0 {
+		meta.Location = &locationMetadata{
+			Latitude:  h.Latitude,
+			Longitude: h.Longitude,
+			Altitude:  h.Altitude,
+			Accuracy:  h.Accuracy,
+			Timestamp: h.LocTimestamp,
+		}
+	}
+	return meta
+}
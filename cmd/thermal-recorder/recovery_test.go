@@ -0,0 +1,250 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cptv "github.com/TheCacophonyProject/go-cptv"
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/lepton3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TheCacophonyProject/thermal-recorder/storage"
+)
+
+var recoveryStart = time.Date(2026, 3, 1, 21, 30, 0, 0, time.UTC)
+
+func newRecoveryDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "recovery")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// writeUnfinished writes a recording of n frames to dir as if
+// thermal-recorder stopped just as it was being compressed. The
+// temporary name and frames are returned.
+func writeUnfinished(t *testing.T, dir string, n int, background bool) (string, []*cptvframe.Frame) {
+	camera := new(TestCamera)
+	tempName := filepath.Join(dir, recoveryStart.Format("20060102.150405.000.")+cptvTempExt)
+	writer, err := cptv.NewFileWriter(tempName, camera)
+	require.NoError(t, err)
+	header := cptv.Header{
+		Timestamp:    recoveryStart,
+		DeviceName:   "test name",
+		CameraSerial: 7,
+		Firmware:     "1.2.3",
+		PreviewSecs:  1,
+		FPS:          camera.FPS(),
+		Brand:        lepton3.Brand,
+		Model:        lepton3.Model,
+	}
+	if background {
+		header.BackgroundFrame = cptvframe.NewFrame(camera)
+	}
+	require.NoError(t, writer.WriteHeader(header))
+
+	var frames []*cptvframe.Frame
+	for i := 0; i < n; i++ {
+		frame := cptvframe.NewFrame(camera)
+		for y, row := range frame.Pix {
+			for x := range row {
+				row[x] = uint16(3000 + i*20 + x + y)
+			}
+		}
+		frame.Status.TimeOn = time.Duration(i+1) * time.Second
+		require.NoError(t, writer.WriteFrame(frame))
+		frames = append(frames, frame)
+	}
+	require.NoError(t, writer.Compress())
+	return tempName, frames
+}
+
+// readRecording returns the frames in a finished recording.
+func readRecording(t *testing.T, name string) (*cptv.Reader, []*cptvframe.Frame) {
+	reader, closeReader, err := openCompressed(name)
+	require.NoError(t, err)
+	defer closeReader()
+	var frames []*cptvframe.Frame
+	for {
+		frame := reader.EmptyFrame()
+		err := reader.ReadFrame(frame)
+		if err == io.EOF {
+			return reader, frames
+		}
+		require.NoError(t, err)
+		frames = append(frames, frame)
+	}
+}
+
+func readMetadata(t *testing.T, recordingName string) recordingMetadata {
+	data, err := ioutil.ReadFile(recordingMetadataName(recordingName))
+	require.NoError(t, err)
+	var meta recordingMetadata
+	require.NoError(t, json.Unmarshal(data, &meta))
+	return meta
+}
+
+func assertNoTempFiles(t *testing.T, dir string) {
+	temps, err := filepath.Glob(filepath.Join(dir, "*.temp*"))
+	require.NoError(t, err)
+	assert.Empty(t, temps)
+	recovering, err := filepath.Glob(filepath.Join(dir, "*"+recoveringExt+"*"))
+	require.NoError(t, err)
+	assert.Empty(t, recovering)
+}
+
+func TestRecoverTruncatedRecording(t *testing.T) {
+	dir := newRecoveryDir(t)
+	tempName, frames := writeUnfinished(t, dir, 5, true)
+	// Cut the last frame short and leave the recording uncompressed.
+	rawName := tempName + rawTempExt
+	info, err := os.Stat(rawName)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(rawName, info.Size()-50))
+	require.NoError(t, os.Truncate(tempName, 0))
+
+	finalName, count, err := recoverRecording(tempName, "")
+	require.NoError(t, err)
+	assert.Equal(t, recordingFinalName(tempName), finalName)
+	assert.Equal(t, 4, count)
+	assertNoTempFiles(t, dir)
+
+	reader, recovered := readRecording(t, finalName)
+	assert.Equal(t, "test name", reader.DeviceName())
+	assert.Equal(t, 7, reader.SerialNumber())
+	assert.True(t, reader.Timestamp().Equal(recoveryStart))
+	assert.True(t, reader.HasBackgroundFrame())
+	require.Len(t, recovered, 5)
+	assert.True(t, recovered[0].Status.BackgroundFrame)
+	for i, frame := range recovered[1:] {
+		assert.Equal(t, frames[i].Pix, frame.Pix)
+		assert.Equal(t, frames[i].Status.TimeOn, frame.Status.TimeOn)
+	}
+
+	meta := readMetadata(t, finalName)
+	assert.True(t, meta.Recovered)
+	assert.Equal(t, 4, meta.Frames)
+	assert.Equal(t, 4, meta.PreviewFrames)
+	assert.Equal(t, "", meta.Trigger)
+	assert.True(t, meta.StartTime.Equal(recoveryStart))
+	assert.True(t, meta.EndTime.Equal(recoveryStart.Add(4*time.Second/9)))
+	assert.Equal(t, "test name", meta.DeviceName)
+	assert.Equal(t, lepton3.Model, meta.Model)
+	assert.Equal(t, 7, meta.CameraSerial)
+	assert.Equal(t, version, meta.RecorderVersion)
+}
+
+func TestRecoverCompressedRecording(t *testing.T) {
+	dir := newRecoveryDir(t)
+	tempName, frames := writeUnfinished(t, dir, 3, false)
+	// It was compressed and its metadata written but it wasn't renamed.
+	require.NoError(t, os.Remove(tempName+rawTempExt))
+	finalName := recordingFinalName(tempName)
+	require.NoError(t, writeJSONFile(recordingMetadataName(finalName), &recordingMetadata{
+		Trigger: triggerMotion,
+		Frames:  3,
+	}))
+
+	_, count, err := recoverRecording(tempName, "")
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assertNoTempFiles(t, dir)
+
+	_, recovered := readRecording(t, finalName)
+	require.Len(t, recovered, 3)
+	assert.Equal(t, frames[2].Pix, recovered[2].Pix)
+	meta := readMetadata(t, finalName)
+	assert.True(t, meta.Recovered)
+	assert.Equal(t, triggerMotion, meta.Trigger)
+	assert.Equal(t, 3, meta.Frames)
+}
+
+func TestDiscardUnreadableRecording(t *testing.T) {
+	dir := newRecoveryDir(t)
+	tempName := filepath.Join(dir, "20260301.213000.000."+cptvTempExt)
+	require.NoError(t, ioutil.WriteFile(tempName, nil, 0644))
+	require.NoError(t, ioutil.WriteFile(tempName+rawTempExt, []byte("not a CPTV file"), 0644))
+
+	finalName, _, err := recoverRecording(tempName, "")
+	assert.Error(t, err)
+	assert.Equal(t, "", finalName)
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Empty(t, files)
+}
+
+func TestDiscardRecordingWithoutFrames(t *testing.T) {
+	dir := newRecoveryDir(t)
+	tempName, _ := writeUnfinished(t, dir, 0, true)
+
+	finalName, _, err := recoverRecording(tempName, "")
+	assert.Equal(t, errNoCompleteFrames, err)
+	assert.Equal(t, "", finalName)
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Empty(t, files)
+}
+
+func TestRecoverAlreadyFinishedRecording(t *testing.T) {
+	dir := newRecoveryDir(t)
+	tempName, _ := writeUnfinished(t, dir, 2, false)
+	finalName := recordingFinalName(tempName)
+	require.NoError(t, ioutil.WriteFile(finalName, []byte("finished"), 0644))
+
+	_, count, err := recoverRecording(tempName, "")
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+	assertNoTempFiles(t, dir)
+	data, err := ioutil.ReadFile(finalName)
+	require.NoError(t, err)
+	assert.Equal(t, "finished", string(data))
+}
+
+func TestRecoverRecordings(t *testing.T) {
+	dir := newRecoveryDir(t)
+	constantDir := filepath.Join(dir, storage.ConstantDir)
+	require.NoError(t, os.Mkdir(constantDir, 0755))
+	tempName, _ := writeUnfinished(t, dir, 2, false)
+	constantName, _ := writeUnfinished(t, constantDir, 3, false)
+	// Only the uncompressed frames had been written.
+	require.NoError(t, os.Remove(constantName))
+	// Left over from an earlier recovery and a metadata file which
+	// wasn't finished.
+	leftover := filepath.Join(dir, "20260301.000000.000.cptv"+recoveringExt)
+	require.NoError(t, ioutil.WriteFile(leftover, nil, 0644))
+	require.NoError(t, ioutil.WriteFile(leftover+rawTempExt, nil, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "20260301.000000.000.json.temp"), nil, 0644))
+
+	require.NoError(t, recoverRecordings(dir))
+	assertNoTempFiles(t, dir)
+	assertNoTempFiles(t, constantDir)
+
+	meta := readMetadata(t, recordingFinalName(tempName))
+	assert.Equal(t, 2, meta.Frames)
+	assert.Equal(t, "", meta.Trigger)
+	meta = readMetadata(t, recordingFinalName(constantName))
+	assert.Equal(t, 3, meta.Frames)
+	assert.Equal(t, triggerConstant, meta.Trigger)
+	assert.True(t, meta.Recovered)
+}
@@ -0,0 +1,216 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+
+	config "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/window"
+	"github.com/google/go-cmp/cmp"
+	"github.com/rjeczalik/notify"
+
+	"github.com/TheCacophonyProject/thermal-recorder/headers"
+	"github.com/TheCacophonyProject/thermal-recorder/recorder"
+	"github.com/TheCacophonyProject/thermal-recorder/throttle"
+)
+
+// configUpdates carries the config each time the config file changes.
+// Only the latest update is kept.
+var configUpdates = make(chan *Config, 1)
+
+// errReconnect is returned by handleConn when a config change can only
+// be applied by setting up the camera connection again.
+var errReconnect = errors.New("config change needs the camera connection to be restarted")
+
+// checkConfigChanges parses the config each time the config file is
+// modified and passes it to the camera connection to be applied.
+func checkConfigChanges(configDir string, verbose bool) error {
+	configFilePath := filepath.Join(configDir, config.ConfigFileName)
+	fsEvents := make(chan notify.EventInfo, 1)
+	if err := notify.Watch(configFilePath, fsEvents, notify.InCloseWrite, notify.InMovedTo); err != nil {
+		return err
+	}
+	defer notify.Stop(fsEvents)
+
+	for {
+		<-fsEvents
+		newConfig, err := ParseConfig(configDir)
+		if err != nil {
+			log.Println("error reloading config:", err)
+			continue
+		}
+		newConfig.Verbose = verbose
+
+		// Replace any update which hasn't been applied yet.
+		select {
+		case <-configUpdates:
+		default:
+		}
+		configUpdates <- newConfig
+	}
+}
+
+// configDiff describes the differences between two configs, or returns
+// "" if they are the same.
+func configDiff(old, new *Config) string {
+	// Need to set Window.Now in Recorder.Config and its profiles to nil
+	// to compare them.
+	isRecorderConfigEqual := func(x, y recorder.RecorderConfig) bool {
+		x.Window.Now = nil
+		y.Window.Now = nil
+		x.Profiles = profilesWithoutNow(x.Profiles)
+		y.Profiles = profilesWithoutNow(y.Profiles)
+		return cmp.Equal(x, y, cmp.AllowUnexported(window.Window{}))
+	}
+
+	return cmp.Diff(
+		old,
+		new,
+		cmp.AllowUnexported(
+			config.Location{},
+			recorder.RecorderConfig{},
+			config.ThermalMotion{},
+			config.ThermalThrottler{},
+			window.Window{},
+		),
+		cmp.Comparer(isRecorderConfigEqual)) // Custom compare function for recorder config ignoring Window.Now
+}
+
+// profilesWithoutNow returns a copy of profiles with their windows'
+// Now functions set to nil.
+func profilesWithoutNow(profiles []recorder.Profile) []recorder.Profile {
+	if profiles == nil {
+		return nil
+	}
+	copied := append([]recorder.Profile(nil), profiles...)
+	for i := range copied {
+		copied[i].Window.Now = nil
+	}
+	return copied
+}
+
+// reconnectNeeded reports whether the changes from old to new can only
+// be applied by setting up the camera connection again. The snapshot
+// write queue is sized for the snapshot length so it is made again
+// when that changes.
+func reconnectNeeded(old, new *Config) bool {
+	return old.FrameInput != new.FrameInput ||
+		old.Throttler.Activate != new.Throttler.Activate ||
+		old.Recorder.ConstantRecorder != new.Recorder.ConstantRecorder ||
+		old.Snapshots.Frames != new.Snapshots.Frames
+}
+
+// reloadMotionConfig loads the motion config into newConf and checks
+// it against camera. If it can't be used the motion config in conf,
+// which may be the camera's defaults, is kept instead so that it isn't
+// seen as changed every time the config file is written. An error is
+// returned if newConf can't be used with either.
+func reloadMotionConfig(conf, newConf *Config, camera *headers.HeaderInfo) error {
+	err := newConf.LoadMotionConfig(camera.Model())
+	if err == nil {
+		err = newConf.ValidateMotion(camera)
+	}
+	if err == nil {
+		return nil
+	}
+	log.Println("keeping the current motion config:", err)
+	newConf.Motion = conf.Motion
+	return newConf.ValidateMotion(camera)
+}
+
+// connRecorders holds the recorders used for a camera connection so
+// that config changes can be applied to them.
+type connRecorders struct {
+	camera        *headers.HeaderInfo
+	cptv          *CPTVFileRecorder
+	throttled     *throttle.ThrottledRecorder
+	async         *recorder.AsyncRecorder
+	constant      *CPTVFileRecorder
+	asyncConstant *recorder.AsyncRecorder
+	snapshot      *CPTVFileRecorder
+	asyncSnapshot *recorder.AsyncRecorder
+}
+
+// applyConfig applies newConf to the motion processor and recorders
+// and then replaces conf with it. It is called between frames.
+// errReconnect is returned if the camera connection needs to be set
+// up again for the change to take effect.
+func (r *connRecorders) applyConfig(conf, newConf *Config) error {
+	if err := reloadMotionConfig(conf, newConf, r.camera); err != nil {
+		log.Println("not applying config change:", err)
+		return nil
+	}
+	diff := configDiff(conf, newConf)
+	if diff == "" {
+		log.Println("No relevant changes detected in config file.")
+		return nil
+	}
+	log.Println("Config changed:", diff)
+	if newConf.HTTP != conf.HTTP {
+		log.Println("live view HTTP server changes need thermal-recorder to be restarted")
+	}
+	if newConf.Metrics != conf.Metrics {
+		log.Println("metrics export changes need thermal-recorder to be restarted")
+	}
+
+	if reconnectNeeded(conf, newConf) {
+		*conf = *newConf
+		return errReconnect
+	}
+
+	storageManager.Update(newConf.OutputDir, newConf.MinDiskSpace, &newConf.Storage)
+	if err := setSnapshotSchedule(newConf); err != nil {
+		log.Printf("failed to update snapshot schedule: %v", err)
+	}
+	processor.UpdateConfig(&newConf.Motion, &newConf.Tracking, &newConf.Recorder, &newConf.Location)
+	if !cmp.Equal(newConf.Mask, conf.Mask) {
+		processor.SetMask(loadMask(newConf, r.camera))
+	}
+
+	// The recorders are changed on their writing goroutines so that
+	// the changes don't race with recordings being written.
+	fileConf := *newConf
+	r.async.Run(func() {
+		if err := r.cptv.UpdateConfig(&fileConf); err != nil {
+			log.Printf("failed to update recorder config: %v", err)
+		}
+		if r.throttled != nil {
+			minRecordingLength := fileConf.Recorder.MinSecs + fileConf.Recorder.PreviewSecs
+			r.throttled.UpdateConfig(&fileConf.Throttler, minRecordingLength)
+		}
+	})
+	if r.constant != nil {
+		r.asyncConstant.Run(func() {
+			if err := r.constant.UpdateConfig(&fileConf); err != nil {
+				log.Printf("failed to update constant recorder config: %v", err)
+			}
+		})
+	}
+	r.asyncSnapshot.Run(func() {
+		if err := r.snapshot.UpdateConfig(&fileConf); err != nil {
+			log.Printf("failed to update snapshot recorder config: %v", err)
+		}
+	})
+
+	*conf = *newConf
+	live.setConfig(conf)
+	logConfig(conf)
+	return nil
+}
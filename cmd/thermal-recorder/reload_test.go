@@ -0,0 +1,124 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	config "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/lepton3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TheCacophonyProject/thermal-recorder/headers"
+	"github.com/TheCacophonyProject/thermal-recorder/recorder"
+)
+
+func TestConfigDiff(t *testing.T) {
+	old := CurrentConfig()
+	new := CurrentConfig()
+	new.Recorder.Window.Now = time.Now
+	assert.Empty(t, configDiff(old, new))
+
+	old.Recorder.Profiles = []recorder.Profile{{Name: "dusk", Window: old.Recorder.Window}}
+	new.Recorder.Profiles = []recorder.Profile{{Name: "dusk", Window: new.Recorder.Window}}
+	assert.Empty(t, configDiff(old, new))
+	new.Recorder.Profiles[0].Name = "night"
+	assert.NotEmpty(t, configDiff(old, new))
+	new.Recorder.Profiles[0].Name = "dusk"
+
+	new.Motion.DeltaThresh++
+	assert.NotEmpty(t, configDiff(old, new))
+}
+
+func TestReconnectNeeded(t *testing.T) {
+	old := CurrentConfig()
+
+	new := CurrentConfig()
+	new.Motion.DeltaThresh++
+	new.Recorder.MaxSecs++
+	new.Throttler.BucketSize *= 2
+	new.OutputDir = "/somewhere/else"
+	new.Snapshots.Interval = time.Hour
+	assert.False(t, reconnectNeeded(old, new))
+
+	new = CurrentConfig()
+	new.FrameInput = "/var/run/other"
+	assert.True(t, reconnectNeeded(old, new))
+
+	new = CurrentConfig()
+	new.Throttler.Activate = !old.Throttler.Activate
+	assert.True(t, reconnectNeeded(old, new))
+
+	new = CurrentConfig()
+	new.Recorder.ConstantRecorder = !old.Recorder.ConstantRecorder
+	assert.True(t, reconnectNeeded(old, new))
+
+	new = CurrentConfig()
+	new.Snapshots.Frames = 100
+	assert.True(t, reconnectNeeded(old, new))
+}
+
+func testCameraHeader(t *testing.T) *headers.HeaderInfo {
+	header := fmt.Sprintf("%s: 160\n%s: 120\n%s: 9\n%s: flir\n%s: %s\n\n",
+		headers.XResolution, headers.YResolution, headers.FPS, headers.Brand, headers.Model, lepton3.Model)
+	camera, err := headers.ReadHeaderInfo(bufio.NewReader(strings.NewReader(header)))
+	require.NoError(t, err)
+	return camera
+}
+
+func TestLoadMotionConfig(t *testing.T) {
+	camera := testCameraHeader(t)
+	conf := CurrentConfig()
+	conf.ConfigDir = writeTestConfig(t, "[thermal-motion]\nedge-pixels = 70\n")
+	require.NoError(t, loadMotionConfig(conf, camera))
+	assert.Equal(t, config.DefaultThermalMotion(camera.Model()), conf.Motion)
+
+	// A profile which can't be used with the defaults either.
+	countThresh := 20000
+	conf.Recorder.Profiles = []recorder.Profile{{Name: "busy", CountThresh: &countThresh}}
+	assert.EqualError(t, loadMotionConfig(conf, camera),
+		"default motion config can't be used either: profile busy: count-thresh is 20000, must be between 1 and 18644 (the pixels inside the edges and motion mask)")
+}
+
+func TestReloadMotionConfig(t *testing.T) {
+	camera := testCameraHeader(t)
+
+	// The defaults are kept when the motion config in the file is
+	// invalid, so there's no change to apply.
+	conf := CurrentConfig()
+	conf.ConfigDir = writeTestConfig(t, "[thermal-motion]\nedge-pixels = 70\n")
+	conf.Motion = config.DefaultThermalMotion(camera.Model())
+	newConf := *conf
+	require.NoError(t, reloadMotionConfig(conf, &newConf, camera))
+	assert.Equal(t, conf.Motion, newConf.Motion)
+	assert.Empty(t, configDiff(conf, &newConf))
+
+	newConf.ConfigDir = writeTestConfig(t, "[thermal-motion]\nedge-pixels = 2\n")
+	require.NoError(t, reloadMotionConfig(conf, &newConf, camera))
+	assert.Equal(t, 2, newConf.Motion.EdgePixels)
+
+	// Profiles are still checked against the motion config kept.
+	newConf.ConfigDir = writeTestConfig(t, "[thermal-motion]\nedge-pixels = 70\n")
+	countThresh := 20000
+	newConf.Recorder.Profiles = []recorder.Profile{{Name: "busy", CountThresh: &countThresh}}
+	assert.Error(t, reloadMotionConfig(conf, &newConf, camera))
+}
@@ -18,6 +18,8 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"log"
 
 	"github.com/TheCacophonyProject/go-cptv/cptvframe"
 	"github.com/TheCacophonyProject/thermal-recorder/headers"
@@ -32,9 +34,51 @@ const (
 )
 
 type service struct {
+	conf *Config
 }
 
-func startService(dir string) error {
+// signalEmitter sends the service's D-Bus signals. A nil
+// signalEmitter does nothing so recordings can be made without the
+// service.
+type signalEmitter struct {
+	conn *dbus.Conn
+}
+
+// signals is set once the D-Bus service has started.
+var signals *signalEmitter
+
+func (e *signalEmitter) emit(name string, values ...interface{}) {
+	if e == nil {
+		return
+	}
+	if err := e.conn.Emit(dbusPath, dbusName+"."+name, values...); err != nil {
+		log.Printf("failed to emit %s signal: %v", name, err)
+	}
+}
+
+// recordingStarted is called when a recording file is started, with
+// the reason for the recording.
+func (e *signalEmitter) recordingStarted(trigger string) {
+	e.emit("RecordingStarted", trigger)
+}
+
+// recordingFinished is called with the path of each finished
+// recording.
+func (e *signalEmitter) recordingFinished(path string) {
+	e.emit("RecordingFinished", path)
+}
+
+// forwardEvents emits the MotionDetected signal when the live view sees
+// motion start.
+func (e *signalEmitter) forwardEvents(events <-chan liveEvent) {
+	for event := range events {
+		if event.Type == eventMotionStarted {
+			e.emit("MotionDetected")
+		}
+	}
+}
+
+func startService(conf *Config) error {
 	conn, err := dbus.SystemBus()
 	if err != nil {
 		return err
@@ -47,9 +91,13 @@ func startService(dir string) error {
 		return errors.New("name already taken")
 	}
 
-	s := &service{}
+	s := &service{conf: conf}
 	conn.Export(s, dbusPath, dbusName)
 	conn.Export(genIntrospectable(s), dbusPath, "org.freedesktop.DBus.Introspectable")
+
+	signals = &signalEmitter{conn: conn}
+	events, _ := live.subscribe()
+	go signals.forwardEvents(events)
 	return nil
 }
 
@@ -58,6 +106,11 @@ func genIntrospectable(v interface{}) introspect.Introspectable {
 		Interfaces: []introspect.Interface{{
 			Name:    dbusName,
 			Methods: introspect.Methods(v),
+			Signals: []introspect.Signal{
+				{Name: "RecordingStarted", Args: []introspect.Arg{{Name: "trigger", Type: "s"}}},
+				{Name: "RecordingFinished", Args: []introspect.Arg{{Name: "path", Type: "s"}}},
+				{Name: "MotionDetected"},
+			},
 		}},
 	}
 	return introspect.NewIntrospectable(node)
@@ -78,7 +131,7 @@ func (s *service) TakeSnapshot(lastFrame int) (*cptvframe.Frame, *dbus.Error) {
 // TakeTestRecording will take a test recording of 2 seconds
 func (s *service) TakeTestRecording() *dbus.Error {
 
-	err := newSnapshotRecording()
+	err := newSnapshotRecording(triggerTest)
 	if err != nil {
 		return &dbus.Error{
 			Name: dbusName + ".TakeSnapshotRecording",
@@ -108,3 +161,156 @@ func (s *service) CameraInfo() (map[string]interface{}, *dbus.Error) {
 	}
 	return camera_specs, nil
 }
+
+// MotionMask returns the mask used for motion detection, a byte per
+// pixel row by row with 1 for included pixels, along with the current
+// background frame.
+func (s *service) MotionMask() ([]byte, *cptvframe.Frame, *dbus.Error) {
+	if processor == nil || headerInfo == nil {
+		return nil, nil, &dbus.Error{
+			Name: dbusName + ".MotionMask",
+			Body: []interface{}{"reading from camera has not started yet"},
+		}
+	}
+	mask, background := processor.MaskAndBackground()
+	if mask == nil {
+		all := make([]byte, headerInfo.ResX()*headerInfo.ResY())
+		for i := range all {
+			all[i] = 1
+		}
+		return all, background, nil
+	}
+	return mask.Bytes(), background, nil
+}
+
+// SetMotionMask saves a new motion detection mask, in the same form as
+// returned by MotionMask, and starts using it. Polygons from the
+// config still apply.
+func (s *service) SetMotionMask(mask []byte) *dbus.Error {
+	if err := setMotionMask(s.conf, mask); err != nil {
+		return &dbus.Error{
+			Name: dbusName + ".SetMotionMask",
+			Body: []interface{}{err.Error()},
+		}
+	}
+	return nil
+}
+
+// StartRecording starts a manual recording of secs seconds, whether or
+// not there is motion or it is in the recording window. A recording
+// already in progress is made to last at least secs seconds instead.
+func (s *service) StartRecording(secs int) *dbus.Error {
+	if err := startManualRecording(secs); err != nil {
+		return &dbus.Error{
+			Name: dbusName + ".StartRecording",
+			Body: []interface{}{err.Error()},
+		}
+	}
+	return nil
+}
+
+// StopRecording stops a manual recording early.
+func (s *service) StopRecording() *dbus.Error {
+	if err := stopManualRecording(); err != nil {
+		return &dbus.Error{
+			Name: dbusName + ".StopRecording",
+			Body: []interface{}{err.Error()},
+		}
+	}
+	return nil
+}
+
+// PauseRecording stops recordings being triggered by motion until
+// ResumeRecording is called or thermal-recorder restarts.
+func (s *service) PauseRecording() *dbus.Error {
+	control.setPaused(true)
+	return nil
+}
+
+// ResumeRecording lets motion trigger recordings again.
+func (s *service) ResumeRecording() *dbus.Error {
+	control.setPaused(false)
+	return nil
+}
+
+// Status returns what thermal-recorder is doing.
+func (s *service) Status() (map[string]interface{}, *dbus.Error) {
+	return recorderStatus(), nil
+}
+
+// Background returns the background frame used for motion detection.
+func (s *service) Background() (*cptvframe.Frame, *dbus.Error) {
+	background := live.background()
+	if background == nil {
+		return nil, &dbus.Error{
+			Name: dbusName + ".Background",
+			Body: []interface{}{errNotConnected.Error()},
+		}
+	}
+	return background, nil
+}
+
+// MotionStats returns the motion detection results for the most recent
+// frame.
+func (s *service) MotionStats() (map[string]interface{}, *dbus.Error) {
+	st := live.status()
+	if st.Camera == nil {
+		return nil, &dbus.Error{
+			Name: dbusName + ".MotionStats",
+			Body: []interface{}{errNotConnected.Error()},
+		}
+	}
+	return map[string]interface{}{
+		"framesRead": st.FramesRead,
+		"tempThresh": st.TempThresh,
+		"deltaCount": st.DeltaCount,
+		"motion":     st.Motion,
+		"tracks":     st.Tracks,
+	}, nil
+}
+
+// maxSnapshotTriggers is the most snapshots SnapshotTriggers lists.
+const maxSnapshotTriggers = 100
+
+// snapshotTrigger is a scheduled snapshot as returned by
+// SnapshotTriggers. Time is in Unix seconds.
+type snapshotTrigger struct {
+	Time   int64
+	Reason string
+}
+
+// SnapshotTriggers lists the next count scheduled snapshot recordings
+// and the reason for each.
+func (s *service) SnapshotTriggers(count int) ([]snapshotTrigger, *dbus.Error) {
+	if count < 1 || count > maxSnapshotTriggers {
+		return nil, &dbus.Error{
+			Name: dbusName + ".SnapshotTriggers",
+			Body: []interface{}{fmt.Sprintf("count must be from 1 to %d", maxSnapshotTriggers)},
+		}
+	}
+	triggers := []snapshotTrigger{}
+	for _, trigger := range upcomingSnapshots(count) {
+		triggers = append(triggers, snapshotTrigger{Time: trigger.Time.Unix(), Reason: trigger.Reason})
+	}
+	return triggers, nil
+}
+
+// recorderStatus returns the status given by the Status method.
+// throttleBucketFrames is only included when throttling is on.
+func recorderStatus() map[string]interface{} {
+	st := live.status()
+	file, frames := control.currentRecording()
+	status := map[string]interface{}{
+		"connected":       st.Camera != nil,
+		"recording":       st.Recording,
+		"manualRecording": st.ManualRecording,
+		"paused":          st.Paused,
+		"file":            file,
+		"framesWritten":   frames,
+		"windowActive":    st.Window.Active,
+	}
+	if st.ThrottleBucketFrames != nil {
+		status["throttleBucketFrames"] = *st.ThrottleBucketFrames
+	}
+	return status
+}
@@ -23,7 +23,8 @@ import (
 	"time"
 
 	"github.com/TheCacophonyProject/go-cptv/cptvframe"
-	"github.com/TheCacophonyProject/window"
+
+	"github.com/TheCacophonyProject/thermal-recorder/snapshot"
 )
 
 const (
@@ -60,7 +61,9 @@ func newSnapshot(lastFrame int) (*cptvframe.Frame, error) {
 	return f, nil
 }
 
-func newSnapshotRecording() error {
+// newSnapshotRecording starts a short recording, saved with trigger as
+// the reason it was made.
+func newSnapshotRecording(trigger string) error {
 	mu.Lock()
 	defer mu.Unlock()
 
@@ -69,41 +72,86 @@ func newSnapshotRecording() error {
 		return errors.New("reading from camera has not started yet")
 	}
 
-	processor.StartSnapshot = true
+	snapshotRecorder.SetTrigger(trigger)
+	frames := 0
+	if schedule := currentSnapshotSchedule(); schedule != nil {
+		frames = schedule.Frames()
+	}
+	processor.StartSnapshot(frames)
 	return nil
 }
 
-// snapshotRecordingTriggers will make a snapshot when in the recording window and at the end of the recording window.
-func snapshotRecordingTriggers(window window.Window) {
+var (
+	scheduleMu       sync.Mutex
+	snapshotSchedule *snapshot.Schedule
+	scheduleChanged  = make(chan struct{}, 1)
+	// startTime is when thermal-recorder started, for the power on
+	// snapshot.
+	startTime = time.Now()
+)
 
-	// Wait for motion processor to start
-	for processor == nil {
-		time.Sleep(time.Second)
+// setSnapshotSchedule makes a snapshot schedule from conf and starts
+// using it.
+func setSnapshotSchedule(conf *Config) error {
+	schedule, err := snapshot.New(&conf.Snapshots, conf.Recorder.Window, conf.Location, startTime)
+	if err != nil {
+		return err
 	}
-
-	if window.NoWindow {
-		log.Println("no recording window so will make snapshot every 12 hours")
-		triggerTime := time.Now().Add(time.Minute)
-		for {
-			time.Sleep(time.Until(triggerTime))
-			_ = newSnapshotRecording()
-			triggerTime = triggerTime.Add(time.Hour * 12)
-		}
+	scheduleMu.Lock()
+	snapshotSchedule = schedule
+	scheduleMu.Unlock()
+	select {
+	case scheduleChanged <- struct{}{}:
+	default:
 	}
+	return nil
+}
 
-	if window.Active() {
-		// If camera just started give it a minute to warm  up.
-		time.Sleep(time.Minute)
-		log.Println("making power on snapshot")
-	} else {
-		// Wait for recording window to start
-		time.Sleep(time.Until(window.NextStart()) + time.Minute)
-		log.Println("making start of window snapshot")
+func currentSnapshotSchedule() *snapshot.Schedule {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+	return snapshotSchedule
+}
+
+// upcomingSnapshots returns the next n scheduled snapshots.
+func upcomingSnapshots(n int) []snapshot.Trigger {
+	schedule := currentSnapshotSchedule()
+	if schedule == nil {
+		return nil
 	}
-	_ = newSnapshotRecording()
+	return schedule.Upcoming(time.Now(), n)
+}
 
-	// Make snapshot at end of window.
-	time.Sleep(time.Until(window.NextEnd()) - 2*time.Minute)
-	log.Println("making end of window snapshot")
-	_ = newSnapshotRecording()
+// runSnapshotSchedule makes snapshot recordings as scheduled by the
+// latest schedule given to setSnapshotSchedule.
+func runSnapshotSchedule() {
+	after := time.Now()
+	for {
+		var timer *time.Timer
+		var fire <-chan time.Time
+		trigger, ok := currentSnapshotSchedule().Next(after)
+		if ok {
+			timer = time.NewTimer(time.Until(trigger.Time))
+			fire = timer.C
+		}
+
+		select {
+		case <-fire:
+			log.Printf("making %s snapshot", trigger.Reason)
+			if err := newSnapshotRecording(triggerSnapshot); err != nil {
+				log.Printf("snapshot not made: %v", err)
+			}
+			// Don't catch up on snapshots missed while the timer was
+			// late, for example when the clock was changed.
+			after = time.Now()
+			if after.Before(trigger.Time) {
+				after = trigger.Time
+			}
+		case <-scheduleChanged:
+			if timer != nil {
+				timer.Stop()
+			}
+			after = time.Now()
+		}
+	}
 }
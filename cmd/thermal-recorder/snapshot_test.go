@@ -0,0 +1,73 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TheCacophonyProject/window"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TheCacophonyProject/thermal-recorder/snapshot"
+)
+
+func TestSnapshotTriggers(t *testing.T) {
+	defer func() {
+		snapshotSchedule = nil
+		<-scheduleChanged
+	}()
+	s := new(service)
+	triggers, dbusErr := s.SnapshotTriggers(3)
+	require.Nil(t, dbusErr)
+	assert.Empty(t, triggers)
+
+	conf := CurrentConfig()
+	conf.Snapshots = snapshot.DefaultConfig()
+	w, err := window.New("20:00", "06:00", 0, 0)
+	require.NoError(t, err)
+	conf.Recorder.Window = *w
+	require.NoError(t, setSnapshotSchedule(conf))
+
+	triggers, dbusErr = s.SnapshotTriggers(3)
+	require.Nil(t, dbusErr)
+	require.Len(t, triggers, 3)
+	for i, trigger := range triggers {
+		assert.True(t, trigger.Time > time.Now().Unix())
+		if i > 0 {
+			assert.True(t, trigger.Time > triggers[i-1].Time)
+		}
+		assert.Contains(t, []string{snapshot.ReasonPowerOn, snapshot.ReasonWindowStart, snapshot.ReasonWindowEnd, snapshot.ReasonInterval}, trigger.Reason)
+	}
+
+	_, dbusErr = s.SnapshotTriggers(0)
+	require.NotNil(t, dbusErr)
+	assert.Equal(t, "count must be from 1 to 100", dbusErr.Error())
+	_, dbusErr = s.SnapshotTriggers(101)
+	assert.NotNil(t, dbusErr)
+}
+
+func TestSnapshotQueueFrames(t *testing.T) {
+	camera := new(TestCamera)
+	conf := CurrentConfig()
+	conf.Snapshots = snapshot.DefaultConfig()
+	assert.Equal(t, 20, snapshotQueueFrames(conf, camera))
+
+	conf.Snapshots.Frames = 100000
+	assert.Equal(t, writeQueueFrames(camera), snapshotQueueFrames(conf, camera))
+}
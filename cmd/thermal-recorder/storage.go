@@ -0,0 +1,54 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/TheCacophonyProject/event-reporter/eventclient"
+
+	"github.com/TheCacophonyProject/thermal-recorder/storage"
+)
+
+// storageCheckInterval is how often the retention rules are applied,
+// as well as after each recording.
+const storageCheckInterval = 10 * time.Minute
+
+// storageManager looks after the recordings in the output directory.
+var storageManager *storage.Manager
+
+// reportDeletion adds an event for each recording deleted by the
+// storage manager.
+func reportDeletion(d storage.Deletion) {
+	recordingsDeleted.Inc()
+	event := eventclient.Event{
+		Timestamp: time.Now(),
+		Type:      "recording-deleted",
+		Details: map[string]interface{}{
+			"path":      d.Path,
+			"reason":    d.Reason,
+			"bytes":     d.Size,
+			"startTime": d.Time,
+			"constant":  d.Constant,
+			"uploaded":  d.Uploaded,
+		},
+	}
+	if err := eventclient.AddEvent(event); err != nil {
+		log.Printf("failed to add recording deleted event: %v", err)
+	}
+}
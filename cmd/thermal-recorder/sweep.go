@@ -0,0 +1,346 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	goconfig "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/window"
+)
+
+// defaultSweepDir holds the CPTV files that ship with the repository,
+// relative to its root, with labels in labels.json.
+const defaultSweepDir = "cmd/thermal-recorder/motiontest"
+
+// SweepCmd replays labelled CPTV files over a grid of motion settings
+// and ranks them. Values to try are given as a list ("30,40,50") or a
+// range ("30:80:10"). Unset fields use the value from the config.
+type SweepCmd struct {
+	Dir              string `arg:"positional" help:"directory of CPTV files [default: cmd/thermal-recorder/motiontest]"`
+	Labels           string `arg:"-l,--labels" help:"JSON file of labels for the CPTV files [default: labels.json in the directory]"`
+	Model            string `arg:"--model" default:"lepton3" help:"camera model the CPTV files are from, for the default motion config"`
+	DeltaThresh      string `arg:"--delta-thresh" help:"delta thresholds to try"`
+	CountThresh      string `arg:"--count-thresh" help:"count thresholds to try"`
+	TriggerFrames    string `arg:"--trigger-frames" help:"trigger frames to try"`
+	FrameCompareGap  string `arg:"--frame-compare-gap" help:"frame compare gaps to try"`
+	UseOneDiffOnly   string `arg:"--use-one-diff-only" help:"use-one-diff-only values to try (true,false)"`
+	WarmerOnly       string `arg:"--warmer-only" help:"warmer-only values to try (true,false)"`
+	DynamicThreshold string `arg:"--dynamic-threshold" help:"dynamic-threshold values to try (true,false)"`
+	Workers          int    `arg:"-w,--workers" help:"number of configs to test at once [default: number of CPUs]"`
+	Top              int    `arg:"--top" default:"20" help:"number of configs to show, 0 for all"`
+	JSON             string `arg:"--json" help:"also write the ranked results as JSON to this file"`
+}
+
+// sweepResult is the score for one set of motion settings.
+type sweepResult struct {
+	Rank   int                    `json:"rank"`
+	Score  float64                `json:"score"`
+	Motion goconfig.ThermalMotion `json:"motion"`
+	Result evaluationScore        `json:"result"`
+}
+
+// parseIntValues parses a list ("1,2,3") or range ("start:end:step",
+// with the step defaulting to 1) of integers.
+func parseIntValues(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("invalid range %q", s)
+		}
+		bounds := []int{0, 0, 1}
+		for i, part := range parts {
+			v, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return nil, fmt.Errorf("invalid range %q", s)
+			}
+			bounds[i] = v
+		}
+		if len(parts) < 2 || bounds[2] < 1 || bounds[1] < bounds[0] {
+			return nil, fmt.Errorf("invalid range %q", s)
+		}
+		var values []int
+		for v := bounds[0]; v <= bounds[1]; v += bounds[2] {
+			values = append(values, v)
+		}
+		return values, nil
+	}
+	var values []int
+	for _, part := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", part)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// parseBoolValues parses a list of booleans ("true,false").
+func parseBoolValues(s string) ([]bool, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var values []bool
+	for _, part := range strings.Split(s, ",") {
+		v, err := strconv.ParseBool(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q", part)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func expandInts(grid []goconfig.ThermalMotion, values []int, set func(*goconfig.ThermalMotion, int)) []goconfig.ThermalMotion {
+	if len(values) == 0 {
+		return grid
+	}
+	expanded := make([]goconfig.ThermalMotion, 0, len(grid)*len(values))
+	for _, m := range grid {
+		for _, v := range values {
+			set(&m, v)
+			expanded = append(expanded, m)
+		}
+	}
+	return expanded
+}
+
+func expandBools(grid []goconfig.ThermalMotion, values []bool, set func(*goconfig.ThermalMotion, bool)) []goconfig.ThermalMotion {
+	if len(values) == 0 {
+		return grid
+	}
+	expanded := make([]goconfig.ThermalMotion, 0, len(grid)*len(values))
+	for _, m := range grid {
+		for _, v := range values {
+			set(&m, v)
+			expanded = append(expanded, m)
+		}
+	}
+	return expanded
+}
+
+// sweepGrid returns every combination of the values in cmd, starting
+// from base.
+func sweepGrid(base goconfig.ThermalMotion, cmd *SweepCmd) ([]goconfig.ThermalMotion, error) {
+	grid := []goconfig.ThermalMotion{base}
+	ints := []struct {
+		name   string
+		values string
+		set    func(*goconfig.ThermalMotion, int)
+	}{
+		{"delta-thresh", cmd.DeltaThresh, func(m *goconfig.ThermalMotion, v int) { m.DeltaThresh = uint16(v) }},
+		{"count-thresh", cmd.CountThresh, func(m *goconfig.ThermalMotion, v int) { m.CountThresh = v }},
+		{"trigger-frames", cmd.TriggerFrames, func(m *goconfig.ThermalMotion, v int) { m.TriggerFrames = v }},
+		{"frame-compare-gap", cmd.FrameCompareGap, func(m *goconfig.ThermalMotion, v int) { m.FrameCompareGap = v }},
+	}
+	for _, field := range ints {
+		values, err := parseIntValues(field.values)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", field.name, err)
+		}
+		grid = expandInts(grid, values, field.set)
+	}
+	bools := []struct {
+		name   string
+		values string
+		set    func(*goconfig.ThermalMotion, bool)
+	}{
+		{"use-one-diff-only", cmd.UseOneDiffOnly, func(m *goconfig.ThermalMotion, v bool) { m.UseOneDiffOnly = v }},
+		{"warmer-only", cmd.WarmerOnly, func(m *goconfig.ThermalMotion, v bool) { m.WarmerOnly = v }},
+		{"dynamic-threshold", cmd.DynamicThreshold, func(m *goconfig.ThermalMotion, v bool) { m.DynamicThreshold = v }},
+	}
+	for _, field := range bools {
+		values, err := parseBoolValues(field.values)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", field.name, err)
+		}
+		grid = expandBools(grid, values, field.set)
+	}
+	return grid, nil
+}
+
+// sweepScore is the F1 score of the frames detected, which balances
+// precision (including frames detected in noise) and recall.
+func sweepScore(s *evaluationScore) float64 {
+	if s.Precision == nil || s.Recall == nil || *s.Precision+*s.Recall == 0 {
+		return 0
+	}
+	return 2 * *s.Precision * *s.Recall / (*s.Precision + *s.Recall)
+}
+
+// sweep scores each set of motion settings in grid against the
+// labelled CPTV files in dir using workers goroutines. The results are
+// ranked best first. Settings which aren't valid are skipped.
+func sweep(conf *Config, grid []goconfig.ThermalMotion, dir string, labels map[string]fileLabels, workers int) ([]sweepResult, error) {
+	camera := new(TestCamera)
+	jobs := make(chan goconfig.ThermalMotion)
+	var (
+		mu       sync.Mutex
+		results  []sweepResult
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for motionConf := range jobs {
+				c := *conf
+				c.Motion = motionConf
+				c.Recorder.Window = window.Window{NoWindow: true}
+				if err := c.ValidateMotion(camera); err != nil {
+					log.Printf("skipping %+v: %v", motionConf, err)
+					continue
+				}
+				tester := NewCPTVPlaybackTester(&c)
+				tester.loadMotionConfig = false
+				tester.quiet = true
+				report, err := scoreResults(&c, tester.TestAllCPTVFiles(dir), labels)
+
+				mu.Lock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = err
+					}
+				} else {
+					results = append(results, sweepResult{
+						Score:  sweepScore(&report.Overall),
+						Motion: motionConf,
+						Result: report.Overall,
+					})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, m := range grid {
+		jobs <- m
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Result.FalseTriggers != b.Result.FalseTriggers {
+			return a.Result.FalseTriggers < b.Result.FalseTriggers
+		}
+		return latency(&a.Result) < latency(&b.Result)
+	})
+	for i := range results {
+		results[i].Rank = i + 1
+	}
+	return results, nil
+}
+
+func latency(s *evaluationScore) float64 {
+	if s.MeanLatencySecs == nil {
+		return 0
+	}
+	return *s.MeanLatencySecs
+}
+
+// writeSweepText writes up to top results as a table, or all of them if
+// top is 0.
+func writeSweepText(w io.Writer, results []sweepResult, top int) {
+	if top > 0 && top < len(results) {
+		results = results[:top]
+	}
+	fmt.Fprintf(w, "%4s %6s %9s %7s %6s %10s %7s %8s | %5s %5s %7s %3s %8s %6s %7s\n",
+		"rank", "score", "precision", "recall", "false", "false mins", "missed", "latency",
+		"delta", "count", "trigger", "gap", "one-diff", "warmer", "dynamic")
+	for _, r := range results {
+		fmt.Fprintf(w, "%4d %6.3f %9s %7s %6d %10.2f %7s %8s | %5d %5d %7d %3d %8t %6t %7t\n",
+			r.Rank,
+			r.Score,
+			formatRatio(r.Result.Precision),
+			formatRatio(r.Result.Recall),
+			r.Result.FalseTriggers,
+			r.Result.FalseTriggerMinutes,
+			fmt.Sprintf("%d/%d", r.Result.AnimalsMissed, r.Result.Animals),
+			formatRatio(r.Result.MeanLatencySecs),
+			r.Motion.DeltaThresh,
+			r.Motion.CountThresh,
+			r.Motion.TriggerFrames,
+			r.Motion.FrameCompareGap,
+			r.Motion.UseOneDiffOnly,
+			r.Motion.WarmerOnly,
+			r.Motion.DynamicThreshold)
+	}
+}
+
+// runSweep runs the sweep command.
+func runSweep(conf *Config, cmd *SweepCmd, w io.Writer) error {
+	dir := cmd.Dir
+	if dir == "" {
+		dir = defaultSweepDir
+	}
+	dir = filepath.Clean(dir)
+	labelsPath := cmd.Labels
+	if labelsPath == "" {
+		labelsPath = filepath.Join(dir, "labels.json")
+	}
+	labels, err := readLabels(labelsPath)
+	if err != nil {
+		return err
+	}
+
+	if err := conf.LoadMotionConfig(cmd.Model); err != nil {
+		return err
+	}
+	conf.Verbose = false
+	grid, err := sweepGrid(conf.Motion, cmd)
+	if err != nil {
+		return err
+	}
+	workers := cmd.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	log.Printf("sweeping %d motion configs using %d workers", len(grid), workers)
+	results, err := sweep(conf, grid, dir, labels, workers)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return errors.New("none of the motion configs were valid")
+	}
+	writeSweepText(w, results, cmd.Top)
+	if cmd.JSON != "" {
+		return writeJSONFile(cmd.JSON, results)
+	}
+	return nil
+}
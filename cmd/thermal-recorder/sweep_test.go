@@ -0,0 +1,89 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIntValues(t *testing.T) {
+	values, err := parseIntValues("30:60:10")
+	require.NoError(t, err)
+	assert.Equal(t, []int{30, 40, 50, 60}, values)
+
+	values, err = parseIntValues("1:3")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, values)
+
+	values, err = parseIntValues("5, 1,3")
+	require.NoError(t, err)
+	assert.Equal(t, []int{5, 1, 3}, values)
+
+	for _, invalid := range []string{"5:1", "1:5:0", "1:2:3:4", "a,b", "3:"} {
+		_, err := parseIntValues(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestSweepGrid(t *testing.T) {
+	base := CurrentConfig().Motion
+	grid, err := sweepGrid(base, &SweepCmd{
+		DeltaThresh:    "30,40",
+		CountThresh:    "1:3",
+		UseOneDiffOnly: "true,false",
+	})
+	require.NoError(t, err)
+	require.Len(t, grid, 12)
+	for _, m := range grid {
+		assert.Equal(t, base.FrameCompareGap, m.FrameCompareGap)
+		assert.Equal(t, base.TriggerFrames, m.TriggerFrames)
+	}
+	assert.EqualValues(t, 30, grid[0].DeltaThresh)
+	assert.Equal(t, 1, grid[0].CountThresh)
+	assert.True(t, grid[0].UseOneDiffOnly)
+	assert.EqualValues(t, 40, grid[11].DeltaThresh)
+	assert.Equal(t, 3, grid[11].CountThresh)
+	assert.False(t, grid[11].UseOneDiffOnly)
+
+	_, err = sweepGrid(base, &SweepCmd{WarmerOnly: "maybe"})
+	assert.EqualError(t, err, `warmer-only: invalid value "maybe"`)
+}
+
+func TestSweepRanksConfigs(t *testing.T) {
+	conf := CurrentConfig()
+	labels, err := readLabels(filepath.Join(GetBaseDir(), "motiontest", "labels.json"))
+	require.NoError(t, err)
+	grid, err := sweepGrid(conf.Motion, &SweepCmd{DeltaThresh: "20,50", TriggerFrames: "2,0"})
+	require.NoError(t, err)
+
+	results, err := sweep(conf, grid, filepath.Join(GetBaseDir(), "motiontest"), labels, 2)
+	require.NoError(t, err)
+
+	// 0 trigger frames isn't valid so is skipped.
+	require.Len(t, results, 2)
+	assert.Equal(t, 1, results[0].Rank)
+	assert.Equal(t, 2, results[1].Rank)
+	assert.True(t, results[0].Score >= results[1].Score)
+	for _, r := range results {
+		assert.Equal(t, 2, r.Motion.TriggerFrames)
+		assert.Equal(t, 7, r.Result.Animals)
+	}
+}
@@ -0,0 +1,119 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/TheCacophonyProject/thermal-recorder/loglimiter"
+)
+
+// slowSync is how long syncing a recording can take before a warning
+// is logged. It usually means the storage is failing.
+const slowSync = time.Second
+
+// syncLog limits the warnings about syncing, which could otherwise be
+// logged for every frame when storage is failing.
+var syncLog = loglimiter.New(time.Hour)
+
+// recordingSyncer syncs the frames written to a recording to storage
+// as set up by a SyncConfig.
+//
+// The CPTV writer writes frames uncompressed to the raw temporary file
+// and only compresses them when the recording is closed, so it is the
+// raw file that is synced. The writer buffers up to 4KB, so part of
+// the latest frame may still be lost.
+type recordingSyncer struct {
+	f        *os.File
+	conf     SyncConfig
+	frames   int
+	lastSync time.Time
+}
+
+// newRecordingSyncer returns a recordingSyncer for the recording being
+// written to tempName, or nil if syncing is turned off. The directory
+// is synced so the recording's files are there after a power cut.
+func newRecordingSyncer(tempName string, conf SyncConfig) (*recordingSyncer, error) {
+	if !conf.enabled() {
+		return nil, nil
+	}
+	if err := syncFile(filepath.Dir(tempName)); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(tempName+rawTempExt, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingSyncer{
+		f:        f,
+		conf:     conf,
+		lastSync: time.Now(),
+	}, nil
+}
+
+// frameWritten is called after each frame is written, and syncs the
+// recording when enough frames or time have gone by. Failing to sync
+// is logged rather than failing the frame, which has been written.
+// A nil recordingSyncer does nothing.
+func (s *recordingSyncer) frameWritten() {
+	if s == nil {
+		return
+	}
+	s.frames++
+	if (s.conf.Frames > 0 && s.frames >= s.conf.Frames) ||
+		(s.conf.Interval > 0 && time.Since(s.lastSync) >= s.conf.Interval) {
+		s.sync()
+	}
+}
+
+func (s *recordingSyncer) sync() {
+	if err := timedSync(s.f); err != nil {
+		syncLog.Printf("failed to sync recording: %v", err)
+	}
+	s.frames = 0
+	s.lastSync = time.Now()
+}
+
+func (s *recordingSyncer) close() {
+	if s != nil {
+		s.f.Close()
+	}
+}
+
+// timedSync syncs f, recording how long it takes.
+func timedSync(f *os.File) error {
+	start := time.Now()
+	err := f.Sync()
+	took := time.Since(start)
+	syncTime.Observe(took.Seconds())
+	if took >= slowSync {
+		syncLog.Printf("syncing %s took %v, storage may be failing", f.Name(), took.Round(time.Millisecond))
+	}
+	return err
+}
+
+// syncFile syncs the file or directory at name.
+func syncFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return timedSync(f)
+}
@@ -0,0 +1,84 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncEveryFrames(t *testing.T) {
+	rec, _, cleanup := newTestFileRecorder(t)
+	defer cleanup()
+	rec.sync = SyncConfig{Frames: 3}
+	camera := new(TestCamera)
+
+	require.NoError(t, rec.StartRecording(cptvframe.NewFrame(camera), 3000))
+	require.NotNil(t, rec.syncer)
+	frame := cptvframe.NewFrame(camera)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, rec.WriteFrame(frame))
+	}
+	assert.Equal(t, 2, rec.syncer.frames)
+	require.NoError(t, rec.WriteFrame(frame))
+	assert.Equal(t, 0, rec.syncer.frames)
+	require.NoError(t, rec.WriteFrame(frame))
+	assert.Equal(t, 1, rec.syncer.frames)
+
+	require.NoError(t, rec.StopRecording())
+	assert.Nil(t, rec.syncer)
+}
+
+func TestSyncInterval(t *testing.T) {
+	rec, _, cleanup := newTestFileRecorder(t)
+	defer cleanup()
+	rec.sync = SyncConfig{Interval: time.Minute}
+	camera := new(TestCamera)
+
+	require.NoError(t, rec.StartRecording(cptvframe.NewFrame(camera), 3000))
+	frame := cptvframe.NewFrame(camera)
+	require.NoError(t, rec.WriteFrame(frame))
+	assert.Equal(t, 1, rec.syncer.frames)
+
+	rec.syncer.lastSync = time.Now().Add(-time.Minute)
+	require.NoError(t, rec.WriteFrame(frame))
+	assert.Equal(t, 0, rec.syncer.frames)
+	assert.WithinDuration(t, time.Now(), rec.syncer.lastSync, time.Second)
+
+	rec.Stop()
+	assert.Nil(t, rec.syncer)
+}
+
+func TestSyncDisabled(t *testing.T) {
+	rec, dir, cleanup := newTestFileRecorder(t)
+	defer cleanup()
+	rec.sync = SyncConfig{}
+	camera := new(TestCamera)
+
+	require.NoError(t, rec.StartRecording(cptvframe.NewFrame(camera), 3000))
+	assert.Nil(t, rec.syncer)
+	require.NoError(t, rec.WriteFrame(cptvframe.NewFrame(camera)))
+	require.NoError(t, rec.StopRecording())
+
+	recordings, _ := filepath.Glob(filepath.Join(dir, "*.cptv"))
+	assert.Len(t, recordings, 1)
+}
@@ -38,7 +38,9 @@ type bufferedFile struct {
 }
 
 func (bf *bufferedFile) Write(p []byte) (int, error) {
-	return bf.w.Write(p)
+	n, err := bf.w.Write(p)
+	bytesWritten.Add(uint64(n))
+	return n, err
 }
 
 func (bf *bufferedFile) Close() error {
@@ -18,6 +18,8 @@ package main
 
 import (
 	goconfig "github.com/TheCacophonyProject/go-config"
+
+	"github.com/TheCacophonyProject/thermal-recorder/metrics"
 )
 
 type Config struct {
@@ -26,6 +28,7 @@ type Config struct {
 	FrameInput   string
 	OutputDir    string
 	MinDiskSpace uint64
+	Metrics      metrics.Config
 }
 
 func ParseConfig(configFolder string) (*Config, error) {
@@ -44,10 +47,16 @@ func ParseConfig(configFolder string) (*Config, error) {
 		return nil, err
 	}
 
+	metricsConfig, err := metrics.NewConfig(configRW, metricsKey)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Config{
 		DeviceID:   deviceConfig.ID,
 		DeviceName: deviceConfig.Name,
 		FrameInput: leptonConfig.FrameOutput,
 		OutputDir:  "/var/spool/thermal-raw",
+		Metrics:    *metricsConfig,
 	}, nil
 }
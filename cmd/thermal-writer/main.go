@@ -18,7 +18,6 @@ package main
 
 import (
 	"bufio"
-	"io"
 	"log"
 	"net"
 	"os"
@@ -27,7 +26,9 @@ import (
 	config "github.com/TheCacophonyProject/go-config"
 	arg "github.com/alexflint/go-arg"
 
+	"github.com/TheCacophonyProject/thermal-recorder/framesocket"
 	"github.com/TheCacophonyProject/thermal-recorder/headers"
+	"github.com/TheCacophonyProject/thermal-recorder/metrics"
 )
 
 var (
@@ -76,6 +77,9 @@ func runMain() error {
 	}
 
 	logConfig(conf)
+	if err := metrics.Start(&conf.Metrics); err != nil {
+		return err
+	}
 
 	for {
 		// Set up listener for frames sent by leptond.
@@ -109,6 +113,10 @@ func handleConn(conn net.Conn, conf *Config, logFrameRate bool) error {
 	}
 
 	log.Printf("connection from %s %s (%dx%d@%dfps)", header.Brand(), header.Model(), header.ResX(), header.ResY(), header.FPS())
+	frames, err := framesocket.NewReader(reader, header)
+	if err != nil {
+		return err
+	}
 
 	const inFlight = 256
 
@@ -129,12 +137,18 @@ func handleConn(conn net.Conn, conf *Config, logFrameRate bool) error {
 	t0 := time.Now()
 	for {
 		frame := <-spentFrames
-		_, err := io.ReadFull(reader, frame)
+		msg, err := frames.ReadMessage(frame)
 		if err != nil {
 			close(writeFrames)
 			return err
 		}
+		if msg.Type != framesocket.Frame {
+			log.Printf("%s received", msg.Type)
+			spentFrames <- frame
+			continue
+		}
 		totalFrames++
+		framesReceived.Inc()
 
 		if logFrameRate {
 			count++
@@ -153,6 +167,7 @@ func handleConn(conn net.Conn, conf *Config, logFrameRate bool) error {
 
 		writeFrames <- frame
 		chLen := len(writeFrames)
+		writeBacklog.Set(float64(chLen))
 		if chLen > 10 && totalFrames%60 == 0 {
 			log.Printf("warning: high write backlog (%d)", chLen)
 		}
@@ -179,9 +194,11 @@ func writer(inFrames <-chan []byte, conf *Config, h *headers.HeaderInfo, outFram
 				builder.Close()
 				return
 			}
+			start := time.Now()
 			if err := writeFrame(builder, frame); err != nil {
 				panic(err)
 			}
+			frameWriteTime.ObserveSince(start)
 			outFrames <- frame // Return the frame to be reused
 		}
 	}
@@ -0,0 +1,31 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "github.com/TheCacophonyProject/thermal-recorder/metrics"
+
+// metricsKey is the config section for exporting thermal-writer's
+// metrics.
+const metricsKey = "thermal-writer-metrics"
+
+var (
+	framesReceived = metrics.NewCounter("thermal_writer_frames_total", "Frames received from the camera.")
+	filesStarted   = metrics.NewCounter("thermal_writer_files_total", "CPTR files started.")
+	bytesWritten   = metrics.NewCounter("thermal_writer_bytes_written_total", "Bytes written to CPTR files.")
+	writeBacklog   = metrics.NewGauge("thermal_writer_write_backlog_frames", "Frames waiting to be written.")
+	frameWriteTime = metrics.NewHistogram("thermal_writer_frame_write_seconds", "Time taken to write each frame.", metrics.LatencyBuckets)
+)
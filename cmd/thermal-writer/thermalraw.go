@@ -67,6 +67,7 @@ func writeFrame(b *Builder, frame []byte) error {
 func nextFile(outDir string) (*bufferedFile, error) {
 	n := nextFileName(outDir)
 	log.Println("writing to", n)
+	filesStarted.Inc()
 	return newBufferedFile(n)
 }
 
@@ -0,0 +1,363 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package fanout sends the messages written to the frame socket to
+// any number of consumers. Each consumer has its own bounded queue so
+// a slow consumer only causes its own frames to be dropped and never
+// blocks the camera. Commands are never dropped; a consumer which falls
+// so far behind that its queue fills with commands is disconnected
+// instead.
+package fanout
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	dialRetryInterval = time.Second
+	dropLogInterval   = 10 * time.Second
+)
+
+// New returns a Broker which sends header to each subscriber when it
+// connects and then queues up to queueLen messages for it. isCommand
+// reports whether a message is a command rather than a frame; every
+// message is treated as a frame if it is nil.
+func New(header []byte, queueLen int, isCommand func(msg []byte) bool) *Broker {
+	if queueLen < 1 {
+		queueLen = 1
+	}
+	return &Broker{
+		header:      header,
+		queueLen:    queueLen,
+		isCommand:   isCommand,
+		subscribers: make(map[*subscriber]struct{}),
+		closed:      make(chan struct{}),
+	}
+}
+
+// Broker distributes messages to subscribers. Each call to Write must
+// contain exactly one complete message (as framesocket.Writer does) so
+// that messages are only ever dropped whole.
+type Broker struct {
+	header    []byte
+	queueLen  int
+	isCommand func(msg []byte) bool
+
+	mu          sync.Mutex
+	subscribers map[*subscriber]struct{}
+	dropped     uint64
+	listeners   []net.Listener
+	closed      chan struct{}
+	isClosed    bool
+}
+
+type subscriber struct {
+	name string
+	conn net.Conn
+	// queue holds the messages waiting to be sent. It is guarded by
+	// the Broker's mu and ready is signalled when a message is added.
+	queue       []queuedMessage
+	ready       chan struct{}
+	done        chan struct{}
+	dropped     int
+	lastDropLog time.Time
+}
+
+type queuedMessage struct {
+	msg     []byte
+	command bool
+}
+
+// Write queues a copy of msg for every subscriber. If a subscriber's
+// queue is full its oldest frame is dropped. Write never blocks on a
+// subscriber and always succeeds.
+func (b *Broker) Write(msg []byte) (int, error) {
+	qm := queuedMessage{msg: make([]byte, len(msg))}
+	copy(qm.msg, msg)
+	qm.command = b.isCommand != nil && b.isCommand(qm.msg)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subscribers {
+		dropped, ok := s.enqueue(qm, b.queueLen)
+		b.dropped += uint64(dropped)
+		if !ok {
+			// Its queue is full of commands, which can't be dropped
+			// without the subscriber losing track of the camera.
+			// Reconnecting starts it again from the header.
+			log.Printf("%s has stopped reading, disconnecting it", s.name)
+			delete(b.subscribers, s)
+			s.conn.Close()
+		}
+	}
+	return len(msg), nil
+}
+
+// enqueue queues qm, returning the number of frames dropped to make
+// room for it. When the queue is full its oldest frame is dropped, or
+// qm itself if it is a frame and only commands are queued. false is
+// returned if qm is a command and the queue is full of commands.
+func (s *subscriber) enqueue(qm queuedMessage, queueLen int) (int, bool) {
+	dropped := 0
+	if len(s.queue) >= queueLen {
+		i := s.oldestFrame()
+		if i < 0 {
+			if qm.command {
+				return 0, false
+			}
+			s.logDropped(1)
+			return 1, true
+		}
+		s.queue = append(s.queue[:i], s.queue[i+1:]...)
+		dropped = 1
+	}
+	s.queue = append(s.queue, qm)
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+	if dropped > 0 {
+		s.logDropped(dropped)
+	}
+	return dropped, true
+}
+
+func (s *subscriber) logDropped(n int) {
+	s.dropped += n
+	now := time.Now()
+	if now.Sub(s.lastDropLog) >= dropLogInterval {
+		log.Printf("%s is too slow, %d frames dropped", s.name, s.dropped)
+		s.lastDropLog = now
+	}
+}
+
+// oldestFrame returns the index of the first frame in the queue, or -1
+// if there isn't one.
+func (s *subscriber) oldestFrame() int {
+	for i, qm := range s.queue {
+		if !qm.command {
+			return i
+		}
+	}
+	return -1
+}
+
+// next takes the next message to send to s, or returns false if its
+// queue is empty.
+func (b *Broker) next(s *subscriber) ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(s.queue) == 0 {
+		return nil, false
+	}
+	msg := s.queue[0].msg
+	s.queue[0] = queuedMessage{}
+	s.queue = s.queue[1:]
+	return msg, true
+}
+
+// Subscribers returns the number of connected subscribers.
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+// Backlog returns the largest number of messages waiting to be sent
+// to a subscriber.
+func (b *Broker) Backlog() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	backlog := 0
+	for s := range b.subscribers {
+		if n := len(s.queue); n > backlog {
+			backlog = n
+		}
+	}
+	return backlog
+}
+
+// Dropped returns the number of frames dropped because subscribers
+// were too slow.
+func (b *Broker) Dropped() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dropped
+}
+
+// Dial repeatedly connects to the unix socket at path, sending
+// messages to it while connected, until the Broker is closed. This
+// is how consumers which listen for the camera (such as
+// thermal-recorder) are fed.
+func (b *Broker) Dial(path string) {
+	waiting := false
+	for {
+		conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Net: "unix", Name: path})
+		if err != nil {
+			if !waiting {
+				log.Printf("waiting for %s to be available", path)
+				waiting = true
+			}
+			select {
+			case <-b.closed:
+				return
+			case <-time.After(dialRetryInterval):
+			}
+			continue
+		}
+		waiting = false
+
+		s := b.subscribe(path, conn)
+		if s == nil {
+			return
+		}
+		<-s.done
+		select {
+		case <-b.closed:
+			return
+		case <-time.After(dialRetryInterval):
+		}
+	}
+}
+
+// Listen accepts subscribers on a unix socket at path until the
+// Broker is closed.
+func (b *Broker) Listen(path string) error {
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	if b.isClosed {
+		b.mu.Unlock()
+		listener.Close()
+		return nil
+	}
+	b.listeners = append(b.listeners, listener)
+	b.mu.Unlock()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			b.subscribe(path+" subscriber", conn)
+		}
+	}()
+	return nil
+}
+
+// subscribe starts sending to conn. It returns nil if the Broker has
+// been closed.
+func (b *Broker) subscribe(name string, conn net.Conn) *subscriber {
+	s := &subscriber{
+		name:  name,
+		conn:  conn,
+		ready: make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	b.mu.Lock()
+	if b.isClosed {
+		b.mu.Unlock()
+		conn.Close()
+		return nil
+	}
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+
+	log.Printf("sending frames to %s", name)
+	go b.run(s)
+	return s
+}
+
+func (b *Broker) run(s *subscriber) {
+	defer close(s.done)
+	defer s.conn.Close()
+	defer b.unsubscribe(s)
+
+	// Subscribers don't send anything, so a read only returns when
+	// the subscriber disconnects. This notices disconnection even when
+	// no frames are being sent.
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, s.conn)
+		close(gone)
+	}()
+
+	if _, err := s.conn.Write(b.header); err != nil {
+		log.Printf("%s disconnected: %v", s.name, err)
+		return
+	}
+	for {
+		select {
+		case <-b.closed:
+			return
+		case <-gone:
+			log.Printf("%s disconnected", s.name)
+			return
+		case <-s.ready:
+			for {
+				msg, ok := b.next(s)
+				if !ok {
+					break
+				}
+				if _, err := s.conn.Write(msg); err != nil {
+					log.Printf("%s disconnected: %v", s.name, err)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *Broker) unsubscribe(s *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscribers, s)
+}
+
+// Close disconnects all subscribers and stops dialing and listening.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	if b.isClosed {
+		b.mu.Unlock()
+		return
+	}
+	b.isClosed = true
+	close(b.closed)
+	listeners := b.listeners
+	subscribers := make([]*subscriber, 0, len(b.subscribers))
+	for s := range b.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	b.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener.Close()
+	}
+	for _, s := range subscribers {
+		s.conn.Close() // Unblocks any write in progress.
+		<-s.done
+	}
+}
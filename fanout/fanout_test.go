@@ -0,0 +1,217 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package fanout
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "fanout")
+	require.NoError(t, err)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func waitForSubscribers(b *Broker, n int) {
+	for b.Subscribers() != n {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func readN(t *testing.T, conn net.Conn, n int) string {
+	buf := make([]byte, n)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err := io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	return string(buf)
+}
+
+func TestMultipleSubscribers(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	// One consumer listens for the broker, as thermal-recorder does.
+	outputPath := filepath.Join(dir, "output")
+	listener, err := net.Listen("unix", outputPath)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	b := New([]byte("header\n\n"), 10, nil)
+	defer b.Close()
+	go b.Dial(outputPath)
+	output, err := listener.Accept()
+	require.NoError(t, err)
+	defer output.Close()
+
+	// Another connects to the broker.
+	subscribePath := filepath.Join(dir, "subscribe")
+	require.NoError(t, b.Listen(subscribePath))
+	client, err := net.Dial("unix", subscribePath)
+	require.NoError(t, err)
+	defer client.Close()
+
+	waitForSubscribers(b, 2)
+	b.Write([]byte("one"))
+	b.Write([]byte("two"))
+
+	assert.Equal(t, "header\n\nonetwo", readN(t, output, 14))
+	assert.Equal(t, "header\n\nonetwo", readN(t, client, 14))
+}
+
+func TestSlowSubscriberDropsOldest(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	subscribePath := filepath.Join(dir, "subscribe")
+	b := New([]byte("h"), 2, nil)
+	defer b.Close()
+	require.NoError(t, b.Listen(subscribePath))
+
+	slow, err := net.Dial("unix", subscribePath)
+	require.NoError(t, err)
+	defer slow.Close()
+	waitForSubscribers(b, 1)
+
+	// Fill the socket buffers so the broker's write to the slow
+	// subscriber blocks, then write more than its queue holds.
+	big := make([]byte, 1<<20)
+	b.Write(big)
+	time.Sleep(50 * time.Millisecond)
+	for _, msg := range []string{"a", "b", "c", "d"} {
+		b.Write([]byte(msg))
+	}
+	assert.Equal(t, 2, b.Backlog())
+	assert.Equal(t, uint64(2), b.Dropped())
+
+	assert.Equal(t, "h", readN(t, slow, 1))
+	readN(t, slow, len(big))
+	assert.Equal(t, "cd", readN(t, slow, 2))
+}
+
+func TestSlowSubscriberKeepsCommands(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	subscribePath := filepath.Join(dir, "subscribe")
+	isCommand := func(msg []byte) bool { return msg[0] == 'C' }
+	b := New([]byte("h"), 3, isCommand)
+	defer b.Close()
+	require.NoError(t, b.Listen(subscribePath))
+
+	slow, err := net.Dial("unix", subscribePath)
+	require.NoError(t, err)
+	defer slow.Close()
+	waitForSubscribers(b, 1)
+
+	big := make([]byte, 1<<20)
+	b.Write(big)
+	time.Sleep(50 * time.Millisecond)
+	for _, msg := range []string{"a", "C1", "b", "C2", "c"} {
+		b.Write([]byte(msg))
+	}
+	assert.Equal(t, 3, b.Backlog())
+	assert.Equal(t, uint64(2), b.Dropped())
+
+	assert.Equal(t, "h", readN(t, slow, 1))
+	readN(t, slow, len(big))
+	assert.Equal(t, "C1C2c", readN(t, slow, 5))
+}
+
+func TestStalledSubscriberDisconnected(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	subscribePath := filepath.Join(dir, "subscribe")
+	isCommand := func(msg []byte) bool { return msg[0] == 'C' }
+	b := New([]byte("h"), 2, isCommand)
+	defer b.Close()
+	require.NoError(t, b.Listen(subscribePath))
+
+	stalled, err := net.Dial("unix", subscribePath)
+	require.NoError(t, err)
+	defer stalled.Close()
+	waitForSubscribers(b, 1)
+
+	big := make([]byte, 1<<20)
+	b.Write(big)
+	time.Sleep(50 * time.Millisecond)
+	for _, msg := range []string{"C1", "a", "C2"} {
+		b.Write([]byte(msg))
+	}
+	assert.Equal(t, 1, b.Subscribers())
+
+	// A command that doesn't fit disconnects it.
+	b.Write([]byte("C3"))
+	assert.Equal(t, 0, b.Subscribers())
+	assert.Equal(t, 0, b.Backlog())
+
+	stalled.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.Copy(ioutil.Discard, stalled)
+	assert.NoError(t, err)
+}
+
+func TestDisconnectedSubscriberRemoved(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	subscribePath := filepath.Join(dir, "subscribe")
+	b := New([]byte("h"), 2, nil)
+	defer b.Close()
+	require.NoError(t, b.Listen(subscribePath))
+
+	client, err := net.Dial("unix", subscribePath)
+	require.NoError(t, err)
+	waitForSubscribers(b, 1)
+	client.Close()
+
+	// Writes fail once the broker notices the subscriber has gone.
+	for b.Subscribers() != 0 {
+		b.Write([]byte("x"))
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDialReconnects(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	outputPath := filepath.Join(dir, "output")
+	b := New([]byte("h"), 2, nil)
+	defer b.Close()
+	go b.Dial(outputPath)
+
+	for i := 0; i < 2; i++ {
+		listener, err := net.Listen("unix", outputPath)
+		require.NoError(t, err)
+		conn, err := listener.Accept()
+		require.NoError(t, err)
+		listener.Close()
+
+		assert.Equal(t, "h", readN(t, conn, 1))
+		conn.Close()
+		os.Remove(outputPath)
+	}
+}
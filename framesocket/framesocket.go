@@ -0,0 +1,311 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package framesocket implements the protocol used to send frames
+// from leptond to the programs that consume them.
+//
+// A connection starts with a YAML header describing the camera (see
+// the headers package) followed by a blank line. When the header
+// includes a ProtocolVersion, every message after it is framed as:
+//
+//	type    1 byte
+//	length  4 bytes, big endian, length of the payload
+//	payload
+//
+// Frame payloads start with a sequence number (8 bytes) and the
+// capture time in nanoseconds since the Unix epoch (8 bytes),
+// followed by the raw frame. Command payloads contain just the time
+// the command was sent. Readers skip message types they don't know.
+//
+// Headers without a ProtocolVersion use the legacy protocol, where
+// raw frames are written back to back and the only command is the
+// string "clear".
+package framesocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/TheCacophonyProject/thermal-recorder/headers"
+)
+
+// Version is the latest protocol version supported.
+const Version = 1
+
+// LegacyVersion is the unversioned protocol used by older peers.
+const LegacyVersion = 0
+
+const (
+	legacyClear = "clear"
+
+	messageHeaderLen = 5
+	timestampLen     = 8
+	frameMetaLen     = 8 + timestampLen
+)
+
+// MessageType identifies the kind of message sent over the socket.
+type MessageType byte
+
+const (
+	// Frame carries a raw frame from the camera.
+	Frame MessageType = 'F'
+
+	// Clear asks consumers to discard any buffered frames.
+	Clear MessageType = 'C'
+
+	// CameraRestarted is sent after the camera has been restarted.
+	// Buffered frames should be discarded.
+	CameraRestarted MessageType = 'R'
+
+	// FFCStarted is sent when a flat field correction has been
+	// requested.
+	FFCStarted MessageType = 'S'
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case Frame:
+		return "frame"
+	case Clear:
+		return "clear"
+	case CameraRestarted:
+		return "camera-restarted"
+	case FFCStarted:
+		return "ffc-started"
+	}
+	return fmt.Sprintf("unknown(%d)", byte(t))
+}
+
+// Message is a single message read from the socket. For Frame
+// messages, Frame holds the raw frame.
+type Message struct {
+	Type      MessageType
+	Seq       uint64
+	Timestamp time.Time
+	Frame     []byte
+}
+
+// NewWriter returns a Writer which sends messages using the protocol
+// version given. The header must be written to w beforehand.
+func NewWriter(w io.Writer, version int) *Writer {
+	return &Writer{
+		w:       w,
+		version: version,
+	}
+}
+
+// Writer sends frames and commands. It is safe for concurrent use.
+type Writer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	version int
+	seq     uint64
+	buf     []byte
+}
+
+// Version returns the protocol version being written.
+func (w *Writer) Version() int {
+	return w.version
+}
+
+// WriteFrame sends a raw frame captured at the time given. Frames are
+// numbered in the order they are written.
+func (w *Writer) WriteFrame(frame []byte, captured time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq++
+	if w.version == LegacyVersion {
+		_, err := w.w.Write(frame)
+		return err
+	}
+
+	size := messageHeaderLen + frameMetaLen + len(frame)
+	if cap(w.buf) < size {
+		w.buf = make([]byte, size)
+	}
+	buf := w.buf[:size]
+	putMessageHeader(buf, Frame, frameMetaLen+len(frame))
+	binary.BigEndian.PutUint64(buf[messageHeaderLen:], w.seq)
+	binary.BigEndian.PutUint64(buf[messageHeaderLen+8:], uint64(captured.UnixNano()))
+	copy(buf[messageHeaderLen+frameMetaLen:], frame)
+	_, err := w.w.Write(buf)
+	return err
+}
+
+// WriteCommand sends a command message. With the legacy protocol,
+// Clear and CameraRestarted are both sent as "clear" and other
+// commands are dropped.
+func (w *Writer) WriteCommand(t MessageType) error {
+	if t == Frame {
+		return fmt.Errorf("%v is not a command", t)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.version == LegacyVersion {
+		if t == Clear || t == CameraRestarted {
+			_, err := io.WriteString(w.w, legacyClear)
+			return err
+		}
+		return nil
+	}
+
+	buf := make([]byte, messageHeaderLen+timestampLen)
+	putMessageHeader(buf, t, timestampLen)
+	binary.BigEndian.PutUint64(buf[messageHeaderLen:], uint64(time.Now().UnixNano()))
+	_, err := w.w.Write(buf)
+	return err
+}
+
+// IsCommand reports whether msg, a single message written by a Writer
+// using the protocol version given, is a command rather than a frame.
+func IsCommand(msg []byte, version int) bool {
+	if version == LegacyVersion {
+		return string(msg) == legacyClear
+	}
+	return len(msg) > 0 && MessageType(msg[0]) != Frame
+}
+
+func putMessageHeader(buf []byte, t MessageType, length int) {
+	buf[0] = byte(t)
+	binary.BigEndian.PutUint32(buf[1:], uint32(length))
+}
+
+// NewReader returns a Reader for the messages which follow the header
+// given. An error is returned if the peer is using a newer protocol
+// version than is supported.
+func NewReader(r *bufio.Reader, header *headers.HeaderInfo) (*Reader, error) {
+	version := header.ProtocolVersion()
+	if version > Version {
+		return nil, fmt.Errorf("unsupported frame protocol version %d (max %d)", version, Version)
+	}
+	return &Reader{
+		r:         r,
+		version:   version,
+		frameSize: header.FrameSize(),
+	}, nil
+}
+
+// Reader reads messages sent by a Writer.
+type Reader struct {
+	r         *bufio.Reader
+	version   int
+	frameSize int
+	seq       uint64
+}
+
+// Version returns the protocol version being read.
+func (r *Reader) Version() int {
+	return r.version
+}
+
+// ReadMessage reads the next message. Frames are read into frame,
+// which must be the frame size given in the header, and
+// Message.Frame refers to it.
+//
+// With the legacy protocol, frames are numbered as they are read and
+// timestamped with the time they were read.
+func (r *Reader) ReadMessage(frame []byte) (*Message, error) {
+	if len(frame) != r.frameSize {
+		return nil, fmt.Errorf("frame buffer is %d bytes, expected %d", len(frame), r.frameSize)
+	}
+	if r.version == LegacyVersion {
+		return r.readLegacy(frame)
+	}
+
+	for {
+		var hdr [messageHeaderLen]byte
+		if _, err := io.ReadFull(r.r, hdr[:]); err != nil {
+			return nil, err
+		}
+		t := MessageType(hdr[0])
+		length := int(binary.BigEndian.Uint32(hdr[1:]))
+
+		switch t {
+		case Frame:
+			return r.readFrame(frame, length)
+		case Clear, CameraRestarted, FFCStarted:
+			return r.readCommand(t, length)
+		}
+		if _, err := io.CopyN(ioutil.Discard, r.r, int64(length)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (r *Reader) readFrame(frame []byte, length int) (*Message, error) {
+	if length != frameMetaLen+r.frameSize {
+		return nil, fmt.Errorf("frame message is %d bytes, expected %d", length, frameMetaLen+r.frameSize)
+	}
+	var meta [frameMetaLen]byte
+	if _, err := io.ReadFull(r.r, meta[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r.r, frame); err != nil {
+		return nil, err
+	}
+	return &Message{
+		Type:      Frame,
+		Seq:       binary.BigEndian.Uint64(meta[:]),
+		Timestamp: fromNanos(meta[8:]),
+		Frame:     frame,
+	}, nil
+}
+
+func (r *Reader) readCommand(t MessageType, length int) (*Message, error) {
+	if length < timestampLen {
+		return nil, fmt.Errorf("%v message too short (%d bytes)", t, length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r.r, payload); err != nil {
+		return nil, err
+	}
+	return &Message{
+		Type:      t,
+		Timestamp: fromNanos(payload),
+	}, nil
+}
+
+func (r *Reader) readLegacy(frame []byte) (*Message, error) {
+	n := len(legacyClear)
+	if _, err := io.ReadFull(r.r, frame[:n]); err != nil {
+		return nil, err
+	}
+	if string(frame[:n]) == legacyClear {
+		return &Message{
+			Type:      Clear,
+			Timestamp: time.Now(),
+		}, nil
+	}
+	if _, err := io.ReadFull(r.r, frame[n:]); err != nil {
+		return nil, err
+	}
+	r.seq++
+	return &Message{
+		Type:      Frame,
+		Seq:       r.seq,
+		Timestamp: time.Now(),
+		Frame:     frame,
+	}, nil
+}
+
+func fromNanos(b []byte) time.Time {
+	return time.Unix(0, int64(binary.BigEndian.Uint64(b)))
+}
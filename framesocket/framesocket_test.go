@@ -0,0 +1,187 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package framesocket
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/TheCacophonyProject/thermal-recorder/headers"
+)
+
+const testFrameSize = 10
+
+func newHeader(t *testing.T, version int) *headers.HeaderInfo {
+	yaml := fmt.Sprintf("%s: %d\n", headers.FrameSize, testFrameSize)
+	if version != LegacyVersion {
+		yaml += fmt.Sprintf("%s: %d\n", headers.ProtocolVersion, version)
+	}
+	header, err := headers.ReadHeaderInfo(bufio.NewReader(strings.NewReader(yaml + "\n")))
+	require.NoError(t, err)
+	return header
+}
+
+func testFrame(b byte) []byte {
+	return bytes.Repeat([]byte{b}, testFrameSize)
+}
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Version)
+	t0 := time.Unix(1600000000, 123456789)
+	require.NoError(t, w.WriteFrame(testFrame(1), t0))
+	require.NoError(t, w.WriteCommand(FFCStarted))
+	require.NoError(t, w.WriteFrame(testFrame(2), t0.Add(time.Second)))
+	require.NoError(t, w.WriteCommand(CameraRestarted))
+	require.NoError(t, w.WriteCommand(Clear))
+
+	r, err := NewReader(bufio.NewReader(&buf), newHeader(t, Version))
+	require.NoError(t, err)
+	assert.Equal(t, Version, r.Version())
+	frame := make([]byte, testFrameSize)
+
+	msg, err := r.ReadMessage(frame)
+	require.NoError(t, err)
+	assert.Equal(t, Frame, msg.Type)
+	assert.Equal(t, uint64(1), msg.Seq)
+	assert.True(t, t0.Equal(msg.Timestamp))
+	assert.Equal(t, testFrame(1), msg.Frame)
+
+	msg, err = r.ReadMessage(frame)
+	require.NoError(t, err)
+	assert.Equal(t, FFCStarted, msg.Type)
+	assert.False(t, msg.Timestamp.IsZero())
+
+	msg, err = r.ReadMessage(frame)
+	require.NoError(t, err)
+	assert.Equal(t, Frame, msg.Type)
+	assert.Equal(t, uint64(2), msg.Seq)
+	assert.True(t, t0.Add(time.Second).Equal(msg.Timestamp))
+	assert.Equal(t, testFrame(2), msg.Frame)
+
+	for _, expected := range []MessageType{CameraRestarted, Clear} {
+		msg, err = r.ReadMessage(frame)
+		require.NoError(t, err)
+		assert.Equal(t, expected, msg.Type)
+	}
+
+	_, err = r.ReadMessage(frame)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestFrameStartingWithClear(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Version)
+	frame := []byte("clear-ish!")
+	require.NoError(t, w.WriteFrame(frame, time.Now()))
+
+	r, err := NewReader(bufio.NewReader(&buf), newHeader(t, Version))
+	require.NoError(t, err)
+	msg, err := r.ReadMessage(make([]byte, testFrameSize))
+	require.NoError(t, err)
+	assert.Equal(t, Frame, msg.Type)
+	assert.Equal(t, frame, msg.Frame)
+}
+
+func TestUnknownMessagesSkipped(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write([]byte{'?', 0, 0, 0, 3, 1, 2, 3})
+	require.NoError(t, NewWriter(&buf, Version).WriteFrame(testFrame(7), time.Now()))
+
+	r, err := NewReader(bufio.NewReader(&buf), newHeader(t, Version))
+	require.NoError(t, err)
+	msg, err := r.ReadMessage(make([]byte, testFrameSize))
+	require.NoError(t, err)
+	assert.Equal(t, Frame, msg.Type)
+	assert.Equal(t, testFrame(7), msg.Frame)
+}
+
+func TestWrongFrameSize(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewWriter(&buf, Version).WriteFrame(testFrame(1)[:4], time.Now()))
+
+	r, err := NewReader(bufio.NewReader(&buf), newHeader(t, Version))
+	require.NoError(t, err)
+	_, err = r.ReadMessage(make([]byte, testFrameSize))
+	assert.Error(t, err)
+}
+
+func TestLegacy(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, LegacyVersion)
+	require.NoError(t, w.WriteFrame(testFrame(1), time.Now()))
+	require.NoError(t, w.WriteCommand(FFCStarted))
+	require.NoError(t, w.WriteCommand(CameraRestarted))
+	require.NoError(t, w.WriteFrame(testFrame(2), time.Now()))
+	assert.Equal(t, string(testFrame(1))+"clear"+string(testFrame(2)), buf.String())
+
+	r, err := NewReader(bufio.NewReader(&buf), newHeader(t, LegacyVersion))
+	require.NoError(t, err)
+	assert.Equal(t, LegacyVersion, r.Version())
+	frame := make([]byte, testFrameSize)
+
+	msg, err := r.ReadMessage(frame)
+	require.NoError(t, err)
+	assert.Equal(t, Frame, msg.Type)
+	assert.Equal(t, uint64(1), msg.Seq)
+	assert.Equal(t, testFrame(1), msg.Frame)
+
+	msg, err = r.ReadMessage(frame)
+	require.NoError(t, err)
+	assert.Equal(t, Clear, msg.Type)
+
+	msg, err = r.ReadMessage(frame)
+	require.NoError(t, err)
+	assert.Equal(t, Frame, msg.Type)
+	assert.Equal(t, uint64(2), msg.Seq)
+	assert.Equal(t, testFrame(2), msg.Frame)
+}
+
+// messageWriter keeps each write separately.
+type messageWriter struct {
+	msgs [][]byte
+}
+
+func (w *messageWriter) Write(p []byte) (int, error) {
+	w.msgs = append(w.msgs, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func TestIsCommand(t *testing.T) {
+	for _, version := range []int{LegacyVersion, Version} {
+		mw := new(messageWriter)
+		w := NewWriter(mw, version)
+		require.NoError(t, w.WriteFrame(testFrame(1), time.Now()))
+		require.NoError(t, w.WriteCommand(CameraRestarted))
+		require.Len(t, mw.msgs, 2)
+		assert.False(t, IsCommand(mw.msgs[0], version))
+		assert.True(t, IsCommand(mw.msgs[1], version))
+	}
+}
+
+func TestNewerVersionRejected(t *testing.T) {
+	_, err := NewReader(bufio.NewReader(new(bytes.Buffer)), newHeader(t, Version+1))
+	assert.Error(t, err)
+}
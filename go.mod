@@ -11,8 +11,9 @@ require (
 	github.com/alexflint/go-arg v1.3.0
 	github.com/coreos/go-systemd v0.0.0-20190321100706-95778dfbb74e
 	github.com/godbus/dbus v4.1.0+incompatible
-	github.com/google/go-cmp v0.2.0
+	github.com/google/go-cmp v0.6.0
 	github.com/juju/ratelimit v1.0.1
+	github.com/nathan-osman/go-sunrise v0.0.0-20171121204956-7c449e7c690b
 	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
 	github.com/pelletier/go-toml v1.6.0 // indirect
 	github.com/rjeczalik/notify v0.9.3
@@ -21,6 +22,7 @@ require (
 	github.com/spf13/viper v1.5.0 // indirect
 	github.com/stretchr/testify v1.6.1
 	golang.org/x/net v0.0.0-20210323141857-08027d57d8cf // indirect
+	golang.org/x/sys v0.0.0-20210315160823-c6e025ad8005
 	golang.org/x/text v0.3.4 // indirect
 	gopkg.in/check.v1 v1.0.0-20200902074654-038fdea0a05b // indirect
 	gopkg.in/yaml.v1 v1.0.0-20140924161607-9f9df34309c0
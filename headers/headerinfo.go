@@ -35,6 +35,7 @@ type HeaderInfo struct {
 	model     string
 	serial    int
 	firmware  string
+	protocol  int
 }
 
 // ResX implements cptvframe.CameraSpec.
@@ -78,6 +79,13 @@ func (h *HeaderInfo) CameraSerial() int {
 	return h.serial
 }
 
+// ProtocolVersion returns the version of the frame socket protocol
+// used after the header. Peers which predate the versioned protocol
+// don't include a version, giving 0.
+func (h *HeaderInfo) ProtocolVersion() int {
+	return h.protocol
+}
+
 func ReadHeaderInfo(reader *bufio.Reader) (*HeaderInfo, error) {
 	var buf bytes.Buffer
 	for {
@@ -104,6 +112,7 @@ func ReadHeaderInfo(reader *bufio.Reader) (*HeaderInfo, error) {
 		model:     toStr(h[Model]),
 		serial:    toInt(h[Serial]),
 		firmware:  toStr(h[Firmware]),
+		protocol:  toInt(h[ProtocolVersion]),
 	}
 	return header, nil
 }
@@ -1,13 +1,14 @@
 package headers
 
 const (
-	XResolution = "ResX"
-	YResolution = "ResY"
-	FPS         = "FPS"
-	Model       = "Model"
-	Brand       = "Brand"
-	PixelBits   = "PixelBits"
-	FrameSize   = "FrameSize"
-	Firmware    = "Firmware"
-	Serial      = "CameraSerial"
+	XResolution     = "ResX"
+	YResolution     = "ResY"
+	FPS             = "FPS"
+	Model           = "Model"
+	Brand           = "Brand"
+	PixelBits       = "PixelBits"
+	FrameSize       = "FrameSize"
+	Firmware        = "Firmware"
+	Serial          = "CameraSerial"
+	ProtocolVersion = "ProtocolVersion"
 )
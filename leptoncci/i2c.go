@@ -0,0 +1,34 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package leptoncci
+
+import (
+	"periph.io/x/periph/conn/i2c"
+	"periph.io/x/periph/conn/i2c/i2creg"
+)
+
+// Open opens the default I2C bus and returns a Client for the camera
+// on it. The periph host must have been initialised.
+func Open() (*Client, error) {
+	bus, err := i2creg.Open("")
+	if err != nil {
+		return nil, err
+	}
+	c := NewClient(&i2c.Dev{Bus: bus, Addr: Addr})
+	c.closer = bus
+	return c, nil
+}
@@ -0,0 +1,438 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package leptoncci talks to FLIR Lepton cameras over their command
+// and control interface (CCI), which uses I2C.
+//
+// The lepton3 package only uses the CCI for what it needs to read
+// frames. This package provides the other controls, such as gain mode
+// and the spot meter.
+package leptoncci
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Addr is the I2C address of the CCI.
+const Addr = 0x2A
+
+// CCI registers.
+const (
+	regStatus     uint16 = 0x0002
+	regCommandID  uint16 = 0x0004
+	regDataLength uint16 = 0x0006
+	regData0      uint16 = 0x0008
+)
+
+const (
+	statusBusy   uint16 = 1 << 0
+	maxDataWords        = 16
+)
+
+// Command types, added to the command IDs.
+const (
+	typeGet uint16 = 0
+	typeSet uint16 = 1
+)
+
+// Command IDs from the Lepton software interface description.
+const (
+	cmdAGCEnable         uint16 = 0x0100
+	cmdSysStatus         uint16 = 0x0204
+	cmdSysUptime         uint16 = 0x020C
+	cmdSysHousingTemp    uint16 = 0x0210
+	cmdSysFPATemp        uint16 = 0x0214
+	cmdSysGainMode       uint16 = 0x0248
+	cmdRadEnable         uint16 = 0x4E10
+	cmdRadTLinearEnable  uint16 = 0x4EC0
+	cmdRadSpotMeterROI   uint16 = 0x4ECC
+	cmdRadSpotMeterValue uint16 = 0x4ED0
+)
+
+// pollInterval and idleTimeout control waiting for the camera to finish
+// a command.
+const (
+	pollInterval = 5 * time.Millisecond
+	idleTimeout  = 500 * time.Millisecond
+)
+
+// Conn is a connection to the camera's I2C address. Tx writes w and
+// then reads into r.
+type Conn interface {
+	Tx(w, r []byte) error
+}
+
+// Client sends commands to a Lepton camera. It is goroutine safe, but
+// other users of the same CCI (such as the lepton3 package) must not
+// send commands at the same time.
+type Client struct {
+	mu     sync.Mutex
+	conn   Conn
+	closer io.Closer
+}
+
+// NewClient returns a Client using conn.
+func NewClient(conn Conn) *Client {
+	return &Client{conn: conn}
+}
+
+// Close releases the I2C bus if it was opened by Open.
+func (c *Client) Close() error {
+	if c.closer == nil {
+		return nil
+	}
+	return c.closer.Close()
+}
+
+// GainMode is the camera's gain mode. High gain has better resolution
+// and low gain a wider temperature range.
+type GainMode uint32
+
+const (
+	GainHigh GainMode = 0
+	GainLow  GainMode = 1
+	GainAuto GainMode = 2
+)
+
+var gainModeNames = []string{"high", "low", "auto"}
+
+func (m GainMode) String() string {
+	if int(m) < len(gainModeNames) {
+		return gainModeNames[m]
+	}
+	return fmt.Sprintf("GainMode(%d)", uint32(m))
+}
+
+// ParseGainMode returns the GainMode called name.
+func ParseGainMode(name string) (GainMode, error) {
+	for i, n := range gainModeNames {
+		if strings.EqualFold(name, n) {
+			return GainMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown gain mode %q, expected one of %s", name, strings.Join(gainModeNames, ", "))
+}
+
+// Status is the camera's system status.
+type Status uint32
+
+const (
+	StatusReady         Status = 0
+	StatusInitializing  Status = 1
+	StatusLowPower      Status = 2
+	StatusGoingStandby  Status = 3
+	StatusFFCInProgress Status = 4
+)
+
+var statusNames = []string{"ready", "initializing", "low-power", "going-standby", "ffc-in-progress"}
+
+func (s Status) String() string {
+	if int(s) < len(statusNames) {
+		return statusNames[s]
+	}
+	return fmt.Sprintf("Status(%d)", uint32(s))
+}
+
+// Frame size for checking spot meter regions.
+const (
+	frameCols = 160
+	frameRows = 120
+)
+
+// ROI is a region of interest in the frame. The end row and column are
+// included in it.
+type ROI struct {
+	StartRow int
+	StartCol int
+	EndRow   int
+	EndCol   int
+}
+
+// Validate checks that the region is inside the frame.
+func (r ROI) Validate() error {
+	if r.StartRow < 0 || r.StartCol < 0 || r.EndRow >= frameRows || r.EndCol >= frameCols ||
+		r.EndRow < r.StartRow || r.EndCol < r.StartCol {
+		return fmt.Errorf("region rows %d-%d, columns %d-%d is not inside the %dx%d frame",
+			r.StartRow, r.EndRow, r.StartCol, r.EndCol, frameCols, frameRows)
+	}
+	return nil
+}
+
+// SpotMeter is the temperature in the spot meter region in degrees C.
+type SpotMeter struct {
+	Mean float64
+	Max  float64
+	Min  float64
+	// Pixels is the number of pixels in the region.
+	Pixels int
+}
+
+// Status returns the camera's system status.
+func (c *Client) Status() (Status, error) {
+	words, err := c.get(cmdSysStatus, 4)
+	if err != nil {
+		return 0, err
+	}
+	return Status(uint32Value(words)), nil
+}
+
+// Uptime returns the time since the camera was powered on. It rolls
+// over after about 49 days.
+func (c *Client) Uptime() (time.Duration, error) {
+	words, err := c.get(cmdSysUptime, 2)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(uint32Value(words)) * time.Millisecond, nil
+}
+
+// FPATemp returns the temperature of the focal plane array in degrees
+// C.
+func (c *Client) FPATemp() (float64, error) {
+	words, err := c.get(cmdSysFPATemp, 1)
+	if err != nil {
+		return 0, err
+	}
+	return centiKelvinToC(words[0]), nil
+}
+
+// HousingTemp returns the temperature of the camera housing in degrees
+// C.
+func (c *Client) HousingTemp() (float64, error) {
+	words, err := c.get(cmdSysHousingTemp, 1)
+	if err != nil {
+		return 0, err
+	}
+	return centiKelvinToC(words[0]), nil
+}
+
+// GainMode returns the camera's gain mode.
+func (c *Client) GainMode() (GainMode, error) {
+	words, err := c.get(cmdSysGainMode, 2)
+	if err != nil {
+		return 0, err
+	}
+	return GainMode(uint32Value(words)), nil
+}
+
+// SetGainMode sets the camera's gain mode.
+func (c *Client) SetGainMode(mode GainMode) error {
+	if int(mode) >= len(gainModeNames) {
+		return fmt.Errorf("invalid gain mode %d", uint32(mode))
+	}
+	return c.set(cmdSysGainMode, uint32Words(uint32(mode)))
+}
+
+// AGC reports whether automatic gain control is enabled. It must be
+// disabled for the camera to output raw 14 bit values.
+func (c *Client) AGC() (bool, error) {
+	return c.getFlag(cmdAGCEnable)
+}
+
+// SetAGC enables or disables automatic gain control.
+func (c *Client) SetAGC(enable bool) error {
+	return c.setFlag(cmdAGCEnable, enable)
+}
+
+// Radiometry reports whether radiometry is enabled.
+func (c *Client) Radiometry() (bool, error) {
+	return c.getFlag(cmdRadEnable)
+}
+
+// SetRadiometry enables or disables radiometry.
+func (c *Client) SetRadiometry(enable bool) error {
+	return c.setFlag(cmdRadEnable, enable)
+}
+
+// TLinear reports whether TLinear is enabled, in which case pixel
+// values are in hundredths of a kelvin. Only radiometric Leptons
+// support it.
+func (c *Client) TLinear() (bool, error) {
+	return c.getFlag(cmdRadTLinearEnable)
+}
+
+// SetTLinear enables or disables TLinear.
+func (c *Client) SetTLinear(enable bool) error {
+	return c.setFlag(cmdRadTLinearEnable, enable)
+}
+
+// SpotMeterROI returns the region measured by the spot meter.
+func (c *Client) SpotMeterROI() (ROI, error) {
+	words, err := c.get(cmdRadSpotMeterROI, 4)
+	if err != nil {
+		return ROI{}, err
+	}
+	return ROI{
+		StartRow: int(words[0]),
+		StartCol: int(words[1]),
+		EndRow:   int(words[2]),
+		EndCol:   int(words[3]),
+	}, nil
+}
+
+// SetSpotMeterROI sets the region measured by the spot meter.
+func (c *Client) SetSpotMeterROI(roi ROI) error {
+	if err := roi.Validate(); err != nil {
+		return err
+	}
+	return c.set(cmdRadSpotMeterROI, []uint16{
+		uint16(roi.StartRow),
+		uint16(roi.StartCol),
+		uint16(roi.EndRow),
+		uint16(roi.EndCol),
+	})
+}
+
+// SpotMeter returns the temperatures measured by the spot meter. They
+// are only meaningful when TLinear is enabled.
+func (c *Client) SpotMeter() (SpotMeter, error) {
+	words, err := c.get(cmdRadSpotMeterValue, 4)
+	if err != nil {
+		return SpotMeter{}, err
+	}
+	return SpotMeter{
+		Mean:   centiKelvinToC(words[0]),
+		Max:    centiKelvinToC(words[1]),
+		Min:    centiKelvinToC(words[2]),
+		Pixels: int(words[3]),
+	}, nil
+}
+
+func (c *Client) getFlag(cmd uint16) (bool, error) {
+	words, err := c.get(cmd, 2)
+	if err != nil {
+		return false, err
+	}
+	return uint32Value(words) != 0, nil
+}
+
+func (c *Client) setFlag(cmd uint16, enable bool) error {
+	var v uint32
+	if enable {
+		v = 1
+	}
+	return c.set(cmd, uint32Words(v))
+}
+
+// get runs a GET command, returning n data words.
+func (c *Client) get(cmd uint16, n int) ([]uint16, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.command(cmd|typeGet, n); err != nil {
+		return nil, err
+	}
+	b := make([]byte, 2*n)
+	if err := c.conn.Tx(regBytes(regData0), b); err != nil {
+		return nil, err
+	}
+	words := make([]uint16, n)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+	return words, nil
+}
+
+// set runs a SET command with data.
+func (c *Client) set(cmd uint16, data []uint16) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.waitIdle(); err != nil {
+		return err
+	}
+	if err := c.writeRegister(regData0, data...); err != nil {
+		return err
+	}
+	return c.command(cmd|typeSet, len(data))
+}
+
+// command starts cmd with n data words and waits for it to finish.
+// c.mu must be held.
+func (c *Client) command(cmd uint16, n int) error {
+	if n > maxDataWords {
+		return fmt.Errorf("command 0x%04x has too much data", cmd)
+	}
+	if _, err := c.waitIdle(); err != nil {
+		return err
+	}
+	if err := c.writeRegister(regDataLength, uint16(n)); err != nil {
+		return err
+	}
+	if err := c.writeRegister(regCommandID, cmd); err != nil {
+		return err
+	}
+	status, err := c.waitIdle()
+	if err != nil {
+		return err
+	}
+	// The high byte is the result code, which is negative on error.
+	if result := int8(status >> 8); result != 0 {
+		return fmt.Errorf("command 0x%04x failed with result %d", cmd, result)
+	}
+	return nil
+}
+
+// waitIdle waits for the camera to finish any command in progress,
+// returning the status register.
+func (c *Client) waitIdle() (uint16, error) {
+	timeout := time.After(idleTimeout)
+	b := make([]byte, 2)
+	for {
+		if err := c.conn.Tx(regBytes(regStatus), b); err != nil {
+			return 0, err
+		}
+		status := binary.BigEndian.Uint16(b)
+		if status&statusBusy == 0 {
+			return status, nil
+		}
+		select {
+		case <-timeout:
+			return 0, errors.New("timed out waiting for camera to be idle")
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// writeRegister writes words starting at reg.
+func (c *Client) writeRegister(reg uint16, words ...uint16) error {
+	w := regBytes(reg)
+	for _, word := range words {
+		w = append(w, byte(word>>8), byte(word))
+	}
+	return c.conn.Tx(w, nil)
+}
+
+func regBytes(reg uint16) []byte {
+	return []byte{byte(reg >> 8), byte(reg)}
+}
+
+// 32 bit values are sent least significant word first.
+func uint32Value(words []uint16) uint32 {
+	return uint32(words[0]) | uint32(words[1])<<16
+}
+
+func uint32Words(v uint32) []uint16 {
+	return []uint16{uint16(v), uint16(v >> 16)}
+}
+
+func centiKelvinToC(v uint16) float64 {
+	return float64(v)/100 - 273.15
+}
@@ -0,0 +1,185 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package leptoncci
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCamera responds to CCI register reads and writes like a Lepton
+// would. Attributes hold the data words for each command ID.
+type fakeCamera struct {
+	registers  map[uint16]uint16
+	attributes map[uint16][]uint16
+	busyPolls  int
+}
+
+func newFakeCamera() *fakeCamera {
+	return &fakeCamera{
+		registers: make(map[uint16]uint16),
+		attributes: map[uint16][]uint16{
+			cmdSysStatus:         {uint16(StatusReady), 0, 7, 0},
+			cmdSysUptime:         {0x4240, 0x000F}, // 1000000ms
+			cmdSysFPATemp:        {30015},          // 27C
+			cmdSysHousingTemp:    {29815},          // 25C
+			cmdSysGainMode:       {uint16(GainHigh), 0},
+			cmdAGCEnable:         {0, 0},
+			cmdRadEnable:         {1, 0},
+			cmdRadTLinearEnable:  {1, 0},
+			cmdRadSpotMeterROI:   {59, 79, 60, 80},
+			cmdRadSpotMeterValue: {30315, 30415, 30215, 4},
+		},
+	}
+}
+
+func (c *fakeCamera) Tx(w, r []byte) error {
+	reg := binary.BigEndian.Uint16(w)
+	for i := 2; i+1 < len(w); i += 2 {
+		c.write(reg+uint16(i-2), binary.BigEndian.Uint16(w[i:]))
+	}
+	for i := 0; i+1 < len(r); i += 2 {
+		binary.BigEndian.PutUint16(r[i:], c.read(reg+uint16(i)))
+	}
+	return nil
+}
+
+func (c *fakeCamera) read(reg uint16) uint16 {
+	if reg == regStatus && c.busyPolls > 0 {
+		c.busyPolls--
+		return c.registers[reg] | statusBusy
+	}
+	return c.registers[reg]
+}
+
+func (c *fakeCamera) write(reg, v uint16) {
+	c.registers[reg] = v
+	if reg != regCommandID {
+		return
+	}
+	cmd, n := v&^3, int(c.registers[regDataLength])
+	attr, ok := c.attributes[cmd]
+	if !ok || len(attr) != n {
+		c.registers[regStatus] = uint16(0xFD) << 8 // LEP_RANGE_ERROR (-3)
+		return
+	}
+	c.registers[regStatus] = 0
+	c.busyPolls = 2
+	switch v & 3 {
+	case typeGet:
+		for i, word := range attr {
+			c.registers[regData0+uint16(2*i)] = word
+		}
+	case typeSet:
+		for i := range attr {
+			attr[i] = c.registers[regData0+uint16(2*i)]
+		}
+	}
+}
+
+func TestGetters(t *testing.T) {
+	client := NewClient(newFakeCamera())
+
+	status, err := client.Status()
+	require.NoError(t, err)
+	assert.Equal(t, StatusReady, status)
+	assert.Equal(t, "ready", status.String())
+
+	uptime, err := client.Uptime()
+	require.NoError(t, err)
+	assert.Equal(t, 1000*time.Second, uptime)
+
+	fpa, err := client.FPATemp()
+	require.NoError(t, err)
+	assert.InDelta(t, 27, fpa, 0.001)
+	housing, err := client.HousingTemp()
+	require.NoError(t, err)
+	assert.InDelta(t, 25, housing, 0.001)
+
+	spot, err := client.SpotMeter()
+	require.NoError(t, err)
+	assert.InDelta(t, 30, spot.Mean, 0.001)
+	assert.InDelta(t, 31, spot.Max, 0.001)
+	assert.InDelta(t, 29, spot.Min, 0.001)
+	assert.Equal(t, 4, spot.Pixels)
+}
+
+func TestSetters(t *testing.T) {
+	client := NewClient(newFakeCamera())
+
+	require.NoError(t, client.SetGainMode(GainAuto))
+	mode, err := client.GainMode()
+	require.NoError(t, err)
+	assert.Equal(t, GainAuto, mode)
+	assert.Error(t, client.SetGainMode(GainMode(3)))
+
+	require.NoError(t, client.SetAGC(true))
+	agc, err := client.AGC()
+	require.NoError(t, err)
+	assert.True(t, agc)
+
+	require.NoError(t, client.SetTLinear(false))
+	tlinear, err := client.TLinear()
+	require.NoError(t, err)
+	assert.False(t, tlinear)
+
+	require.NoError(t, client.SetRadiometry(false))
+	radiometry, err := client.Radiometry()
+	require.NoError(t, err)
+	assert.False(t, radiometry)
+
+	roi := ROI{StartRow: 10, StartCol: 20, EndRow: 30, EndCol: 40}
+	require.NoError(t, client.SetSpotMeterROI(roi))
+	got, err := client.SpotMeterROI()
+	require.NoError(t, err)
+	assert.Equal(t, roi, got)
+}
+
+func TestInvalidROI(t *testing.T) {
+	client := NewClient(newFakeCamera())
+	for _, roi := range []ROI{
+		{StartRow: -1, EndRow: 10, EndCol: 10},
+		{EndRow: 120, EndCol: 10},
+		{EndRow: 10, EndCol: 160},
+		{StartRow: 10, EndRow: 9, EndCol: 10},
+	} {
+		assert.Error(t, client.SetSpotMeterROI(roi), "%+v", roi)
+	}
+}
+
+func TestCommandError(t *testing.T) {
+	camera := newFakeCamera()
+	delete(camera.attributes, cmdRadTLinearEnable)
+	client := NewClient(camera)
+
+	_, err := client.TLinear()
+	assert.EqualError(t, err, "command 0x4ec0 failed with result -3")
+}
+
+func TestParseGainMode(t *testing.T) {
+	for _, mode := range []GainMode{GainHigh, GainLow, GainAuto} {
+		parsed, err := ParseGainMode(mode.String())
+		require.NoError(t, err)
+		assert.Equal(t, mode, parsed)
+	}
+	_, err := ParseGainMode("medium")
+	assert.Error(t, err)
+}
@@ -1,6 +1,10 @@
 package leptondController
 
-import "github.com/godbus/dbus"
+import (
+	"time"
+
+	"github.com/godbus/dbus"
+)
 
 const (
 	dbusPath   = "/org/cacophony/leptond"
@@ -40,3 +44,86 @@ func RestartCamera() error {
 	}
 	return obj.Call(methodBase+".RestartCamera", 0).Store()
 }
+
+// Gain modes accepted by SetGainMode.
+const (
+	GainHigh = "high"
+	GainLow  = "low"
+	GainAuto = "auto"
+)
+
+// SetGainMode sets the camera's gain mode to GainHigh, GainLow or
+// GainAuto.
+func SetGainMode(mode string) error {
+	obj, err := getDbusObj()
+	if err != nil {
+		return err
+	}
+	return obj.Call(methodBase+".SetGainMode", 0, mode).Store()
+}
+
+func SetRadiometry(enable bool) error {
+	obj, err := getDbusObj()
+	if err != nil {
+		return err
+	}
+	return obj.Call(methodBase+".SetRadiometry", 0, enable).Store()
+}
+
+func SetTLinear(enable bool) error {
+	obj, err := getDbusObj()
+	if err != nil {
+		return err
+	}
+	return obj.Call(methodBase+".SetTLinear", 0, enable).Store()
+}
+
+// SetFFCInterval sets how often the camera runs flat field corrections
+// by itself, to the nearest second.
+func SetFFCInterval(interval time.Duration) error {
+	obj, err := getDbusObj()
+	if err != nil {
+		return err
+	}
+	return obj.Call(methodBase+".SetFFCInterval", 0, int(interval.Round(time.Second)/time.Second)).Store()
+}
+
+// SetSpotMeterROI sets the region measured by the spot meter. The end
+// row and column are included in it.
+func SetSpotMeterROI(startRow, startCol, endRow, endCol int) error {
+	obj, err := getDbusObj()
+	if err != nil {
+		return err
+	}
+	return obj.Call(methodBase+".SetSpotMeterROI", 0, startRow, startCol, endRow, endCol).Store()
+}
+
+// SetAGC enables or disables automatic gain control. Frames don't have
+// raw values while it's enabled.
+func SetAGC(enable bool) error {
+	obj, err := getDbusObj()
+	if err != nil {
+		return err
+	}
+	return obj.Call(methodBase+".SetAGC", 0, enable).Store()
+}
+
+// GetCameraStatus returns the camera's status and the state of its
+// controls, such as "status", "fpaTempC", "housingTempC", "uptimeSecs",
+// "gainMode" and "ffcIntervalSecs". Controls the camera doesn't
+// support are left out.
+func GetCameraStatus() (map[string]interface{}, error) {
+	obj, err := getDbusObj()
+	if err != nil {
+		return nil, err
+	}
+	var variants map[string]dbus.Variant
+	if err := obj.Call(methodBase+".CameraStatus", 0).Store(&variants); err != nil {
+		return nil, err
+	}
+	status := make(map[string]interface{}, len(variants))
+	for key, v := range variants {
+		status[key] = v.Value()
+	}
+	return status, nil
+}
@@ -0,0 +1,119 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	config "github.com/TheCacophonyProject/go-config"
+
+	"github.com/TheCacophonyProject/thermal-recorder/loglimiter"
+)
+
+// Path is the HTTP path the metrics are served on.
+const Path = "/metrics"
+
+// Config says how metrics are exported. Nothing is exported when
+// Address and File are empty.
+//
+// Address is the TCP address to serve the metrics on over HTTP, at
+// Path. File is a file to write the metrics to every FileInterval,
+// for example for the node_exporter textfile collector.
+type Config struct {
+	Address      string        `mapstructure:"address"`
+	File         string        `mapstructure:"file"`
+	FileInterval time.Duration `mapstructure:"file-interval"`
+}
+
+func DefaultConfig() Config {
+	return Config{FileInterval: 15 * time.Second}
+}
+
+// NewConfig reads the metrics config from the config section key.
+func NewConfig(configRW *config.Config, key string) (*Config, error) {
+	conf := DefaultConfig()
+	if err := configRW.Unmarshal(key, &conf); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+
+// Start exports the metrics in r as set up in conf, in the background.
+// An error is returned if the HTTP address can't be listened on.
+func (r *Registry) Start(conf *Config) error {
+	if conf.Address != "" {
+		listener, err := net.Listen("tcp", conf.Address)
+		if err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.Handle(Path, r.Handler())
+		log.Printf("serving metrics on http://%s%s", listener.Addr(), Path)
+		go func() {
+			err := http.Serve(listener, mux)
+			log.Printf("metrics server stopped: %v", err)
+		}()
+	}
+	if conf.File != "" {
+		interval := conf.FileInterval
+		if interval <= 0 {
+			interval = DefaultConfig().FileInterval
+		}
+		log.Printf("writing metrics to %s every %s", conf.File, interval)
+		go r.writeFileEvery(conf.File, interval)
+	}
+	return nil
+}
+
+// Start exports the default registry's metrics.
+func Start(conf *Config) error {
+	return Default.Start(conf)
+}
+
+func (r *Registry) writeFileEvery(filename string, interval time.Duration) {
+	logLimiter := loglimiter.New(time.Hour)
+	for {
+		if err := r.WriteFile(filename); err != nil {
+			logLimiter.Printf("failed to write metrics: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// WriteFile writes the metrics to filename. The file is replaced in one
+// step so readers never see a partly written file.
+func (r *Registry) WriteFile(filename string) error {
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		return err
+	}
+	tempName := filename + ".temp"
+	if err := ioutil.WriteFile(tempName, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tempName, filename); err != nil {
+		os.Remove(tempName)
+		return err
+	}
+	return nil
+}
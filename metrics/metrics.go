@@ -0,0 +1,349 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package metrics keeps counters, gauges and histograms describing the
+// health of a program and exports them in the Prometheus text format,
+// over HTTP or by writing a file.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metric types, as written in the text format.
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// LatencyBuckets are histogram buckets, in seconds, suitable for the
+// time taken to write frames.
+var LatencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+
+var validName = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+type metric interface {
+	describe() *desc
+	// writeValues writes the sample lines for the metric.
+	writeValues(w *bufio.Writer)
+}
+
+type desc struct {
+	name string
+	help string
+	kind string
+}
+
+func (d *desc) describe() *desc {
+	return d
+}
+
+// Registry holds a set of metrics.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// Default is the Registry used by the package level functions.
+var Default = NewRegistry()
+
+// register adds m to the registry. It panics if the name is invalid or
+// already used, as that is a programming error.
+func (r *Registry) register(m metric) {
+	name := m.describe().name
+	if !validName.MatchString(name) {
+		panic(fmt.Sprintf("invalid metric name %q", name))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic(fmt.Sprintf("metric %s registered twice", name))
+	}
+	r.metrics[name] = m
+}
+
+// Counter is a count which only goes up.
+type Counter struct {
+	desc
+	value uint64
+}
+
+// NewCounter adds a counter to r.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{desc: desc{name, help, typeCounter}}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Add adds n to the counter.
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.value, n)
+}
+
+// Value returns the count.
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+func (c *Counter) writeValues(w *bufio.Writer) {
+	writeSample(w, c.name, "", float64(c.Value()))
+}
+
+type counterFunc struct {
+	desc
+	fn func() uint64
+}
+
+// NewCounterFunc adds a counter to r whose value is found by calling
+// fn each time the metrics are exported. fn may be called from any
+// goroutine.
+func (r *Registry) NewCounterFunc(name, help string, fn func() uint64) {
+	r.register(&counterFunc{desc: desc{name, help, typeCounter}, fn: fn})
+}
+
+func (c *counterFunc) writeValues(w *bufio.Writer) {
+	writeSample(w, c.name, "", float64(c.fn()))
+}
+
+// Gauge is a value which can go up and down.
+type Gauge struct {
+	desc
+	bits uint64
+}
+
+// NewGauge adds a gauge to r.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{desc: desc{name, help, typeGauge}}
+	r.register(g)
+	return g
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+// Add adds v, which may be negative, to the gauge.
+func (g *Gauge) Add(v float64) {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		new := math.Float64bits(math.Float64frombits(old) + v)
+		if atomic.CompareAndSwapUint64(&g.bits, old, new) {
+			return
+		}
+	}
+}
+
+// Value returns the gauge's value.
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+func (g *Gauge) writeValues(w *bufio.Writer) {
+	writeSample(w, g.name, "", g.Value())
+}
+
+type gaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+// NewGaugeFunc adds a gauge to r whose value is found by calling fn
+// each time the metrics are exported. fn may be called from any
+// goroutine.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(&gaugeFunc{desc: desc{name, help, typeGauge}, fn: fn})
+}
+
+func (g *gaugeFunc) writeValues(w *bufio.Writer) {
+	writeSample(w, g.name, "", g.fn())
+}
+
+// Histogram counts observations, such as how long something took, in
+// buckets.
+type Histogram struct {
+	desc
+	bounds []float64
+
+	mu     sync.Mutex
+	counts []uint64 // observations in each bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram adds a histogram to r. buckets are the upper bounds of
+// the buckets, in increasing order; a +Inf bucket is added.
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("histogram %s buckets are not in order", name))
+	}
+	h := &Histogram{
+		desc:   desc{name, help, typeHistogram},
+		bounds: append([]float64(nil), buckets...),
+		counts: make([]uint64, len(buckets)+1),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe adds v to the histogram.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// ObserveSince adds the seconds since start to the histogram.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+func (h *Histogram) writeValues(w *bufio.Writer) {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	sum, count := h.sum, h.count
+	h.mu.Unlock()
+
+	var cumulative uint64
+	for i, n := range counts {
+		cumulative += n
+		bound := math.Inf(1)
+		if i < len(h.bounds) {
+			bound = h.bounds[i]
+		}
+		writeSample(w, h.name+"_bucket", `le="`+formatValue(bound)+`"`, float64(cumulative))
+	}
+	writeSample(w, h.name+"_sum", "", sum)
+	writeSample(w, h.name+"_count", "", float64(count))
+}
+
+func writeSample(w *bufio.Writer, name, labels string, v float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteString(" " + formatValue(v) + "\n")
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	case v == math.Trunc(v) && math.Abs(v) < 1e15:
+		// Write counts in full rather than with an exponent.
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WriteText writes the metrics in the Prometheus text format, sorted
+// by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := make([]metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.mu.Unlock()
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].describe().name < metrics[j].describe().name
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		d := m.describe()
+		fmt.Fprintf(bw, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", d.name, d.kind)
+		m.writeValues(bw)
+	}
+	return bw.Flush()
+}
+
+func escapeHelp(help string) string {
+	out := make([]byte, 0, len(help))
+	for i := 0; i < len(help); i++ {
+		switch help[i] {
+		case '\\':
+			out = append(out, '\\', '\\')
+		case '\n':
+			out = append(out, '\\', 'n')
+		default:
+			out = append(out, help[i])
+		}
+	}
+	return string(out)
+}
+
+// Handler returns an HTTP handler serving the metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// NewCounter adds a counter to the default registry.
+func NewCounter(name, help string) *Counter {
+	return Default.NewCounter(name, help)
+}
+
+// NewCounterFunc adds a counter calling fn to the default registry.
+func NewCounterFunc(name, help string, fn func() uint64) {
+	Default.NewCounterFunc(name, help, fn)
+}
+
+// NewGauge adds a gauge to the default registry.
+func NewGauge(name, help string) *Gauge {
+	return Default.NewGauge(name, help)
+}
+
+// NewGaugeFunc adds a gauge calling fn to the default registry.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.NewGaugeFunc(name, help, fn)
+}
+
+// NewHistogram adds a histogram to the default registry.
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return Default.NewHistogram(name, help, buckets)
+}
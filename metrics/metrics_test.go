@@ -0,0 +1,140 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "github.com/TheCacophonyProject/go-config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	frames := r.NewCounter("test_frames_total", "Frames read.")
+	backlog := r.NewGauge("test_backlog", "Frames waiting.\nSecond line.")
+	r.NewGaugeFunc("test_level", `Level with a \ in it.`, func() float64 { return 2.5 })
+	r.NewCounterFunc("test_dropped_total", "Frames dropped.", func() uint64 { return 12 })
+	latency := r.NewHistogram("test_write_seconds", "Time to write.", []float64{0.01, 0.1})
+
+	frames.Inc()
+	frames.Add(2)
+	backlog.Set(4)
+	backlog.Add(-1)
+	latency.Observe(0.005)
+	latency.Observe(0.01)
+	latency.Observe(0.05)
+	latency.Observe(3)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteText(&buf))
+	assert.Equal(t, `# HELP test_backlog Frames waiting.\nSecond line.
+# TYPE test_backlog gauge
+test_backlog 3
+# HELP test_dropped_total Frames dropped.
+# TYPE test_dropped_total counter
+test_dropped_total 12
+# HELP test_frames_total Frames read.
+# TYPE test_frames_total counter
+test_frames_total 3
+# HELP test_level Level with a \\ in it.
+# TYPE test_level gauge
+test_level 2.5
+# HELP test_write_seconds Time to write.
+# TYPE test_write_seconds histogram
+test_write_seconds_bucket{le="0.01"} 2
+test_write_seconds_bucket{le="0.1"} 3
+test_write_seconds_bucket{le="+Inf"} 4
+test_write_seconds_sum 3.065
+test_write_seconds_count 4
+`, buf.String())
+}
+
+func TestRegisterPanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "")
+	assert.Panics(t, func() { r.NewGauge("test_total", "") })
+	assert.Panics(t, func() { r.NewCounter("test-total", "") })
+	assert.Panics(t, func() { r.NewHistogram("test_seconds", "", []float64{1, 0.1}) })
+}
+
+func TestFormatValue(t *testing.T) {
+	assert.Equal(t, "+Inf", formatValue(math.Inf(1)))
+	assert.Equal(t, "-Inf", formatValue(math.Inf(-1)))
+	assert.Equal(t, "NaN", formatValue(math.NaN()))
+	assert.Equal(t, "12345678", formatValue(12345678))
+	assert.Equal(t, "0.25", formatValue(0.25))
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "A count.").Inc()
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", Path, nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "\ntest_total 1\n")
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := tempDir(t)
+	r := NewRegistry()
+	r.NewCounter("test_total", "A count.").Add(7)
+
+	filename := filepath.Join(dir, "test.prom")
+	require.NoError(t, r.WriteFile(filename))
+	data, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "\ntest_total 7\n")
+	_, err = os.Stat(filename + ".temp")
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Error(t, r.WriteFile(filepath.Join(dir, "missing", "test.prom")))
+}
+
+func TestNewConfig(t *testing.T) {
+	dir := tempDir(t)
+	configFile := filepath.Join(dir, config.ConfigFileName)
+	require.NoError(t, ioutil.WriteFile(configFile, nil, 0644))
+	configRW, err := config.New(dir)
+	require.NoError(t, err)
+	conf, err := NewConfig(configRW, "test-metrics")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultConfig(), *conf)
+
+	toml := "[test-metrics]\naddress = \"127.0.0.1:9101\"\nfile = \"/tmp/test.prom\"\nfile-interval = \"1m\"\n"
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(toml), 0644))
+	configRW, err = config.New(dir)
+	require.NoError(t, err)
+	conf, err = NewConfig(configRW, "test-metrics")
+	require.NoError(t, err)
+	assert.Equal(t, Config{Address: "127.0.0.1:9101", File: "/tmp/test.prom", FileInterval: time.Minute}, *conf)
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "metrics")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
@@ -0,0 +1,252 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package motion
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	config "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+)
+
+// MaskKey is the config section for the motion detection mask.
+const MaskKey = "thermal-motion-mask"
+
+// MaskConfig selects the pixels used for motion detection.
+//
+// Include and Exclude are lists of polygons, each a list of [x, y]
+// points. When Include is empty every pixel is included to start
+// with. Pixels inside an Exclude polygon are then removed. Bitmap is
+// the path of a greyscale PNG the size of the camera's frames; black
+// pixels in it are also excluded. A missing bitmap file is ignored.
+type MaskConfig struct {
+	Include [][][]int `mapstructure:"include"`
+	Exclude [][][]int `mapstructure:"exclude"`
+	Bitmap  string    `mapstructure:"bitmap"`
+}
+
+// MaskBitmapFile is the name of the default bitmap mask, in the
+// config directory.
+const MaskBitmapFile = "motion-mask.png"
+
+func DefaultMaskConfig(configDir string) MaskConfig {
+	return MaskConfig{
+		Bitmap: filepath.Join(configDir, MaskBitmapFile),
+	}
+}
+
+func NewMaskConfig(configRW *config.Config, configDir string) (*MaskConfig, error) {
+	maskConfig := DefaultMaskConfig(configDir)
+	if err := configRW.Unmarshal(MaskKey, &maskConfig); err != nil {
+		return nil, err
+	}
+	for _, polygon := range append(maskConfig.Include, maskConfig.Exclude...) {
+		if err := checkPolygon(polygon); err != nil {
+			return nil, err
+		}
+	}
+	return &maskConfig, nil
+}
+
+func checkPolygon(polygon [][]int) error {
+	if len(polygon) < 3 {
+		return errors.New("mask polygons need at least 3 points")
+	}
+	for _, point := range polygon {
+		if len(point) != 2 {
+			return fmt.Errorf("mask polygon point %v should be [x, y]", point)
+		}
+	}
+	return nil
+}
+
+// Mask records which pixels are used for motion detection.
+type Mask struct {
+	width    int
+	height   int
+	included []bool
+}
+
+// NewMask returns the mask described by conf for the camera given.
+func NewMask(conf *MaskConfig, camera cptvframe.CameraSpec) (*Mask, error) {
+	m := newMask(camera.ResX(), camera.ResY(), len(conf.Include) == 0)
+	for _, polygon := range conf.Include {
+		m.fillPolygon(polygon, true)
+	}
+	for _, polygon := range conf.Exclude {
+		m.fillPolygon(polygon, false)
+	}
+
+	if conf.Bitmap != "" {
+		bitmap, err := ReadMaskBitmap(conf.Bitmap, camera)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if bitmap != nil {
+			for i, included := range bitmap.included {
+				m.included[i] = m.included[i] && included
+			}
+		}
+	}
+	if m.Count() == 0 {
+		return nil, errors.New("motion mask excludes every pixel")
+	}
+	return m, nil
+}
+
+// MaskFromBytes returns a mask from a byte per pixel, row by row, with
+// non-zero bytes being included.
+func MaskFromBytes(b []byte, camera cptvframe.CameraSpec) (*Mask, error) {
+	if len(b) != camera.ResX()*camera.ResY() {
+		return nil, fmt.Errorf("mask has %d pixels, expected %d", len(b), camera.ResX()*camera.ResY())
+	}
+	m := newMask(camera.ResX(), camera.ResY(), false)
+	for i, v := range b {
+		m.included[i] = v != 0
+	}
+	if m.Count() == 0 {
+		return nil, errors.New("motion mask excludes every pixel")
+	}
+	return m, nil
+}
+
+// ReadMaskBitmap reads a mask from a PNG file.
+func ReadMaskBitmap(path string, camera cptvframe.CameraSpec) (*Mask, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("reading mask %s: %v", path, err)
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() != camera.ResX() || bounds.Dy() != camera.ResY() {
+		return nil, fmt.Errorf("mask %s is %dx%d, expected %dx%d", path, bounds.Dx(), bounds.Dy(), camera.ResX(), camera.ResY())
+	}
+	m := newMask(camera.ResX(), camera.ResY(), false)
+	for y := 0; y < m.height; y++ {
+		for x := 0; x < m.width; x++ {
+			grey := color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray)
+			m.included[y*m.width+x] = grey.Y != 0
+		}
+	}
+	return m, nil
+}
+
+// WriteBitmap saves the mask as a PNG, with excluded pixels black and
+// included pixels white. The file is replaced atomically.
+func (m *Mask) WriteBitmap(path string) error {
+	img := image.NewGray(image.Rect(0, 0, m.width, m.height))
+	for i, included := range m.included {
+		if included {
+			img.Pix[i] = 0xff
+		}
+	}
+	tempPath := path + ".temp"
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+func newMask(width, height int, included bool) *Mask {
+	m := &Mask{
+		width:    width,
+		height:   height,
+		included: make([]bool, width*height),
+	}
+	if included {
+		for i := range m.included {
+			m.included[i] = true
+		}
+	}
+	return m
+}
+
+// Included reports whether the pixel at x, y is used for motion
+// detection.
+func (m *Mask) Included(x, y int) bool {
+	return m.included[y*m.width+x]
+}
+
+// Count returns the number of included pixels.
+func (m *Mask) Count() int {
+	count := 0
+	for _, included := range m.included {
+		if included {
+			count++
+		}
+	}
+	return count
+}
+
+// Bytes returns a byte per pixel, row by row, which is 1 for included
+// pixels and 0 for excluded pixels.
+func (m *Mask) Bytes() []byte {
+	b := make([]byte, len(m.included))
+	for i, included := range m.included {
+		if included {
+			b[i] = 1
+		}
+	}
+	return b
+}
+
+// fillPolygon sets the pixels whose centres are inside polygon.
+func (m *Mask) fillPolygon(polygon [][]int, included bool) {
+	for y := 0; y < m.height; y++ {
+		for x := 0; x < m.width; x++ {
+			if insidePolygon(polygon, float64(x)+0.5, float64(y)+0.5) {
+				m.included[y*m.width+x] = included
+			}
+		}
+	}
+}
+
+// insidePolygon uses the even-odd rule to find whether x, y is inside
+// polygon.
+func insidePolygon(polygon [][]int, x, y float64) bool {
+	inside := false
+	j := len(polygon) - 1
+	for i := range polygon {
+		xi, yi := float64(polygon[i][0]), float64(polygon[i][1])
+		xj, yj := float64(polygon[j][0]), float64(polygon[j][1])
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+		j = i
+	}
+	return inside
+}
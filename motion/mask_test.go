@@ -0,0 +1,113 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package motion
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TheCacophonyProject/lepton3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func square(x0, y0, x1, y1 int) [][]int {
+	return [][]int{{x0, y0}, {x1, y0}, {x1, y1}, {x0, y1}}
+}
+
+func TestMaskPolygons(t *testing.T) {
+	camera := new(TestCamera)
+
+	mask, err := NewMask(&MaskConfig{Exclude: [][][]int{square(0, 0, 10, 10)}}, camera)
+	require.NoError(t, err)
+	assert.False(t, mask.Included(0, 0))
+	assert.False(t, mask.Included(9, 9))
+	assert.True(t, mask.Included(10, 10))
+	assert.Equal(t, 160*120-100, mask.Count())
+
+	mask, err = NewMask(&MaskConfig{
+		Include: [][][]int{square(0, 0, 10, 10)},
+		Exclude: [][][]int{square(0, 0, 5, 5)},
+	}, camera)
+	require.NoError(t, err)
+	assert.False(t, mask.Included(4, 4))
+	assert.True(t, mask.Included(5, 5))
+	assert.False(t, mask.Included(10, 10))
+	assert.Equal(t, 75, mask.Count())
+
+	// A triangle.
+	mask, err = NewMask(&MaskConfig{Include: [][][]int{{{0, 0}, {10, 0}, {0, 10}}}}, camera)
+	require.NoError(t, err)
+	assert.True(t, mask.Included(0, 8))
+	assert.False(t, mask.Included(8, 8))
+
+	_, err = NewMask(&MaskConfig{Exclude: [][][]int{square(0, 0, 160, 120)}}, camera)
+	assert.EqualError(t, err, "motion mask excludes every pixel")
+}
+
+func TestMaskBitmap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "motion-mask")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	camera := new(TestCamera)
+	path := filepath.Join(dir, MaskBitmapFile)
+
+	// A missing bitmap is ignored.
+	mask, err := NewMask(&MaskConfig{Bitmap: path}, camera)
+	require.NoError(t, err)
+	assert.Equal(t, 160*120, mask.Count())
+
+	b := mask.Bytes()
+	b[0] = 0
+	b[160*120-1] = 0
+	bitmap, err := MaskFromBytes(b, camera)
+	require.NoError(t, err)
+	require.NoError(t, bitmap.WriteBitmap(path))
+
+	// The bitmap is combined with the polygons.
+	mask, err = NewMask(&MaskConfig{Bitmap: path, Exclude: [][][]int{square(10, 10, 12, 12)}}, camera)
+	require.NoError(t, err)
+	assert.False(t, mask.Included(0, 0))
+	assert.False(t, mask.Included(159, 119))
+	assert.False(t, mask.Included(11, 11))
+	assert.Equal(t, 160*120-6, mask.Count())
+
+	_, err = MaskFromBytes(b[1:], camera)
+	assert.EqualError(t, err, "mask has 19199 pixels, expected 19200")
+}
+
+func TestMaskedMotionIgnored(t *testing.T) {
+	rec := new(TestRecorder)
+	camera := new(TestCamera)
+	processor := NewMotionProcessor(lepton3.ParseRawFrame, MotionTestConfig(), nil, RecorderTestConfig(), LocationTestConfig(), nil, rec, camera, nil, nil)
+	mask, err := NewMask(&MaskConfig{Exclude: [][][]int{square(0, 0, 20, 20)}}, camera)
+	require.NoError(t, err)
+	processor.SetMask(mask)
+
+	frameMaker := MakeTestFrameMaker(processor, camera)
+	frameMaker.AddBackgroundFrames(11).AddMovingDotFrames(3)
+	assert.False(t, rec.IsRecording())
+
+	// The dot has moved out of the excluded area.
+	frameMaker.AddMovingDotFrames(4)
+	assert.True(t, rec.IsRecording())
+
+	got, _ := processor.MaskAndBackground()
+	assert.Equal(t, mask, got)
+}
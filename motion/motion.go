@@ -17,6 +17,7 @@
 package motion
 
 import (
+	"image"
 	"log"
 	"math"
 	"time"
@@ -88,6 +89,71 @@ type motionDetector struct {
 	numPixels        float64
 	affectedByFCC    bool
 	framesHz         int
+	tracker          *Tracker
+	triggerOnTracks  bool
+	deltaCount       int
+	mask             *Mask
+}
+
+// setMask limits motion detection to the pixels included by mask. A
+// nil mask includes every pixel. The background is rebuilt as pixels
+// excluded before won't have been kept up to date.
+func (d *motionDetector) setMask(mask *Mask) {
+	d.mask = mask
+	d.numPixels = 0
+	for y := d.start; y < d.rowStop; y++ {
+		for x := d.start; x < d.columnStop; x++ {
+			if !d.masked(x, y) {
+				d.numPixels++
+			}
+		}
+	}
+	if d.numPixels == 0 {
+		log.Print("motion mask excludes every pixel inside the edge, ignoring it")
+		d.setMask(nil)
+		return
+	}
+	d.backgroundFrames = 0
+}
+
+// masked reports whether the pixel at x, y is excluded from motion
+// detection.
+func (d *motionDetector) masked(x, y int) bool {
+	return d.mask != nil && !d.mask.Included(x, y)
+}
+
+// enableTracking makes the detector track the regions which have
+// changed.
+func (d *motionDetector) enableTracking(conf TrackingConfig, camera cptvframe.CameraSpec) {
+	d.tracker = NewTracker(conf, camera)
+	d.triggerOnTracks = conf.TriggerOnTracks
+}
+
+// disableTracking stops tracking changed regions.
+func (d *motionDetector) disableTracking() {
+	d.tracker = nil
+	d.triggerOnTracks = false
+}
+
+// updateThresholds applies the settings from args which can be
+// changed without rebuilding the detector. A dynamic threshold which
+// stays enabled keeps its current value.
+func (d *motionDetector) updateThresholds(args config.ThermalMotion) {
+	if !d.dynamicThresh || !args.DynamicThreshold {
+		d.tempThresh = args.TempThresh
+	}
+	d.dynamicThresh = args.DynamicThreshold
+	d.useOneDiff = args.UseOneDiffOnly
+	d.deltaThresh = args.DeltaThresh
+	d.countThresh = args.CountThresh
+	d.tempThreshMin = args.TempThreshMin
+	d.tempThreshMax = args.TempThreshMax
+	d.warmerOnly = args.WarmerOnly
+	if !args.Verbose {
+		d.debug = nil
+	} else if d.debug == nil {
+		d.debug = newDebugTracker()
+	}
 }
 
 func (d *motionDetector) Reset(camera cptvframe.CameraSpec) {
@@ -95,6 +161,13 @@ func (d *motionDetector) Reset(camera cptvframe.CameraSpec) {
 	d.count = 0
 	d.flooredFrames.Reset()
 	d.diffFrames.Reset()
+	d.resetTracker()
+}
+
+func (d *motionDetector) resetTracker() {
+	if d.tracker != nil {
+		d.tracker.Reset()
+	}
 }
 
 func (d *motionDetector) calculateThreshold(backAverage float64) {
@@ -120,13 +193,14 @@ func (d *motionDetector) Detect(frame *cptvframe.Frame) bool {
 	}
 	d.count++
 	movement, deltaCount := d.pixelsChanged(frame, prevFFC)
+	d.deltaCount = deltaCount
 	if movement {
 		d.debug.update("detect", 1)
 	}
 	d.debug.update("delta", deltaCount)
 
 	if d.debug != nil && d.count%(debugLogSecs*d.framesHz) == 0 {
-		log.Print("motion:: " + d.debug.string("thresh:all detect:n temp:all ftemp:all diff:max delta:max ffc:n"))
+		log.Print("motion:: " + d.debug.string("thresh:all detect:n temp:all ftemp:all diff:max delta:max tracks:max ffc:n"))
 		d.debug.reset()
 	}
 	return movement
@@ -150,6 +224,7 @@ func (d *motionDetector) pixelsChanged(frame *cptvframe.Frame, prevFFC bool) (bo
 
 	if !d.firstDiff {
 		d.firstDiff = true
+		d.resetTracker()
 		return false, 0
 	}
 
@@ -157,13 +232,36 @@ func (d *motionDetector) pixelsChanged(frame *cptvframe.Frame, prevFFC bool) (bo
 		d.debug.update("ffc", 1)
 		d.flooredFrames.SetAsOldest()
 		d.firstDiff = false
+		d.resetTracker()
 		return false, 0
 	}
 
 	if d.useOneDiff {
-		return d.hasMotion(diffFrame, nil)
+		prevDiffFrame = nil
+	}
+	movement, deltaCount := d.hasMotion(diffFrame, prevDiffFrame)
+	if d.tracker != nil {
+		d.updateTracker(diffFrame, prevDiffFrame)
+		if d.triggerOnTracks {
+			movement = d.tracker.Persistent()
+		}
+	}
+	return movement, deltaCount
+}
+
+// updateTracker tracks the regions of pixels counted as changed by
+// hasMotion.
+func (d *motionDetector) updateTracker(f1, f2 *cptvframe.Frame) {
+	changed := func(x, y int) bool {
+		return f1.Pix[y][x] > d.deltaThresh
+	}
+	if f2 != nil {
+		changed = func(x, y int) bool {
+			return f1.Pix[y][x] > d.deltaThresh && f2.Pix[y][x] > d.deltaThresh
+		}
 	}
-	return d.hasMotion(diffFrame, prevDiffFrame)
+	d.tracker.Update(changed, image.Rect(d.start, d.start, d.columnStop, d.rowStop))
+	d.debug.update("tracks", len(d.tracker.Tracks()))
 }
 
 func isAffectedByFFC(f *cptvframe.Frame) bool {
@@ -179,6 +277,9 @@ func (d *motionDetector) CountPixelsTwoCompare(f1 *cptvframe.Frame, f2 *cptvfram
 	var deltaCount int
 	for y := d.start; y < d.rowStop; y++ {
 		for x := d.start; x < d.columnStop; x++ {
+			if d.masked(x, y) {
+				continue
+			}
 			v1 := f1.Pix[y][x]
 			v2 := f2.Pix[y][x]
 			if (v1 > d.deltaThresh) && (v2 > d.deltaThresh) {
@@ -193,6 +294,9 @@ func (d *motionDetector) CountPixels(f1 *cptvframe.Frame) (deltas int) {
 	var deltaCount int
 	for y := d.start; y < d.rowStop; y++ {
 		for x := d.start; x < d.columnStop; x++ {
+			if d.masked(x, y) {
+				continue
+			}
 			v := f1.Pix[y][x]
 			d.debug.update("diff", int(v))
 			if v > d.deltaThresh {
@@ -216,6 +320,10 @@ func (d *motionDetector) hasMotion(f1 *cptvframe.Frame, f2 *cptvframe.Frame) (bo
 func (d *motionDetector) absDiffFrames(a, b, out *cptvframe.Frame) *cptvframe.Frame {
 	for y := d.start; y < d.rowStop; y++ {
 		for x := d.start; x < d.columnStop; x++ {
+			if d.masked(x, y) {
+				out.Pix[y][x] = 0
+				continue
+			}
 			va := a.Pix[y][x]
 			if va < d.tempThresh {
 				va = d.tempThresh
@@ -233,6 +341,10 @@ func (d *motionDetector) absDiffFrames(a, b, out *cptvframe.Frame) *cptvframe.Fr
 func (d *motionDetector) warmerDiffFrames(a, b, out *cptvframe.Frame) *cptvframe.Frame {
 	for y := d.start; y < d.rowStop; y++ {
 		for x := d.start; x < d.columnStop; x++ {
+			if d.masked(x, y) {
+				out.Pix[y][x] = 0
+				continue
+			}
 			va := a.Pix[y][x]
 			d.debug.update("ftemp", int(va))
 			if va < d.tempThresh {
@@ -270,19 +382,21 @@ func (d *motionDetector) updateBackground(new_frame *cptvframe.Frame, prevFFC bo
 	var average float64 = 0
 	for y := d.start; y < d.rowStop; y++ {
 		for x := d.start; x < d.columnStop; x++ {
-			weight := d.backgroundWeight[y][x]
-			if prevFFC || (float32(new_frame.Pix[y][x])-weight) < float32(d.background.Pix[y][x]) {
-				d.background.Pix[y][x] = new_frame.Pix[y][x]
-				d.backgroundWeight[y][x] = 0
-				changed = true
-			} else {
-				weight += 0.1
-				if weight > math.MaxFloat32 {
-					weight = math.MaxFloat32
+			if !d.masked(x, y) {
+				weight := d.backgroundWeight[y][x]
+				if prevFFC || (float32(new_frame.Pix[y][x])-weight) < float32(d.background.Pix[y][x]) {
+					d.background.Pix[y][x] = new_frame.Pix[y][x]
+					d.backgroundWeight[y][x] = 0
+					changed = true
+				} else {
+					weight += 0.1
+					if weight > math.MaxFloat32 {
+						weight = math.MaxFloat32
+					}
+					d.backgroundWeight[y][x] = weight
 				}
-				d.backgroundWeight[y][x] = weight
+				average = average + float64(d.background.Pix[y][x])/d.numPixels
 			}
-			average = average + float64(d.background.Pix[y][x])/d.numPixels
 			for x := 0; x < d.start; x++ {
 				// copy valid pixels into edge pixels
 				d.background.Pix[y][x] = d.background.Pix[y][d.start]
@@ -17,7 +17,10 @@
 package motion
 
 import (
+	"fmt"
+
 	config "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
 )
 
 func NewConfig(configRW *config.Config, cameraModel string) (*config.ThermalMotion, error) {
@@ -25,13 +28,86 @@ func NewConfig(configRW *config.Config, cameraModel string) (*config.ThermalMoti
 	if err := configRW.Unmarshal(config.ThermalMotionKey, &thermalMotionConfig); err != nil {
 		return nil, err
 	}
-	if err := validateConfig(&thermalMotionConfig); err != nil {
-		return nil, err
-	}
 	return &thermalMotionConfig, nil
 }
 
-func validateConfig(*config.ThermalMotion) error {
-	// TODO
+// ValidateConfig checks that conf can be used with camera. mask is the
+// motion mask in use, or nil if there isn't one. The preview frame loop
+// is made long enough for the trigger frames so they aren't limited by
+// the preview length.
+func ValidateConfig(conf *config.ThermalMotion, camera cptvframe.CameraSpec, mask *Mask) error {
+	maxEdge := (min(camera.ResX(), camera.ResY()) - 1) / 2
+	if conf.EdgePixels < 0 || conf.EdgePixels > maxEdge {
+		return fmt.Errorf("edge-pixels is %d, must be between 0 and %d for a %dx%d camera",
+			conf.EdgePixels, maxEdge, camera.ResX(), camera.ResY())
+	}
+	if conf.FrameCompareGap < 1 {
+		return fmt.Errorf("frame-compare-gap is %d, must be at least 1", conf.FrameCompareGap)
+	}
+	if conf.TempThreshMax != 0 && conf.TempThreshMin > conf.TempThreshMax {
+		return fmt.Errorf("temp-thresh-min is %d, must be no more than temp-thresh-max (%d)",
+			conf.TempThreshMin, conf.TempThreshMax)
+	}
+	pixels := usablePixels(conf.EdgePixels, camera, mask)
+	if conf.CountThresh < 1 || conf.CountThresh > pixels {
+		return fmt.Errorf("count-thresh is %d, must be between 1 and %d (the pixels inside the edges and motion mask)",
+			conf.CountThresh, pixels)
+	}
+	if conf.TriggerFrames < 1 {
+		return fmt.Errorf("trigger-frames is %d, must be at least 1", conf.TriggerFrames)
+	}
 	return nil
 }
+
+// usablePixels counts the pixels used for motion detection once the
+// edges and mask are excluded.
+func usablePixels(edgePixels int, camera cptvframe.CameraSpec, mask *Mask) int {
+	count := 0
+	for y := edgePixels; y < camera.ResY()-edgePixels; y++ {
+		for x := edgePixels; x < camera.ResX()-edgePixels; x++ {
+			if mask == nil || mask.Included(x, y) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// TrackingKey is the config section for the region tracker.
+const TrackingKey = "thermal-tracking"
+
+// TrackingConfig controls the region tracker. When TriggerOnTracks is
+// set, a frame only counts as having motion if a track has been seen
+// for at least MinTrackFrames, instead of comparing the number of
+// changed pixels with the count threshold.
+type TrackingConfig struct {
+	Enabled          bool    `mapstructure:"enabled"`
+	TriggerOnTracks  bool    `mapstructure:"trigger-on-tracks"`
+	MinRegionPixels  int     `mapstructure:"min-region-pixels"`
+	MaxRegionPixels  int     `mapstructure:"max-region-pixels"`
+	MaxAspectRatio   float64 `mapstructure:"max-aspect-ratio"`
+	MaxMatchDistance float64 `mapstructure:"max-match-distance"`
+	MinTrackFrames   int     `mapstructure:"min-track-frames"`
+	MaxMissedFrames  int     `mapstructure:"max-missed-frames"`
+}
+
+func DefaultTrackingConfig() TrackingConfig {
+	return TrackingConfig{
+		Enabled:          false,
+		TriggerOnTracks:  false,
+		MinRegionPixels:  4,
+		MaxRegionPixels:  0,
+		MaxAspectRatio:   5,
+		MaxMatchDistance: 10,
+		MinTrackFrames:   3,
+		MaxMissedFrames:  3,
+	}
+}
+
+func NewTrackingConfig(configRW *config.Config) (*TrackingConfig, error) {
+	trackingConfig := DefaultTrackingConfig()
+	if err := configRW.Unmarshal(TrackingKey, &trackingConfig); err != nil {
+		return nil, err
+	}
+	return &trackingConfig, nil
+}
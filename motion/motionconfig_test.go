@@ -0,0 +1,76 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package motion
+
+import (
+	"testing"
+
+	config "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/lepton3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConfig(t *testing.T) {
+	camera := new(TestCamera)
+
+	valid := config.DefaultThermalMotion(lepton3.Model35)
+	assert.NoError(t, ValidateConfig(&valid, camera, nil))
+
+	conf := valid
+	conf.EdgePixels = 60
+	assert.EqualError(t, ValidateConfig(&conf, camera, nil),
+		"edge-pixels is 60, must be between 0 and 59 for a 160x120 camera")
+
+	conf = valid
+	conf.FrameCompareGap = 0
+	assert.EqualError(t, ValidateConfig(&conf, camera, nil),
+		"frame-compare-gap is 0, must be at least 1")
+
+	conf = valid
+	conf.TempThreshMin = 3000
+	conf.TempThreshMax = 2900
+	assert.EqualError(t, ValidateConfig(&conf, camera, nil),
+		"temp-thresh-min is 3000, must be no more than temp-thresh-max (2900)")
+
+	conf = valid
+	conf.TriggerFrames = 0
+	assert.EqualError(t, ValidateConfig(&conf, camera, nil),
+		"trigger-frames is 0, must be at least 1")
+
+	// Trigger frames longer than the preview still fit in the frame
+	// loop.
+	conf = valid
+	conf.TriggerFrames = 100
+	assert.NoError(t, ValidateConfig(&conf, camera, nil))
+}
+
+func TestValidateConfigCountThreshUsesMask(t *testing.T) {
+	camera := new(TestCamera)
+	conf := config.DefaultThermalMotion(lepton3.Model35)
+	conf.EdgePixels = 1
+	conf.CountThresh = 82
+
+	mask, err := NewMask(&MaskConfig{Include: [][][]int{square(0, 0, 10, 10)}}, camera)
+	require.NoError(t, err)
+	// The first row and column of the mask are inside the edge.
+	assert.EqualError(t, ValidateConfig(&conf, camera, mask),
+		"count-thresh is 82, must be between 1 and 81 (the pixels inside the edges and motion mask)")
+
+	conf.CountThresh = 81
+	assert.NoError(t, ValidateConfig(&conf, camera, mask))
+}
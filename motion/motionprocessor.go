@@ -18,7 +18,10 @@ package motion
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/TheCacophonyProject/go-cptv/cptvframe"
@@ -31,11 +34,16 @@ import (
 
 const minLogInterval = time.Minute
 
+// defaultSnapshotFrames is the length of snapshot recordings when
+// StartSnapshot isn't given a length.
+const defaultSnapshotFrames = 20
+
 type FrameParser func([]byte, *cptvframe.Frame, int) error
 
 func NewMotionProcessor(
 	parseFrame FrameParser,
 	motionConf *config.ThermalMotion,
+	trackingConf *TrackingConfig,
 	recorderConf *recorder.RecorderConfig,
 	locationConf *config.Location,
 	listener RecordingListener,
@@ -44,7 +52,7 @@ func NewMotionProcessor(
 	constantRecorder recorder.Recorder,
 	snapshotRecorder recorder.Recorder,
 ) *MotionProcessor {
-	return &MotionProcessor{
+	mp := &MotionProcessor{
 		parseFrame:        parseFrame,
 		minFrames:         recorderConf.MinSecs * c.FPS(),
 		maxFrames:         recorderConf.MaxSecs * c.FPS(),
@@ -62,7 +70,20 @@ func NewMotionProcessor(
 		constantRecording: !isNullOrNullPointer(constantRecorder),
 		CurrentFrame:      0,
 		snapshotRecorder:  snapshotRecorder,
+		backgroundEvery:   c.FPS(),
+		camera:            c,
+		motionConf:        *motionConf,
+		baseMotionConf:    *motionConf,
+		baseConf:          recorderConf,
+	}
+	mp.applyProfile(recorderConf.ActiveProfile())
+	if trackingConf != nil {
+		mp.trackingConf = *trackingConf
+	}
+	if mp.trackingConf.Enabled {
+		mp.motionDetector.enableTracking(mp.trackingConf, c)
 	}
+	return mp
 }
 
 func isNullOrNullPointer(i interface{}) bool {
@@ -80,6 +101,7 @@ type MotionProcessor struct {
 	motionDetector    *motionDetector
 	frameLoop         *FrameLoop
 	isRecording       bool
+	manualRecording   bool
 	writeUntil        int
 	window            window.Window
 	conf              *recorder.RecorderConfig
@@ -94,15 +116,58 @@ type MotionProcessor struct {
 	crFrames          int
 	CurrentFrame      uint32
 	snapshotRecorder  recorder.Recorder
-	StartSnapshot     bool
 	SnapshotRecording bool
 	snapshotFrames    int
+	snapshotLength    int
+
+	// snapshotMu guards the snapshot requested by StartSnapshot, which
+	// is started by the frame goroutine.
+	snapshotMu              sync.Mutex
+	startSnapshot           bool
+	requestedSnapshotFrames int
+
+	// frameMeta holds the motion metadata for each frame in
+	// frameLoop.
+	frameMeta map[*cptvframe.Frame]*recorder.FrameMetadata
+
+	camera       cptvframe.CameraSpec
+	motionConf   config.ThermalMotion
+	trackingConf TrackingConfig
+	// rebuildDetector is set when a config change needs the motion
+	// detector and frame loop to be rebuilt.
+	rebuildDetector bool
+
+	// baseMotionConf and baseConf are the settings before the active
+	// profile, if any, is applied to give motionConf and conf.
+	baseMotionConf config.ThermalMotion
+	baseConf       *recorder.RecorderConfig
+	profile        *recorder.Profile
+	profileAge     int
+	profileMu      sync.Mutex
+	profileName    string
+	// profileMotion is motionConf while a profile is active, for
+	// ActiveProfile.
+	profileMotion config.ThermalMotion
+
+	maskMu          sync.Mutex
+	mask            *Mask
+	maskChanged     bool
+	background      *cptvframe.Frame
+	backgroundAge   int
+	backgroundEvery int
+
+	pausedMu sync.Mutex
+	paused   bool
 }
 
 type RecordingListener interface {
 	MotionDetected()
 	RecordingStarted()
 	RecordingEnded()
+
+	// TracksUpdated is called for every frame with the tracks seen in
+	// it, when tracking is enabled.
+	TracksUpdated(tracks []Track)
 }
 
 func (mp *MotionProcessor) Reset(camera cptvframe.CameraSpec) {
@@ -111,6 +176,7 @@ func (mp *MotionProcessor) Reset(camera cptvframe.CameraSpec) {
 }
 
 func (mp *MotionProcessor) Process(rawFrame []byte) error {
+	mp.maybeRebuildDetector()
 	frame := mp.frameLoop.Current()
 	if err := mp.parseFrame(rawFrame, frame, mp.motionDetector.start); err != nil {
 		mp.stopRecording()
@@ -124,22 +190,47 @@ func (mp *MotionProcessor) Process(rawFrame []byte) error {
 	return nil
 }
 
+// StartSnapshot starts a snapshot recording of frames frames, or the
+// default length if frames is 0, on the next frame. It may be called
+// from any goroutine.
+func (mp *MotionProcessor) StartSnapshot(frames int) {
+	mp.snapshotMu.Lock()
+	defer mp.snapshotMu.Unlock()
+	mp.startSnapshot = true
+	mp.requestedSnapshotFrames = frames
+}
+
+// snapshotRequest returns the length of the snapshot requested by
+// StartSnapshot and clears the request, or false if there isn't one.
+func (mp *MotionProcessor) snapshotRequest() (int, bool) {
+	mp.snapshotMu.Lock()
+	defer mp.snapshotMu.Unlock()
+	if !mp.startSnapshot {
+		return 0, false
+	}
+	mp.startSnapshot = false
+	return mp.requestedSnapshotFrames, true
+}
+
 func (mp *MotionProcessor) processSnapshot(frame *cptvframe.Frame) {
-	if mp.StartSnapshot {
+	if frames, ok := mp.snapshotRequest(); ok {
 		mp.log.Printf("making a snapshot")
-		mp.StartSnapshot = false
 		if err := mp.snapshotRecorder.StartRecording(mp.motionDetector.background, 0); err != nil {
 			mp.log.Printf("error with starting constant recorder: %v", err)
 			return
 		}
 		mp.SnapshotRecording = true
+		mp.snapshotLength = frames
+		if mp.snapshotLength <= 0 {
+			mp.snapshotLength = defaultSnapshotFrames
+		}
 	}
 	if !mp.SnapshotRecording {
 		return
 	}
 	mp.snapshotRecorder.WriteFrame(frame)
 	mp.snapshotFrames++
-	if mp.snapshotFrames > 20 {
+	if mp.snapshotFrames >= mp.snapshotLength {
 		mp.SnapshotRecording = false
 		if err := mp.snapshotRecorder.StopRecording(); err != nil {
 			mp.log.Printf("error with stoping constant recorder: %v", err)
@@ -177,16 +268,193 @@ func (mp *MotionProcessor) processConstantRecorder(frame *cptvframe.Frame) {
 	}
 }
 
+// UpdateConfig changes the motion detection and recording settings.
+// It must be called from the goroutine processing frames.
+//
+// Thresholds, recording lengths, the recording window, profiles and
+// tracking take effect straight away. Changes to the frame compare gap, edge
+// pixels, trigger frames or preview length need the motion detector
+// rebuilt, losing the learnt background, so are made once any
+// recording in progress has finished.
+func (mp *MotionProcessor) UpdateConfig(
+	motionConf *config.ThermalMotion,
+	trackingConf *TrackingConfig,
+	recorderConf *recorder.RecorderConfig,
+	locationConf *config.Location,
+) {
+	if motionConf.FrameCompareGap != mp.motionConf.FrameCompareGap ||
+		motionConf.EdgePixels != mp.motionConf.EdgePixels ||
+		motionConf.TriggerFrames != mp.motionConf.TriggerFrames ||
+		recorderConf.PreviewSecs != mp.conf.PreviewSecs {
+		mp.rebuildDetector = true
+	}
+
+	mp.baseMotionConf = *motionConf
+	mp.baseConf = recorderConf
+	mp.locationConfig = locationConf
+	mp.window = recorderConf.Window
+	mp.applyProfile(recorderConf.ActiveProfile())
+
+	if *trackingConf != mp.trackingConf {
+		mp.trackingConf = *trackingConf
+		mp.motionDetector.disableTracking()
+		if trackingConf.Enabled {
+			mp.motionDetector.enableTracking(*trackingConf, mp.camera)
+		}
+	}
+}
+
+// checkProfile switches to the profile which is active now, checking
+// once a second.
+func (mp *MotionProcessor) checkProfile() {
+	mp.profileAge++
+	if mp.profileAge < mp.camera.FPS() {
+		return
+	}
+	mp.profileAge = 0
+	if profile := mp.baseConf.ActiveProfile(); profile != mp.profile {
+		mp.applyProfile(profile)
+	}
+}
+
+// applyProfile applies profile, which may be nil for none, on top of
+// the base settings.
+func (mp *MotionProcessor) applyProfile(profile *recorder.Profile) {
+	motionConf := mp.baseMotionConf
+	recorderConf := *mp.baseConf
+	name := ""
+	if profile != nil {
+		profile.Apply(&motionConf, &recorderConf)
+		name = profile.Name
+	}
+
+	fps := mp.camera.FPS()
+	mp.profile = profile
+	mp.motionConf = motionConf
+	mp.conf = &recorderConf
+	mp.minFrames = recorderConf.MinSecs * fps
+	mp.maxFrames = recorderConf.MaxSecs * fps
+	mp.motionDetector.updateThresholds(motionConf)
+
+	mp.profileMu.Lock()
+	defer mp.profileMu.Unlock()
+	if name != mp.profileName {
+		if name == "" {
+			log.Printf("profile %s finished", mp.profileName)
+		} else {
+			log.Printf("using profile %s", name)
+		}
+	}
+	mp.profileName = name
+	mp.profileMotion = motionConf
+}
+
+// Profile returns the name of the active profile, or "" if none is. It
+// may be called from any goroutine.
+func (mp *MotionProcessor) Profile() string {
+	mp.profileMu.Lock()
+	defer mp.profileMu.Unlock()
+	return mp.profileName
+}
+
+// ActiveProfile returns the name of the active profile and the motion
+// config with it applied, or "" and nil if no profile is active. It may
+// be called from any goroutine.
+func (mp *MotionProcessor) ActiveProfile() (string, *config.ThermalMotion) {
+	mp.profileMu.Lock()
+	defer mp.profileMu.Unlock()
+	if mp.profileName == "" {
+		return "", nil
+	}
+	motionConf := mp.profileMotion
+	return mp.profileName, &motionConf
+}
+
+// maybeRebuildDetector rebuilds the motion detector and frame loop
+// after a config change, once no recording is in progress.
+func (mp *MotionProcessor) maybeRebuildDetector() {
+	if !mp.rebuildDetector || mp.isRecording {
+		return
+	}
+	mp.rebuildDetector = false
+
+	previewFrames := mp.conf.PreviewSecs * mp.camera.FPS()
+	mp.motionDetector = NewMotionDetector(mp.motionConf, previewFrames, mp.camera)
+	mp.frameLoop = NewFrameLoop(previewFrames+mp.motionConf.TriggerFrames, mp.camera)
+	mp.triggerFrames = mp.motionConf.TriggerFrames
+	mp.triggered = 0
+	mp.frameMeta = nil
+	if mp.trackingConf.Enabled {
+		mp.motionDetector.enableTracking(mp.trackingConf, mp.camera)
+	}
+
+	// Apply the mask to the new detector.
+	mp.maskMu.Lock()
+	mp.maskChanged = true
+	mp.maskMu.Unlock()
+}
+
+// SetMask sets the mask used for motion detection. It takes effect
+// from the next frame processed and may be called from any goroutine.
+func (mp *MotionProcessor) SetMask(mask *Mask) {
+	mp.maskMu.Lock()
+	defer mp.maskMu.Unlock()
+	mp.mask = mask
+	mp.maskChanged = true
+}
+
+// MaskAndBackground returns the mask used for motion detection (nil
+// if every pixel is used) and a copy of the background frame, which is
+// refreshed every second. It may be called from any goroutine.
+func (mp *MotionProcessor) MaskAndBackground() (*Mask, *cptvframe.Frame) {
+	mp.maskMu.Lock()
+	defer mp.maskMu.Unlock()
+	var background *cptvframe.Frame
+	if mp.background != nil {
+		background = mp.background.CreateCopy()
+	}
+	return mp.mask, background
+}
+
+// syncMask applies any new mask and keeps a copy of the background for
+// MaskAndBackground.
+func (mp *MotionProcessor) syncMask() {
+	mp.maskMu.Lock()
+	defer mp.maskMu.Unlock()
+	if mp.maskChanged {
+		mp.motionDetector.setMask(mp.mask)
+		mp.maskChanged = false
+	}
+	mp.backgroundAge++
+	if mp.background == nil {
+		mp.background = mp.motionDetector.background.CreateCopy()
+	} else if mp.backgroundAge >= mp.backgroundEvery {
+		mp.background.Copy(mp.motionDetector.background)
+		mp.backgroundAge = 0
+	}
+}
+
 func (mp *MotionProcessor) process(frame *cptvframe.Frame) {
-	if mp.motionDetector.Detect(frame) {
+	mp.checkProfile()
+	mp.syncMask()
+	movement := mp.motionDetector.Detect(frame)
+	tracks := mp.Tracks()
+	if mp.listener != nil && mp.motionDetector.tracker != nil {
+		mp.listener.TracksUpdated(tracks)
+	}
+	meta := mp.updateFrameMeta(frame, movement, tracks)
+	if movement {
 		if mp.listener != nil {
 			mp.listener.MotionDetected()
 		}
 		mp.triggered++
 
 		if mp.isRecording {
-			// increase the length of recording
-			mp.writeUntil = min(mp.framesWritten+mp.minFrames, mp.maxFrames)
+			// increase the length of recording, unless it's a manual
+			// recording which lasts as long as asked for
+			if !mp.manualRecording {
+				mp.writeUntil = min(mp.framesWritten+mp.minFrames, mp.maxFrames)
+			}
 		} else if mp.triggered < mp.triggerFrames {
 			// Only start recording after n (triggerFrames) consecutive frames with motion detected.
 		} else if err := mp.canStartWriting(); err != nil {
@@ -194,6 +462,7 @@ func (mp *MotionProcessor) process(frame *cptvframe.Frame) {
 		} else if err := mp.startRecording(); err != nil {
 			mp.log.Printf("Can't start recording file: %v", err)
 		} else {
+			meta.Trigger = true
 			mp.writeUntil = mp.minFrames
 		}
 	} else {
@@ -202,7 +471,7 @@ func (mp *MotionProcessor) process(frame *cptvframe.Frame) {
 
 	// If recording, write the frame.
 	if mp.isRecording {
-		err := mp.recorder.WriteFrame(frame)
+		err := mp.writeFrame(frame, false)
 		if err != nil {
 			mp.log.Printf("Failed to write to CPTV file %v", err)
 		}
@@ -220,19 +489,110 @@ func (mp *MotionProcessor) process(frame *cptvframe.Frame) {
 }
 
 func (mp *MotionProcessor) ProcessFrame(srcFrame *cptvframe.Frame) {
+	mp.maybeRebuildDetector()
 	frame := mp.frameLoop.Current()
 	frame.Copy(srcFrame)
 	mp.process(frame)
 }
 
+// Tracks returns the tracks seen in the most recent frame. It returns
+// nil if tracking is disabled.
+func (mp *MotionProcessor) Tracks() []Track {
+	if mp.motionDetector.tracker == nil {
+		return nil
+	}
+	return mp.motionDetector.tracker.Tracks()
+}
+
+// TempThresh returns the temperature threshold used for the most
+// recent frame. It must be called from the goroutine processing frames.
+func (mp *MotionProcessor) TempThresh() uint16 {
+	return mp.motionDetector.tempThresh
+}
+
+// DeltaCount returns the number of pixels which changed by more than
+// the delta threshold in the most recent frame. It must be called from
+// the goroutine processing frames.
+func (mp *MotionProcessor) DeltaCount() int {
+	return mp.motionDetector.deltaCount
+}
+
+// SetPaused stops recordings being started by motion while paused is
+// true. A recording in progress carries on until it would have
+// finished. Manual recordings can still be made. It may be called from
+// any goroutine.
+func (mp *MotionProcessor) SetPaused(paused bool) {
+	mp.pausedMu.Lock()
+	defer mp.pausedMu.Unlock()
+	mp.paused = paused
+}
+
+// Paused reports whether motion triggered recording is paused. It may
+// be called from any goroutine.
+func (mp *MotionProcessor) Paused() bool {
+	mp.pausedMu.Lock()
+	defer mp.pausedMu.Unlock()
+	return mp.paused
+}
+
+// StartManualRecording starts a recording of secs seconds regardless
+// of motion or the recording window. If a recording is already in
+// progress it is made at least secs seconds long from now instead. It
+// must be called from the goroutine processing frames.
+func (mp *MotionProcessor) StartManualRecording(secs int) error {
+	frames := secs * mp.camera.FPS()
+	if secs < 1 || frames > mp.maxFrames {
+		return fmt.Errorf("manual recording length must be from 1 to %d seconds", mp.conf.MaxSecs)
+	}
+	if mp.isRecording {
+		mp.manualRecording = true
+		if until := mp.framesWritten + frames; until > mp.writeUntil {
+			mp.writeUntil = until
+		}
+		return nil
+	}
+	if err := mp.recorder.CheckCanRecord(); err != nil {
+		return err
+	}
+	if err := mp.startRecording(); err != nil {
+		return err
+	}
+	mp.manualRecording = true
+	mp.writeUntil = frames
+	return nil
+}
+
+// StopManualRecording stops a manual recording early. It must be
+// called from the goroutine processing frames.
+func (mp *MotionProcessor) StopManualRecording() error {
+	if !mp.manualRecording {
+		return errors.New("no manual recording in progress")
+	}
+	return mp.stopRecording()
+}
+
+// ManualRecording reports whether a manual recording is in progress.
+// It must be called from the goroutine processing frames.
+func (mp *MotionProcessor) ManualRecording() bool {
+	return mp.manualRecording
+}
+
 func (mp *MotionProcessor) GetRecentFrame() (uint32, *cptvframe.Frame) {
 	return mp.CurrentFrame, mp.frameLoop.CopyRecent()
 }
 
 func (mp *MotionProcessor) canStartWriting() error {
-	if !mp.window.Active() {
+	// An active profile takes the place of the recording window.
+	if mp.profile != nil {
+		if mp.profile.SnapshotOnly {
+			return fmt.Errorf("motion detected but the %s profile is snapshot only", mp.profile.Name)
+		}
+	} else if !mp.window.Active() {
 		return errors.New("motion detected but outside of recording window")
 	}
+	if mp.Paused() {
+		return errors.New("motion detected but recording is paused")
+	}
 	return mp.recorder.CheckCanRecord()
 }
 
@@ -263,6 +623,7 @@ func (mp *MotionProcessor) stopRecording() error {
 	mp.framesWritten = 0
 	mp.writeUntil = 0
 	mp.isRecording = false
+	mp.manualRecording = false
 	mp.triggered = 0
 	// if it starts recording again very quickly it won't write the same frames again
 	mp.frameLoop.SetAsOldest()
@@ -270,6 +631,44 @@ func (mp *MotionProcessor) stopRecording() error {
 	return err
 }
 
+// updateFrameMeta records what motion detection found in frame.
+func (mp *MotionProcessor) updateFrameMeta(frame *cptvframe.Frame, movement bool, tracks []Track) *recorder.FrameMetadata {
+	meta := &recorder.FrameMetadata{
+		DeltaCount: mp.motionDetector.deltaCount,
+		TempThresh: mp.motionDetector.tempThresh,
+		Motion:     movement,
+	}
+	for _, track := range tracks {
+		bounds := track.Region.Bounds
+		meta.Regions = append(meta.Regions, recorder.Region{
+			TrackID: track.ID,
+			X:       bounds.Min.X,
+			Y:       bounds.Min.Y,
+			Width:   bounds.Dx(),
+			Height:  bounds.Dy(),
+			Pixels:  track.Region.Pixels,
+		})
+	}
+	if mp.frameMeta == nil {
+		mp.frameMeta = make(map[*cptvframe.Frame]*recorder.FrameMetadata)
+	}
+	mp.frameMeta[frame] = meta
+	return meta
+}
+
+// writeFrame writes frame along with its motion metadata if the
+// recorder supports it.
+func (mp *MotionProcessor) writeFrame(frame *cptvframe.Frame, preview bool) error {
+	metaRecorder, ok := mp.recorder.(recorder.MetadataRecorder)
+	meta := mp.frameMeta[frame]
+	if !ok || meta == nil {
+		return mp.recorder.WriteFrame(frame)
+	}
+	metaCopy := *meta
+	metaCopy.Preview = preview
+	return metaRecorder.WriteFrameWithMetadata(frame, &metaCopy)
+}
+
 func (mp *MotionProcessor) recordPreTriggerFrames() error {
 	frames := mp.frameLoop.GetHistory()
 	var frame *cptvframe.Frame
@@ -278,7 +677,7 @@ func (mp *MotionProcessor) recordPreTriggerFrames() error {
 	// it never writes the current frame as this will be written later
 	for ii < len(frames)-1 {
 		frame = frames[ii]
-		if err := mp.recorder.WriteFrame(frame); err != nil {
+		if err := mp.writeFrame(frame, true); err != nil {
 			return err
 		}
 		ii++
@@ -19,8 +19,10 @@ package motion
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	config "github.com/TheCacophonyProject/go-config"
 	"github.com/TheCacophonyProject/go-cptv/cptvframe"
@@ -110,7 +112,7 @@ func FramesFrom(start, end int) []int {
 func SetupTest(mConf *config.ThermalMotion, rConf *recorder.RecorderConfig, lConf *config.Location) (*TestRecorder, *TestFrameMaker) {
 	recorder := new(TestRecorder)
 	camera := new(TestCamera)
-	processor := NewMotionProcessor(lepton3.ParseRawFrame, mConf, rConf, lConf, nil, recorder, camera, nil, nil)
+	processor := NewMotionProcessor(lepton3.ParseRawFrame, mConf, nil, rConf, lConf, nil, recorder, camera, nil, nil)
 
 	scenarioMaker := MakeTestFrameMaker(processor, camera)
 	return recorder, scenarioMaker
@@ -173,3 +175,216 @@ func TestMultipleRecordingsDontRepeatAnyFrames(t *testing.T) {
 	scenarioMaker.AddMovingDotFrames(1).AddBackgroundFrames(39)
 	assert.Equal(t, FramesFrom(38, 67), recorder.GetRecordedFramesIds())
 }
+
+type metadataRecorder struct {
+	TestRecorder
+	meta []recorder.FrameMetadata
+}
+
+func (mr *metadataRecorder) WriteFrameWithMetadata(frame *cptvframe.Frame, meta *recorder.FrameMetadata) error {
+	mr.meta = append(mr.meta, *meta)
+	return mr.WriteFrame(frame)
+}
+
+func TestMetadataWrittenWithFrames(t *testing.T) {
+	rec := new(metadataRecorder)
+	camera := new(TestCamera)
+	processor := NewMotionProcessor(lepton3.ParseRawFrame, MotionTestConfig(), nil, RecorderTestConfig(), LocationTestConfig(), nil, rec, camera, nil, nil)
+	MakeTestFrameMaker(processor, camera).AddBackgroundFrames(11).AddMovingDotFrames(1).AddBackgroundFrames(2)
+
+	// 9 preview frames, the trigger frame and 2 more.
+	assert.Len(t, rec.meta, 12)
+	for _, meta := range rec.meta[:9] {
+		assert.True(t, meta.Preview)
+		assert.False(t, meta.Motion)
+	}
+	trigger := rec.meta[9]
+	assert.False(t, trigger.Preview)
+	assert.True(t, trigger.Motion)
+	assert.True(t, trigger.Trigger)
+	assert.Equal(t, 9, trigger.DeltaCount)
+	assert.Equal(t, uint16(3000), trigger.TempThresh)
+	for _, meta := range rec.meta[10:] {
+		assert.False(t, meta.Preview)
+		assert.False(t, meta.Trigger)
+	}
+}
+
+func TestUpdateConfigThresholds(t *testing.T) {
+	recorder, scenarioMaker := SetupTest(MotionTestConfig(), RecorderTestConfig(), LocationTestConfig())
+	processor := scenarioMaker.processor
+
+	motionConf := MotionTestConfig()
+	motionConf.CountThresh = 20
+	processor.UpdateConfig(motionConf, &TrackingConfig{}, RecorderTestConfig(), LocationTestConfig())
+
+	// The moving dot only changes 9 pixels.
+	scenarioMaker.AddBackgroundFrames(11).AddMovingDotFrames(1).AddBackgroundFrames(5)
+	assert.False(t, recorder.IsRecording())
+}
+
+func TestUpdateConfigRebuildWaitsForRecording(t *testing.T) {
+	recorder, scenarioMaker := SetupTest(MotionTestConfig(), RecorderTestConfig(), LocationTestConfig())
+	processor := scenarioMaker.processor
+
+	scenarioMaker.AddBackgroundFrames(11).AddMovingDotFrames(1)
+	assert.True(t, recorder.IsRecording())
+
+	recorderConf := RecorderTestConfig()
+	recorderConf.PreviewSecs = 2
+	processor.UpdateConfig(MotionTestConfig(), &TrackingConfig{}, recorderConf, LocationTestConfig())
+	scenarioMaker.AddBackgroundFrames(5)
+	assert.True(t, recorder.IsRecording())
+	assert.Equal(t, 10, processor.frameLoop.size)
+
+	// Rebuilt once the recording finishes.
+	scenarioMaker.AddBackgroundFrames(30)
+	assert.False(t, recorder.IsRecording())
+	assert.Equal(t, 19, processor.frameLoop.size)
+}
+
+func TestManualRecording(t *testing.T) {
+	recorder, scenarioMaker := SetupTest(MotionTestConfig(), RecorderTestConfig(), LocationTestConfig())
+	processor := scenarioMaker.processor
+
+	scenarioMaker.AddBackgroundFrames(11)
+	assert.NoError(t, processor.StartManualRecording(2))
+	assert.True(t, processor.ManualRecording())
+
+	// Motion doesn't change the length of a manual recording.
+	scenarioMaker.AddMovingDotFrames(1).AddBackgroundFrames(30)
+	assert.False(t, processor.ManualRecording())
+	assert.Equal(t, FramesFrom(2, 28), recorder.GetRecordedFramesIds())
+}
+
+func TestManualRecordingLength(t *testing.T) {
+	_, scenarioMaker := SetupTest(MotionTestConfig(), RecorderTestConfig(), LocationTestConfig())
+	processor := scenarioMaker.processor
+	scenarioMaker.AddBackgroundFrames(11)
+
+	assert.Error(t, processor.StartManualRecording(0))
+	assert.Error(t, processor.StartManualRecording(21))
+	assert.Error(t, processor.StopManualRecording())
+}
+
+func TestStopManualRecording(t *testing.T) {
+	recorder, scenarioMaker := SetupTest(MotionTestConfig(), RecorderTestConfig(), LocationTestConfig())
+	processor := scenarioMaker.processor
+
+	scenarioMaker.AddBackgroundFrames(11)
+	assert.NoError(t, processor.StartManualRecording(10))
+	scenarioMaker.AddBackgroundFrames(5)
+	assert.NoError(t, processor.StopManualRecording())
+	assert.False(t, recorder.IsRecording())
+	assert.Equal(t, FramesFrom(2, 15), recorder.GetRecordedFramesIds())
+}
+
+func TestPausedRecording(t *testing.T) {
+	recorder, scenarioMaker := SetupTest(MotionTestConfig(), RecorderTestConfig(), LocationTestConfig())
+	processor := scenarioMaker.processor
+
+	processor.SetPaused(true)
+	scenarioMaker.AddBackgroundFrames(11).AddMovingDotFrames(1).AddBackgroundFrames(5)
+	assert.False(t, recorder.IsRecording())
+
+	// Manual recordings can still be made.
+	assert.NoError(t, processor.StartManualRecording(1))
+	assert.True(t, recorder.IsRecording())
+	scenarioMaker.AddBackgroundFrames(10)
+	assert.False(t, recorder.IsRecording())
+
+	processor.SetPaused(false)
+	scenarioMaker.AddMovingDotFrames(1)
+	assert.True(t, recorder.IsRecording())
+}
+
+func profileTestConfig(now *time.Time) *recorder.RecorderConfig {
+	conf := RecorderTestConfig()
+	countThresh := 20
+	w, err := window.New("18:00", "22:00", 0, 0)
+	if err != nil {
+		panic(err)
+	}
+	w.Now = func() time.Time { return *now }
+	conf.Profiles = []recorder.Profile{{Name: "dusk", CountThresh: &countThresh, Window: *w}}
+	w, err = window.New("09:00", "17:00", 0, 0)
+	if err != nil {
+		panic(err)
+	}
+	w.Now = func() time.Time { return *now }
+	conf.Profiles = append(conf.Profiles, recorder.Profile{Name: "day", SnapshotOnly: true, Window: *w})
+	return conf
+}
+
+func TestProfiles(t *testing.T) {
+	now := time.Date(2026, 10, 17, 19, 0, 0, 0, time.Local)
+	recorder, scenarioMaker := SetupTest(MotionTestConfig(), profileTestConfig(&now), LocationTestConfig())
+	processor := scenarioMaker.processor
+	assert.Equal(t, "dusk", processor.Profile())
+
+	// The moving dot only changes 9 pixels.
+	scenarioMaker.AddBackgroundFrames(11).AddMovingDotFrames(1).AddBackgroundFrames(5)
+	assert.False(t, recorder.IsRecording())
+
+	// The profile changes within a second.
+	now = now.Add(4 * time.Hour)
+	scenarioMaker.AddBackgroundFrames(10)
+	assert.Equal(t, "", processor.Profile())
+	scenarioMaker.AddMovingDotFrames(1)
+	assert.True(t, recorder.IsRecording())
+	scenarioMaker.AddBackgroundFrames(40)
+	assert.False(t, recorder.IsRecording())
+
+	now = now.Add(12 * time.Hour)
+	scenarioMaker.AddBackgroundFrames(10)
+	assert.Equal(t, "day", processor.Profile())
+	scenarioMaker.AddMovingDotFrames(1).AddBackgroundFrames(5)
+	assert.False(t, recorder.IsRecording())
+
+	// Manual recordings can still be made.
+	assert.NoError(t, processor.StartManualRecording(1))
+	assert.True(t, recorder.IsRecording())
+}
+
+func TestUpdateConfigProfiles(t *testing.T) {
+	now := time.Date(2026, 10, 17, 19, 0, 0, 0, time.Local)
+	_, scenarioMaker := SetupTest(MotionTestConfig(), RecorderTestConfig(), LocationTestConfig())
+	processor := scenarioMaker.processor
+	assert.Equal(t, "", processor.Profile())
+
+	processor.UpdateConfig(MotionTestConfig(), &TrackingConfig{}, profileTestConfig(&now), LocationTestConfig())
+	assert.Equal(t, "dusk", processor.Profile())
+	assert.Equal(t, 20, processor.motionConf.CountThresh)
+	name, motionConf := processor.ActiveProfile()
+	assert.Equal(t, "dusk", name)
+	require.NotNil(t, motionConf)
+	assert.Equal(t, 20, motionConf.CountThresh)
+
+	processor.UpdateConfig(MotionTestConfig(), &TrackingConfig{}, RecorderTestConfig(), LocationTestConfig())
+	assert.Equal(t, "", processor.Profile())
+	assert.Equal(t, 3, processor.motionConf.CountThresh)
+	name, motionConf = processor.ActiveProfile()
+	assert.Equal(t, "", name)
+	assert.Nil(t, motionConf)
+}
+
+func TestSnapshotFrames(t *testing.T) {
+	snapshots := new(TestRecorder)
+	camera := new(TestCamera)
+	processor := NewMotionProcessor(lepton3.ParseRawFrame, MotionTestConfig(), nil, RecorderTestConfig(), LocationTestConfig(), nil, new(TestRecorder), camera, nil, snapshots)
+	snapshotFrames := func(n int) {
+		for i := 1; i <= n; i++ {
+			frame := cptvframe.NewFrame(camera)
+			frame.Pix[0][0] = uint16(i)
+			processor.processSnapshot(frame)
+		}
+	}
+
+	processor.StartSnapshot(0)
+	snapshotFrames(30)
+	assert.Equal(t, FramesFrom(1, defaultSnapshotFrames), snapshots.GetRecordedFramesIds())
+
+	processor.StartSnapshot(5)
+	snapshotFrames(10)
+	assert.Equal(t, FramesFrom(1, 5), snapshots.GetRecordedFramesIds())
+}
@@ -0,0 +1,249 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package motion
+
+import (
+	"image"
+	"math"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+)
+
+// Region is a group of connected pixels which have changed.
+type Region struct {
+	Bounds  image.Rectangle
+	Pixels  int
+	CentreX float64
+	CentreY float64
+}
+
+func (r *Region) aspectRatio() float64 {
+	w, h := r.Bounds.Dx(), r.Bounds.Dy()
+	if w < h {
+		w, h = h, w
+	}
+	return float64(w) / float64(h)
+}
+
+// Track follows a region across frames. Velocity is in pixels per
+// frame.
+type Track struct {
+	ID        int
+	Region    Region
+	VelocityX float64
+	VelocityY float64
+
+	// Frames is the number of frames the track has been seen in.
+	Frames int
+
+	// Missed is the number of frames since the track was last seen.
+	Missed int
+}
+
+// NewTracker returns a Tracker for frames from camera.
+func NewTracker(conf TrackingConfig, camera cptvframe.CameraSpec) *Tracker {
+	labels := make([][]int32, camera.ResY())
+	for i := range labels {
+		labels[i] = make([]int32, camera.ResX())
+	}
+	return &Tracker{
+		conf:   conf,
+		labels: labels,
+	}
+}
+
+// Tracker finds moving regions in each frame and matches them with
+// the regions found in previous frames.
+type Tracker struct {
+	conf   TrackingConfig
+	labels [][]int32
+	stack  []image.Point
+	tracks []*Track
+	nextID int
+}
+
+// Reset forgets all tracks.
+func (t *Tracker) Reset() {
+	t.tracks = nil
+}
+
+// Tracks returns the tracks seen in the most recent frame.
+func (t *Tracker) Tracks() []Track {
+	tracks := make([]Track, 0, len(t.tracks))
+	for _, track := range t.tracks {
+		if track.Missed == 0 {
+			tracks = append(tracks, *track)
+		}
+	}
+	return tracks
+}
+
+// Persistent returns true if a track seen in the most recent frame has
+// been seen for at least MinTrackFrames.
+func (t *Tracker) Persistent() bool {
+	for _, track := range t.tracks {
+		if track.Missed == 0 && track.Frames >= t.conf.MinTrackFrames {
+			return true
+		}
+	}
+	return false
+}
+
+// Update finds the regions of pixels within bounds for which changed
+// returns true and updates the tracks with them.
+func (t *Tracker) Update(changed func(x, y int) bool, bounds image.Rectangle) {
+	t.match(t.findRegions(changed, bounds))
+}
+
+// findRegions labels the 8-connected regions of changed pixels and
+// returns those which pass the size and shape filters.
+func (t *Tracker) findRegions(changed func(x, y int) bool, bounds image.Rectangle) []Region {
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row := t.labels[y]
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			row[x] = 0
+		}
+	}
+
+	var regions []Region
+	var label int32
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if t.labels[y][x] != 0 || !changed(x, y) {
+				continue
+			}
+			label++
+			region := t.fill(changed, bounds, x, y, label)
+			if t.accept(&region) {
+				regions = append(regions, region)
+			}
+		}
+	}
+	return regions
+}
+
+// fill labels the region containing (x, y) and returns it.
+func (t *Tracker) fill(changed func(x, y int) bool, bounds image.Rectangle, x, y int, label int32) Region {
+	var sumX, sumY int
+	region := Region{Bounds: image.Rect(x, y, x+1, y+1)}
+
+	t.labels[y][x] = label
+	t.stack = append(t.stack[:0], image.Pt(x, y))
+	for len(t.stack) > 0 {
+		p := t.stack[len(t.stack)-1]
+		t.stack = t.stack[:len(t.stack)-1]
+
+		region.Pixels++
+		sumX += p.X
+		sumY += p.Y
+		region.Bounds = region.Bounds.Union(image.Rect(p.X, p.Y, p.X+1, p.Y+1))
+
+		for ny := p.Y - 1; ny <= p.Y+1; ny++ {
+			for nx := p.X - 1; nx <= p.X+1; nx++ {
+				n := image.Pt(nx, ny)
+				if !n.In(bounds) || t.labels[ny][nx] != 0 || !changed(nx, ny) {
+					continue
+				}
+				t.labels[ny][nx] = label
+				t.stack = append(t.stack, n)
+			}
+		}
+	}
+	region.CentreX = float64(sumX) / float64(region.Pixels)
+	region.CentreY = float64(sumY) / float64(region.Pixels)
+	return region
+}
+
+func (t *Tracker) accept(r *Region) bool {
+	if r.Pixels < t.conf.MinRegionPixels {
+		return false
+	}
+	if t.conf.MaxRegionPixels > 0 && r.Pixels > t.conf.MaxRegionPixels {
+		return false
+	}
+	if t.conf.MaxAspectRatio > 0 && r.aspectRatio() > t.conf.MaxAspectRatio {
+		return false
+	}
+	return true
+}
+
+// match assigns regions to the existing tracks, nearest first, and
+// starts new tracks for the regions left over. Tracks which haven't
+// been seen for more than MaxMissedFrames are dropped.
+func (t *Tracker) match(regions []Region) {
+	for _, track := range t.tracks {
+		track.Missed++
+	}
+
+	used := make([]bool, len(regions))
+	for {
+		bestDist := t.conf.MaxMatchDistance
+		var bestTrack *Track
+		bestRegion := -1
+		for _, track := range t.tracks {
+			if track.Missed == 0 {
+				continue // Already matched this frame.
+			}
+			// Predict where the track should be now.
+			steps := float64(track.Missed)
+			predX := track.Region.CentreX + track.VelocityX*steps
+			predY := track.Region.CentreY + track.VelocityY*steps
+			for i := range regions {
+				if used[i] {
+					continue
+				}
+				dist := math.Hypot(regions[i].CentreX-predX, regions[i].CentreY-predY)
+				if dist <= bestDist {
+					bestDist = dist
+					bestTrack = track
+					bestRegion = i
+				}
+			}
+		}
+		if bestTrack == nil {
+			break
+		}
+
+		region := regions[bestRegion]
+		used[bestRegion] = true
+		steps := float64(bestTrack.Missed)
+		bestTrack.VelocityX = (region.CentreX - bestTrack.Region.CentreX) / steps
+		bestTrack.VelocityY = (region.CentreY - bestTrack.Region.CentreY) / steps
+		bestTrack.Region = region
+		bestTrack.Frames++
+		bestTrack.Missed = 0
+	}
+
+	tracks := t.tracks[:0]
+	for _, track := range t.tracks {
+		if track.Missed <= t.conf.MaxMissedFrames {
+			tracks = append(tracks, track)
+		}
+	}
+	for i, region := range regions {
+		if used[i] {
+			continue
+		}
+		t.nextID++
+		tracks = append(tracks, &Track{
+			ID:     t.nextID,
+			Region: region,
+			Frames: 1,
+		})
+	}
+	t.tracks = tracks
+}
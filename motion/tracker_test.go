@@ -0,0 +1,200 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package motion
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// changedRects returns a function reporting pixels within any of
+// rects as changed.
+func changedRects(rects ...image.Rectangle) func(x, y int) bool {
+	return func(x, y int) bool {
+		for _, r := range rects {
+			if image.Pt(x, y).In(r) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+var trackerBounds = image.Rect(0, 0, 160, 120)
+
+func TestFindRegions(t *testing.T) {
+	tracker := NewTracker(DefaultTrackingConfig(), new(TestCamera))
+
+	// Two separate blobs plus one touching the first diagonally.
+	regions := tracker.findRegions(changedRects(
+		image.Rect(10, 10, 13, 13),
+		image.Rect(13, 13, 15, 15),
+		image.Rect(50, 60, 54, 62),
+	), trackerBounds)
+
+	require.Len(t, regions, 2)
+	assert.Equal(t, image.Rect(10, 10, 15, 15), regions[0].Bounds)
+	assert.Equal(t, 13, regions[0].Pixels)
+	assert.Equal(t, image.Rect(50, 60, 54, 62), regions[1].Bounds)
+	assert.Equal(t, 8, regions[1].Pixels)
+	assert.Equal(t, 51.5, regions[1].CentreX)
+	assert.Equal(t, 60.5, regions[1].CentreY)
+}
+
+func TestRegionFilters(t *testing.T) {
+	conf := DefaultTrackingConfig()
+	conf.MinRegionPixels = 4
+	conf.MaxRegionPixels = 50
+	conf.MaxAspectRatio = 3
+	tracker := NewTracker(conf, new(TestCamera))
+
+	regions := tracker.findRegions(changedRects(
+		image.Rect(10, 10, 11, 13), // too small
+		image.Rect(30, 30, 40, 40), // too big
+		image.Rect(50, 50, 60, 51), // too thin
+		image.Rect(70, 70, 73, 73), // ok
+		image.Rect(90, 90, 93, 99), // ok, aspect 3
+	), trackerBounds)
+
+	require.Len(t, regions, 2)
+	assert.Equal(t, image.Rect(70, 70, 73, 73), regions[0].Bounds)
+	assert.Equal(t, image.Rect(90, 90, 93, 99), regions[1].Bounds)
+}
+
+func TestRegionsOutsideBoundsIgnored(t *testing.T) {
+	tracker := NewTracker(DefaultTrackingConfig(), new(TestCamera))
+	regions := tracker.findRegions(changedRects(image.Rect(0, 0, 4, 4)), image.Rect(2, 2, 158, 118))
+	require.Len(t, regions, 1)
+	assert.Equal(t, image.Rect(2, 2, 4, 4), regions[0].Bounds)
+}
+
+func TestTracksFollowMovingRegions(t *testing.T) {
+	conf := DefaultTrackingConfig()
+	conf.MinTrackFrames = 3
+	tracker := NewTracker(conf, new(TestCamera))
+
+	for i := 0; i < 4; i++ {
+		tracker.Update(changedRects(
+			image.Rect(10+3*i, 10, 13+3*i, 13),
+			image.Rect(100, 100-2*i, 103, 103-2*i),
+		), trackerBounds)
+		assert.Equal(t, i >= 2, tracker.Persistent())
+	}
+
+	tracks := tracker.Tracks()
+	require.Len(t, tracks, 2)
+	assert.Equal(t, 1, tracks[0].ID)
+	assert.Equal(t, 4, tracks[0].Frames)
+	assert.Equal(t, image.Rect(19, 10, 22, 13), tracks[0].Region.Bounds)
+	assert.Equal(t, 3.0, tracks[0].VelocityX)
+	assert.Equal(t, 0.0, tracks[0].VelocityY)
+
+	assert.Equal(t, 2, tracks[1].ID)
+	assert.Equal(t, 0.0, tracks[1].VelocityX)
+	assert.Equal(t, -2.0, tracks[1].VelocityY)
+}
+
+func TestTrackSurvivesMissedFrames(t *testing.T) {
+	conf := DefaultTrackingConfig()
+	conf.MaxMissedFrames = 2
+	tracker := NewTracker(conf, new(TestCamera))
+	none := changedRects()
+
+	tracker.Update(changedRects(image.Rect(10, 10, 13, 13)), trackerBounds)
+	tracker.Update(changedRects(image.Rect(12, 10, 15, 13)), trackerBounds)
+	tracker.Update(none, trackerBounds)
+	assert.Empty(t, tracker.Tracks())
+
+	// Reappears where its velocity predicts.
+	tracker.Update(changedRects(image.Rect(16, 10, 19, 13)), trackerBounds)
+	tracks := tracker.Tracks()
+	require.Len(t, tracks, 1)
+	assert.Equal(t, 1, tracks[0].ID)
+	assert.Equal(t, 3, tracks[0].Frames)
+	assert.Equal(t, 2.0, tracks[0].VelocityX)
+
+	// Gone for too long.
+	for i := 0; i < 3; i++ {
+		tracker.Update(none, trackerBounds)
+	}
+	tracker.Update(changedRects(image.Rect(24, 10, 27, 13)), trackerBounds)
+	tracks = tracker.Tracks()
+	require.Len(t, tracks, 1)
+	assert.Equal(t, 2, tracks[0].ID)
+}
+
+func TestDistantRegionStartsNewTrack(t *testing.T) {
+	tracker := NewTracker(DefaultTrackingConfig(), new(TestCamera))
+	tracker.Update(changedRects(image.Rect(10, 10, 13, 13)), trackerBounds)
+	tracker.Update(changedRects(image.Rect(80, 80, 83, 83)), trackerBounds)
+
+	tracks := tracker.Tracks()
+	require.Len(t, tracks, 1)
+	assert.Equal(t, 2, tracks[0].ID)
+	assert.Equal(t, 1, tracks[0].Frames)
+}
+
+type trackListener struct {
+	tracks [][]Track
+}
+
+func (l *trackListener) MotionDetected()   {}
+func (l *trackListener) RecordingStarted() {}
+func (l *trackListener) RecordingEnded()   {}
+
+func (l *trackListener) TracksUpdated(tracks []Track) {
+	l.tracks = append(l.tracks, tracks)
+}
+
+func TestProcessorReportsTracks(t *testing.T) {
+	tracking := DefaultTrackingConfig()
+	tracking.Enabled = true
+	listener := new(trackListener)
+	camera := new(TestCamera)
+	processor := NewMotionProcessor(nil, MotionTestConfig(), &tracking, RecorderTestConfig(), LocationTestConfig(), listener, new(TestRecorder), camera, nil, nil)
+
+	MakeTestFrameMaker(processor, camera).AddBackgroundFrames(11).AddMovingDotFrames(3)
+	require.Len(t, listener.tracks, 14)
+	for _, tracks := range listener.tracks[:11] {
+		assert.Empty(t, tracks)
+	}
+	for i, tracks := range listener.tracks[11:] {
+		require.Len(t, tracks, 1)
+		assert.Equal(t, 1, tracks[0].ID)
+		assert.Equal(t, i+1, tracks[0].Frames)
+	}
+}
+
+func TestRecordingTriggeredByTrackPersistence(t *testing.T) {
+	tracking := DefaultTrackingConfig()
+	tracking.Enabled = true
+	tracking.TriggerOnTracks = true
+	tracking.MinTrackFrames = 3
+	recorder := new(TestRecorder)
+	camera := new(TestCamera)
+	processor := NewMotionProcessor(nil, MotionTestConfig(), &tracking, RecorderTestConfig(), LocationTestConfig(), nil, recorder, camera, nil, nil)
+	frameMaker := MakeTestFrameMaker(processor, camera)
+
+	frameMaker.AddBackgroundFrames(11).AddMovingDotFrames(2)
+	assert.False(t, recorder.IsRecording())
+
+	frameMaker.AddMovingDotFrames(1)
+	assert.True(t, recorder.IsRecording())
+}
@@ -0,0 +1,264 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package recorder
+
+import (
+	"log"
+	"sync"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+)
+
+type asyncOp int
+
+const (
+	opStart asyncOp = iota
+	opFrame
+	opStop
+	opRun
+)
+
+type asyncItem struct {
+	op         asyncOp
+	frame      *cptvframe.Frame
+	meta       *FrameMetadata
+	tempThresh uint16
+	fn         func()
+	// result receives the outcome of starting or stopping a recording.
+	result chan error
+}
+
+// AsyncStats describes the write backlog of an AsyncRecorder.
+type AsyncStats struct {
+	// Backlog is the number of frames waiting to be written.
+	Backlog int
+	// MaxBacklog is the largest backlog seen.
+	MaxBacklog int
+	// Written is the number of frames written.
+	Written uint64
+	// Dropped is the number of frames dropped because the backlog was
+	// full.
+	Dropped uint64
+}
+
+// AsyncRecorder passes frames to another Recorder on a separate
+// goroutine so that slow storage doesn't hold up frame processing.
+//
+// Frames are copied into a fixed pool of buffers. If every buffer is
+// waiting to be written when a new frame arrives then the new frame
+// is dropped and counted in AsyncStats.Dropped; frames which have been
+// queued are always written. Starting and stopping recordings is
+// never dropped.
+//
+// StartRecording and StopRecording wait for the recording to be
+// started or stopped on the writing goroutine and return its error.
+// StopRecording also returns the first error from writing the
+// recording's frames; other errors are logged. Frames for a recording
+// which failed to start are discarded.
+type AsyncRecorder struct {
+	recorder Recorder
+	items    chan asyncItem
+	spent    chan *cptvframe.Frame
+	done     chan struct{}
+
+	mu    sync.Mutex
+	stats AsyncStats
+	err   error
+}
+
+// NewAsyncRecorder returns an AsyncRecorder writing to r using a pool
+// of queueLen frame buffers.
+func NewAsyncRecorder(r Recorder, camera cptvframe.CameraSpec, queueLen int) *AsyncRecorder {
+	if queueLen < 1 {
+		queueLen = 1
+	}
+	ar := &AsyncRecorder{
+		recorder: r,
+		// Room for every pooled frame plus the start and stop of a
+		// few recordings.
+		items: make(chan asyncItem, queueLen+8),
+		spent: make(chan *cptvframe.Frame, queueLen),
+		done:  make(chan struct{}),
+	}
+	for i := 0; i < queueLen; i++ {
+		ar.spent <- cptvframe.NewFrame(camera)
+	}
+	go ar.run()
+	return ar
+}
+
+// CheckCanRecord is passed straight to the underlying recorder.
+func (ar *AsyncRecorder) CheckCanRecord() error {
+	return ar.recorder.CheckCanRecord()
+}
+
+func (ar *AsyncRecorder) StartRecording(background *cptvframe.Frame, tempThresh uint16) error {
+	var backgroundCopy *cptvframe.Frame
+	if background != nil {
+		backgroundCopy = background.CreateCopy()
+	}
+	result := make(chan error, 1)
+	ar.items <- asyncItem{op: opStart, frame: backgroundCopy, tempThresh: tempThresh, result: result}
+	return <-result
+}
+
+// StopRecording waits for the frames queued so far to be written and
+// the recording to be finished.
+func (ar *AsyncRecorder) StopRecording() error {
+	result := make(chan error, 1)
+	ar.items <- asyncItem{op: opStop, result: result}
+	return <-result
+}
+
+func (ar *AsyncRecorder) WriteFrame(frame *cptvframe.Frame) error {
+	return ar.queueFrame(frame, nil)
+}
+
+// WriteFrameWithMetadata queues frame with a copy of meta. The
+// metadata is passed on if the underlying recorder supports it.
+func (ar *AsyncRecorder) WriteFrameWithMetadata(frame *cptvframe.Frame, meta *FrameMetadata) error {
+	var metaCopy *FrameMetadata
+	if meta != nil {
+		m := *meta
+		metaCopy = &m
+	}
+	return ar.queueFrame(frame, metaCopy)
+}
+
+func (ar *AsyncRecorder) queueFrame(frame *cptvframe.Frame, meta *FrameMetadata) error {
+	var buf *cptvframe.Frame
+	select {
+	case buf = <-ar.spent:
+	default:
+		ar.mu.Lock()
+		ar.stats.Dropped++
+		ar.mu.Unlock()
+		return nil
+	}
+	buf.Copy(frame)
+
+	ar.mu.Lock()
+	ar.stats.Backlog++
+	if ar.stats.Backlog > ar.stats.MaxBacklog {
+		ar.stats.MaxBacklog = ar.stats.Backlog
+	}
+	ar.mu.Unlock()
+
+	ar.items <- asyncItem{op: opFrame, frame: buf, meta: meta}
+	return nil
+}
+
+// Run calls fn on the writing goroutine after everything queued so far
+// has been written. It is used to change the underlying recorder's
+// settings without racing with writes.
+func (ar *AsyncRecorder) Run(fn func()) {
+	ar.items <- asyncItem{op: opRun, fn: fn}
+}
+
+// Stats returns the current backlog statistics.
+func (ar *AsyncRecorder) Stats() AsyncStats {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	return ar.stats
+}
+
+// Close writes everything queued and then stops the writing goroutine.
+// The AsyncRecorder must not be used afterwards.
+func (ar *AsyncRecorder) Close() {
+	close(ar.items)
+	<-ar.done
+}
+
+func (ar *AsyncRecorder) run() {
+	defer close(ar.done)
+
+	metaRecorder, hasMeta := ar.recorder.(MetadataRecorder)
+	recording := false
+	var dropped uint64
+	for item := range ar.items {
+		switch item.op {
+		case opStart:
+			dropped = ar.Stats().Dropped
+			err := ar.recorder.StartRecording(item.frame, item.tempThresh)
+			recording = err == nil
+			ar.takeErr()
+			item.result <- err
+		case opStop:
+			var err error
+			if recording {
+				err = ar.recorder.StopRecording()
+				recording = false
+				if n := ar.Stats().Dropped - dropped; n > 0 {
+					log.Printf("%d frames dropped from recording due to write backlog", n)
+				}
+			}
+			if writeErr := ar.takeErr(); writeErr != nil {
+				err = writeErr
+			}
+			item.result <- err
+		case opRun:
+			item.fn()
+		case opFrame:
+			written := false
+			if recording {
+				var err error
+				if hasMeta && item.meta != nil {
+					err = metaRecorder.WriteFrameWithMetadata(item.frame, item.meta)
+				} else {
+					err = ar.recorder.WriteFrame(item.frame)
+				}
+				ar.setErr(err)
+				written = err == nil
+			}
+			ar.mu.Lock()
+			ar.stats.Backlog--
+			if written {
+				ar.stats.Written++
+			}
+			ar.mu.Unlock()
+			ar.spent <- item.frame
+		}
+	}
+	if recording {
+		if err := ar.recorder.StopRecording(); err != nil {
+			log.Printf("recording error: %v", err)
+		}
+	}
+}
+
+// setErr logs an error from writing a frame and keeps it to be
+// returned by StopRecording if it is the first for the recording.
+func (ar *AsyncRecorder) setErr(err error) {
+	if err == nil {
+		return
+	}
+	log.Printf("recording error: %v", err)
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	if ar.err == nil {
+		ar.err = err
+	}
+}
+
+// takeErr returns the error kept by setErr and clears it.
+func (ar *AsyncRecorder) takeErr() error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	err := ar.err
+	ar.err = nil
+	return err
+}
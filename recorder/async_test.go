@@ -0,0 +1,174 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package recorder
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCamera struct{}
+
+func (testCamera) ResX() int { return 4 }
+func (testCamera) ResY() int { return 3 }
+func (testCamera) FPS() int  { return 9 }
+
+// logRecorder records what it is asked to do. Writes block while
+// release is non-nil and hasn't been closed.
+type logRecorder struct {
+	events   []string
+	frameIDs []uint16
+	meta     []FrameMetadata
+	startErr error
+	stopErr  error
+	writeErr error
+	release  chan struct{}
+}
+
+func (lr *logRecorder) CheckCanRecord() error { return nil }
+
+func (lr *logRecorder) StartRecording(background *cptvframe.Frame, tempThresh uint16) error {
+	lr.events = append(lr.events, "start")
+	return lr.startErr
+}
+
+func (lr *logRecorder) StopRecording() error {
+	lr.events = append(lr.events, "stop")
+	return lr.stopErr
+}
+
+func (lr *logRecorder) WriteFrame(frame *cptvframe.Frame) error {
+	if lr.release != nil {
+		<-lr.release
+	}
+	lr.events = append(lr.events, "frame")
+	lr.frameIDs = append(lr.frameIDs, frame.Pix[0][0])
+	return lr.writeErr
+}
+
+func (lr *logRecorder) WriteFrameWithMetadata(frame *cptvframe.Frame, meta *FrameMetadata) error {
+	lr.meta = append(lr.meta, *meta)
+	return lr.WriteFrame(frame)
+}
+
+func testFrame(id uint16) *cptvframe.Frame {
+	frame := cptvframe.NewFrame(testCamera{})
+	frame.Pix[0][0] = id
+	return frame
+}
+
+func TestAsyncRecorderWritesInOrder(t *testing.T) {
+	lr := new(logRecorder)
+	ar := NewAsyncRecorder(lr, testCamera{}, 4)
+
+	frame := testFrame(0)
+	require.NoError(t, ar.StartRecording(frame, 3000))
+	for i := uint16(1); i <= 3; i++ {
+		// The frame is reused, as the motion processor does.
+		frame.Pix[0][0] = i
+		require.NoError(t, ar.WriteFrameWithMetadata(frame, &FrameMetadata{DeltaCount: int(i)}))
+	}
+	require.NoError(t, ar.StopRecording())
+	ar.Close()
+
+	assert.Equal(t, []string{"start", "frame", "frame", "frame", "stop"}, lr.events)
+	assert.Equal(t, []uint16{1, 2, 3}, lr.frameIDs)
+	assert.Equal(t, []FrameMetadata{{DeltaCount: 1}, {DeltaCount: 2}, {DeltaCount: 3}}, lr.meta)
+
+	stats := ar.Stats()
+	assert.Equal(t, uint64(3), stats.Written)
+	assert.Equal(t, uint64(0), stats.Dropped)
+	assert.Equal(t, 0, stats.Backlog)
+}
+
+func TestAsyncRecorderDropsNewFramesWhenFull(t *testing.T) {
+	lr := &logRecorder{release: make(chan struct{})}
+	ar := NewAsyncRecorder(lr, testCamera{}, 2)
+
+	require.NoError(t, ar.StartRecording(nil, 0))
+	for i := uint16(1); i <= 5; i++ {
+		require.NoError(t, ar.WriteFrame(testFrame(i)))
+	}
+	stats := ar.Stats()
+	assert.Equal(t, 2, stats.Backlog)
+	assert.Equal(t, uint64(3), stats.Dropped)
+
+	close(lr.release)
+	require.NoError(t, ar.StopRecording())
+	ar.Close()
+
+	assert.Equal(t, []uint16{1, 2}, lr.frameIDs)
+	stats = ar.Stats()
+	assert.Equal(t, 2, stats.MaxBacklog)
+	assert.Equal(t, uint64(2), stats.Written)
+}
+
+func TestAsyncRecorderReportsStartError(t *testing.T) {
+	lr := &logRecorder{startErr: errors.New("no space")}
+	ar := NewAsyncRecorder(lr, testCamera{}, 2)
+
+	assert.EqualError(t, ar.StartRecording(nil, 0), "no space")
+	require.NoError(t, ar.WriteFrame(testFrame(1)))
+	require.NoError(t, ar.StopRecording())
+	ar.Close()
+
+	// Frames for the failed recording are discarded and it isn't stopped.
+	assert.Equal(t, []string{"start"}, lr.events)
+}
+
+func TestAsyncRecorderReportsStopError(t *testing.T) {
+	lr := &logRecorder{stopErr: errors.New("rename failed")}
+	ar := NewAsyncRecorder(lr, testCamera{}, 2)
+
+	require.NoError(t, ar.StartRecording(nil, 0))
+	require.NoError(t, ar.WriteFrame(testFrame(1)))
+	assert.EqualError(t, ar.StopRecording(), "rename failed")
+
+	// The error isn't reported again for the next recording.
+	lr.stopErr = nil
+	require.NoError(t, ar.StartRecording(nil, 0))
+	require.NoError(t, ar.StopRecording())
+	ar.Close()
+}
+
+func TestAsyncRecorderReportsWriteError(t *testing.T) {
+	lr := &logRecorder{writeErr: errors.New("disk full")}
+	ar := NewAsyncRecorder(lr, testCamera{}, 2)
+
+	require.NoError(t, ar.StartRecording(nil, 0))
+	require.NoError(t, ar.WriteFrame(testFrame(1)))
+	require.NoError(t, ar.WriteFrame(testFrame(2)))
+	assert.EqualError(t, ar.StopRecording(), "disk full")
+	ar.Close()
+}
+
+func TestAsyncRecorderRunsInOrder(t *testing.T) {
+	lr := new(logRecorder)
+	ar := NewAsyncRecorder(lr, testCamera{}, 2)
+
+	require.NoError(t, ar.StartRecording(nil, 0))
+	require.NoError(t, ar.WriteFrame(testFrame(1)))
+	ar.Run(func() { lr.events = append(lr.events, "run") })
+	require.NoError(t, ar.StopRecording())
+	ar.Close()
+
+	assert.Equal(t, []string{"start", "frame", "run", "stop"}, lr.events)
+}
@@ -0,0 +1,150 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package recorder
+
+import (
+	"errors"
+	"fmt"
+
+	config "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/window"
+)
+
+// ProfilesKey is the config section for recording profiles.
+const ProfilesKey = "thermal-recorder-profiles"
+
+// Profile overrides motion detection and recording settings for part
+// of each day. Only the settings which are set are overridden. The
+// settings which need the motion detector rebuilt, such as
+// frame-compare-gap and preview-secs, can't be overridden as that
+// would lose the learnt background each time the profile changed.
+type Profile struct {
+	Name           string `mapstructure:"name"`
+	StartRecording string `mapstructure:"start-recording"`
+	StopRecording  string `mapstructure:"stop-recording"`
+	// SnapshotOnly stops motion triggering recordings while the
+	// profile is active. Snapshots and manual recordings can still be
+	// made.
+	SnapshotOnly bool `mapstructure:"snapshot-only"`
+
+	DynamicThreshold *bool   `mapstructure:"dynamic-threshold"`
+	TempThresh       *uint16 `mapstructure:"temp-thresh"`
+	TempThreshMin    *uint16 `mapstructure:"temp-thresh-min"`
+	TempThreshMax    *uint16 `mapstructure:"temp-thresh-max"`
+	DeltaThresh      *uint16 `mapstructure:"delta-thresh"`
+	CountThresh      *int    `mapstructure:"count-thresh"`
+	UseOneDiffOnly   *bool   `mapstructure:"use-one-diff-only"`
+	WarmerOnly       *bool   `mapstructure:"warmer-only"`
+	MinSecs          *int    `mapstructure:"min-secs"`
+	MaxSecs          *int    `mapstructure:"max-secs"`
+
+	// Window is when the profile is active, made from StartRecording
+	// and StopRecording.
+	Window window.Window `mapstructure:"-"`
+}
+
+// Apply overrides motionConf and recorderConf with the settings set in
+// the profile.
+func (p *Profile) Apply(motionConf *config.ThermalMotion, recorderConf *RecorderConfig) {
+	if p.DynamicThreshold != nil {
+		motionConf.DynamicThreshold = *p.DynamicThreshold
+	}
+	if p.TempThresh != nil {
+		motionConf.TempThresh = *p.TempThresh
+	}
+	if p.TempThreshMin != nil {
+		motionConf.TempThreshMin = *p.TempThreshMin
+	}
+	if p.TempThreshMax != nil {
+		motionConf.TempThreshMax = *p.TempThreshMax
+	}
+	if p.DeltaThresh != nil {
+		motionConf.DeltaThresh = *p.DeltaThresh
+	}
+	if p.CountThresh != nil {
+		motionConf.CountThresh = *p.CountThresh
+	}
+	if p.UseOneDiffOnly != nil {
+		motionConf.UseOneDiffOnly = *p.UseOneDiffOnly
+	}
+	if p.WarmerOnly != nil {
+		motionConf.WarmerOnly = *p.WarmerOnly
+	}
+	if p.MinSecs != nil {
+		recorderConf.MinSecs = *p.MinSecs
+	}
+	if p.MaxSecs != nil {
+		recorderConf.MaxSecs = *p.MaxSecs
+	}
+}
+
+// ActiveProfile returns the first profile which is active now, or nil
+// if none are.
+func (conf *RecorderConfig) ActiveProfile() *Profile {
+	for i := range conf.Profiles {
+		if conf.Profiles[i].Window.Active() {
+			return &conf.Profiles[i]
+		}
+	}
+	return nil
+}
+
+// newProfiles reads the profiles from conf, using the location for
+// times relative to sunrise and sunset.
+func newProfiles(conf *config.Config, location config.Location) ([]Profile, error) {
+	var profiles []Profile
+	if err := conf.Unmarshal(ProfilesKey, &profiles); err != nil {
+		return nil, err
+	}
+	for i := range profiles {
+		p := &profiles[i]
+		if p.StartRecording == "" || p.StopRecording == "" {
+			return nil, fmt.Errorf("profile %q needs start-recording and stop-recording", p.Name)
+		}
+		w, err := window.New(
+			p.StartRecording,
+			p.StopRecording,
+			float64(location.Latitude),
+			float64(location.Longitude))
+		if err != nil {
+			return nil, fmt.Errorf("profile %q: %v", p.Name, err)
+		}
+		p.Window = *w
+	}
+	return profiles, nil
+}
+
+func (conf *RecorderConfig) validateProfiles() error {
+	names := make(map[string]bool)
+	for i := range conf.Profiles {
+		p := &conf.Profiles[i]
+		if p.Name == "" {
+			return errors.New("profiles need a name")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("there is more than one profile named %q", p.Name)
+		}
+		names[p.Name] = true
+
+		profileConf := *conf
+		p.Apply(new(config.ThermalMotion), &profileConf)
+		if err := profileConf.validate(); err != nil {
+			return fmt.Errorf("profile %q: %v", p.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package recorder
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/window"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConfig(t *testing.T, toml string) (*RecorderConfig, error) {
+	dir, err := ioutil.TempDir("", "recorder")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, config.ConfigFileName), []byte(toml), 0644))
+	configRW, err := config.New(dir)
+	require.NoError(t, err)
+	return NewConfig(configRW)
+}
+
+func TestProfilesConfig(t *testing.T) {
+	conf, err := newTestConfig(t, `
+[thermal-recorder]
+min-secs = 10
+max-secs = 600
+
+[[thermal-recorder-profiles]]
+name = "dusk"
+start-recording = "-30m"
+stop-recording = "+2h"
+delta-thresh = 30
+min-secs = 20
+
+[[thermal-recorder-profiles]]
+name = "day"
+start-recording = "09:00"
+stop-recording = "17:00"
+snapshot-only = true
+`)
+	require.NoError(t, err)
+	require.Len(t, conf.Profiles, 2)
+
+	dusk := conf.Profiles[0]
+	assert.Equal(t, "dusk", dusk.Name)
+	assert.False(t, dusk.SnapshotOnly)
+	motionConf := config.DefaultThermalMotion("")
+	recorderConf := *conf
+	dusk.Apply(&motionConf, &recorderConf)
+	assert.Equal(t, uint16(30), motionConf.DeltaThresh)
+	assert.Equal(t, config.DefaultThermalMotion("").CountThresh, motionConf.CountThresh)
+	assert.Equal(t, 20, recorderConf.MinSecs)
+	assert.Equal(t, 600, recorderConf.MaxSecs)
+
+	day := conf.Profiles[1]
+	assert.Equal(t, "day", day.Name)
+	assert.True(t, day.SnapshotOnly)
+	assert.Nil(t, day.DeltaThresh)
+	assert.False(t, day.Window.NoWindow)
+}
+
+func TestNoProfiles(t *testing.T) {
+	conf, err := newTestConfig(t, "")
+	require.NoError(t, err)
+	assert.Empty(t, conf.Profiles)
+	assert.Nil(t, conf.ActiveProfile())
+}
+
+func TestInvalidProfiles(t *testing.T) {
+	_, err := newTestConfig(t, `
+[[thermal-recorder-profiles]]
+start-recording = "09:00"
+stop-recording = "17:00"
+`)
+	assert.EqualError(t, err, "profiles need a name")
+
+	_, err = newTestConfig(t, `
+[[thermal-recorder-profiles]]
+name = "day"
+start-recording = "09:00"
+`)
+	assert.EqualError(t, err, `profile "day" needs start-recording and stop-recording`)
+
+	_, err = newTestConfig(t, `
+[[thermal-recorder-profiles]]
+name = "day"
+start-recording = "09:00"
+stop-recording = "17:00"
+
+[[thermal-recorder-profiles]]
+name = "day"
+start-recording = "17:00"
+stop-recording = "18:00"
+`)
+	assert.EqualError(t, err, `there is more than one profile named "day"`)
+
+	_, err = newTestConfig(t, `
+[[thermal-recorder-profiles]]
+name = "day"
+start-recording = "09:00"
+stop-recording = "17:00"
+max-secs = 1
+`)
+	assert.EqualError(t, err, `profile "day": max-secs should be larger than min-secs`)
+}
+
+func profileWindow(t *testing.T, start, stop string, now *time.Time) window.Window {
+	w, err := window.New(start, stop, 0, 0)
+	require.NoError(t, err)
+	w.Now = func() time.Time { return *now }
+	return *w
+}
+
+func TestActiveProfile(t *testing.T) {
+	now := time.Date(2026, 10, 17, 10, 0, 0, 0, time.Local)
+	conf := RecorderConfig{
+		Profiles: []Profile{
+			{Name: "evening", Window: profileWindow(t, "17:00", "22:00", &now)},
+			{Name: "morning", Window: profileWindow(t, "06:00", "12:00", &now)},
+			{Name: "day", Window: profileWindow(t, "08:00", "17:00", &now)},
+		},
+	}
+	assert.Equal(t, "morning", conf.ActiveProfile().Name)
+
+	now = now.Add(4 * time.Hour)
+	assert.Equal(t, "day", conf.ActiveProfile().Name)
+
+	now = now.Add(10 * time.Hour)
+	assert.Nil(t, conf.ActiveProfile())
+}
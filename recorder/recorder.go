@@ -27,6 +27,36 @@ type Recorder interface {
 	CheckCanRecord() error
 }
 
+// FrameMetadata describes what motion detection found in a frame.
+type FrameMetadata struct {
+	// Frame is the index of the frame in the recording. It is set by
+	// the recorder.
+	Frame      int      `json:"frame"`
+	DeltaCount int      `json:"deltaCount"`
+	TempThresh uint16   `json:"tempThresh"`
+	Motion     bool     `json:"motion"`
+	Preview    bool     `json:"preview"`
+	Trigger    bool     `json:"trigger"`
+	Regions    []Region `json:"regions,omitempty"`
+}
+
+// Region is a tracked region of motion within a frame.
+type Region struct {
+	TrackID int `json:"trackId"`
+	X       int `json:"x"`
+	Y       int `json:"y"`
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+	Pixels  int `json:"pixels"`
+}
+
+// MetadataRecorder is implemented by recorders which can save motion
+// metadata with each frame.
+type MetadataRecorder interface {
+	Recorder
+	WriteFrameWithMetadata(frame *cptvframe.Frame, meta *FrameMetadata) error
+}
+
 type NoWriteRecorder struct {
 }
 
@@ -29,6 +29,9 @@ type RecorderConfig struct {
 	PreviewSecs      int
 	Window           window.Window
 	ConstantRecorder bool
+	// Profiles override settings for parts of the day. When more than
+	// one is active the first is used.
+	Profiles []Profile
 }
 
 func NewConfig(conf *config.Config) (*RecorderConfig, error) {
@@ -54,17 +57,26 @@ func NewConfig(conf *config.Config) (*RecorderConfig, error) {
 		return nil, err
 	}
 
+	profiles, err := newProfiles(conf, windowLocationConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	recorderConfig := RecorderConfig{
 		MinSecs:          thermalRecorderConfig.MinSecs,
 		MaxSecs:          thermalRecorderConfig.MaxSecs,
 		PreviewSecs:      thermalRecorderConfig.PreviewSecs,
 		Window:           *w,
 		ConstantRecorder: thermalRecorderConfig.ConstantRecorder,
+		Profiles:         profiles,
 	}
 
 	if err := recorderConfig.validate(); err != nil {
 		return nil, err
 	}
+	if err := recorderConfig.validateProfiles(); err != nil {
+		return nil, err
+	}
 	return &recorderConfig, nil
 }
 
@@ -0,0 +1,134 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package replay
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	cptv "github.com/TheCacophonyProject/go-cptv"
+)
+
+// These match the values written by thermal-writer.
+const (
+	cptrVersion byte = 0x02
+
+	cptrHeaderSection = 'H'
+	cptrFrameSection  = 'F'
+)
+
+func newCPTRSource(f *os.File, r *bufio.Reader) (*cptrSource, error) {
+	pre := make([]byte, len(cptrMagic)+2)
+	if _, err := io.ReadFull(r, pre); err != nil {
+		return nil, err
+	}
+	if version := pre[len(cptrMagic)]; version != cptrVersion {
+		return nil, fmt.Errorf("unsupported CPTR version %d", version)
+	}
+	if section := pre[len(cptrMagic)+1]; section != cptrHeaderSection {
+		return nil, fmt.Errorf("unexpected section %q", section)
+	}
+	header, err := cptv.ReadFields(r)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &cptrSource{
+		f:      f,
+		r:      r,
+		header: header,
+	}
+
+	// The frame size is only recorded against each frame so read the
+	// first one now.
+	s.pending, err = s.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// cptrSource reads frames from a raw thermal (CPTR) file as written
+// by thermal-writer. These files already hold raw camera frames.
+type cptrSource struct {
+	f       *os.File
+	r       *bufio.Reader
+	header  cptv.Fields
+	pending []byte
+}
+
+func (s *cptrSource) ResX() int        { return s.header.ResX() }
+func (s *cptrSource) ResY() int        { return s.header.ResY() }
+func (s *cptrSource) FPS() int         { return s.header.FPS() }
+func (s *cptrSource) Serial() int      { return 0 }
+func (s *cptrSource) Firmware() string { return "" }
+func (s *cptrSource) FrameSize() int   { return len(s.pending) }
+func (s *cptrSource) Close() error     { return s.f.Close() }
+
+func (s *cptrSource) Brand() string {
+	brand, _ := s.header.String(cptv.Brand)
+	return brand
+}
+
+func (s *cptrSource) Model() string {
+	model, _ := s.header.String(cptv.Model)
+	return model
+}
+
+func (s *cptrSource) NextFrame(raw []byte) error {
+	if s.pending == nil {
+		frame, err := s.readFrame()
+		if err != nil {
+			return err
+		}
+		s.pending = frame
+	}
+	if len(raw) != len(s.pending) {
+		return fmt.Errorf("raw frame is %d bytes, expected %d", len(raw), len(s.pending))
+	}
+	copy(raw, s.pending)
+	s.pending = nil
+	return nil
+}
+
+func (s *cptrSource) readFrame() ([]byte, error) {
+	section, err := s.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if section != cptrFrameSection {
+		return nil, fmt.Errorf("unexpected section %q", section)
+	}
+	fields, err := cptv.ReadFields(s.r)
+	if err != nil {
+		return nil, err
+	}
+	size, err := fields.Uint32(cptv.FrameSize)
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(s.r, frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return frame, nil
+}
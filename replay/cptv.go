@@ -0,0 +1,93 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package replay
+
+import (
+	"io"
+	"os"
+	"time"
+
+	cptv "github.com/TheCacophonyProject/go-cptv"
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+)
+
+// Older CPTV files don't include the time the camera has been on for
+// each frame. This is the time used for the first frame of such files
+// so that frames don't look like they have just had an FFC.
+const fakeTimeOnStart = time.Minute
+
+func newCPTVSource(f *os.File, r io.Reader) (*cptvSource, error) {
+	reader, err := cptv.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	frameSize, err := RawFrameSize(reader.BrandName(), reader.ModelName(), reader)
+	if err != nil {
+		return nil, err
+	}
+	return &cptvSource{
+		f:         f,
+		reader:    reader,
+		frame:     reader.EmptyFrame(),
+		frameSize: frameSize,
+		timeOn:    fakeTimeOnStart,
+	}, nil
+}
+
+// cptvSource reads frames from a CPTV recording and encodes them as
+// raw camera frames.
+type cptvSource struct {
+	f          *os.File
+	reader     *cptv.Reader
+	frame      *cptvframe.Frame
+	frameSize  int
+	frameCount int
+	timeOn     time.Duration
+}
+
+func (s *cptvSource) ResX() int        { return s.reader.ResX() }
+func (s *cptvSource) ResY() int        { return s.reader.ResY() }
+func (s *cptvSource) FPS() int         { return s.reader.FPS() }
+func (s *cptvSource) Brand() string    { return s.reader.BrandName() }
+func (s *cptvSource) Model() string    { return s.reader.ModelName() }
+func (s *cptvSource) Serial() int      { return s.reader.SerialNumber() }
+func (s *cptvSource) FrameSize() int   { return s.frameSize }
+func (s *cptvSource) Close() error     { return s.f.Close() }
+func (s *cptvSource) Firmware() string { return s.reader.FirmwareVersion() }
+
+func (s *cptvSource) NextFrame(raw []byte) error {
+	for {
+		s.frame.Status = cptvframe.Telemetry{}
+		if err := s.reader.ReadFrame(s.frame); err != nil {
+			return err
+		}
+		// The background frame isn't something the camera produced.
+		if !s.frame.Status.BackgroundFrame {
+			break
+		}
+	}
+
+	s.frameCount++
+	s.timeOn += time.Second / time.Duration(s.FPS())
+	if s.frame.Status.TimeOn == 0 {
+		s.frame.Status.TimeOn = s.timeOn
+	}
+	if s.frame.Status.FrameCount == 0 {
+		s.frame.Status.FrameCount = s.frameCount
+	}
+	return EncodeFrame(s.Brand(), s.Model(), s.frame, raw)
+}
@@ -0,0 +1,193 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package replay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/lepton3"
+
+	"github.com/TheCacophonyProject/thermal-recorder/boson"
+)
+
+const (
+	leptonTelemetryBytes = 160 * 4
+	bosonModel           = "boson"
+)
+
+// leptonTelemetry mirrors the layout of the Lepton 3 telemetry rows
+// which lepton3.ParseTelemetry reads.
+type leptonTelemetry struct {
+	TelemetryRevision  uint16
+	TimeOn             uint32
+	StatusBits         uint32
+	Reserved5          [8]uint16
+	SoftwareRevision   [8]uint8
+	Reserved17         [3]uint16
+	FrameCounter       uint32
+	FrameMean          uint16
+	FPATempCounts      uint16
+	FPATemp            uint16
+	HousingTempRaw     uint16
+	HousingTemp        uint16
+	Reserved25         [2]uint16
+	FPATempLastFFC     uint16
+	TimeCounterLastFFC uint32
+	HousingTempLastFFC uint16
+}
+
+// RawFrameSize returns the number of bytes a camera of the brand and
+// model given uses for each raw frame.
+func RawFrameSize(brand, model string, camera cptvframe.CameraSpec) (int, error) {
+	if brand != lepton3.Brand {
+		return 0, fmt.Errorf("unsupported camera brand %q", brand)
+	}
+	switch model {
+	case lepton3.Model, lepton3.Model35:
+		return lepton3.BytesPerFrame, nil
+	case bosonModel:
+		return camera.ResX() * camera.ResY() * 2, nil
+	}
+	return 0, fmt.Errorf("unsupported camera model %q", model)
+}
+
+// EncodeFrame writes frame into raw using the raw frame format of the
+// camera brand and model given. It is the inverse of the frame
+// parsers used by thermal-recorder.
+func EncodeFrame(brand, model string, frame *cptvframe.Frame, raw []byte) error {
+	if brand != lepton3.Brand {
+		return fmt.Errorf("unsupported camera brand %q", brand)
+	}
+	switch model {
+	case lepton3.Model, lepton3.Model35:
+		return encodeLeptonFrame(frame, raw)
+	case bosonModel:
+		return encodeBosonFrame(frame, raw)
+	}
+	return fmt.Errorf("unsupported camera model %q", model)
+}
+
+// DecodeFrame reads raw, in the raw frame format of the camera brand
+// and model given, into frame. It is the inverse of EncodeFrame.
+func DecodeFrame(brand, model string, raw []byte, frame *cptvframe.Frame) error {
+	if brand != lepton3.Brand {
+		return fmt.Errorf("unsupported camera brand %q", brand)
+	}
+	switch model {
+	case lepton3.Model, lepton3.Model35:
+		return lepton3.ParseRawFrame(raw, frame, 0)
+	case bosonModel:
+		return decodeBosonFrame(raw, frame)
+	}
+	return fmt.Errorf("unsupported camera model %q", model)
+}
+
+func encodeLeptonFrame(frame *cptvframe.Frame, raw []byte) error {
+	if len(raw) != lepton3.BytesPerFrame {
+		return fmt.Errorf("raw frame is %d bytes, expected %d", len(raw), lepton3.BytesPerFrame)
+	}
+	t := leptonTelemetry{
+		TimeOn:             durationToMillis(frame.Status.TimeOn),
+		StatusBits:         ffcStateToStatus(frame.Status.FFCState),
+		FrameCounter:       uint32(frame.Status.FrameCount),
+		FrameMean:          frame.Status.FrameMean,
+		FPATemp:            celsiusToCentiK(frame.Status.TempC),
+		FPATempLastFFC:     celsiusToCentiK(frame.Status.LastFFCTempC),
+		TimeCounterLastFFC: durationToMillis(frame.Status.LastFFCTime),
+	}
+	buf := bytes.NewBuffer(raw[:0])
+	if err := binary.Write(buf, lepton3.Big16, &t); err != nil {
+		return err
+	}
+	for i := buf.Len(); i < leptonTelemetryBytes; i++ {
+		raw[i] = 0
+	}
+
+	i := leptonTelemetryBytes
+	for _, row := range frame.Pix {
+		for _, v := range row {
+			binary.BigEndian.PutUint16(raw[i:i+2], v)
+			i += 2
+		}
+	}
+	return nil
+}
+
+func encodeBosonFrame(frame *cptvframe.Frame, raw []byte) error {
+	i := 0
+	for _, row := range frame.Pix {
+		for _, v := range row {
+			if i+2 > len(raw) {
+				return fmt.Errorf("raw frame too small (%d bytes)", len(raw))
+			}
+			binary.LittleEndian.PutUint16(raw[i:i+2], v)
+			i += 2
+		}
+	}
+	return nil
+}
+
+// decodeBosonFrame reads little endian pixels followed by the
+// telemetry leptond adds, if it is there.
+func decodeBosonFrame(raw []byte, frame *cptvframe.Frame) error {
+	pixelBytes := len(frame.Pix) * len(frame.Pix[0]) * 2
+	if len(raw) < pixelBytes {
+		return fmt.Errorf("raw frame too small (%d bytes)", len(raw))
+	}
+	frame.Status = cptvframe.Telemetry{}
+	if len(raw) >= pixelBytes+boson.TelemetrySize {
+		if err := boson.ParseTelemetry(raw[pixelBytes:], &frame.Status); err != nil {
+			return err
+		}
+	}
+	i := 0
+	for _, row := range frame.Pix {
+		for x := range row {
+			row[x] = binary.LittleEndian.Uint16(raw[i : i+2])
+			i += 2
+		}
+	}
+	return nil
+}
+
+func durationToMillis(d time.Duration) uint32 {
+	return uint32(d / time.Millisecond)
+}
+
+func celsiusToCentiK(c float64) uint16 {
+	if c == 0 {
+		return 0
+	}
+	return uint16(c*100 + 27315)
+}
+
+func ffcStateToStatus(state string) uint32 {
+	var bits uint32
+	switch state {
+	case lepton3.FFCImminent:
+		bits = 1
+	case lepton3.FFCRunning:
+		bits = 2
+	case lepton3.FFCComplete:
+		bits = 3
+	}
+	return bits << 4
+}
@@ -0,0 +1,95 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package replay reads CPTV recordings and CPTR raw thermal files and
+// produces frames in the same raw format that a camera service sends
+// over the frame socket.
+package replay
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+)
+
+const (
+	cptrMagic = "CPTR"
+	gzipMagic = "\x1f\x8b"
+)
+
+// Source provides raw camera frames read from a file. Frames are
+// returned exactly as a camera service would write them to the frame
+// socket.
+type Source interface {
+	cptvframe.CameraSpec
+
+	// Brand returns the camera brand.
+	Brand() string
+
+	// Model returns the camera model.
+	Model() string
+
+	// Serial returns the camera serial number, or 0 if unknown.
+	Serial() int
+
+	// Firmware returns the camera firmware version, or an empty
+	// string if unknown.
+	Firmware() string
+
+	// FrameSize returns the number of bytes in each raw frame.
+	FrameSize() int
+
+	// NextFrame reads the next raw frame into raw, which must be
+	// FrameSize() bytes long. io.EOF is returned once all frames
+	// have been read.
+	NextFrame(raw []byte) error
+
+	// Close releases the underlying file.
+	Close() error
+}
+
+// Open returns a Source for the CPTV or CPTR file given. The file
+// type is detected from its content rather than the file extension.
+func Open(filename string) (Source, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(f)
+	magic, err := r.Peek(len(cptrMagic))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read %s: %v", filename, err)
+	}
+
+	var src Source
+	switch {
+	case string(magic) == cptrMagic:
+		src, err = newCPTRSource(f, r)
+	case string(magic[:len(gzipMagic)]) == gzipMagic:
+		src, err = newCPTVSource(f, r)
+	default:
+		err = errors.New("not a CPTV or CPTR file")
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to open %s: %v", filename, err)
+	}
+	return src, nil
+}
@@ -0,0 +1,205 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package replay
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cptv "github.com/TheCacophonyProject/go-cptv"
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/TheCacophonyProject/lepton3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCPTV = "../cmd/thermal-recorder/motiontest/animals/rat.cptv"
+
+func TestLeptonFrameRoundTrip(t *testing.T) {
+	camera := new(lepton3.Lepton3)
+	frame := cptvframe.NewFrame(camera)
+	for y, row := range frame.Pix {
+		for x := range row {
+			frame.Pix[y][x] = uint16(3000 + x + y)
+		}
+	}
+	frame.Status.TimeOn = 2 * time.Minute
+	frame.Status.LastFFCTime = 90 * time.Second
+	frame.Status.FrameCount = 1234
+	frame.Status.FFCState = lepton3.FFCComplete
+	frame.Status.TempC = 25.5
+	frame.Status.LastFFCTempC = 24.25
+
+	raw := lepton3.NewRawFrame()
+	require.NoError(t, EncodeFrame(lepton3.Brand, lepton3.Model, frame, raw))
+
+	parsed := cptvframe.NewFrame(camera)
+	require.NoError(t, lepton3.ParseRawFrame(raw, parsed, 0))
+	assert.Equal(t, frame.Pix, parsed.Pix)
+	assert.Equal(t, frame.Status.TimeOn, parsed.Status.TimeOn)
+	assert.Equal(t, frame.Status.LastFFCTime, parsed.Status.LastFFCTime)
+	assert.Equal(t, frame.Status.FrameCount, parsed.Status.FrameCount)
+	assert.Equal(t, frame.Status.FFCState, parsed.Status.FFCState)
+	assert.InDelta(t, frame.Status.TempC, parsed.Status.TempC, 0.01)
+	assert.InDelta(t, frame.Status.LastFFCTempC, parsed.Status.LastFFCTempC, 0.01)
+}
+
+type bosonCamera struct{}
+
+func (bosonCamera) ResX() int { return 8 }
+func (bosonCamera) ResY() int { return 4 }
+func (bosonCamera) FPS() int  { return 60 }
+
+func TestBosonFrameRoundTrip(t *testing.T) {
+	frame := cptvframe.NewFrame(bosonCamera{})
+	for y, row := range frame.Pix {
+		for x := range row {
+			frame.Pix[y][x] = uint16(20000 + x*y)
+		}
+	}
+	size, err := RawFrameSize(lepton3.Brand, "boson", bosonCamera{})
+	require.NoError(t, err)
+	raw := make([]byte, size)
+	require.NoError(t, EncodeFrame(lepton3.Brand, "boson", frame, raw))
+
+	parsed := cptvframe.NewFrame(bosonCamera{})
+	require.NoError(t, DecodeFrame(lepton3.Brand, "boson", raw, parsed))
+	assert.Equal(t, frame.Pix, parsed.Pix)
+}
+
+func TestUnsupportedModel(t *testing.T) {
+	_, err := RawFrameSize(lepton3.Brand, "lepton9", new(lepton3.Lepton3))
+	assert.Error(t, err)
+}
+
+func TestCPTVSource(t *testing.T) {
+	src, err := Open(testCPTV)
+	require.NoError(t, err)
+	defer src.Close()
+
+	assert.Equal(t, lepton3.Brand, src.Brand())
+	assert.Equal(t, lepton3.Model, src.Model())
+	assert.Equal(t, 160, src.ResX())
+	assert.Equal(t, 120, src.ResY())
+	assert.Equal(t, lepton3.BytesPerFrame, src.FrameSize())
+
+	expected := readAllFrames(t, testCPTV)
+
+	raw := make([]byte, src.FrameSize())
+	frame := cptvframe.NewFrame(src)
+	count := 0
+	var prevTimeOn time.Duration
+	for {
+		err := src.NextFrame(raw)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.NoError(t, lepton3.ParseRawFrame(raw, frame, 0))
+		assert.Equal(t, expected[count].Pix, frame.Pix)
+		// TimeOn is missing from this file so should be faked.
+		assert.True(t, frame.Status.TimeOn > prevTimeOn)
+		prevTimeOn = frame.Status.TimeOn
+		count++
+	}
+	assert.Equal(t, len(expected), count)
+}
+
+func TestCPTRSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "test.cptr")
+	frames := [][]byte{{1, 2, 3, 4}, {5, 6, 7, 8}}
+	writeCPTR(t, filename, frames)
+
+	src, err := Open(filename)
+	require.NoError(t, err)
+	defer src.Close()
+
+	assert.Equal(t, "flir", src.Brand())
+	assert.Equal(t, "boson", src.Model())
+	assert.Equal(t, 2, src.ResX())
+	assert.Equal(t, 1, src.ResY())
+	assert.Equal(t, 30, src.FPS())
+	assert.Equal(t, 4, src.FrameSize())
+
+	raw := make([]byte, src.FrameSize())
+	for _, expected := range frames {
+		require.NoError(t, src.NextFrame(raw))
+		assert.Equal(t, expected, raw)
+	}
+	assert.Equal(t, io.EOF, src.NextFrame(raw))
+}
+
+func TestOpenRejectsOtherFiles(t *testing.T) {
+	f, err := ioutil.TempFile("", "replay")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("not a recording")
+	f.Close()
+
+	_, err = Open(f.Name())
+	assert.Error(t, err)
+}
+
+func readAllFrames(t *testing.T, filename string) []*cptvframe.Frame {
+	f, err := os.Open(filename)
+	require.NoError(t, err)
+	defer f.Close()
+	reader, err := cptv.NewReader(f)
+	require.NoError(t, err)
+
+	var frames []*cptvframe.Frame
+	for {
+		frame := reader.EmptyFrame()
+		if err := reader.ReadFrame(frame); err != nil {
+			return frames
+		}
+		if !frame.Status.BackgroundFrame {
+			frames = append(frames, frame)
+		}
+	}
+}
+
+func writeCPTR(t *testing.T, filename string, frames [][]byte) {
+	f, err := os.Create(filename)
+	require.NoError(t, err)
+	defer f.Close()
+
+	header := cptv.NewFieldWriter()
+	header.String(cptv.Brand, "flir")
+	header.String(cptv.Model, "boson")
+	header.Uint8(cptv.FPS, 30)
+	header.Uint32(cptv.XResolution, 2)
+	header.Uint32(cptv.YResolution, 1)
+	data, n := header.Bytes()
+	f.Write(append([]byte{'C', 'P', 'T', 'R', cptrVersion, cptrHeaderSection, byte(n)}, data...))
+
+	for _, frame := range frames {
+		fields := cptv.NewFieldWriter()
+		fields.Uint32(cptv.FrameSize, uint32(len(frame)))
+		data, n := fields.Bytes()
+		f.Write(append([]byte{cptrFrameSection, byte(n)}, data...))
+		f.Write(frame)
+	}
+}
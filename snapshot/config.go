@@ -0,0 +1,87 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	config "github.com/TheCacophonyProject/go-config"
+)
+
+// Config sets when snapshot recordings are made and how long they
+// are.
+//
+// Frames is the length of each snapshot recording. PowerOn makes a
+// snapshot a minute after starting, if the recording window is
+// active. WindowStart makes one a minute after the recording window
+// starts and WindowEnd one two minutes before it ends. Interval makes
+// one every interval while the recording window is active, counted
+// from the start of the window, or from starting when there is no
+// window. Times are extra times to make snapshots at, each either a
+// time of day ("21:30"), a time relative to sunrise or sunset
+// ("sunset+30m") or a cron expression ("0 */2 * * *").
+type Config struct {
+	Frames      int           `mapstructure:"frames"`
+	PowerOn     bool          `mapstructure:"power-on"`
+	WindowStart bool          `mapstructure:"window-start"`
+	WindowEnd   bool          `mapstructure:"window-end"`
+	Interval    time.Duration `mapstructure:"interval"`
+	Times       []string      `mapstructure:"times"`
+}
+
+// DefaultConfig returns the snapshot config used when none is set.
+func DefaultConfig() Config {
+	return Config{
+		Frames:      20,
+		PowerOn:     true,
+		WindowStart: true,
+		WindowEnd:   true,
+		Interval:    12 * time.Hour,
+	}
+}
+
+// NewConfig reads the snapshot config from the config section key.
+func NewConfig(configRW *config.Config, key string) (*Config, error) {
+	conf := DefaultConfig()
+	if err := configRW.Unmarshal(key, &conf); err != nil {
+		return nil, err
+	}
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+
+func (conf *Config) validate() error {
+	if conf.Frames < 1 {
+		return errors.New("snapshot frames must be at least 1")
+	}
+	if conf.Interval < 0 {
+		return errors.New("snapshot interval can't be negative")
+	}
+	if conf.Interval > 0 && conf.Interval < time.Minute {
+		return fmt.Errorf("snapshot interval is %v, must be at least a minute", conf.Interval)
+	}
+	for _, spec := range conf.Times {
+		if _, err := parseTime(spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package snapshot schedules snapshot recordings, short recordings
+// made whether or not there is motion to show what the camera sees.
+package snapshot
+
+import (
+	"time"
+
+	config "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/window"
+)
+
+// Reasons for snapshots, other than the entries from Config.Times
+// which are their own reason.
+const (
+	ReasonPowerOn     = "power-on"
+	ReasonWindowStart = "window-start"
+	ReasonWindowEnd   = "window-end"
+	ReasonInterval    = "interval"
+)
+
+const (
+	// powerOnDelay gives the camera time to warm up before the power
+	// on snapshot.
+	powerOnDelay     = time.Minute
+	windowStartDelay = time.Minute
+	windowEndLead    = 2 * time.Minute
+)
+
+// Trigger is a time a snapshot will be made.
+type Trigger struct {
+	Time   time.Time
+	Reason string
+}
+
+// Schedule works out when snapshots are made.
+type Schedule struct {
+	conf      Config
+	window    window.Window
+	latitude  float64
+	longitude float64
+	started   time.Time
+	times     []timeSpec
+}
+
+// New returns the schedule for conf with the recording window w.
+// location is used for times relative to sunrise and sunset, and
+// started is when thermal-recorder started, for the power on snapshot.
+func New(conf *Config, w window.Window, location config.Location, started time.Time) (*Schedule, error) {
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+	// Use the same default location as the recording window.
+	if location.Latitude == 0 || location.Longitude == 0 {
+		location = config.DefaultWindowLocation()
+	}
+	s := &Schedule{
+		conf:      *conf,
+		window:    w,
+		latitude:  float64(location.Latitude),
+		longitude: float64(location.Longitude),
+		started:   started,
+	}
+	for _, spec := range conf.Times {
+		t, err := parseTime(spec)
+		if err != nil {
+			return nil, err
+		}
+		s.times = append(s.times, t)
+	}
+	return s, nil
+}
+
+// Frames returns the length of each snapshot recording.
+func (s *Schedule) Frames() int {
+	return s.conf.Frames
+}
+
+// windowAt returns the recording window as seen at t.
+func (s *Schedule) windowAt(t time.Time) *window.Window {
+	w := s.window
+	w.Now = func() time.Time { return t }
+	return &w
+}
+
+// Next returns the first snapshot after after, or false if there are
+// none.
+func (s *Schedule) Next(after time.Time) (Trigger, bool) {
+	var next Trigger
+	found := false
+	add := func(t time.Time, reason string) {
+		if t.After(after) && (!found || t.Before(next.Time)) {
+			next = Trigger{Time: t, Reason: reason}
+			found = true
+		}
+	}
+
+	if s.conf.PowerOn {
+		t := s.started.Add(powerOnDelay)
+		if s.windowAt(t).Active() {
+			add(t, ReasonPowerOn)
+		}
+	}
+	if !s.window.NoWindow {
+		if s.conf.WindowStart {
+			add(s.windowAt(after.Add(-windowStartDelay)).NextStart().Add(windowStartDelay), ReasonWindowStart)
+		}
+		if s.conf.WindowEnd {
+			add(s.windowAt(after.Add(windowEndLead)).NextEnd().Add(-windowEndLead), ReasonWindowEnd)
+		}
+	}
+	if s.conf.Interval > 0 {
+		if t, ok := s.nextInterval(after); ok {
+			add(t, ReasonInterval)
+		}
+	}
+	for i, spec := range s.times {
+		if t, ok := spec.next(after, s.latitude, s.longitude); ok {
+			add(t, s.conf.Times[i])
+		}
+	}
+	return next, found
+}
+
+// nextInterval returns the first interval snapshot after after.
+func (s *Schedule) nextInterval(after time.Time) (time.Time, bool) {
+	interval := s.conf.Interval
+	// intervalAfter returns the first time after after which is a
+	// whole number of intervals after start.
+	intervalAfter := func(start time.Time) time.Time {
+		if after.Before(start) {
+			return start.Add(interval)
+		}
+		return start.Add((after.Sub(start)/interval + 1) * interval)
+	}
+
+	if s.window.NoWindow {
+		return intervalAfter(s.started.Add(powerOnDelay)), true
+	}
+	w := s.windowAt(after)
+	if w.Active() {
+		if t := intervalAfter(w.PreviousStart()); t.Before(w.NextEnd()) {
+			return t, true
+		}
+	}
+	// The first interval in the next window, if it's long enough.
+	start := w.NextStart()
+	if t := start.Add(interval); t.Before(s.windowAt(start).NextEnd()) {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// Upcoming returns the next n snapshots after after.
+func (s *Schedule) Upcoming(after time.Time, n int) []Trigger {
+	var triggers []Trigger
+	for len(triggers) < n {
+		trigger, ok := s.Next(after)
+		if !ok {
+			break
+		}
+		triggers = append(triggers, trigger)
+		after = trigger.Time
+	}
+	return triggers
+}
@@ -0,0 +1,181 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "github.com/TheCacophonyProject/go-config"
+	"github.com/TheCacophonyProject/window"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func at(day, hour, minute int) time.Time {
+	return time.Date(2026, 10, day, hour, minute, 0, 0, time.Local)
+}
+
+func newWindow(t *testing.T, start, end string) window.Window {
+	w, err := window.New(start, end, 0, 0)
+	require.NoError(t, err)
+	return *w
+}
+
+func newSchedule(t *testing.T, conf Config, w window.Window, started time.Time) *Schedule {
+	s, err := New(&conf, w, config.Location{}, started)
+	require.NoError(t, err)
+	return s
+}
+
+func TestNewConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, config.ConfigFileName)
+	toml := "[test-snapshots]\nframes = 45\ninterval = \"2h\"\ntimes = [\"12:00\", \"sunset-10m\", \"*/15 9-17 * * 1-5\"]\n"
+	require.NoError(t, ioutil.WriteFile(configFile, []byte(toml), 0644))
+	configRW, err := config.New(dir)
+	require.NoError(t, err)
+
+	conf, err := NewConfig(configRW, "test-snapshots")
+	require.NoError(t, err)
+	want := DefaultConfig()
+	want.Frames = 45
+	want.Interval = 2 * time.Hour
+	want.Times = []string{"12:00", "sunset-10m", "*/15 9-17 * * 1-5"}
+	assert.Equal(t, want, *conf)
+}
+
+func TestValidate(t *testing.T) {
+	conf := DefaultConfig()
+	conf.Frames = 0
+	assert.EqualError(t, conf.validate(), "snapshot frames must be at least 1")
+
+	conf = DefaultConfig()
+	conf.Interval = time.Second
+	assert.EqualError(t, conf.validate(), "snapshot interval is 1s, must be at least a minute")
+
+	for _, spec := range []string{"noon", "sunset30m", "sunrise+half", "60 * * * *", "* * * *", "*/0 * * * *", "5-1 * * * *"} {
+		conf = DefaultConfig()
+		conf.Times = []string{spec}
+		assert.Error(t, conf.validate(), spec)
+	}
+}
+
+func nextTime(t *testing.T, spec string, after time.Time) time.Time {
+	ts, err := parseTime(spec)
+	require.NoError(t, err)
+	next, ok := ts.next(after, -43.5, 172.6)
+	require.True(t, ok)
+	return next
+}
+
+func TestCronTimes(t *testing.T) {
+	// 17 October 2026 is a Saturday.
+	now := at(17, 10, 7)
+	assert.Equal(t, at(17, 21, 30), nextTime(t, "21:30", now))
+	assert.Equal(t, at(18, 9, 0), nextTime(t, "09:00", now))
+	assert.Equal(t, at(17, 10, 15), nextTime(t, "*/15 * * * *", now))
+	assert.Equal(t, at(17, 12, 0), nextTime(t, "0 12,18 * * *", now))
+	assert.Equal(t, at(19, 9, 0), nextTime(t, "0 9-17 * * 1-5", now))
+	assert.Equal(t, at(18, 0, 0), nextTime(t, "0 0 * * 7", now))
+	assert.Equal(t, time.Date(2027, 1, 1, 0, 0, 0, 0, time.Local), nextTime(t, "0 0 1 1 *", now))
+	// With both days restricted either can match.
+	assert.Equal(t, at(18, 6, 0), nextTime(t, "0 6 20 * 0", now))
+	// Times on the minute come after it.
+	assert.Equal(t, at(18, 21, 30), nextTime(t, "21:30", at(17, 21, 30)))
+}
+
+func TestSunTimes(t *testing.T) {
+	// Midday in Christchurch, where the times are worked out for.
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.FixedZone("NZDT", 13*60*60))
+	sunset := nextTime(t, "sunset", now)
+	assert.True(t, sunset.After(now))
+	assert.True(t, sunset.Before(now.Add(12*time.Hour)))
+	assert.Equal(t, sunset.Add(-30*time.Minute), nextTime(t, "sunset-30m", now))
+	assert.Equal(t, sunset.Add(time.Hour), nextTime(t, "sunset+1h", now))
+
+	sunrise := nextTime(t, "sunrise", now)
+	assert.True(t, sunrise.After(sunset))
+	assert.True(t, sunrise.Before(now.Add(24*time.Hour)))
+	// Tomorrow's sunset once today's has gone.
+	assert.WithinDuration(t, sunset.Add(24*time.Hour), nextTime(t, "sunset", sunset), 5*time.Minute)
+}
+
+func TestWindowSnapshots(t *testing.T) {
+	conf := DefaultConfig()
+	conf.Interval = 0
+	s := newSchedule(t, conf, newWindow(t, "20:00", "06:00"), at(17, 12, 0))
+	assert.Equal(t, []Trigger{
+		{Time: at(17, 20, 1), Reason: ReasonWindowStart},
+		{Time: at(18, 5, 58), Reason: ReasonWindowEnd},
+		{Time: at(18, 20, 1), Reason: ReasonWindowStart},
+		{Time: at(19, 5, 58), Reason: ReasonWindowEnd},
+		{Time: at(19, 20, 1), Reason: ReasonWindowStart},
+	}, s.Upcoming(at(17, 12, 0), 5))
+
+	// Starting in the window makes a power on snapshot.
+	s = newSchedule(t, conf, newWindow(t, "20:00", "06:00"), at(17, 22, 0))
+	assert.Equal(t, []Trigger{
+		{Time: at(17, 22, 1), Reason: ReasonPowerOn},
+		{Time: at(18, 5, 58), Reason: ReasonWindowEnd},
+		{Time: at(18, 20, 1), Reason: ReasonWindowStart},
+	}, s.Upcoming(at(17, 22, 0), 3))
+}
+
+func TestIntervalSnapshots(t *testing.T) {
+	conf := DefaultConfig()
+	conf.Interval = 3 * time.Hour
+	conf.WindowEnd = false
+	s := newSchedule(t, conf, newWindow(t, "20:00", "06:00"), at(17, 12, 0))
+	assert.Equal(t, []Trigger{
+		{Time: at(17, 20, 1), Reason: ReasonWindowStart},
+		{Time: at(17, 23, 0), Reason: ReasonInterval},
+		{Time: at(18, 2, 0), Reason: ReasonInterval},
+		{Time: at(18, 5, 0), Reason: ReasonInterval},
+		{Time: at(18, 20, 1), Reason: ReasonWindowStart},
+		{Time: at(18, 23, 0), Reason: ReasonInterval},
+	}, s.Upcoming(at(17, 12, 0), 6))
+
+	// Without a window snapshots are made every interval from starting.
+	conf = DefaultConfig()
+	s = newSchedule(t, conf, newWindow(t, "12:00", "12:00"), at(17, 12, 0))
+	assert.Equal(t, []Trigger{
+		{Time: at(17, 12, 1), Reason: ReasonPowerOn},
+		{Time: at(18, 0, 1), Reason: ReasonInterval},
+		{Time: at(18, 12, 1), Reason: ReasonInterval},
+	}, s.Upcoming(at(17, 12, 0), 3))
+}
+
+func TestTimesAndNoSnapshots(t *testing.T) {
+	conf := Config{Frames: 20, Times: []string{"12:00", "0 */6 * * *"}}
+	s := newSchedule(t, conf, newWindow(t, "20:00", "06:00"), at(17, 10, 0))
+	assert.Equal(t, []Trigger{
+		{Time: at(17, 12, 0), Reason: "12:00"},
+		{Time: at(17, 18, 0), Reason: "0 */6 * * *"},
+		{Time: at(18, 0, 0), Reason: "0 */6 * * *"},
+	}, s.Upcoming(at(17, 10, 0), 3))
+
+	s = newSchedule(t, Config{Frames: 20}, newWindow(t, "20:00", "06:00"), at(17, 10, 0))
+	_, ok := s.Next(at(17, 10, 0))
+	assert.False(t, ok)
+	assert.Empty(t, s.Upcoming(at(17, 10, 0), 3))
+}
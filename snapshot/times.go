@@ -0,0 +1,232 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	sunrise "github.com/nathan-osman/go-sunrise"
+)
+
+// timeSpec is a recurring time from Config.Times.
+type timeSpec interface {
+	// next returns the first time after after, or false if there
+	// isn't one. lat and long are used for times relative to sunrise
+	// and sunset.
+	next(after time.Time, lat, long float64) (time.Time, bool)
+}
+
+// parseTime parses an entry from Config.Times.
+func parseTime(spec string) (timeSpec, error) {
+	s := strings.TrimSpace(spec)
+	if strings.HasPrefix(s, "sunrise") || strings.HasPrefix(s, "sunset") {
+		return parseSunTime(spec, s)
+	}
+	if t, err := time.Parse("15:04", s); err == nil {
+		return &cronTime{
+			minute:  bit(t.Minute()),
+			hour:    bit(t.Hour()),
+			dom:     allBits(1, 31),
+			month:   allBits(1, 12),
+			dow:     allBits(0, 6),
+			domStar: true,
+			dowStar: true,
+		}, nil
+	}
+	if len(strings.Fields(s)) == 5 {
+		return parseCron(spec, s)
+	}
+	return nil, fmt.Errorf("snapshot time %q isn't a time of day, relative to sunrise or sunset or a cron expression", spec)
+}
+
+// sunTime is a time relative to sunrise or sunset.
+type sunTime struct {
+	sunset bool
+	offset time.Duration
+}
+
+func parseSunTime(spec, s string) (*sunTime, error) {
+	st := &sunTime{sunset: strings.HasPrefix(s, "sunset")}
+	rest := strings.TrimPrefix(strings.TrimPrefix(s, "sunrise"), "sunset")
+	if rest == "" {
+		return st, nil
+	}
+	if rest[0] != '+' && rest[0] != '-' {
+		return nil, fmt.Errorf("snapshot time %q needs + or - before the offset", spec)
+	}
+	offset, err := time.ParseDuration(rest)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot time %q: %v", spec, err)
+	}
+	st.offset = offset
+	return st, nil
+}
+
+func (st *sunTime) next(after time.Time, lat, long float64) (time.Time, bool) {
+	// Offsets of more than a day would need more days checked, but
+	// aren't useful.
+	for day := -1; day <= 3; day++ {
+		d := after.AddDate(0, 0, day)
+		rise, set := sunrise.SunriseSunset(lat, long, d.Year(), d.Month(), d.Day())
+		t := rise
+		if st.sunset {
+			t = set
+		}
+		if t.IsZero() {
+			// The sun doesn't rise or set on this day.
+			continue
+		}
+		if t = t.Add(st.offset).In(after.Location()); t.After(after) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// cronTime is a cron expression of minute, hour, day of month, month
+// and day of week. Each field is a bit set of the values it matches.
+type cronTime struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar are set when the day of month or day of
+	// week is "*". When only one is restricted that one must match,
+	// and when both are either can match, as with cron.
+	domStar, dowStar bool
+}
+
+func bit(n int) uint64 {
+	return 1 << uint(n)
+}
+
+func allBits(min, max int) uint64 {
+	var bits uint64
+	for n := min; n <= max; n++ {
+		bits |= bit(n)
+	}
+	return bits
+}
+
+func parseCron(spec, s string) (*cronTime, error) {
+	fields := strings.Fields(s)
+	ranges := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var bits [5]uint64
+	for i, field := range fields {
+		b, err := parseCronField(field, ranges[i][0], ranges[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("snapshot time %q: %v", spec, err)
+		}
+		bits[i] = b
+	}
+	// Sunday can be 0 or 7.
+	if bits[4]&bit(7) != 0 {
+		bits[4] = bits[4]&^bit(7) | bit(0)
+	}
+	return &cronTime{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: fields[2] == "*",
+		dowStar: fields[4] == "*",
+	}, nil
+}
+
+// parseCronField parses a comma separated list of *, n or n-m, each
+// optionally followed by /step.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("bad step in %q", item)
+			}
+			step = n
+			item = item[:i]
+		}
+		lo, hi := min, max
+		if item != "*" {
+			var err error
+			parts := strings.SplitN(item, "-", 2)
+			if lo, err = strconv.Atoi(parts[0]); err != nil {
+				return 0, fmt.Errorf("bad value %q", item)
+			}
+			hi = lo
+			if len(parts) == 2 {
+				if hi, err = strconv.Atoi(parts[1]); err != nil {
+					return 0, fmt.Errorf("bad range %q", item)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", item, min, max)
+		}
+		for n := lo; n <= hi; n += step {
+			bits |= bit(n)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronTime) dayMatches(t time.Time) bool {
+	dom := c.dom&bit(t.Day()) != 0
+	dow := c.dow&bit(int(t.Weekday())) != 0
+	switch {
+	case c.domStar && c.dowStar:
+		return true
+	case c.domStar:
+		return dow
+	case c.dowStar:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+func (c *cronTime) next(after time.Time, lat, long float64) (time.Time, bool) {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		y, m, d := t.Date()
+		var next time.Time
+		switch {
+		case c.month&bit(int(m)) == 0:
+			next = time.Date(y, m+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			next = time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+		case c.hour&bit(t.Hour()) == 0:
+			next = time.Date(y, m, d, t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&bit(t.Minute()) == 0:
+			next = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+		// Daylight saving changes can make the next day or hour
+		// earlier than expected.
+		if !next.After(t) {
+			next = t.Add(time.Minute)
+		}
+		t = next
+	}
+	return time.Time{}, false
+}
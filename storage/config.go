@@ -0,0 +1,70 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"errors"
+	"time"
+
+	config "github.com/TheCacophonyProject/go-config"
+)
+
+// Config sets the retention rules for recordings. Rules set to zero
+// aren't applied.
+//
+// KeepNewest is the number of recordings to keep. MaxTotalGB is the
+// most space recordings may use in total. MaxAge is how long
+// recordings are kept. Snapshot recordings aren't deleted by any rule
+// while KeepSnapshots is set. ConstantMinFreePercent is the
+// percentage of the disk kept free before each constant recording is
+// started.
+type Config struct {
+	KeepNewest             int           `mapstructure:"keep-newest"`
+	MaxTotalGB             float64       `mapstructure:"max-total-gb"`
+	MaxAge                 time.Duration `mapstructure:"max-age"`
+	KeepSnapshots          bool          `mapstructure:"keep-snapshots"`
+	ConstantMinFreePercent int           `mapstructure:"constant-min-free-percent"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		KeepSnapshots:          true,
+		ConstantMinFreePercent: 30,
+	}
+}
+
+// NewConfig reads the storage config from the config section key.
+func NewConfig(configRW *config.Config, key string) (*Config, error) {
+	conf := DefaultConfig()
+	if err := configRW.Unmarshal(key, &conf); err != nil {
+		return nil, err
+	}
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+
+func (conf *Config) validate() error {
+	if conf.KeepNewest < 0 || conf.MaxTotalGB < 0 || conf.MaxAge < 0 {
+		return errors.New("storage keep-newest, max-total-gb and max-age can't be negative")
+	}
+	if conf.ConstantMinFreePercent < 0 || conf.ConstantMinFreePercent >= 100 {
+		return errors.New("storage constant-min-free-percent must be from 0 to 99")
+	}
+	return nil
+}
@@ -0,0 +1,458 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package storage looks after the recordings in thermal-recorder's
+// output directory. Recordings are deleted to keep within the
+// retention rules in Config and to keep enough disk space free.
+//
+// When space is needed, recordings which have been uploaded are
+// deleted first, then constant recordings and then everything else,
+// oldest first in each group. Only uploaded and constant recordings
+// are deleted just to free up disk space.
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/TheCacophonyProject/thermal-recorder/loglimiter"
+)
+
+const (
+	// ConstantDir is the directory in the output directory which holds
+	// constant recordings.
+	ConstantDir = "constant-recordings"
+
+	// UploadedExt is the extension of the marker file saved next to a
+	// recording once it has been uploaded, in place of ".cptv".
+	UploadedExt = ".uploaded"
+
+	recordingExt    = ".cptv"
+	metadataExt     = ".json"
+	nameTimeFormat  = "20060102.150405.000"
+	triggerSnapshot = "snapshot"
+	megabyte        = 1024 * 1024
+	gigabyte        = 1024 * megabyte
+)
+
+// sidecarExts are the extensions of the files saved next to a
+// recording, which are deleted along with it.
+var sidecarExts = []string{metadataExt, ".motion.json", UploadedExt}
+
+// Reasons for a recording being deleted.
+const (
+	ReasonMaxAge     = "max-age"
+	ReasonKeepNewest = "keep-newest"
+	ReasonMaxTotal   = "max-total"
+	ReasonFreeSpace  = "free-space"
+)
+
+// ErrNotEnoughSpace is returned by MakeSpace when there are no more
+// recordings that can be deleted to free up space.
+var ErrNotEnoughSpace = errors.New("not enough free disk space and no more recordings can be deleted")
+
+// Recording is a finished recording in the output directory.
+type Recording struct {
+	Path string
+	// Time is when the recording started.
+	Time time.Time
+	// Size is the size in bytes of the recording and the files saved
+	// next to it.
+	Size     int64
+	Constant bool
+	Snapshot bool
+	Uploaded bool
+}
+
+// Deletion describes a recording which was deleted and why.
+type Deletion struct {
+	Recording
+	Reason string
+}
+
+// MarkUploaded saves the marker showing that the recording at path has
+// been uploaded, so that it is deleted before other recordings.
+func MarkUploaded(path string) error {
+	return ioutil.WriteFile(strings.TrimSuffix(path, recordingExt)+UploadedExt, nil, 0644)
+}
+
+// Manager deletes recordings from an output directory. onDelete is
+// called for each recording deleted.
+type Manager struct {
+	onDelete func(Deletion)
+	tidy     chan struct{}
+	logs     *loglimiter.LogLimiter
+
+	// opMu is held while recordings are being looked at or deleted.
+	opMu      sync.Mutex
+	snapshots map[string]bool
+
+	confMu    sync.Mutex
+	dir       string
+	minFreeMB uint64
+	conf      Config
+
+	now       func() time.Time
+	diskSpace func(dir string) (free, total uint64, err error)
+}
+
+// New returns a Manager for the recordings in dir, keeping minFreeMB
+// of disk space free.
+func New(dir string, minFreeMB uint64, conf *Config, onDelete func(Deletion)) *Manager {
+	return &Manager{
+		onDelete:  onDelete,
+		tidy:      make(chan struct{}, 1),
+		logs:      loglimiter.New(time.Hour),
+		snapshots: make(map[string]bool),
+		dir:       dir,
+		minFreeMB: minFreeMB,
+		conf:      *conf,
+		now:       time.Now,
+		diskSpace: diskSpace,
+	}
+}
+
+// Update changes the output directory, free space and retention rules.
+func (m *Manager) Update(dir string, minFreeMB uint64, conf *Config) {
+	m.confMu.Lock()
+	defer m.confMu.Unlock()
+	m.dir = dir
+	m.minFreeMB = minFreeMB
+	m.conf = *conf
+}
+
+func (m *Manager) config() (string, uint64, Config) {
+	m.confMu.Lock()
+	defer m.confMu.Unlock()
+	return m.dir, m.minFreeMB, m.conf
+}
+
+// Run applies the retention rules and frees disk space every interval,
+// and soon after Tidy is called. It doesn't return.
+func (m *Manager) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := m.MakeSpace(0); err != nil {
+			m.logs.Printf("storage: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-m.tidy:
+		}
+	}
+}
+
+// Tidy asks Run to check the recordings without waiting for it.
+func (m *Manager) Tidy() {
+	select {
+	case m.tidy <- struct{}{}:
+	default:
+	}
+}
+
+// CheckSpace reports whether there is the minimum free disk space to
+// start a recording. It doesn't delete anything so it is quick, but if
+// there isn't enough space Run is asked to make some.
+func (m *Manager) CheckSpace() (bool, error) {
+	dir, minFreeMB, _ := m.config()
+	free, _, err := m.diskSpace(dir)
+	if err != nil {
+		return false, err
+	}
+	if free/megabyte < minFreeMB {
+		m.Tidy()
+		return false, nil
+	}
+	return true, nil
+}
+
+// MakeSpace applies the retention rules and then deletes uploaded and
+// constant recordings until there is the minimum free disk space and
+// minFreePercent of the disk is free. ErrNotEnoughSpace is returned if
+// that isn't possible.
+func (m *Manager) MakeSpace(minFreePercent int) error {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+
+	dir, minFreeMB, conf := m.config()
+	recordings, err := m.recordings(dir)
+	if err != nil {
+		return err
+	}
+	recordings, err = m.applyRetention(recordings, &conf)
+	if err != nil {
+		return err
+	}
+
+	var expendable []Recording
+	for _, r := range byPriority(recordings) {
+		if (r.Uploaded || r.Constant) && !conf.keeps(r) {
+			expendable = append(expendable, r)
+		}
+	}
+	for {
+		free, total, err := m.diskSpace(dir)
+		if err != nil {
+			return err
+		}
+		if free/megabyte >= minFreeMB && (total == 0 || free*100/total >= uint64(minFreePercent)) {
+			return nil
+		}
+		if len(expendable) == 0 {
+			return ErrNotEnoughSpace
+		}
+		if err := m.delete(expendable[0], ReasonFreeSpace); err != nil {
+			return err
+		}
+		expendable = expendable[1:]
+	}
+}
+
+// Recordings returns the finished recordings, oldest first.
+func (m *Manager) Recordings() ([]Recording, error) {
+	m.opMu.Lock()
+	defer m.opMu.Unlock()
+	dir, _, _ := m.config()
+	return m.recordings(dir)
+}
+
+// keeps reports whether r is kept regardless of the retention rules.
+func (conf *Config) keeps(r Recording) bool {
+	return conf.KeepSnapshots && r.Snapshot
+}
+
+// applyRetention deletes the recordings not allowed by conf and
+// returns the rest.
+func (m *Manager) applyRetention(recordings []Recording, conf *Config) ([]Recording, error) {
+	deleted := make(map[string]bool)
+	del := func(r Recording, reason string) error {
+		deleted[r.Path] = true
+		return m.delete(r, reason)
+	}
+
+	if conf.MaxAge > 0 {
+		cutoff := m.now().Add(-conf.MaxAge)
+		for _, r := range recordings {
+			if !conf.keeps(r) && r.Time.Before(cutoff) {
+				if err := del(r, ReasonMaxAge); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if conf.KeepNewest > 0 {
+		count := 0
+		for _, r := range recordings {
+			if !deleted[r.Path] && !conf.keeps(r) {
+				count++
+			}
+		}
+		for _, r := range recordings {
+			if count <= conf.KeepNewest {
+				break
+			}
+			if !deleted[r.Path] && !conf.keeps(r) {
+				if err := del(r, ReasonKeepNewest); err != nil {
+					return nil, err
+				}
+				count--
+			}
+		}
+	}
+
+	if conf.MaxTotalGB > 0 {
+		var total int64
+		for _, r := range recordings {
+			if !deleted[r.Path] {
+				total += r.Size
+			}
+		}
+		limit := int64(conf.MaxTotalGB * gigabyte)
+		for _, r := range byPriority(recordings) {
+			if total <= limit {
+				break
+			}
+			if !deleted[r.Path] && !conf.keeps(r) {
+				if err := del(r, ReasonMaxTotal); err != nil {
+					return nil, err
+				}
+				total -= r.Size
+			}
+		}
+	}
+
+	remaining := recordings[:0:0]
+	for _, r := range recordings {
+		if !deleted[r.Path] {
+			remaining = append(remaining, r)
+		}
+	}
+	return remaining, nil
+}
+
+// byPriority returns a copy of recordings, which are oldest first, in
+// the order they should be deleted in.
+func byPriority(recordings []Recording) []Recording {
+	rank := func(r Recording) int {
+		switch {
+		case r.Uploaded:
+			return 0
+		case r.Constant:
+			return 1
+		}
+		return 2
+	}
+	sorted := append([]Recording(nil), recordings...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return rank(sorted[i]) < rank(sorted[j])
+	})
+	return sorted
+}
+
+// recordings finds the finished recordings in dir and its constant
+// recordings directory, oldest first.
+func (m *Manager) recordings(dir string) ([]Recording, error) {
+	recordings, err := m.readDir(dir, false)
+	if err != nil {
+		return nil, err
+	}
+	constant, err := m.readDir(filepath.Join(dir, ConstantDir), true)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	recordings = append(recordings, constant...)
+	m.pruneSnapshots(recordings)
+	sort.Slice(recordings, func(i, j int) bool {
+		if recordings[i].Time.Equal(recordings[j].Time) {
+			return recordings[i].Path < recordings[j].Path
+		}
+		return recordings[i].Time.Before(recordings[j].Time)
+	})
+	return recordings, nil
+}
+
+func (m *Manager) readDir(dir string, constant bool) ([]Recording, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]os.FileInfo, len(infos))
+	for _, info := range infos {
+		files[info.Name()] = info
+	}
+
+	var recordings []Recording
+	for name, info := range files {
+		if info.IsDir() || !strings.HasSuffix(name, recordingExt) {
+			continue
+		}
+		base := strings.TrimSuffix(name, recordingExt)
+		r := Recording{
+			Path:     filepath.Join(dir, name),
+			Size:     info.Size(),
+			Constant: constant,
+		}
+		r.Time, err = time.ParseInLocation(nameTimeFormat, base, time.Local)
+		if err != nil {
+			r.Time = info.ModTime()
+		}
+		for _, ext := range sidecarExts {
+			if sidecar, ok := files[base+ext]; ok {
+				r.Size += sidecar.Size()
+			}
+		}
+		_, r.Uploaded = files[base+UploadedExt]
+		if _, ok := files[base+metadataExt]; ok {
+			r.Snapshot = m.isSnapshot(filepath.Join(dir, base+metadataExt), r.Path)
+		}
+		recordings = append(recordings, r)
+	}
+	return recordings, nil
+}
+
+// isSnapshot reads the trigger for a recording from its metadata file.
+// The result is kept so each file is only read once.
+func (m *Manager) isSnapshot(metadataPath, path string) bool {
+	if snapshot, ok := m.snapshots[path]; ok {
+		return snapshot
+	}
+	var meta struct {
+		Trigger string `json:"trigger"`
+	}
+	data, err := ioutil.ReadFile(metadataPath)
+	if err == nil {
+		err = json.Unmarshal(data, &meta)
+	}
+	if err != nil {
+		log.Printf("storage: reading %s: %v", metadataPath, err)
+	}
+	m.snapshots[path] = meta.Trigger == triggerSnapshot
+	return m.snapshots[path]
+}
+
+// pruneSnapshots forgets the triggers of recordings which aren't in
+// recordings, such as those removed by the uploader, so the cache only
+// holds the recordings from the latest scan.
+func (m *Manager) pruneSnapshots(recordings []Recording) {
+	found := make(map[string]bool, len(recordings))
+	for _, r := range recordings {
+		found[r.Path] = true
+	}
+	for path := range m.snapshots {
+		if !found[path] {
+			delete(m.snapshots, path)
+		}
+	}
+}
+
+// delete removes r and the files saved next to it. The recording is
+// removed first so that it is never seen without its metadata.
+func (m *Manager) delete(r Recording, reason string) error {
+	if err := os.Remove(r.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(m.snapshots, r.Path)
+	base := strings.TrimSuffix(r.Path, recordingExt)
+	for _, ext := range sidecarExts {
+		if err := os.Remove(base + ext); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	log.Printf("deleted recording %s (%s)", r.Path, reason)
+	if m.onDelete != nil {
+		m.onDelete(Deletion{Recording: r, Reason: reason})
+	}
+	return nil
+}
+
+func diskSpace(dir string) (free, total uint64, err error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		return 0, 0, err
+	}
+	return fs.Bavail * uint64(fs.Bsize), fs.Blocks * uint64(fs.Bsize), nil
+}
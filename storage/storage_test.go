@@ -0,0 +1,262 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type storageTest struct {
+	t         *testing.T
+	dir       string
+	manager   *Manager
+	deletions []Deletion
+	free      uint64
+	total     uint64
+}
+
+func newStorageTest(t *testing.T, conf Config) *storageTest {
+	dir, err := ioutil.TempDir("", "storage")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ConstantDir), 0755))
+
+	st := &storageTest{t: t, dir: dir, free: 1000 * megabyte, total: 2000 * megabyte}
+	st.manager = New(dir, 100, &conf, func(d Deletion) {
+		st.deletions = append(st.deletions, d)
+	})
+	st.manager.now = func() time.Time {
+		return time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	}
+	st.manager.diskSpace = func(string) (uint64, uint64, error) {
+		return st.free, st.total, nil
+	}
+	return st
+}
+
+// addRecording saves a recording of size bytes started at the given
+// day and hour in March 2026, with its metadata.
+func (st *storageTest) addRecording(dir string, day, hour int, size int, trigger string) string {
+	base := time.Date(2026, 3, day, hour, 0, 0, 0, time.Local).Format(nameTimeFormat)
+	path := filepath.Join(st.dir, dir, base+recordingExt)
+	require.NoError(st.t, ioutil.WriteFile(path, make([]byte, size), 0644))
+	meta := []byte(`{"trigger":"` + trigger + `"}`)
+	require.NoError(st.t, ioutil.WriteFile(filepath.Join(st.dir, dir, base+metadataExt), meta, 0644))
+	return path
+}
+
+func (st *storageTest) deleted() map[string]string {
+	reasons := make(map[string]string)
+	for _, d := range st.deletions {
+		reasons[filepath.Base(d.Path)] = d.Reason
+	}
+	return reasons
+}
+
+func name(path string) string {
+	return filepath.Base(path)
+}
+
+func assertGone(t *testing.T, path string) {
+	matches, err := filepath.Glob(path[:len(path)-len(recordingExt)] + ".*")
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestRecordings(t *testing.T) {
+	st := newStorageTest(t, DefaultConfig())
+	motion := st.addRecording("", 2, 9, 100, "motion")
+	snapshot := st.addRecording("", 1, 9, 10, "snapshot")
+	constant := st.addRecording(ConstantDir, 1, 10, 1000, "constant")
+	require.NoError(t, MarkUploaded(motion))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(st.dir, "20260303.090000.000.cptv.temp"), nil, 0644))
+
+	recordings, err := st.manager.Recordings()
+	require.NoError(t, err)
+	require.Len(t, recordings, 3)
+	assert.Equal(t, snapshot, recordings[0].Path)
+	assert.True(t, recordings[0].Snapshot)
+	assert.Equal(t, time.Date(2026, 3, 1, 9, 0, 0, 0, time.Local), recordings[0].Time)
+	assert.Equal(t, constant, recordings[1].Path)
+	assert.True(t, recordings[1].Constant)
+	assert.Equal(t, motion, recordings[2].Path)
+	assert.True(t, recordings[2].Uploaded)
+	assert.False(t, recordings[2].Snapshot)
+	assert.Equal(t, int64(100+len(`{"trigger":"motion"}`)), recordings[2].Size)
+}
+
+func TestRemovedRecordingsForgotten(t *testing.T) {
+	st := newStorageTest(t, DefaultConfig())
+	snapshot := st.addRecording("", 1, 9, 10, "snapshot")
+	_, err := st.manager.Recordings()
+	require.NoError(t, err)
+	assert.Len(t, st.manager.snapshots, 1)
+
+	// Removed by something else, such as the uploader.
+	require.NoError(t, os.Remove(snapshot))
+	_, err = st.manager.Recordings()
+	require.NoError(t, err)
+	assert.Empty(t, st.manager.snapshots)
+
+	// A new recording with the same name isn't taken as a snapshot.
+	st.addRecording("", 1, 9, 10, "motion")
+	recordings, err := st.manager.Recordings()
+	require.NoError(t, err)
+	require.Len(t, recordings, 1)
+	assert.False(t, recordings[0].Snapshot)
+}
+
+func TestMaxAge(t *testing.T) {
+	conf := DefaultConfig()
+	conf.MaxAge = 7 * 24 * time.Hour
+	st := newStorageTest(t, conf)
+	old := st.addRecording("", 1, 9, 10, "motion")
+	oldSnapshot := st.addRecording("", 1, 10, 10, "snapshot")
+	oldConstant := st.addRecording(ConstantDir, 2, 9, 10, "constant")
+	recent := st.addRecording("", 5, 9, 10, "motion")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(st.dir, "20260301.090000.000.motion.json"), nil, 0644))
+
+	require.NoError(t, st.manager.MakeSpace(0))
+	assert.Equal(t, map[string]string{
+		name(old):         ReasonMaxAge,
+		name(oldConstant): ReasonMaxAge,
+	}, st.deleted())
+	assertGone(t, old)
+	assert.FileExists(t, oldSnapshot)
+	assert.FileExists(t, recent)
+}
+
+func TestSnapshotsNotKept(t *testing.T) {
+	conf := DefaultConfig()
+	conf.MaxAge = 7 * 24 * time.Hour
+	conf.KeepSnapshots = false
+	st := newStorageTest(t, conf)
+	snapshot := st.addRecording("", 1, 10, 10, "snapshot")
+
+	require.NoError(t, st.manager.MakeSpace(0))
+	assert.Equal(t, map[string]string{name(snapshot): ReasonMaxAge}, st.deleted())
+}
+
+func TestKeepNewest(t *testing.T) {
+	conf := DefaultConfig()
+	conf.KeepNewest = 2
+	st := newStorageTest(t, conf)
+	first := st.addRecording("", 1, 9, 10, "motion")
+	st.addRecording("", 1, 10, 10, "snapshot")
+	second := st.addRecording(ConstantDir, 2, 9, 10, "constant")
+	third := st.addRecording("", 3, 9, 10, "motion")
+	fourth := st.addRecording("", 4, 9, 10, "motion")
+	require.NoError(t, MarkUploaded(fourth))
+
+	require.NoError(t, st.manager.MakeSpace(0))
+	assert.Equal(t, map[string]string{
+		name(first):  ReasonKeepNewest,
+		name(second): ReasonKeepNewest,
+	}, st.deleted())
+	assert.FileExists(t, third)
+	assert.FileExists(t, fourth)
+}
+
+func TestMaxTotal(t *testing.T) {
+	conf := DefaultConfig()
+	conf.MaxTotalGB = 2500.0 / gigabyte
+	st := newStorageTest(t, conf)
+	meta := len(`{"trigger":"motion"}`)
+	oldest := st.addRecording("", 1, 9, 1000-meta, "motion")
+	constant := st.addRecording(ConstantDir, 2, 9, 1000-len(`{"trigger":"constant"}`), "constant")
+	uploaded := st.addRecording("", 3, 9, 1000-meta, "motion")
+	newest := st.addRecording("", 4, 9, 1000-meta, "motion")
+	require.NoError(t, MarkUploaded(uploaded))
+
+	require.NoError(t, st.manager.MakeSpace(0))
+	assert.Equal(t, []string{name(uploaded), name(constant)}, []string{name(st.deletions[0].Path), name(st.deletions[1].Path)})
+	assert.Equal(t, map[string]string{
+		name(uploaded): ReasonMaxTotal,
+		name(constant): ReasonMaxTotal,
+	}, st.deleted())
+	assertGone(t, uploaded)
+	assert.FileExists(t, oldest)
+	assert.FileExists(t, newest)
+}
+
+func TestMakeSpace(t *testing.T) {
+	st := newStorageTest(t, DefaultConfig())
+	motion := st.addRecording("", 1, 9, 10, "motion")
+	constant := st.addRecording(ConstantDir, 2, 9, 10, "constant")
+	uploaded := st.addRecording("", 3, 9, 10, "motion")
+	require.NoError(t, MarkUploaded(uploaded))
+
+	// Each deletion frees up 60MB.
+	st.free = 50 * megabyte
+	st.manager.onDelete = func(d Deletion) {
+		st.deletions = append(st.deletions, d)
+		st.free += 60 * megabyte
+	}
+	require.NoError(t, st.manager.MakeSpace(0))
+	assert.Equal(t, map[string]string{name(uploaded): ReasonFreeSpace}, st.deleted())
+
+	require.NoError(t, st.manager.MakeSpace(8))
+	assert.Equal(t, map[string]string{
+		name(uploaded): ReasonFreeSpace,
+		name(constant): ReasonFreeSpace,
+	}, st.deleted())
+
+	// Motion recordings which haven't been uploaded aren't deleted to
+	// free up space.
+	assert.Equal(t, ErrNotEnoughSpace, st.manager.MakeSpace(50))
+	assert.FileExists(t, motion)
+}
+
+func TestCheckSpace(t *testing.T) {
+	st := newStorageTest(t, DefaultConfig())
+	ok, err := st.manager.CheckSpace()
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	st.free = 99 * megabyte
+	ok, err = st.manager.CheckSpace()
+	require.NoError(t, err)
+	assert.False(t, ok)
+	select {
+	case <-st.manager.tidy:
+	default:
+		t.Fatal("tidy not requested")
+	}
+
+	conf := DefaultConfig()
+	st.manager.Update(st.dir, 90, &conf)
+	ok, err = st.manager.CheckSpace()
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestValidate(t *testing.T) {
+	conf := DefaultConfig()
+	assert.NoError(t, conf.validate())
+	conf.KeepNewest = -1
+	assert.Error(t, conf.validate())
+	conf = DefaultConfig()
+	conf.ConstantMinFreePercent = 100
+	assert.Error(t, conf.validate())
+}
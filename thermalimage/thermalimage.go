@@ -0,0 +1,214 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package thermalimage turns thermal frames into images using colour
+// maps.
+package thermalimage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+)
+
+// Levels is the number of colours in a ColourMap.
+const Levels = 255
+
+// ColourMap maps pixel values, scaled to 0 to Levels-1, to colours.
+// It leaves room for one more colour in a 256 colour palette, which
+// Paletted uses for overlays.
+type ColourMap [Levels]color.RGBA
+
+// stop is a point in a colour gradient. At is from 0 to 1.
+type stop struct {
+	at    float64
+	color color.RGBA
+}
+
+func gradient(stops ...stop) *ColourMap {
+	cm := new(ColourMap)
+	for i := range cm {
+		at := float64(i) / (Levels - 1)
+		j := 1
+		for j < len(stops)-1 && stops[j].at < at {
+			j++
+		}
+		a, b := stops[j-1], stops[j]
+		f := (at - a.at) / (b.at - a.at)
+		cm[i] = color.RGBA{
+			R: uint8(float64(a.color.R) + f*(float64(b.color.R)-float64(a.color.R)) + 0.5),
+			G: uint8(float64(a.color.G) + f*(float64(b.color.G)-float64(a.color.G)) + 0.5),
+			B: uint8(float64(a.color.B) + f*(float64(b.color.B)-float64(a.color.B)) + 0.5),
+			A: 0xff,
+		}
+	}
+	return cm
+}
+
+var (
+	// Greyscale maps cold to black and hot to white.
+	Greyscale = gradient(
+		stop{0, color.RGBA{0, 0, 0, 0xff}},
+		stop{1, color.RGBA{0xff, 0xff, 0xff, 0xff}},
+	)
+	// Ironbow maps cold to black through purple, red and yellow to
+	// white for hot.
+	Ironbow = gradient(
+		stop{0, color.RGBA{0, 0, 0, 0xff}},
+		stop{0.15, color.RGBA{30, 0, 110, 0xff}},
+		stop{0.35, color.RGBA{140, 0, 150, 0xff}},
+		stop{0.55, color.RGBA{220, 50, 50, 0xff}},
+		stop{0.75, color.RGBA{250, 140, 0, 0xff}},
+		stop{0.9, color.RGBA{255, 220, 50, 0xff}},
+		stop{1, color.RGBA{0xff, 0xff, 0xff, 0xff}},
+	)
+)
+
+// ColourMaps holds the colour maps by name.
+var ColourMaps = map[string]*ColourMap{
+	"greyscale": Greyscale,
+	"ironbow":   Ironbow,
+}
+
+// ColourMapNames returns the names of the colour maps, sorted.
+func ColourMapNames() []string {
+	names := make([]string, 0, len(ColourMaps))
+	for name := range ColourMaps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Range is the span of pixel values shown, from Min (coldest colour)
+// to Max (hottest colour). Values outside it are clamped.
+type Range struct {
+	Min uint16
+	Max uint16
+}
+
+// Validate checks that the range isn't empty.
+func (r Range) Validate() error {
+	if r.Max <= r.Min {
+		return fmt.Errorf("range max (%d) must be more than min (%d)", r.Max, r.Min)
+	}
+	return nil
+}
+
+// FrameRange returns the range of the pixel values in frame.
+func FrameRange(frame *cptvframe.Frame) Range {
+	r := Range{Min: 0xffff}
+	r.Extend(frame)
+	return r
+}
+
+// Extend widens r to include the pixel values in frame.
+func (r *Range) Extend(frame *cptvframe.Frame) {
+	for _, row := range frame.Pix {
+		for _, v := range row {
+			if v < r.Min {
+				r.Min = v
+			}
+			if v > r.Max {
+				r.Max = v
+			}
+		}
+	}
+}
+
+// level scales v to a colour map index.
+func (r Range) level(v uint16) uint8 {
+	if v <= r.Min {
+		return 0
+	}
+	if v >= r.Max || r.Max <= r.Min {
+		return Levels - 1
+	}
+	return uint8(int(v-r.Min) * (Levels - 1) / int(r.Max-r.Min))
+}
+
+// OverlayIndex is the palette index used for overlays in images from
+// Paletted.
+const OverlayIndex = Levels
+
+// Palette returns cm as a palette with overlay as its last colour.
+func (cm *ColourMap) Palette(overlay color.Color) color.Palette {
+	p := make(color.Palette, Levels+1)
+	for i, c := range cm {
+		p[i] = c
+	}
+	p[OverlayIndex] = overlay
+	return p
+}
+
+// Paletted renders frame as a paletted image using the palette from
+// cm.Palette.
+func Paletted(frame *cptvframe.Frame, r Range, cm *ColourMap, overlay color.Color) *image.Paletted {
+	height := len(frame.Pix)
+	width := 0
+	if height > 0 {
+		width = len(frame.Pix[0])
+	}
+	img := image.NewPaletted(image.Rect(0, 0, width, height), cm.Palette(overlay))
+	for y, row := range frame.Pix {
+		for x, v := range row {
+			img.Pix[y*img.Stride+x] = r.level(v)
+		}
+	}
+	return img
+}
+
+// RGBA renders frame as an RGBA image.
+func RGBA(frame *cptvframe.Frame, r Range, cm *ColourMap) *image.RGBA {
+	height := len(frame.Pix)
+	width := 0
+	if height > 0 {
+		width = len(frame.Pix[0])
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, row := range frame.Pix {
+		for x, v := range row {
+			img.SetRGBA(x, y, cm[r.level(v)])
+		}
+	}
+	return img
+}
+
+// DrawRect draws the outline of rect on img, clipped to img. For images
+// from Paletted, c should be the overlay colour.
+func DrawRect(img draw.Image, rect image.Rectangle, c color.Color) {
+	if rect.Empty() {
+		return
+	}
+	bounds := img.Bounds()
+	set := func(x, y int) {
+		if image.Pt(x, y).In(bounds) {
+			img.Set(x, y, c)
+		}
+	}
+	for x := rect.Min.X; x < rect.Max.X; x++ {
+		set(x, rect.Min.Y)
+		set(x, rect.Max.Y-1)
+	}
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		set(rect.Min.X, y)
+		set(rect.Max.X-1, y)
+	}
+}
@@ -0,0 +1,91 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package thermalimage
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCamera struct{}
+
+func (testCamera) ResX() int { return 4 }
+func (testCamera) ResY() int { return 3 }
+func (testCamera) FPS() int  { return 9 }
+
+func testFrame() *cptvframe.Frame {
+	frame := cptvframe.NewFrame(testCamera{})
+	for y, row := range frame.Pix {
+		for x := range row {
+			frame.Pix[y][x] = uint16(1000 + 100*(y*4+x))
+		}
+	}
+	return frame
+}
+
+func TestColourMaps(t *testing.T) {
+	black := color.RGBA{0, 0, 0, 0xff}
+	white := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	for _, name := range ColourMapNames() {
+		cm := ColourMaps[name]
+		assert.Equal(t, black, cm[0], name)
+		assert.Equal(t, white, cm[Levels-1], name)
+	}
+	assert.Equal(t, color.RGBA{0x80, 0x80, 0x80, 0xff}, Greyscale[Levels/2])
+	assert.Equal(t, []string{"greyscale", "ironbow"}, ColourMapNames())
+}
+
+func TestFrameRange(t *testing.T) {
+	r := FrameRange(testFrame())
+	assert.Equal(t, Range{Min: 1000, Max: 2100}, r)
+	require.NoError(t, r.Validate())
+	assert.Error(t, Range{Min: 5, Max: 5}.Validate())
+
+	assert.Equal(t, uint8(0), r.level(900))
+	assert.Equal(t, uint8(0), r.level(1000))
+	assert.Equal(t, uint8(Levels-1), r.level(2100))
+	assert.Equal(t, uint8(Levels-1), r.level(3000))
+	assert.Equal(t, uint8(127), r.level(1550))
+}
+
+func TestRender(t *testing.T) {
+	frame := testFrame()
+	r := Range{Min: 1000, Max: 2100}
+
+	rgba := RGBA(frame, r, Greyscale)
+	assert.Equal(t, image.Rect(0, 0, 4, 3), rgba.Bounds())
+	assert.Equal(t, color.RGBA{0, 0, 0, 0xff}, rgba.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{0xff, 0xff, 0xff, 0xff}, rgba.RGBAAt(3, 2))
+
+	overlay := color.RGBA{0, 0xff, 0, 0xff}
+	paletted := Paletted(frame, r, Ironbow, overlay)
+	assert.Len(t, paletted.Palette, 256)
+	assert.Equal(t, uint8(0), paletted.ColorIndexAt(0, 0))
+	assert.Equal(t, uint8(Levels-1), paletted.ColorIndexAt(3, 2))
+
+	DrawRect(paletted, image.Rect(1, 1, 10, 10), overlay)
+	assert.Equal(t, uint8(OverlayIndex), paletted.ColorIndexAt(1, 1))
+	assert.Equal(t, uint8(OverlayIndex), paletted.ColorIndexAt(1, 2))
+	assert.NotEqual(t, uint8(OverlayIndex), paletted.ColorIndexAt(0, 0))
+	// The right and bottom edges are outside the image.
+	assert.NotEqual(t, uint8(OverlayIndex), paletted.ColorIndexAt(3, 0))
+}
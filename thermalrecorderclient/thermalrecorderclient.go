@@ -0,0 +1,396 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+// Package thermalrecorderclient calls the thermal-recorder D-Bus
+// service and listens for its signals.
+package thermalrecorderclient
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/godbus/dbus"
+)
+
+const (
+	dbusName = "org.cacophony.thermalrecorder"
+	dbusPath = "/org/cacophony/thermalrecorder"
+)
+
+// Client calls thermal-recorder over D-Bus.
+type Client struct {
+	conn *dbus.Conn
+	obj  dbus.BusObject
+}
+
+// New returns a Client using the system bus.
+func New() (*Client, error) {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return nil, err
+	}
+	return NewWithConn(conn), nil
+}
+
+// NewWithConn returns a Client using conn, which must already be
+// authenticated.
+func NewWithConn(conn *dbus.Conn) *Client {
+	return &Client{
+		conn: conn,
+		obj:  conn.Object(dbusName, dbusPath),
+	}
+}
+
+func (c *Client) call(method string, args ...interface{}) *dbus.Call {
+	return c.obj.Call(dbusName+"."+method, 0, args...)
+}
+
+// TakeSnapshot returns the latest frame from the camera and saves it as
+// a still. An error is returned if the latest frame has the number
+// lastFrame, so pass the number of the previous snapshot to wait for
+// a new one or -1 to take any frame.
+func (c *Client) TakeSnapshot(lastFrame int) (*cptvframe.Frame, error) {
+	frame := new(cptvframe.Frame)
+	if err := c.call("TakeSnapshot", lastFrame).Store(frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// TakeTestRecording makes a short recording triggered as a test.
+func (c *Client) TakeTestRecording() error {
+	return c.call("TakeTestRecording").Store()
+}
+
+// CameraInfo describes the camera thermal-recorder is reading from.
+type CameraInfo struct {
+	ResX      int
+	ResY      int
+	FrameSize int
+	FPS       int
+	Model     string
+	Brand     string
+	Serial    int
+	Firmware  string
+}
+
+// CameraInfo returns details of the camera. It fails if thermal-recorder
+// hasn't connected to a camera yet.
+func (c *Client) CameraInfo() (*CameraInfo, error) {
+	var info map[string]dbus.Variant
+	if err := c.call("CameraInfo").Store(&info); err != nil {
+		return nil, err
+	}
+	return &CameraInfo{
+		ResX:      variantInt(info["ResX"]),
+		ResY:      variantInt(info["ResY"]),
+		FrameSize: variantInt(info["FrameSize"]),
+		FPS:       variantInt(info["FPS"]),
+		Model:     variantString(info["Model"]),
+		Brand:     variantString(info["Brand"]),
+		Serial:    variantInt(info["CameraSerial"]),
+		Firmware:  variantString(info["Firmware"]),
+	}, nil
+}
+
+// MotionMask returns the mask used for motion detection, a byte per
+// pixel row by row with 1 for included pixels, along with the current
+// background frame.
+func (c *Client) MotionMask() ([]byte, *cptvframe.Frame, error) {
+	var mask []byte
+	background := new(cptvframe.Frame)
+	if err := c.call("MotionMask").Store(&mask, background); err != nil {
+		return nil, nil, err
+	}
+	return mask, background, nil
+}
+
+// SetMotionMask saves a new motion detection mask, in the same form as
+// returned by MotionMask, and starts using it.
+func (c *Client) SetMotionMask(mask []byte) error {
+	return c.call("SetMotionMask", mask).Store()
+}
+
+// StartRecording starts a manual recording lasting d, to the nearest
+// second, whether or not there is motion. A recording already in
+// progress is made to last at least d instead.
+func (c *Client) StartRecording(d time.Duration) error {
+	return c.call("StartRecording", int(d.Round(time.Second)/time.Second)).Store()
+}
+
+// StopRecording stops a manual recording early.
+func (c *Client) StopRecording() error {
+	return c.call("StopRecording").Store()
+}
+
+// PauseRecording stops motion triggering recordings until
+// ResumeRecording is called or thermal-recorder restarts.
+func (c *Client) PauseRecording() error {
+	return c.call("PauseRecording").Store()
+}
+
+// ResumeRecording lets motion trigger recordings again.
+func (c *Client) ResumeRecording() error {
+	return c.call("ResumeRecording").Store()
+}
+
+// Status describes what thermal-recorder is doing.
+type Status struct {
+	Connected       bool
+	Recording       bool
+	ManualRecording bool
+	Paused          bool
+	// File is the recording being written, or "" if there isn't one.
+	File          string
+	FramesWritten int
+	WindowActive  bool
+	// ThrottleBucketFrames is the number of frames that can be recorded
+	// before recordings are throttled, or nil if throttling is off.
+	ThrottleBucketFrames *int64
+}
+
+// Status returns what thermal-recorder is doing.
+func (c *Client) Status() (*Status, error) {
+	var status map[string]dbus.Variant
+	if err := c.call("Status").Store(&status); err != nil {
+		return nil, err
+	}
+	s := &Status{
+		Connected:       variantBool(status["connected"]),
+		Recording:       variantBool(status["recording"]),
+		ManualRecording: variantBool(status["manualRecording"]),
+		Paused:          variantBool(status["paused"]),
+		File:            variantString(status["file"]),
+		FramesWritten:   variantInt(status["framesWritten"]),
+		WindowActive:    variantBool(status["windowActive"]),
+	}
+	if v, ok := status["throttleBucketFrames"]; ok {
+		frames := int64(variantInt(v))
+		s.ThrottleBucketFrames = &frames
+	}
+	return s, nil
+}
+
+// Background returns the background frame used for motion detection.
+func (c *Client) Background() (*cptvframe.Frame, error) {
+	frame := new(cptvframe.Frame)
+	if err := c.call("Background").Store(frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// MotionStats are the motion detection results for a frame.
+type MotionStats struct {
+	FramesRead int
+	TempThresh int
+	DeltaCount int
+	Motion     bool
+	Tracks     int
+}
+
+// MotionStats returns the motion detection results for the most recent
+// frame.
+func (c *Client) MotionStats() (*MotionStats, error) {
+	var stats map[string]dbus.Variant
+	if err := c.call("MotionStats").Store(&stats); err != nil {
+		return nil, err
+	}
+	return &MotionStats{
+		FramesRead: variantInt(stats["framesRead"]),
+		TempThresh: variantInt(stats["tempThresh"]),
+		DeltaCount: variantInt(stats["deltaCount"]),
+		Motion:     variantBool(stats["motion"]),
+		Tracks:     variantInt(stats["tracks"]),
+	}, nil
+}
+
+// SnapshotTrigger is a scheduled snapshot recording. Reason is
+// "power-on", "window-start", "window-end", "interval" or the entry
+// from the snapshot times config which scheduled it.
+type SnapshotTrigger struct {
+	Time   time.Time
+	Reason string
+}
+
+// SnapshotTriggers returns the next n scheduled snapshot recordings.
+// n can be up to 100.
+func (c *Client) SnapshotTriggers(n int) ([]SnapshotTrigger, error) {
+	var raw []struct {
+		Time   int64
+		Reason string
+	}
+	if err := c.call("SnapshotTriggers", n).Store(&raw); err != nil {
+		return nil, err
+	}
+	triggers := make([]SnapshotTrigger, len(raw))
+	for i, t := range raw {
+		triggers[i] = SnapshotTrigger{Time: time.Unix(t.Time, 0), Reason: t.Reason}
+	}
+	return triggers, nil
+}
+
+// variantInt returns the integer in v, or 0 if v isn't an integer.
+func variantInt(v dbus.Variant) int {
+	switch n := v.Value().(type) {
+	case byte:
+		return int(n)
+	case int16:
+		return int(n)
+	case uint16:
+		return int(n)
+	case int32:
+		return int(n)
+	case uint32:
+		return int(n)
+	case int64:
+		return int(n)
+	case uint64:
+		return int(n)
+	}
+	return 0
+}
+
+func variantString(v dbus.Variant) string {
+	s, _ := v.Value().(string)
+	return s
+}
+
+func variantBool(v dbus.Variant) bool {
+	b, _ := v.Value().(bool)
+	return b
+}
+
+// Signals sent by thermal-recorder.
+const (
+	// RecordingStarted is sent with the reason for the recording, such
+	// as "motion", "manual" or "test".
+	RecordingStarted = "RecordingStarted"
+	// RecordingFinished is sent with the path of the finished recording.
+	RecordingFinished = "RecordingFinished"
+	// MotionDetected is sent when motion starts being detected.
+	MotionDetected = "MotionDetected"
+)
+
+// Event is a signal from thermal-recorder. Trigger is only set for
+// RecordingStarted and Path for RecordingFinished.
+type Event struct {
+	Signal  string
+	Trigger string
+	Path    string
+}
+
+// Subscription passes on signals from thermal-recorder until it is
+// closed.
+type Subscription struct {
+	// Events receives the signals. It is closed by Close. Signals sent
+	// close together can arrive out of order, as the D-Bus connection
+	// delivers each one from its own goroutine.
+	Events <-chan Event
+
+	conn    *dbus.Conn
+	rule    string
+	names   map[string]bool
+	signals chan *dbus.Signal
+	events  chan Event
+	closing chan struct{}
+	removed chan struct{}
+}
+
+// Subscribe starts listening for the named signals, or for every
+// signal if none are named.
+func (c *Client) Subscribe(names ...string) (*Subscription, error) {
+	rule := fmt.Sprintf("type='signal',path='%s',interface='%s'", dbusPath, dbusName)
+	if err := c.conn.BusObject().Call("org.freedesktop.DBus.AddMatch", 0, rule).Store(); err != nil {
+		return nil, err
+	}
+	events := make(chan Event, 10)
+	s := &Subscription{
+		Events:  events,
+		conn:    c.conn,
+		rule:    rule,
+		names:   make(map[string]bool),
+		signals: make(chan *dbus.Signal, 10),
+		events:  events,
+		closing: make(chan struct{}),
+		removed: make(chan struct{}),
+	}
+	for _, name := range names {
+		s.names[name] = true
+	}
+	c.conn.Signal(s.signals)
+	go s.run()
+	return s, nil
+}
+
+func (s *Subscription) run() {
+	defer close(s.events)
+	for {
+		select {
+		case sig := <-s.signals:
+			event, ok := s.event(sig)
+			if !ok {
+				continue
+			}
+			select {
+			case s.events <- event:
+			case <-s.closing:
+			}
+		case <-s.removed:
+			return
+		}
+	}
+}
+
+// event converts sig to an Event if it is one of the subscribed
+// signals from thermal-recorder.
+func (s *Subscription) event(sig *dbus.Signal) (Event, bool) {
+	if sig.Path != dbusPath || !strings.HasPrefix(sig.Name, dbusName+".") {
+		return Event{}, false
+	}
+	event := Event{Signal: strings.TrimPrefix(sig.Name, dbusName+".")}
+	if len(s.names) > 0 && !s.names[event.Signal] {
+		return Event{}, false
+	}
+	var arg string
+	if len(sig.Body) > 0 {
+		arg, _ = sig.Body[0].(string)
+	}
+	switch event.Signal {
+	case RecordingStarted:
+		event.Trigger = arg
+	case RecordingFinished:
+		event.Path = arg
+	}
+	return event, true
+}
+
+// Close stops the subscription and closes Events.
+func (s *Subscription) Close() error {
+	select {
+	case <-s.closing:
+		return nil
+	default:
+	}
+	// Signals are still read until the channel is removed from the
+	// connection, which waits for signals being delivered to it.
+	close(s.closing)
+	s.conn.RemoveSignal(s.signals)
+	close(s.removed)
+	return s.conn.BusObject().Call("org.freedesktop.DBus.RemoveMatch", 0, s.rule).Store()
+}
@@ -0,0 +1,388 @@
+// thermal-recorder - record thermal video footage of warm moving objects
+//  Copyright (C) 2026, The Cacophony Project
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program. If not, see <http://www.gnu.org/licenses/>.
+
+package thermalrecorderclient
+
+import (
+	"bufio"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TheCacophonyProject/go-cptv/cptvframe"
+	"github.com/godbus/dbus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startBus starts a private dbus-daemon for the test and returns its
+// address. The test is skipped if dbus-daemon isn't installed.
+func startBus(t *testing.T) string {
+	path, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+	cmd := exec.Command(path, "--session", "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	return strings.TrimSpace(address)
+}
+
+func dial(t *testing.T, address string) *dbus.Conn {
+	conn, err := dbus.Dial(address)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.NoError(t, conn.Auth(nil))
+	require.NoError(t, conn.Hello())
+	return conn
+}
+
+// fakeService has the same methods as the thermal-recorder service.
+type fakeService struct {
+	conn      *dbus.Conn
+	frame     *cptvframe.Frame
+	mask      []byte
+	paused    bool
+	recording int
+	calls     []string
+}
+
+func newFakeService(t *testing.T, address string) *fakeService {
+	conn := dial(t, address)
+	reply, err := conn.RequestName(dbusName, dbus.NameFlagDoNotQueue)
+	require.NoError(t, err)
+	require.Equal(t, dbus.RequestNameReplyPrimaryOwner, reply)
+
+	frame := cptvframe.NewFrame(&camera{})
+	frame.Pix[1][2] = 3000
+	frame.Status.FrameCount = 42
+	frame.Status.TimeOn = time.Minute
+	frame.Status.TempC = 21.5
+	s := &fakeService{conn: conn, frame: frame}
+	require.NoError(t, conn.Export(s, dbusPath, dbusName))
+	return s
+}
+
+func (s *fakeService) fail(method, msg string) *dbus.Error {
+	return &dbus.Error{Name: dbusName + "." + method, Body: []interface{}{msg}}
+}
+
+func (s *fakeService) TakeSnapshot(lastFrame int) (*cptvframe.Frame, *dbus.Error) {
+	if lastFrame == s.frame.Status.FrameCount {
+		return nil, s.fail("TakeSnapshot", "no new frames yet")
+	}
+	return s.frame, nil
+}
+
+func (s *fakeService) TakeTestRecording() *dbus.Error {
+	s.calls = append(s.calls, "TakeTestRecording")
+	s.conn.Emit(dbusPath, dbusName+".RecordingStarted", "test")
+	s.conn.Emit(dbusPath, dbusName+".RecordingFinished", "/var/spool/cptv/test.cptv")
+	return nil
+}
+
+func (s *fakeService) CameraInfo() (map[string]interface{}, *dbus.Error) {
+	return map[string]interface{}{
+		"ResX":         160,
+		"ResY":         120,
+		"FrameSize":    160 * 120 * 2,
+		"Model":        "lepton3.5",
+		"Brand":        "flir",
+		"FPS":          9,
+		"CameraSerial": 1234,
+		"Firmware":     "3.3.26",
+	}, nil
+}
+
+func (s *fakeService) MotionMask() ([]byte, *cptvframe.Frame, *dbus.Error) {
+	return s.mask, s.frame, nil
+}
+
+func (s *fakeService) SetMotionMask(mask []byte) *dbus.Error {
+	s.mask = mask
+	return nil
+}
+
+func (s *fakeService) StartRecording(secs int) *dbus.Error {
+	if secs < 1 {
+		return s.fail("StartRecording", "recording length must be at least a second")
+	}
+	s.recording = secs
+	s.conn.Emit(dbusPath, dbusName+".MotionDetected")
+	return nil
+}
+
+func (s *fakeService) StopRecording() *dbus.Error {
+	s.recording = 0
+	return nil
+}
+
+func (s *fakeService) PauseRecording() *dbus.Error {
+	s.paused = true
+	return nil
+}
+
+func (s *fakeService) ResumeRecording() *dbus.Error {
+	s.paused = false
+	return nil
+}
+
+func (s *fakeService) Status() (map[string]interface{}, *dbus.Error) {
+	return map[string]interface{}{
+		"connected":            true,
+		"recording":            s.recording > 0,
+		"manualRecording":      s.recording > 0,
+		"paused":               s.paused,
+		"file":                 "/var/spool/cptv/.temp.cptv",
+		"framesWritten":        27,
+		"windowActive":         true,
+		"throttleBucketFrames": int64(900),
+	}, nil
+}
+
+func (s *fakeService) Background() (*cptvframe.Frame, *dbus.Error) {
+	return s.frame, nil
+}
+
+func (s *fakeService) MotionStats() (map[string]interface{}, *dbus.Error) {
+	return map[string]interface{}{
+		"framesRead": uint64(1000),
+		"tempThresh": uint16(2900),
+		"deltaCount": 12,
+		"motion":     true,
+		"tracks":     2,
+	}, nil
+}
+
+type snapshotTrigger struct {
+	Time   int64
+	Reason string
+}
+
+func (s *fakeService) SnapshotTriggers(count int) ([]snapshotTrigger, *dbus.Error) {
+	if count < 1 {
+		return nil, s.fail("SnapshotTriggers", "count must be from 1 to 100")
+	}
+	triggers := []snapshotTrigger{
+		{Time: 1792260060, Reason: "window-start"},
+		{Time: 1792299480, Reason: "window-end"},
+	}
+	if count < len(triggers) {
+		triggers = triggers[:count]
+	}
+	return triggers, nil
+}
+
+type camera struct{}
+
+func (c *camera) ResX() int { return 4 }
+func (c *camera) ResY() int { return 3 }
+func (c *camera) FPS() int  { return 9 }
+
+func newTestClient(t *testing.T) (*Client, *fakeService) {
+	address := startBus(t)
+	s := newFakeService(t, address)
+	return NewWithConn(dial(t, address)), s
+}
+
+func TestTakeSnapshot(t *testing.T) {
+	client, s := newTestClient(t)
+
+	frame, err := client.TakeSnapshot(-1)
+	require.NoError(t, err)
+	assert.Equal(t, s.frame, frame)
+
+	_, err = client.TakeSnapshot(42)
+	assert.EqualError(t, err, "no new frames yet")
+	var dbusErr dbus.Error
+	require.True(t, errors.As(err, &dbusErr))
+	assert.Equal(t, dbusName+".TakeSnapshot", dbusErr.Name)
+}
+
+func TestCameraInfo(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	info, err := client.CameraInfo()
+	require.NoError(t, err)
+	assert.Equal(t, &CameraInfo{
+		ResX:      160,
+		ResY:      120,
+		FrameSize: 38400,
+		FPS:       9,
+		Model:     "lepton3.5",
+		Brand:     "flir",
+		Serial:    1234,
+		Firmware:  "3.3.26",
+	}, info)
+}
+
+func TestMotionMask(t *testing.T) {
+	client, s := newTestClient(t)
+
+	mask := []byte{1, 1, 0, 0, 1, 1, 0, 0, 1, 1, 1, 1}
+	require.NoError(t, client.SetMotionMask(mask))
+	assert.Equal(t, mask, s.mask)
+
+	gotMask, background, err := client.MotionMask()
+	require.NoError(t, err)
+	assert.Equal(t, mask, gotMask)
+	assert.Equal(t, s.frame, background)
+
+	background, err = client.Background()
+	require.NoError(t, err)
+	assert.Equal(t, s.frame, background)
+}
+
+func TestRecordingControl(t *testing.T) {
+	client, s := newTestClient(t)
+
+	require.NoError(t, client.StartRecording(1500*time.Millisecond))
+	assert.Equal(t, 2, s.recording)
+	assert.EqualError(t, client.StartRecording(0), "recording length must be at least a second")
+	require.NoError(t, client.PauseRecording())
+
+	status, err := client.Status()
+	require.NoError(t, err)
+	bucket := int64(900)
+	assert.Equal(t, &Status{
+		Connected:            true,
+		Recording:            true,
+		ManualRecording:      true,
+		Paused:               true,
+		File:                 "/var/spool/cptv/.temp.cptv",
+		FramesWritten:        27,
+		WindowActive:         true,
+		ThrottleBucketFrames: &bucket,
+	}, status)
+
+	require.NoError(t, client.StopRecording())
+	require.NoError(t, client.ResumeRecording())
+	status, err = client.Status()
+	require.NoError(t, err)
+	assert.False(t, status.Recording)
+	assert.False(t, status.Paused)
+}
+
+func TestMotionStats(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	stats, err := client.MotionStats()
+	require.NoError(t, err)
+	assert.Equal(t, &MotionStats{
+		FramesRead: 1000,
+		TempThresh: 2900,
+		DeltaCount: 12,
+		Motion:     true,
+		Tracks:     2,
+	}, stats)
+}
+
+func TestSnapshotTriggers(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	triggers, err := client.SnapshotTriggers(5)
+	require.NoError(t, err)
+	assert.Equal(t, []SnapshotTrigger{
+		{Time: time.Unix(1792260060, 0), Reason: "window-start"},
+		{Time: time.Unix(1792299480, 0), Reason: "window-end"},
+	}, triggers)
+
+	triggers, err = client.SnapshotTriggers(1)
+	require.NoError(t, err)
+	assert.Len(t, triggers, 1)
+
+	_, err = client.SnapshotTriggers(0)
+	assert.EqualError(t, err, "count must be from 1 to 100")
+}
+
+func TestNotRunning(t *testing.T) {
+	client := NewWithConn(dial(t, startBus(t)))
+	_, err := client.Status()
+	assert.Error(t, err)
+}
+
+func nextEvent(t *testing.T, sub *Subscription) Event {
+	select {
+	case event := <-sub.Events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for signal")
+	}
+	return Event{}
+}
+
+// nextEvents returns the next n events. Signals can be delivered out
+// of order so tests compare them with assert.ElementsMatch.
+func nextEvents(t *testing.T, sub *Subscription, n int) []Event {
+	events := make([]Event, n)
+	for i := range events {
+		events[i] = nextEvent(t, sub)
+	}
+	return events
+}
+
+func TestSubscribe(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	sub, err := client.Subscribe()
+	require.NoError(t, err)
+	require.NoError(t, client.TakeTestRecording())
+	require.NoError(t, client.StartRecording(time.Second))
+	assert.ElementsMatch(t, []Event{
+		{Signal: RecordingStarted, Trigger: "test"},
+		{Signal: RecordingFinished, Path: "/var/spool/cptv/test.cptv"},
+		{Signal: MotionDetected},
+	}, nextEvents(t, sub, 3))
+
+	require.NoError(t, sub.Close())
+	_, ok := <-sub.Events
+	assert.False(t, ok)
+	require.NoError(t, sub.Close())
+}
+
+func TestSubscribeToNamed(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	sub, err := client.Subscribe(RecordingFinished, MotionDetected)
+	require.NoError(t, err)
+	defer sub.Close()
+	require.NoError(t, client.TakeTestRecording())
+	require.NoError(t, client.StartRecording(time.Second))
+	assert.ElementsMatch(t, []Event{
+		{Signal: RecordingFinished, Path: "/var/spool/cptv/test.cptv"},
+		{Signal: MotionDetected},
+	}, nextEvents(t, sub, 2))
+}
+
+func TestCloseWithUnreadEvents(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	sub, err := client.Subscribe()
+	require.NoError(t, err)
+	for i := 0; i < 20; i++ {
+		require.NoError(t, client.TakeTestRecording())
+	}
+	require.NoError(t, sub.Close())
+}
@@ -18,6 +18,7 @@ package throttle
 
 import (
 	"log"
+	"sync"
 	"time"
 
 	"github.com/juju/ratelimit"
@@ -49,27 +50,47 @@ func NewThrottledRecorderWithClock(
 	listener ThrottledEventListener,
 	clock ratelimit.Clock, camera cptvframe.CameraSpec,
 ) *ThrottledRecorder {
-	// The token bucket tracks the number of *frames* available for recording.
-	bucketFrames := int64(config.BucketSize.Seconds()) * int64(camera.FPS())
-	minFrames := int64(minSeconds * camera.FPS())
+	if listener == nil {
+		listener = new(nullListener)
+	}
+
+	throttler := &ThrottledRecorder{
+		recorder: baseRecorder,
+		listener: listener,
+		clock:    clock,
+		camera:   camera,
+	}
+	throttler.bucket, throttler.minRecordingLength = throttler.newBucket(config, minSeconds)
+	return throttler
+}
+
+// newBucket returns a token bucket which tracks the number of *frames*
+// available for recording, along with the minimum recording length in
+// frames.
+func (throttler *ThrottledRecorder) newBucket(config *config.ThermalThrottler, minSeconds int) (*ratelimit.Bucket, int64) {
+	bucketFrames := int64(config.BucketSize.Seconds()) * int64(throttler.camera.FPS())
+	minFrames := int64(minSeconds * throttler.camera.FPS())
 	refillRate := float64(minFrames) / config.MinRefill.Seconds()
 
 	if minFrames > bucketFrames {
 		log.Println("minimum recording length is greater than throttle bucket - recording will not be possible!")
 	}
 
-	bucket := ratelimit.NewBucketWithRateAndClock(refillRate, bucketFrames, clock)
-
-	if listener == nil {
-		listener = new(nullListener)
-	}
+	return ratelimit.NewBucketWithRateAndClock(refillRate, bucketFrames, throttler.clock), minFrames
+}
 
-	return &ThrottledRecorder{
-		recorder:           baseRecorder,
-		listener:           listener,
-		bucket:             bucket,
-		minRecordingLength: minFrames,
+// UpdateConfig changes the throttling settings. The frames available
+// for recording are kept, up to the new bucket size.
+func (throttler *ThrottledRecorder) UpdateConfig(config *config.ThermalThrottler, minSeconds int) {
+	throttler.bucketMu.Lock()
+	defer throttler.bucketMu.Unlock()
+	available := throttler.bucket.Available()
+	bucket, minFrames := throttler.newBucket(config, minSeconds)
+	if available < bucket.Capacity() {
+		bucket.TakeAvailable(bucket.Capacity() - available)
 	}
+	throttler.bucket = bucket
+	throttler.minRecordingLength = minFrames
 }
 
 // ThrottledRecorder wraps a standard recorder so that it stops
@@ -81,7 +102,10 @@ func NewThrottledRecorderWithClock(
 type ThrottledRecorder struct {
 	recorder           recorder.Recorder
 	listener           ThrottledEventListener
+	bucketMu           sync.Mutex // guards replacing bucket, for BucketLevel
 	bucket             *ratelimit.Bucket
+	clock              ratelimit.Clock
+	camera             cptvframe.CameraSpec
 	recording          bool
 	minRecordingLength int64
 	tempThresh         uint16
@@ -122,6 +146,16 @@ func (throttler *ThrottledRecorder) StopRecording() error {
 }
 
 func (throttler *ThrottledRecorder) WriteFrame(frame *cptvframe.Frame) error {
+	return throttler.writeFrame(frame, nil)
+}
+
+// WriteFrameWithMetadata passes the metadata on if the underlying
+// recorder supports it.
+func (throttler *ThrottledRecorder) WriteFrameWithMetadata(frame *cptvframe.Frame, meta *recorder.FrameMetadata) error {
+	return throttler.writeFrame(frame, meta)
+}
+
+func (throttler *ThrottledRecorder) writeFrame(frame *cptvframe.Frame, meta *recorder.FrameMetadata) error {
 	if !throttler.recording {
 		if err := throttler.maybeStartRecording(throttler.backgroundFrame, throttler.tempThresh); err != nil {
 			return err
@@ -132,6 +166,9 @@ func (throttler *ThrottledRecorder) WriteFrame(frame *cptvframe.Frame) error {
 	}
 
 	if throttler.bucket.TakeAvailable(1) > 0 {
+		if metaRecorder, ok := throttler.recorder.(recorder.MetadataRecorder); ok && meta != nil {
+			return metaRecorder.WriteFrameWithMetadata(frame, meta)
+		}
 		return throttler.recorder.WriteFrame(frame)
 	}
 
@@ -140,6 +177,14 @@ func (throttler *ThrottledRecorder) WriteFrame(frame *cptvframe.Frame) error {
 	return throttler.StopRecording()
 }
 
+// BucketLevel returns the number of frames currently available in the
+// throttler's token bucket. It may be called from any goroutine.
+func (throttler *ThrottledRecorder) BucketLevel() int64 {
+	throttler.bucketMu.Lock()
+	defer throttler.bucketMu.Unlock()
+	return throttler.bucket.Available()
+}
+
 func (throttler *ThrottledRecorder) maybeStartRecording(background *cptvframe.Frame, tempThresh uint16) error {
 	if throttler.bucket.Available() >= throttler.minRecordingLength {
 		if err := throttler.recorder.StartRecording(background, tempThresh); err != nil {
@@ -224,3 +224,45 @@ func (c *testClock) Now() time.Time {
 func (c *testClock) Sleep(d time.Duration) {
 	c.now = c.now.Add(d)
 }
+
+type metadataRecorder struct {
+	writeRecorder
+	meta []*recorder.FrameMetadata
+}
+
+func (rec *metadataRecorder) WriteFrameWithMetadata(frame *cptvframe.Frame, meta *recorder.FrameMetadata) error {
+	rec.meta = append(rec.meta, meta)
+	return rec.WriteFrame(frame)
+}
+
+func TestMetadataPassedThrough(t *testing.T) {
+	rec := new(metadataRecorder)
+	throtRecorder := NewThrottledRecorderWithClock(rec, newTestConfig(), minRecordingSecs, nil, new(testClock), new(TestCamera))
+
+	f := cptvframe.NewFrame(new(TestCamera))
+	meta := &recorder.FrameMetadata{DeltaCount: 5}
+	throtRecorder.StartRecording(nil, 0)
+	throtRecorder.WriteFrameWithMetadata(f, meta)
+	throtRecorder.WriteFrame(f)
+	throtRecorder.StopRecording()
+
+	assert.Equal(t, 2, rec.writes)
+	assert.Equal(t, []*recorder.FrameMetadata{meta}, rec.meta)
+}
+
+func TestUpdateConfigKeepsBucketLevel(t *testing.T) {
+	_, _, throttler, _ := newTestThrottledRecorder()
+	throttler.bucket.TakeAvailable(100)
+	assert.Equal(t, int64(throttleFrames-100), throttler.BucketLevel())
+
+	conf := newTestConfig()
+	conf.BucketSize = 2 * throttleAfter
+	throttler.UpdateConfig(conf, minRecordingSecs)
+	assert.Equal(t, int64(throttleFrames-100), throttler.BucketLevel())
+	assert.Equal(t, int64(2*throttleFrames), throttler.bucket.Capacity())
+
+	conf.BucketSize = 10 * time.Second
+	throttler.UpdateConfig(conf, 5)
+	assert.Equal(t, int64(90), throttler.BucketLevel())
+	assert.Equal(t, int64(45), throttler.minRecordingLength)
+}